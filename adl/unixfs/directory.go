@@ -0,0 +1,105 @@
+package unixfs
+
+import (
+	"github.com/ipld/go-ipld-prime/adl"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	"github.com/ipld/go-ipld-prime/node/mixins"
+)
+
+var _ adl.ADL = (*Directory)(nil)
+
+// Directory is a UnixFS directory, presented as a map from the names of its entries to links to them.
+// The entries are in the order they're stored in, which is normally sorted by name.
+//
+// All the entries of a Directory are in its one block, so none of its methods load anything.
+type Directory struct {
+	substrate datamodel.Node
+	entries   []pbLink
+}
+
+func (*Directory) Kind() datamodel.Kind {
+	return datamodel.Kind_Map
+}
+func (d *Directory) LookupByString(key string) (datamodel.Node, error) {
+	for _, e := range d.entries {
+		if e.name == key {
+			return basicnode.NewLink(e.link), nil
+		}
+	}
+	return nil, datamodel.ErrNotExists{Segment: datamodel.PathSegmentOfString(key)}
+}
+func (d *Directory) LookupByNode(key datamodel.Node) (datamodel.Node, error) {
+	ks, err := key.AsString()
+	if err != nil {
+		return nil, err
+	}
+	return d.LookupByString(ks)
+}
+func (*Directory) LookupByIndex(idx int64) (datamodel.Node, error) {
+	return mixins.Map{TypeName: "unixfs.Directory"}.LookupByIndex(0)
+}
+func (d *Directory) LookupBySegment(seg datamodel.PathSegment) (datamodel.Node, error) {
+	return d.LookupByString(seg.String())
+}
+func (d *Directory) MapIterator() datamodel.MapIterator {
+	return &directoryIterator{d.entries}
+}
+func (*Directory) ListIterator() datamodel.ListIterator {
+	return nil
+}
+func (d *Directory) Length() int64 {
+	return int64(len(d.entries))
+}
+func (*Directory) IsAbsent() bool {
+	return false
+}
+func (*Directory) IsNull() bool {
+	return false
+}
+func (*Directory) AsBool() (bool, error) {
+	return mixins.Map{TypeName: "unixfs.Directory"}.AsBool()
+}
+func (*Directory) AsInt() (int64, error) {
+	return mixins.Map{TypeName: "unixfs.Directory"}.AsInt()
+}
+func (*Directory) AsFloat() (float64, error) {
+	return mixins.Map{TypeName: "unixfs.Directory"}.AsFloat()
+}
+func (*Directory) AsString() (string, error) {
+	return mixins.Map{TypeName: "unixfs.Directory"}.AsString()
+}
+func (*Directory) AsBytes() ([]byte, error) {
+	return mixins.Map{TypeName: "unixfs.Directory"}.AsBytes()
+}
+func (*Directory) AsLink() (datamodel.Link, error) {
+	return mixins.Map{TypeName: "unixfs.Directory"}.AsLink()
+}
+
+// Prototype returns the basicnode map prototype: this ADL can't create directories,
+// so new nodes built in place of a Directory are plain maps.
+func (*Directory) Prototype() datamodel.NodePrototype {
+	return basicnode.Prototype.Map
+}
+
+// Substrate returns the DAG-PB node the Directory was reified from.
+func (d *Directory) Substrate() datamodel.Node {
+	return d.substrate
+}
+
+type directoryIterator struct {
+	entries []pbLink
+}
+
+func (itr *directoryIterator) Next() (datamodel.Node, datamodel.Node, error) {
+	if len(itr.entries) == 0 {
+		return nil, nil, datamodel.ErrIteratorOverread{}
+	}
+	e := itr.entries[0]
+	itr.entries = itr.entries[1:]
+	return basicnode.NewString(e.name), basicnode.NewLink(e.link), nil
+}
+
+func (itr *directoryIterator) Done() bool {
+	return len(itr.entries) == 0
+}
@@ -0,0 +1,37 @@
+/*
+Package unixfs is an ADL which presents UnixFS data -- the files and directories of IPFS,
+stored as DAG-PB blocks -- as plain data model nodes.
+
+Directories are presented as maps, from the names of their entries to links to them.
+This includes HAMT-sharded directories, which are spread across many blocks:
+they are presented as a single map, and the blocks of the HAMT are loaded as they're needed.
+Files are presented as bytes nodes, which also implement datamodel.LargeBytesNode,
+so that their content can be streamed, a chunk at a time, rather than loaded all at once.
+
+Reify fits the linking.NodeReifier function interface,
+so a LinkSystem with it as its NodeReifier will present any UnixFS data it loads this way.
+Then, paths such as "dir/file.txt" can be used with traversal.Focus (and similar functions)
+to reach the file of that name, starting from the root directory:
+directory entries are links, and loading them yields the reified directory or file.
+
+	lsys := cidlink.DefaultLinkSystem()
+	lsys.StorageReadOpener = ...
+	lsys.NodeReifier = unixfs.Reify
+	root, err := lsys.Load(linking.LinkContext{}, rootLink, basicnode.Prototype.Any)
+	prog := traversal.Progress{Cfg: &traversal.Config{LinkSystem: lsys, LinkTargetNodePrototypeChooser: basicnode.Chooser}}
+	file, err := prog.Get(root, datamodel.ParsePath("dir/file.txt"))
+	r, err := file.(datamodel.LargeBytesNode).AsLargeBytes()
+
+The dagpb codec must be registered (by importing its package) for the LinkSystem to load DAG-PB blocks at all.
+
+Nodes of any other kind, including DAG-PB nodes which don't hold UnixFS data, are left as they are by Reify.
+UnixFS symlinks and metadata nodes are also left as they are.
+The "raw" blocks which are often used as the leaves of files are bytes nodes already,
+and need no reification (and they're read as such when they're part of a larger file).
+
+This ADL only reads UnixFS data; it doesn't offer a way to create it.
+The substrate of each node (see adl.ADL) is the DAG-PB node it was reified from.
+
+See https://github.com/ipfs/specs/blob/main/UNIXFS.md for the UnixFS specification.
+*/
+package unixfs
@@ -0,0 +1,227 @@
+package unixfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/ipld/go-ipld-prime/adl"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/linking"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	"github.com/ipld/go-ipld-prime/node/mixins"
+)
+
+var (
+	_ adl.ADL                  = (*File)(nil)
+	_ datamodel.LargeBytesNode = (*File)(nil)
+)
+
+// File is a UnixFS file, presented as a bytes node.
+//
+// A large file is spread across many blocks: a tree of them, with the content in the leaves.
+// Only the root of the tree is loaded by Reify.
+// AsLargeBytes returns a reader which loads the rest as it's read, holding only one path down the tree in memory at a time;
+// AsBytes reads the whole content into memory, so it should be avoided for large files.
+// The leaves may be DAG-PB nodes, or "raw" blocks.
+type File struct {
+	substrate datamodel.Node
+	root      fileNode
+	ctx       context.Context
+	lsys      *linking.LinkSystem
+}
+
+// fileNode is one node of a file's tree.
+// Its content is its own data, followed by the content of each of its children, in order;
+// the size of each child's content is given in blocksizes.
+type fileNode struct {
+	data       []byte
+	children   []datamodel.Link
+	blocksizes []uint64
+}
+
+func newFileNode(pb pbNode, d unixfsData) (fileNode, error) {
+	if len(pb.links) != len(d.blocksizes) {
+		return fileNode{}, fmt.Errorf("unixfs: file node has %d links, but %d block sizes", len(pb.links), len(d.blocksizes))
+	}
+	fn := fileNode{data: d.data, blocksizes: d.blocksizes}
+	for _, l := range pb.links {
+		fn.children = append(fn.children, l.link)
+	}
+	return fn, nil
+}
+
+func (fn fileNode) size() int64 {
+	size := int64(len(fn.data))
+	for _, bs := range fn.blocksizes {
+		size += int64(bs)
+	}
+	return size
+}
+
+func (f *File) loadChild(lnk datamodel.Link) (fileNode, error) {
+	n, pb, d, err := loadPBNode(f.ctx, f.lsys, lnk)
+	if n != nil && n.Kind() == datamodel.Kind_Bytes {
+		// A raw block.
+		data, err := n.AsBytes()
+		return fileNode{data: data}, err
+	}
+	if err != nil {
+		return fileNode{}, err
+	}
+	if d.typ != typeFile && d.typ != typeRaw {
+		return fileNode{}, fmt.Errorf("unixfs: block %s, in a file, is not part of a file", lnk)
+	}
+	return newFileNode(pb, d)
+}
+
+func (*File) Kind() datamodel.Kind {
+	return datamodel.Kind_Bytes
+}
+func (*File) LookupByString(string) (datamodel.Node, error) {
+	return mixins.Bytes{TypeName: "unixfs.File"}.LookupByString("")
+}
+func (*File) LookupByNode(datamodel.Node) (datamodel.Node, error) {
+	return mixins.Bytes{TypeName: "unixfs.File"}.LookupByNode(nil)
+}
+func (*File) LookupByIndex(idx int64) (datamodel.Node, error) {
+	return mixins.Bytes{TypeName: "unixfs.File"}.LookupByIndex(0)
+}
+func (*File) LookupBySegment(seg datamodel.PathSegment) (datamodel.Node, error) {
+	return mixins.Bytes{TypeName: "unixfs.File"}.LookupBySegment(seg)
+}
+func (*File) MapIterator() datamodel.MapIterator {
+	return nil
+}
+func (*File) ListIterator() datamodel.ListIterator {
+	return nil
+}
+func (*File) Length() int64 {
+	return -1
+}
+func (*File) IsAbsent() bool {
+	return false
+}
+func (*File) IsNull() bool {
+	return false
+}
+func (*File) AsBool() (bool, error) {
+	return mixins.Bytes{TypeName: "unixfs.File"}.AsBool()
+}
+func (*File) AsInt() (int64, error) {
+	return mixins.Bytes{TypeName: "unixfs.File"}.AsInt()
+}
+func (*File) AsFloat() (float64, error) {
+	return mixins.Bytes{TypeName: "unixfs.File"}.AsFloat()
+}
+func (*File) AsString() (string, error) {
+	return mixins.Bytes{TypeName: "unixfs.File"}.AsString()
+}
+
+// AsBytes reads the whole content of the file into memory.
+func (f *File) AsBytes() ([]byte, error) {
+	r, _ := f.AsLargeBytes()
+	return ioutil.ReadAll(r)
+}
+func (*File) AsLink() (datamodel.Link, error) {
+	return mixins.Bytes{TypeName: "unixfs.File"}.AsLink()
+}
+
+// AsLargeBytes returns a reader of the content of the file, which loads its blocks as they're reached.
+// Seeking skips over blocks without loading them.
+// The error is always nil; errors from loading blocks are returned by the reader.
+func (f *File) AsLargeBytes() (io.ReadSeeker, error) {
+	return &fileReader{f: f, size: f.root.size(), path: []fileFrame{{node: f.root, end: f.root.size()}}}, nil
+}
+
+// Prototype returns the basicnode bytes prototype: this ADL can't create files,
+// so new nodes built in place of a File are plain bytes.
+func (*File) Prototype() datamodel.NodePrototype {
+	return basicnode.Prototype.Bytes
+}
+
+// Substrate returns the DAG-PB node the File was reified from (the root of its tree).
+func (f *File) Substrate() datamodel.Node {
+	return f.substrate
+}
+
+// fileReader reads a File, keeping the nodes on the path from the root down to the one it last read from.
+type fileReader struct {
+	f    *File
+	size int64
+	off  int64
+	path []fileFrame
+}
+
+// fileFrame is a node of a file's tree, and the range of the file's content it holds.
+type fileFrame struct {
+	node       fileNode
+	start, end int64
+}
+
+func (r *fileReader) Read(p []byte) (int, error) {
+	if r.off >= r.size {
+		return 0, io.EOF
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	// Go back up the tree until we're at a node that holds the offset (which the root always does)...
+	for len(r.path) > 1 {
+		top := r.path[len(r.path)-1]
+		if r.off >= top.start && r.off < top.end {
+			break
+		}
+		r.path = r.path[:len(r.path)-1]
+	}
+	// ... then go down, loading nodes, until we're at one whose own data holds it.
+	for {
+		top := r.path[len(r.path)-1]
+		rel := r.off - top.start
+		if rel < int64(len(top.node.data)) {
+			n := copy(p, top.node.data[rel:])
+			r.off += int64(n)
+			return n, nil
+		}
+		rel -= int64(len(top.node.data))
+		start := top.start + int64(len(top.node.data))
+		i := 0
+		for ; i < len(top.node.blocksizes); i++ {
+			if rel < int64(top.node.blocksizes[i]) {
+				break
+			}
+			rel -= int64(top.node.blocksizes[i])
+			start += int64(top.node.blocksizes[i])
+		}
+		if i == len(top.node.blocksizes) {
+			return 0, errors.New("unixfs: file is shorter than its block sizes say")
+		}
+		child, err := r.f.loadChild(top.node.children[i])
+		if err != nil {
+			return 0, err
+		}
+		if child.size() != int64(top.node.blocksizes[i]) {
+			return 0, fmt.Errorf("unixfs: block %s has %d bytes of content, but its parent says %d", top.node.children[i], child.size(), top.node.blocksizes[i])
+		}
+		r.path = append(r.path, fileFrame{node: child, start: start, end: start + child.size()})
+	}
+}
+
+func (r *fileReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.off
+	case io.SeekEnd:
+		offset += r.size
+	default:
+		return r.off, fmt.Errorf("unixfs: invalid whence %d", whence)
+	}
+	if offset < 0 {
+		return r.off, errors.New("unixfs: seek to a negative offset")
+	}
+	r.off = offset
+	return offset, nil
+}
@@ -0,0 +1,240 @@
+package unixfs
+
+import (
+	"context"
+	"fmt"
+	"math/bits"
+
+	"github.com/ipld/go-ipld-prime/adl"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/linking"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	"github.com/ipld/go-ipld-prime/node/mixins"
+)
+
+// hashMurmur3 is the multicodec of the only hash function HAMT-sharded directories use.
+const hashMurmur3 = 0x22
+
+var _ adl.ADL = (*ShardedDirectory)(nil)
+
+// ShardedDirectory is a HAMT-sharded UnixFS directory, presented as a map from the names of its entries to links to them,
+// the same as a Directory.
+//
+// Sharded directories are spread across many blocks: one for the root of the HAMT (which is what was reified),
+// and one for each of its other shards.
+// The other shards are loaded when they're needed, with the LinkSystem that was given to Reify.
+// A lookup loads only the shards on the way to the entry (so, a few at most);
+// iterating loads every shard, one at a time, as the iteration reaches it.
+//
+// The entries are iterated in the order they're found in the HAMT, which is not sorted.
+type ShardedDirectory struct {
+	substrate datamodel.Node
+	root      shard
+	ctx       context.Context
+	lsys      *linking.LinkSystem
+}
+
+// shard is one node of a HAMT.
+// Each of its links is named with the hex index of its bucket, padded to padLen characters;
+// a link with nothing after that is to another shard, and otherwise, the rest of the name is the name of an entry.
+type shard struct {
+	links    []pbLink
+	fanout   uint64
+	bitWidth int
+	padLen   int
+}
+
+func newShard(pb pbNode, d unixfsData) (shard, error) {
+	if d.hashType != hashMurmur3 {
+		return shard{}, fmt.Errorf("unixfs: sharded directory uses hash function 0x%x, not murmur3 (0x%x)", d.hashType, hashMurmur3)
+	}
+	if d.fanout < 2 || d.fanout > 1<<16 || d.fanout&(d.fanout-1) != 0 {
+		return shard{}, fmt.Errorf("unixfs: sharded directory has invalid fanout %d", d.fanout)
+	}
+	sh := shard{
+		links:    pb.links,
+		fanout:   d.fanout,
+		bitWidth: bits.TrailingZeros64(d.fanout),
+		padLen:   len(fmt.Sprintf("%X", d.fanout-1)),
+	}
+	for _, l := range sh.links {
+		if len(l.name) < sh.padLen {
+			return shard{}, fmt.Errorf("unixfs: sharded directory has invalid link name %q", l.name)
+		}
+	}
+	return sh, nil
+}
+
+func (d *ShardedDirectory) loadShard(lnk datamodel.Link) (shard, error) {
+	_, pb, ud, err := loadPBNode(d.ctx, d.lsys, lnk)
+	if err != nil {
+		return shard{}, err
+	}
+	if ud.typ != typeHAMTShard {
+		return shard{}, fmt.Errorf("unixfs: block %s, in a sharded directory, is not a shard", lnk)
+	}
+	sh, err := newShard(pb, ud)
+	if err != nil {
+		return shard{}, err
+	}
+	if sh.fanout != d.root.fanout {
+		return shard{}, fmt.Errorf("unixfs: block %s has fanout %d, but its sharded directory has fanout %d", lnk, sh.fanout, d.root.fanout)
+	}
+	return sh, nil
+}
+
+func (*ShardedDirectory) Kind() datamodel.Kind {
+	return datamodel.Kind_Map
+}
+
+// LookupByString finds an entry by hashing its name, and following the hash through the HAMT,
+// loading shards as necessary.
+// Errors from loading them are returned as they are.
+func (d *ShardedDirectory) LookupByString(key string) (datamodel.Node, error) {
+	hash := murmur3x64([]byte(key))
+	sh := d.root
+	for depth := 1; ; depth++ {
+		consumed := depth * sh.bitWidth
+		if consumed > 64 {
+			return nil, fmt.Errorf("unixfs: sharded directory is deeper than its hash allows")
+		}
+		prefix := fmt.Sprintf("%0*X", sh.padLen, (hash>>(64-consumed))&(sh.fanout-1))
+		var next datamodel.Link
+		for _, l := range sh.links {
+			if l.name[:sh.padLen] != prefix {
+				continue
+			}
+			if len(l.name) == sh.padLen {
+				next = l.link
+				break
+			}
+			if l.name[sh.padLen:] == key {
+				return basicnode.NewLink(l.link), nil
+			}
+		}
+		if next == nil {
+			return nil, datamodel.ErrNotExists{Segment: datamodel.PathSegmentOfString(key)}
+		}
+		var err error
+		if sh, err = d.loadShard(next); err != nil {
+			return nil, err
+		}
+	}
+}
+func (d *ShardedDirectory) LookupByNode(key datamodel.Node) (datamodel.Node, error) {
+	ks, err := key.AsString()
+	if err != nil {
+		return nil, err
+	}
+	return d.LookupByString(ks)
+}
+func (*ShardedDirectory) LookupByIndex(idx int64) (datamodel.Node, error) {
+	return mixins.Map{TypeName: "unixfs.ShardedDirectory"}.LookupByIndex(0)
+}
+func (d *ShardedDirectory) LookupBySegment(seg datamodel.PathSegment) (datamodel.Node, error) {
+	return d.LookupByString(seg.String())
+}
+func (d *ShardedDirectory) MapIterator() datamodel.MapIterator {
+	return &shardIterator{d: d, stack: [][]pbLink{d.root.links}}
+}
+func (*ShardedDirectory) ListIterator() datamodel.ListIterator {
+	return nil
+}
+
+// Length counts the entries, which means loading every shard.
+// If any of them can't be loaded, Length returns -1.
+func (d *ShardedDirectory) Length() int64 {
+	var n int64
+	for itr := d.MapIterator(); !itr.Done(); n++ {
+		if _, _, err := itr.Next(); err != nil {
+			return -1
+		}
+	}
+	return n
+}
+func (*ShardedDirectory) IsAbsent() bool {
+	return false
+}
+func (*ShardedDirectory) IsNull() bool {
+	return false
+}
+func (*ShardedDirectory) AsBool() (bool, error) {
+	return mixins.Map{TypeName: "unixfs.ShardedDirectory"}.AsBool()
+}
+func (*ShardedDirectory) AsInt() (int64, error) {
+	return mixins.Map{TypeName: "unixfs.ShardedDirectory"}.AsInt()
+}
+func (*ShardedDirectory) AsFloat() (float64, error) {
+	return mixins.Map{TypeName: "unixfs.ShardedDirectory"}.AsFloat()
+}
+func (*ShardedDirectory) AsString() (string, error) {
+	return mixins.Map{TypeName: "unixfs.ShardedDirectory"}.AsString()
+}
+func (*ShardedDirectory) AsBytes() ([]byte, error) {
+	return mixins.Map{TypeName: "unixfs.ShardedDirectory"}.AsBytes()
+}
+func (*ShardedDirectory) AsLink() (datamodel.Link, error) {
+	return mixins.Map{TypeName: "unixfs.ShardedDirectory"}.AsLink()
+}
+
+// Prototype returns the basicnode map prototype, as for Directory.
+func (*ShardedDirectory) Prototype() datamodel.NodePrototype {
+	return basicnode.Prototype.Map
+}
+
+// Substrate returns the DAG-PB node of the root shard, which the ShardedDirectory was reified from.
+func (d *ShardedDirectory) Substrate() datamodel.Node {
+	return d.substrate
+}
+
+// shardIterator walks the HAMT depth-first, loading each shard as it's reached.
+type shardIterator struct {
+	d     *ShardedDirectory
+	stack [][]pbLink // The links not yet visited, of each shard on the way down to the current one.
+	next  *pbLink    // The entry the next call to Next will return, once found.
+	err   error      // The error the next call to Next will return, if finding the next entry failed.
+}
+
+// advance finds the next entry (if it hasn't been found already), loading shards on the way as needed.
+func (itr *shardIterator) advance() {
+	for itr.next == nil && itr.err == nil && len(itr.stack) > 0 {
+		top := &itr.stack[len(itr.stack)-1]
+		if len(*top) == 0 {
+			itr.stack = itr.stack[:len(itr.stack)-1]
+			continue
+		}
+		l := (*top)[0]
+		*top = (*top)[1:]
+		padLen := itr.d.root.padLen
+		if len(l.name) == padLen {
+			sh, err := itr.d.loadShard(l.link)
+			if err != nil {
+				itr.err = err
+				return
+			}
+			itr.stack = append(itr.stack, sh.links)
+			continue
+		}
+		itr.next = &pbLink{name: l.name[padLen:], link: l.link}
+	}
+}
+
+func (itr *shardIterator) Next() (datamodel.Node, datamodel.Node, error) {
+	itr.advance()
+	if itr.err != nil {
+		return nil, nil, itr.err
+	}
+	if itr.next == nil {
+		return nil, nil, datamodel.ErrIteratorOverread{}
+	}
+	e := itr.next
+	itr.next = nil
+	return basicnode.NewString(e.name), basicnode.NewLink(e.link), nil
+}
+
+// Done may load shards, to find out whether there are any entries left.
+// If loading one fails, Done returns false, and the following call to Next returns the error.
+func (itr *shardIterator) Done() bool {
+	itr.advance()
+	return itr.next == nil && itr.err == nil
+}
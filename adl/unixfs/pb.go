@@ -0,0 +1,103 @@
+package unixfs
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// The types of UnixFS node, as they're numbered in the Type field of the UnixFS Data message.
+const (
+	typeRaw       = 0
+	typeDirectory = 1
+	typeFile      = 2
+	typeMetadata  = 3
+	typeSymlink   = 4
+	typeHAMTShard = 5
+)
+
+// unixfsData is the UnixFS Data message, which is found in the Data field of a DAG-PB node.
+// The mode and mtime fields aren't used by this package, so they aren't kept.
+type unixfsData struct {
+	typ        uint64
+	data       []byte
+	filesize   uint64
+	hasSize    bool
+	blocksizes []uint64
+	hashType   uint64
+	fanout     uint64
+}
+
+var errTruncated = errors.New("unixfs: truncated protobuf")
+
+// parseData parses a UnixFS Data message.
+// Unlike the dagpb codec, it's lenient about field order and unknown fields,
+// as protobuf decoders generally are, and as UnixFS data found in the wild requires.
+func parseData(buf []byte) (unixfsData, error) {
+	var d unixfsData
+	var hasType bool
+	for len(buf) > 0 {
+		key, n := binary.Uvarint(buf)
+		if n <= 0 {
+			return d, errTruncated
+		}
+		buf = buf[n:]
+		field, wireType := key>>3, key&7
+		switch wireType {
+		case 0: // varint
+			v, n := binary.Uvarint(buf)
+			if n <= 0 {
+				return d, errTruncated
+			}
+			buf = buf[n:]
+			switch field {
+			case 1:
+				d.typ, hasType = v, true
+			case 3:
+				d.filesize, d.hasSize = v, true
+			case 4:
+				d.blocksizes = append(d.blocksizes, v)
+			case 5:
+				d.hashType = v
+			case 6:
+				d.fanout = v
+			}
+		case 2: // length-delimited
+			l, n := binary.Uvarint(buf)
+			if n <= 0 || uint64(len(buf)-n) < l {
+				return d, errTruncated
+			}
+			chunk := buf[n : n+int(l)]
+			buf = buf[n+int(l):]
+			switch field {
+			case 2:
+				d.data = chunk
+			case 4: // blocksizes, packed.
+				for len(chunk) > 0 {
+					v, n := binary.Uvarint(chunk)
+					if n <= 0 {
+						return d, errTruncated
+					}
+					d.blocksizes = append(d.blocksizes, v)
+					chunk = chunk[n:]
+				}
+			}
+		case 1: // 64-bit
+			if len(buf) < 8 {
+				return d, errTruncated
+			}
+			buf = buf[8:]
+		case 5: // 32-bit
+			if len(buf) < 4 {
+				return d, errTruncated
+			}
+			buf = buf[4:]
+		default:
+			return d, fmt.Errorf("unixfs: unsupported protobuf wire type %d", wireType)
+		}
+	}
+	if !hasType {
+		return d, errors.New("unixfs: Data message has no Type")
+	}
+	return d, nil
+}
@@ -0,0 +1,126 @@
+package unixfs
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/linking"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+)
+
+var _ linking.NodeReifier = Reify
+
+// Reify examines a node to see if it's a DAG-PB node holding UnixFS data,
+// and if so, returns the ADL node presenting it: a *Directory, a *ShardedDirectory, or a *File.
+// Any other node is returned unchanged, with no error.
+// If the node is UnixFS data of a kind this package presents, but it's malformed, an error is returned.
+//
+// The LinkSystem is kept by the ADL nodes of sharded directories and files, for loading the rest of their blocks,
+// along with the context from the LinkContext.
+// Those blocks are loaded with LinkSystem.Fill, so no reification is applied to them.
+//
+// Reify fits the linking.NodeReifier function interface.
+func Reify(lnkCtx linking.LinkContext, n datamodel.Node, lsys *linking.LinkSystem) (datamodel.Node, error) {
+	pb, ok := readPBNode(n)
+	if !ok {
+		return n, nil
+	}
+	d, err := parseData(pb.data)
+	if err != nil {
+		// Not UnixFS.  DAG-PB is occasionally used for other things.
+		return n, nil
+	}
+	ctx := lnkCtx.Ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	switch d.typ {
+	case typeDirectory:
+		return &Directory{substrate: n, entries: pb.links}, nil
+	case typeHAMTShard:
+		sh, err := newShard(pb, d)
+		if err != nil {
+			return nil, err
+		}
+		return &ShardedDirectory{substrate: n, root: sh, ctx: ctx, lsys: lsys}, nil
+	case typeFile, typeRaw:
+		fn, err := newFileNode(pb, d)
+		if err != nil {
+			return nil, err
+		}
+		return &File{substrate: n, root: fn, ctx: ctx, lsys: lsys}, nil
+	default:
+		return n, nil
+	}
+}
+
+// pbNode and pbLink are the parts of a DAG-PB node that this package uses.
+type pbNode struct {
+	links []pbLink
+	data  []byte
+}
+
+type pbLink struct {
+	name string
+	link datamodel.Link
+}
+
+// readPBNode reads a node of the PBNode shape, as the dagpb codec produces.
+// If the node isn't of that shape, or has no Data, ok is false.
+func readPBNode(n datamodel.Node) (pb pbNode, ok bool) {
+	if n.Kind() != datamodel.Kind_Map {
+		return pb, false
+	}
+	data, err := n.LookupByString("Data")
+	if err != nil {
+		return pb, false
+	}
+	if pb.data, err = data.AsBytes(); err != nil {
+		return pb, false
+	}
+	links, err := n.LookupByString("Links")
+	if err != nil || links.Kind() != datamodel.Kind_List {
+		return pb, false
+	}
+	pb.links = make([]pbLink, 0, links.Length())
+	for itr := links.ListIterator(); !itr.Done(); {
+		_, v, err := itr.Next()
+		if err != nil {
+			return pb, false
+		}
+		hash, err := v.LookupByString("Hash")
+		if err != nil {
+			return pb, false
+		}
+		var l pbLink
+		if l.link, err = hash.AsLink(); err != nil {
+			return pb, false
+		}
+		if name, err := v.LookupByString("Name"); err == nil {
+			if l.name, err = name.AsString(); err != nil {
+				return pb, false
+			}
+		}
+		pb.links = append(pb.links, l)
+	}
+	return pb, true
+}
+
+// loadPBNode loads a block which is expected to be a DAG-PB node holding UnixFS data.
+func loadPBNode(ctx context.Context, lsys *linking.LinkSystem, lnk datamodel.Link) (datamodel.Node, pbNode, unixfsData, error) {
+	nb := basicnode.Prototype.Any.NewBuilder()
+	if err := lsys.Fill(linking.LinkContext{Ctx: ctx}, lnk, nb); err != nil {
+		return nil, pbNode{}, unixfsData{}, err
+	}
+	n := nb.Build()
+	pb, ok := readPBNode(n)
+	if !ok {
+		return n, pb, unixfsData{}, fmt.Errorf("unixfs: block %s is not a DAG-PB node with data", lnk)
+	}
+	d, err := parseData(pb.data)
+	if err != nil {
+		return n, pb, d, fmt.Errorf("unixfs: block %s: %w", lnk, err)
+	}
+	return n, pb, d, nil
+}
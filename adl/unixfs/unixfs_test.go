@@ -0,0 +1,332 @@
+package unixfs
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+	cid "github.com/ipfs/go-cid"
+
+	_ "github.com/ipld/go-ipld-prime/codec/dagjson"
+	_ "github.com/ipld/go-ipld-prime/codec/dagpb"
+	_ "github.com/ipld/go-ipld-prime/codec/raw"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/fluent/qp"
+	"github.com/ipld/go-ipld-prime/linking"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	"github.com/ipld/go-ipld-prime/storage"
+	"github.com/ipld/go-ipld-prime/traversal"
+)
+
+func TestMurmur3(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want uint64
+	}{
+		{"", 0x0000000000000000},
+		{"hello", 0xcbd8a7b341bd9b02},
+		{"hello, world", 0x342fac623a5ebc8e},
+		{"19 Jan 2038 at 3:14:07 AM", 0xb89e5988b737affc},
+		{"The quick brown fox jumps over the lazy dog.", 0xcd99481f9ee902c9},
+	} {
+		qt.Check(t, murmur3x64([]byte(tc.in)), qt.Equals, tc.want, qt.Commentf("%q", tc.in))
+	}
+}
+
+// fixture builds UnixFS data in memory storage.
+type fixture struct {
+	t    *testing.T
+	lsys linking.LinkSystem
+}
+
+func newFixture(t *testing.T) *fixture {
+	store := storage.Memory{}
+	lsys := cidlink.DefaultLinkSystem()
+	lsys.StorageReadOpener = store.OpenRead
+	lsys.StorageWriteOpener = store.OpenWrite
+	lsys.NodeReifier = Reify
+	return &fixture{t, lsys}
+}
+
+func (f *fixture) store(codec uint64, n datamodel.Node) datamodel.Link {
+	lp := cidlink.LinkPrototype{Prefix: cid.Prefix{Version: 1, Codec: codec, MhType: 0x12, MhLength: 32}}
+	lnk, err := f.lsys.Store(linking.LinkContext{}, lp, n)
+	qt.Assert(f.t, err, qt.IsNil)
+	return lnk
+}
+
+func (f *fixture) raw(data string) datamodel.Link {
+	return f.store(0x55, basicnode.NewBytes([]byte(data)))
+}
+
+// pb stores a DAG-PB node with the given UnixFS data and links.
+func (f *fixture) pb(data []byte, links ...pbLink) datamodel.Link {
+	n, err := qp.BuildMap(basicnode.Prototype.Any, 2, func(ma datamodel.MapAssembler) {
+		qp.MapEntry(ma, "Links", qp.List(int64(len(links)), func(la datamodel.ListAssembler) {
+			for _, l := range links {
+				qp.ListEntry(la, qp.Map(2, func(ma datamodel.MapAssembler) {
+					qp.MapEntry(ma, "Hash", qp.Link(l.link))
+					qp.MapEntry(ma, "Name", qp.String(l.name))
+				}))
+			}
+		}))
+		qp.MapEntry(ma, "Data", qp.Bytes(data))
+	})
+	qt.Assert(f.t, err, qt.IsNil)
+	return f.store(0x70, n)
+}
+
+// unixfsBytes encodes a UnixFS Data message.
+func unixfsBytes(typ uint64, data []byte, blocksizes []uint64, fanout uint64) []byte {
+	var buf []byte
+	buf = appendUvarint(buf, 1<<3)
+	buf = appendUvarint(buf, typ)
+	if data != nil {
+		buf = appendUvarint(buf, 2<<3|2)
+		buf = appendUvarint(buf, uint64(len(data)))
+		buf = append(buf, data...)
+	}
+	for _, bs := range blocksizes {
+		buf = appendUvarint(buf, 4<<3)
+		buf = appendUvarint(buf, bs)
+	}
+	if fanout != 0 {
+		buf = appendUvarint(buf, 5<<3)
+		buf = appendUvarint(buf, hashMurmur3)
+		buf = appendUvarint(buf, 6<<3)
+		buf = appendUvarint(buf, fanout)
+	}
+	return buf
+}
+
+func appendUvarint(buf []byte, v uint64) []byte {
+	for v >= 0x80 {
+		buf = append(buf, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(buf, byte(v))
+}
+
+// file stores a file node, whose children are given with their sizes.
+func (f *fixture) file(data string, children ...interface{}) datamodel.Link {
+	var links []pbLink
+	var sizes []uint64
+	for i := 0; i < len(children); i += 2 {
+		links = append(links, pbLink{link: children[i].(datamodel.Link)})
+		sizes = append(sizes, uint64(children[i+1].(int)))
+	}
+	return f.pb(unixfsBytes(typeFile, []byte(data), sizes, 0), links...)
+}
+
+func (f *fixture) dir(entries map[string]datamodel.Link) datamodel.Link {
+	var links []pbLink
+	for name, lnk := range entries {
+		links = append(links, pbLink{name, lnk})
+	}
+	sort.Slice(links, func(i, j int) bool { return links[i].name < links[j].name })
+	return f.pb(unixfsBytes(typeDirectory, nil, nil, 0), links...)
+}
+
+// hamt stores a HAMT-sharded directory, the same way other UnixFS implementations lay them out.
+func (f *fixture) hamt(fanout uint64, entries map[string]datamodel.Link, depth int) datamodel.Link {
+	bitWidth := 0
+	for 1<<bitWidth < fanout {
+		bitWidth++
+	}
+	padLen := len(fmt.Sprintf("%X", fanout-1))
+	buckets := make([]map[string]datamodel.Link, fanout)
+	for name, lnk := range entries {
+		consumed := (depth + 1) * bitWidth
+		idx := (murmur3x64([]byte(name)) >> (64 - consumed)) & (fanout - 1)
+		if buckets[idx] == nil {
+			buckets[idx] = map[string]datamodel.Link{}
+		}
+		buckets[idx][name] = lnk
+	}
+	var links []pbLink
+	for idx, bucket := range buckets {
+		prefix := fmt.Sprintf("%0*X", padLen, idx)
+		switch len(bucket) {
+		case 0:
+		case 1:
+			for name, lnk := range bucket {
+				links = append(links, pbLink{prefix + name, lnk})
+			}
+		default:
+			links = append(links, pbLink{prefix, f.hamt(fanout, bucket, depth+1)})
+		}
+	}
+	return f.pb(unixfsBytes(typeHAMTShard, []byte{}, nil, fanout), links...)
+}
+
+func (f *fixture) load(lnk datamodel.Link) datamodel.Node {
+	n, err := f.lsys.Load(linking.LinkContext{}, lnk, basicnode.Prototype.Any)
+	qt.Assert(f.t, err, qt.IsNil)
+	return n
+}
+
+func (f *fixture) get(root datamodel.Node, path string) (datamodel.Node, error) {
+	prog := traversal.Progress{Cfg: &traversal.Config{LinkSystem: f.lsys, LinkTargetNodePrototypeChooser: basicnode.Chooser}}
+	return prog.Get(root, datamodel.ParsePath(path))
+}
+
+func TestFile(t *testing.T) {
+	f := newFixture(t)
+	// "hello world", spread over a tree: a raw leaf, and an intermediate node holding a UnixFS raw leaf and a file leaf.
+	inner := f.file("", f.pb(unixfsBytes(typeRaw, []byte("wor"), nil, 0)), 3, f.file("ld"), 2)
+	root := f.file("", f.raw("hello "), 6, inner, 5)
+
+	n := f.load(root)
+	qt.Assert(t, n, qt.Satisfies, func(n datamodel.Node) bool { _, ok := n.(*File); return ok })
+	qt.Check(t, n.Kind(), qt.Equals, datamodel.Kind_Bytes)
+	b, err := n.AsBytes()
+	qt.Assert(t, err, qt.IsNil)
+	qt.Check(t, string(b), qt.Equals, "hello world")
+
+	t.Run("seek", func(t *testing.T) {
+		r, err := n.(datamodel.LargeBytesNode).AsLargeBytes()
+		qt.Assert(t, err, qt.IsNil)
+		for _, tc := range []struct {
+			offset int64
+			whence int
+			want   string
+		}{
+			{7, io.SeekStart, "orld"},
+			{-4, io.SeekEnd, "orld"},
+			{0, io.SeekStart, "hello world"},
+			{-10, io.SeekEnd, "ello world"},
+			{20, io.SeekStart, ""},
+		} {
+			_, err := r.Seek(tc.offset, tc.whence)
+			qt.Assert(t, err, qt.IsNil)
+			got, err := ioutil.ReadAll(r)
+			qt.Assert(t, err, qt.IsNil)
+			qt.Check(t, string(got), qt.Equals, tc.want)
+		}
+		_, err = r.Seek(-1, io.SeekStart)
+		qt.Check(t, err, qt.Not(qt.IsNil))
+	})
+	t.Run("small reads", func(t *testing.T) {
+		r, _ := n.(datamodel.LargeBytesNode).AsLargeBytes()
+		var got bytes.Buffer
+		buf := make([]byte, 2)
+		for {
+			n, err := r.Read(buf)
+			got.Write(buf[:n])
+			if err == io.EOF {
+				break
+			}
+			qt.Assert(t, err, qt.IsNil)
+		}
+		qt.Check(t, got.String(), qt.Equals, "hello world")
+	})
+	t.Run("wrong block size", func(t *testing.T) {
+		n := f.load(f.file("", f.raw("hello"), 6))
+		_, err := n.AsBytes()
+		qt.Check(t, err, qt.ErrorMatches, ".*has 5 bytes of content, but its parent says 6")
+	})
+	t.Run("missing block", func(t *testing.T) {
+		lsys := cidlink.DefaultLinkSystem()
+		lsys.StorageReadOpener = (&storage.Memory{}).OpenRead
+		missing := lsys.MustComputeLink(cidlink.LinkPrototype{Prefix: cid.Prefix{Version: 1, Codec: 0x55, MhType: 0x12, MhLength: 32}}, basicnode.NewBytes([]byte("gone")))
+		n := f.load(f.file("a", missing, 4))
+		r, _ := n.(datamodel.LargeBytesNode).AsLargeBytes()
+		buf := make([]byte, 10)
+		c, err := r.Read(buf)
+		qt.Check(t, err, qt.IsNil)
+		qt.Check(t, string(buf[:c]), qt.Equals, "a")
+		_, err = r.Read(buf)
+		qt.Check(t, errors.As(err, &linking.ErrNotFound{}), qt.IsTrue)
+	})
+}
+
+func TestDirectory(t *testing.T) {
+	f := newFixture(t)
+	file := f.file("content")
+	sub := f.dir(map[string]datamodel.Link{"file.txt": file})
+	root := f.dir(map[string]datamodel.Link{"dir": sub, "other": f.raw("x")})
+
+	n := f.load(root)
+	qt.Check(t, n.Kind(), qt.Equals, datamodel.Kind_Map)
+	qt.Check(t, n.Length(), qt.Equals, int64(2))
+	var keys []string
+	for itr := n.MapIterator(); !itr.Done(); {
+		k, v, err := itr.Next()
+		qt.Assert(t, err, qt.IsNil)
+		ks, _ := k.AsString()
+		keys = append(keys, ks)
+		qt.Check(t, v.Kind(), qt.Equals, datamodel.Kind_Link)
+	}
+	qt.Check(t, keys, qt.DeepEquals, []string{"dir", "other"})
+	qt.Check(t, n.(*Directory).Substrate().Kind(), qt.Equals, datamodel.Kind_Map)
+
+	got, err := f.get(n, "dir/file.txt")
+	qt.Assert(t, err, qt.IsNil)
+	b, err := got.AsBytes()
+	qt.Assert(t, err, qt.IsNil)
+	qt.Check(t, string(b), qt.Equals, "content")
+
+	_, err = f.get(n, "dir/nope")
+	qt.Check(t, errors.As(err, &datamodel.ErrNotExists{}), qt.IsTrue)
+}
+
+func TestShardedDirectory(t *testing.T) {
+	f := newFixture(t)
+	entries := map[string]datamodel.Link{}
+	for i := 0; i < 50; i++ {
+		entries[fmt.Sprintf("file-%d.txt", i)] = f.file(fmt.Sprintf("content %d", i))
+	}
+	root := f.dir(map[string]datamodel.Link{"big": f.hamt(4, entries, 0)})
+
+	n := f.load(root)
+	big, err := f.get(n, "big")
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, big, qt.Satisfies, func(n datamodel.Node) bool { _, ok := n.(*ShardedDirectory); return ok })
+	qt.Check(t, big.Length(), qt.Equals, int64(50))
+
+	seen := map[string]bool{}
+	for itr := big.MapIterator(); !itr.Done(); {
+		k, v, err := itr.Next()
+		qt.Assert(t, err, qt.IsNil)
+		ks, _ := k.AsString()
+		lnk, _ := v.AsLink()
+		qt.Check(t, lnk, qt.Equals, entries[ks])
+		seen[ks] = true
+	}
+	qt.Check(t, seen, qt.HasLen, 50)
+
+	for _, i := range []int{0, 17, 49} {
+		got, err := f.get(n, fmt.Sprintf("big/file-%d.txt", i))
+		qt.Assert(t, err, qt.IsNil)
+		b, err := got.AsBytes()
+		qt.Assert(t, err, qt.IsNil)
+		qt.Check(t, string(b), qt.Equals, fmt.Sprintf("content %d", i))
+	}
+	_, err = big.LookupByString("file-50.txt")
+	qt.Check(t, errors.As(err, &datamodel.ErrNotExists{}), qt.IsTrue)
+}
+
+func TestReifyLeavesOtherNodes(t *testing.T) {
+	f := newFixture(t)
+	for _, lnk := range []datamodel.Link{
+		f.raw("raw"),
+		f.store(0x0129, basicnode.NewString("dag-json")),
+		f.pb([]byte("not unixfs")),
+		f.pb(unixfsBytes(typeSymlink, []byte("target"), nil, 0)),
+	} {
+		n := f.load(lnk)
+		_, isADL := n.(interface{ Substrate() datamodel.Node })
+		qt.Check(t, isADL, qt.IsFalse, qt.Commentf("%s", lnk))
+	}
+
+	// Malformed UnixFS is an error, though.
+	lnk := f.pb(unixfsBytes(typeFile, nil, []uint64{3}, 0))
+	_, err := f.lsys.Load(linking.LinkContext{}, lnk, basicnode.Prototype.Any)
+	qt.Check(t, err, qt.ErrorMatches, ".*has 0 links, but 1 block sizes")
+}
@@ -1,6 +1,7 @@
 package codec
 
 import (
+	"fmt"
 	"io"
 
 	"github.com/ipld/go-ipld-prime/datamodel"
@@ -109,10 +110,124 @@ type (
 //  Errors
 //
 
-type ErrBudgetExhausted struct{}
+// ErrBudgetExhausted is returned by decoders when data would demand more resources than their limits allow
+// (and by a LinkSystem, when a block is larger than its MaxBlockSize).
+// These limits are a defense against untrusted data which is crafted to exhaust memory or stack.
+//
+// Budget says which limit was reached; see the DecodeOptions of each codec for how to configure them.
+type ErrBudgetExhausted struct {
+	Budget Budget
+}
 
 func (e ErrBudgetExhausted) Error() string {
-	return "decoder resource budget exhausted (message too long or too complex)"
+	if e.Budget == BudgetUnspecified {
+		return "decoder resource budget exhausted (message too long or too complex)"
+	}
+	return fmt.Sprintf("decoder resource budget exhausted (%s limit reached)", e.Budget)
+}
+
+// Budget names one of the limits which can cause ErrBudgetExhausted.
+type Budget uint8
+
+const (
+	BudgetUnspecified  Budget = iota // The decoder didn't say which limit.
+	BudgetAllocation                 // The total of memory allocated for the decoded data (very roughly, in bytes).
+	BudgetDepth                      // The nesting depth of maps and lists.
+	BudgetStringLength               // The length of a single string or bytes value (including map keys).
+	BudgetBlockSize                  // The size of a whole block, as read from storage.
+)
+
+func (b Budget) String() string {
+	switch b {
+	case BudgetUnspecified:
+		return "unspecified"
+	case BudgetAllocation:
+		return "allocation"
+	case BudgetDepth:
+		return "depth"
+	case BudgetStringLength:
+		return "string length"
+	case BudgetBlockSize:
+		return "block size"
+	default:
+		return "invalid"
+	}
+}
+
+// DefaultAllocationBudget is the allocation budget dag-cbor decoding uses when none is configured:
+// very roughly, 10 megabytes.
+const DefaultAllocationBudget = 1048576 * 10
+
+// ErrNotCanonical is returned by decoders in their strict modes (see the DecodeOptions of each codec)
+// when the data isn't in the one form the codec's specification allows for it.
+// That's the form the codec's encoder produces, so any data a strict decoder accepts
+// will be encoded again to exactly the same bytes.
+//
+// Offset is the position (in bytes, from the start of the data) of the item which isn't canonical,
+// and Reason says what's wrong with it.
+type ErrNotCanonical struct {
+	Offset int64
+	Reason NonCanonical
+}
+
+func (e ErrNotCanonical) Error() string {
+	return fmt.Sprintf("data is not in canonical form: %s (at offset %d)", e.Reason, e.Offset)
+}
+
+// NonCanonical names one of the reasons data can be rejected with ErrNotCanonical.
+// Not every reason applies to every codec.
+type NonCanonical uint8
+
+const (
+	NonCanonicalUnspecified      NonCanonical = iota // The decoder didn't say why.
+	NonCanonicalMapKeyOrder                          // Map keys aren't in the order the codec sorts them in.
+	NonCanonicalDuplicateMapKey                      // A map has the same key more than once.
+	NonCanonicalInteger                              // An integer (or a length, in binary codecs) isn't written in its shortest form.
+	NonCanonicalIntegerRange                         // An integer is too large (or small) to be represented as an int64.
+	NonCanonicalFloat                                // A float isn't written in the one form the codec uses for it (such as with 64 bits, in DAG-CBOR).
+	NonCanonicalFloatSpecial                         // A float is NaN or infinite.
+	NonCanonicalIndefiniteLength                     // A string, list, or map has an indefinite length.
+	NonCanonicalTag                                  // A tag which the codec doesn't use (in DAG-CBOR, any other than 42, on bytes).
+	NonCanonicalSimpleValue                          // A simple value other than true, false, or null (such as CBOR's undefined).
+	NonCanonicalString                               // A string isn't valid UTF-8, or (in text codecs) isn't escaped the way the codec escapes strings.
+	NonCanonicalLink                                 // A link, or bytes, in a text codec, isn't written the way the codec writes them.
+	NonCanonicalWhitespace                           // Whitespace, in a text codec, outside of strings.
+	NonCanonicalTrailingData                         // There's more data after the end of the value.
+)
+
+func (r NonCanonical) String() string {
+	switch r {
+	case NonCanonicalUnspecified:
+		return "unspecified"
+	case NonCanonicalMapKeyOrder:
+		return "map keys not sorted"
+	case NonCanonicalDuplicateMapKey:
+		return "duplicate map key"
+	case NonCanonicalInteger:
+		return "integer not in shortest form"
+	case NonCanonicalIntegerRange:
+		return "integer out of range"
+	case NonCanonicalFloat:
+		return "float not in canonical form"
+	case NonCanonicalFloatSpecial:
+		return "NaN or infinite float"
+	case NonCanonicalIndefiniteLength:
+		return "indefinite length"
+	case NonCanonicalTag:
+		return "disallowed tag"
+	case NonCanonicalSimpleValue:
+		return "disallowed simple value"
+	case NonCanonicalString:
+		return "string not in canonical form"
+	case NonCanonicalLink:
+		return "link or bytes not in canonical form"
+	case NonCanonicalWhitespace:
+		return "whitespace"
+	case NonCanonicalTrailingData:
+		return "trailing data"
+	default:
+		return "invalid"
+	}
 }
 
 // ---------------------
@@ -0,0 +1,187 @@
+package dagcbor
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"unicode/utf8"
+
+	"github.com/ipld/go-ipld-prime/codec"
+)
+
+// checkCanonical checks that data holds exactly one item of DAG-CBOR in its canonical form:
+// the form Encode produces (with the default, RFC7049, map sorting), and the only one the DAG-CBOR spec allows.
+// It's used by DecodeOptions.Decode when Strict is set, before decoding.
+//
+// Only canonical form is checked here; anything else which would make the data undecodable is left to the decoder,
+// except for truncation, and map keys which aren't strings, which would prevent the check from continuing.
+func checkCanonical(data []byte, options DecodeOptions) error {
+	c := canonicalChecker{data: data, options: options}
+	if err := c.item(0); err != nil {
+		return err
+	}
+	if c.off != len(data) {
+		return c.fail(c.off, codec.NonCanonicalTrailingData)
+	}
+	return nil
+}
+
+type canonicalChecker struct {
+	data    []byte
+	off     int
+	options DecodeOptions
+}
+
+func (c *canonicalChecker) fail(off int, reason codec.NonCanonical) error {
+	return codec.ErrNotCanonical{Offset: int64(off), Reason: reason}
+}
+
+// head reads the initial byte of an item, and its argument, checking the argument is minimally encoded.
+// For the floats and simple values of major type 7, the argument is their bits, which needn't be minimal.
+func (c *canonicalChecker) head() (major byte, info byte, arg uint64, err error) {
+	start := c.off
+	if c.off >= len(c.data) {
+		return 0, 0, 0, io.ErrUnexpectedEOF
+	}
+	major, info = c.data[c.off]>>5, c.data[c.off]&0x1f
+	c.off++
+	var size int
+	switch {
+	case info < 24:
+		return major, info, uint64(info), nil
+	case info == 24:
+		size = 1
+	case info == 25:
+		size = 2
+	case info == 26:
+		size = 4
+	case info == 27:
+		size = 8
+	case info == 31:
+		return 0, 0, 0, c.fail(start, codec.NonCanonicalIndefiniteLength)
+	default:
+		return 0, 0, 0, fmt.Errorf("invalid cbor: reserved additional information %d at offset %d", info, start)
+	}
+	if len(c.data)-c.off < size {
+		return 0, 0, 0, io.ErrUnexpectedEOF
+	}
+	var buf [8]byte
+	copy(buf[8-size:], c.data[c.off:c.off+size])
+	arg = binary.BigEndian.Uint64(buf[:])
+	c.off += size
+	if major == 7 {
+		return major, info, arg, nil
+	}
+	// A shorter argument would do if this one fits in half the bytes (or, for one byte, in the initial byte).
+	if arg < 24 || (size > 1 && arg>>(uint(size)*4) == 0) {
+		return 0, 0, 0, c.fail(start, codec.NonCanonicalInteger)
+	}
+	return major, info, arg, nil
+}
+
+// str reads the content of a string or bytes item, given its length.
+func (c *canonicalChecker) str(length uint64) ([]byte, error) {
+	if uint64(len(c.data)-c.off) < length {
+		return nil, io.ErrUnexpectedEOF
+	}
+	s := c.data[c.off : c.off+int(length)]
+	c.off += int(length)
+	return s, nil
+}
+
+func (c *canonicalChecker) item(depth int) error {
+	start := c.off
+	major, info, arg, err := c.head()
+	if err != nil {
+		return err
+	}
+	switch major {
+	case 0, 1: // Unsigned and negative integers.
+		if arg > math.MaxInt64 {
+			return c.fail(start, codec.NonCanonicalIntegerRange)
+		}
+		return nil
+	case 2: // Bytes.
+		_, err := c.str(arg)
+		return err
+	case 3: // Strings.
+		s, err := c.str(arg)
+		if err != nil {
+			return err
+		}
+		if !utf8.Valid(s) {
+			return c.fail(start, codec.NonCanonicalString)
+		}
+		return nil
+	case 4: // Lists.
+		if c.options.MaxDepth > 0 && depth >= c.options.MaxDepth {
+			return codec.ErrBudgetExhausted{Budget: codec.BudgetDepth}
+		}
+		for i := uint64(0); i < arg; i++ {
+			if err := c.item(depth + 1); err != nil {
+				return err
+			}
+		}
+		return nil
+	case 5: // Maps.
+		if c.options.MaxDepth > 0 && depth >= c.options.MaxDepth {
+			return codec.ErrBudgetExhausted{Budget: codec.BudgetDepth}
+		}
+		var prev []byte
+		for i := uint64(0); i < arg; i++ {
+			keyStart := c.off
+			kmajor, _, klen, err := c.head()
+			if err != nil {
+				return err
+			}
+			if kmajor != 3 {
+				return fmt.Errorf("invalid dag-cbor: map key at offset %d is not a string", keyStart)
+			}
+			key, err := c.str(klen)
+			if err != nil {
+				return err
+			}
+			if !utf8.Valid(key) {
+				return c.fail(keyStart, codec.NonCanonicalString)
+			}
+			// Keys are sorted by length, and then bytewise.
+			if i > 0 {
+				switch {
+				case string(prev) == string(key):
+					return c.fail(keyStart, codec.NonCanonicalDuplicateMapKey)
+				case len(prev) > len(key) || (len(prev) == len(key) && string(prev) > string(key)):
+					return c.fail(keyStart, codec.NonCanonicalMapKeyOrder)
+				}
+			}
+			prev = key
+			if err := c.item(depth + 1); err != nil {
+				return err
+			}
+		}
+		return nil
+	case 6: // Tags.
+		if arg != linkTag {
+			return c.fail(start, codec.NonCanonicalTag)
+		}
+		if c.off < len(c.data) && c.data[c.off]>>5 != 2 {
+			return c.fail(start, codec.NonCanonicalTag)
+		}
+		return c.item(depth)
+	default: // Floats and simple values.
+		switch info {
+		case 20, 21, 22: // False, true, and null.
+			return nil
+		case 25, 26:
+			return c.fail(start, codec.NonCanonicalFloat)
+		case 27:
+			f := math.Float64frombits(arg)
+			if math.IsNaN(f) || math.IsInf(f, 0) {
+				return c.fail(start, codec.NonCanonicalFloatSpecial)
+			}
+			return nil
+		default:
+			return c.fail(start, codec.NonCanonicalSimpleValue)
+		}
+	}
+}
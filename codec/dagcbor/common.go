@@ -1,3 +1,29 @@
 package dagcbor
 
 const linkTag = 42
+
+// The CBOR major types: the top three bits of the initial byte of each data item.
+const (
+	majorUint   = 0
+	majorNegInt = 1
+	majorBytes  = 2
+	majorString = 3
+	majorList   = 4
+	majorMap    = 5
+	majorTag    = 6
+	majorSimple = 7 // Floats, true, false, null, and the like -- and the break that ends indefinite-length items.
+)
+
+// Some values of the additional information: the bottom five bits of the initial byte.
+const (
+	infoUint8      = 24 // The argument is in the following byte...
+	infoUint16     = 25 // ... or the following two; for major type 7, a half-precision float...
+	infoUint32     = 26 // ... or four; for major type 7, a single-precision float...
+	infoUint64     = 27 // ... or eight; for major type 7, a double-precision float.
+	infoIndefinite = 31 // The item has indefinite length; for major type 7, the break.
+
+	simpleFalse     = 20
+	simpleTrue      = 21
+	simpleNull      = 22
+	simpleUndefined = 23
+)
@@ -23,20 +23,15 @@
 	To emit sorted data, the node should be sorted before applying the Encode function.
 
 	- Decode is order-passthrough when parsing maps (it does not sort, nor abort in error if unsorted data is encountered).
-	To be strict about the ordering of data, additional validation must be applied to the result of the Decode function.
 
 	- Decode will accept indeterminate length lists and maps without complaint.
-	(These should not be allowed according to the DAG-CBOR spec, nor will the Encode function re-emit such values,
-	so this behavior should almost certainly be seen as a bug.)
+	(These should not be allowed according to the DAG-CBOR spec, nor will the Encode function re-emit such values.)
 
 	- Decode does not consistently verify that ints and floats use the smallest representation possible (or, the 64-bit version, in the float case).
-	(Only these numeric encodings should be allowed according to the DAG-CBOR spec, and the Encode function will not re-emit variations,
-	so this behavior should almost certainly be seen as a bug.)
-
-	A note for future contributors: some functions in this package expose references to packages from the refmt module, and/or use them internally.
-	Please avoid adding new code which expands the visibility of these references.
-	In future work, we'd like to reduce or break this relationship entirely
-	(in part, to reduce dependency sprawl, and in part because several of
-	the imprecisions noted above stem from that library's lack of strictness).
+	(Only these numeric encodings should be allowed according to the DAG-CBOR spec, and the Encode function will not re-emit variations.)
+
+	All of these rules (and the spec's others) are enforced by Decode when the Strict field of DecodeOptions is set:
+	then, any data which isn't in canonical form is rejected, with a codec.ErrNotCanonical saying why,
+	and any data which is accepted will be re-encoded by Encode to exactly the same bytes.
 */
 package dagcbor
@@ -0,0 +1,126 @@
+package dagcbor
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+)
+
+// The emitter writes CBOR to an io.Writer.
+// It gathers small items in a buffer, and writes the buffer whenever it's full
+// (and strings or bytes too large to fit it, straight through), so that the writer sees few, large writes.
+// The caller must call flush when done.
+
+// flushSize is the size the emitter's buffer may reach before it's written out.
+const flushSize = 4096
+
+type emitter struct {
+	w       io.Writer
+	buf     []byte
+	scratch [128]byte // Initial storage for buf, so that small items don't need another allocation.
+}
+
+func newEmitter(w io.Writer) *emitter {
+	e := &emitter{w: w}
+	e.buf = e.scratch[:0]
+	return e
+}
+
+// flush writes out whatever is buffered.
+func (e *emitter) flush() error {
+	if len(e.buf) == 0 {
+		return nil
+	}
+	_, err := e.w.Write(e.buf)
+	e.buf = e.buf[:0]
+	return err
+}
+
+// maybeFlush flushes, if the buffer is full.
+func (e *emitter) maybeFlush() error {
+	if len(e.buf) >= flushSize {
+		return e.flush()
+	}
+	return nil
+}
+
+// appendHead appends the head of a data item, with the argument in its shortest form.
+func (e *emitter) appendHead(major byte, arg uint64) {
+	major <<= 5
+	switch {
+	case arg < infoUint8:
+		e.buf = append(e.buf, major|byte(arg))
+	case arg <= math.MaxUint8:
+		e.buf = append(e.buf, major|infoUint8, byte(arg))
+	case arg <= math.MaxUint16:
+		e.buf = append(e.buf, major|infoUint16, byte(arg>>8), byte(arg))
+	case arg <= math.MaxUint32:
+		e.buf = append(e.buf, major|infoUint32, 0, 0, 0, 0)
+		binary.BigEndian.PutUint32(e.buf[len(e.buf)-4:], uint32(arg))
+	default:
+		e.buf = append(e.buf, major|infoUint64, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(e.buf[len(e.buf)-8:], arg)
+	}
+}
+
+func (e *emitter) writeHead(major byte, arg uint64) error {
+	e.appendHead(major, arg)
+	return e.maybeFlush()
+}
+
+func (e *emitter) writeNull() error {
+	return e.writeHead(majorSimple, simpleNull)
+}
+
+func (e *emitter) writeBool(v bool) error {
+	if v {
+		return e.writeHead(majorSimple, simpleTrue)
+	}
+	return e.writeHead(majorSimple, simpleFalse)
+}
+
+func (e *emitter) writeInt(v int64) error {
+	if v < 0 {
+		return e.writeHead(majorNegInt, uint64(-(v + 1)))
+	}
+	return e.writeHead(majorUint, uint64(v))
+}
+
+// writeFloat writes a float, always in 64 bits.
+// (Smaller encodings would be possible for some values, but the DAG-CBOR spec asks for 64 bits only.)
+func (e *emitter) writeFloat(v float64) error {
+	e.buf = append(e.buf, majorSimple<<5|infoUint64, 0, 0, 0, 0, 0, 0, 0, 0)
+	binary.BigEndian.PutUint64(e.buf[len(e.buf)-8:], math.Float64bits(v))
+	return e.maybeFlush()
+}
+
+func (e *emitter) writeString(s string) error {
+	e.appendHead(majorString, uint64(len(s)))
+	if len(s) > flushSize {
+		if err := e.flush(); err != nil {
+			return err
+		}
+		_, err := io.WriteString(e.w, s)
+		return err
+	}
+	e.buf = append(e.buf, s...)
+	return e.maybeFlush()
+}
+
+func (e *emitter) writeBytes(b []byte) error {
+	e.appendHead(majorBytes, uint64(len(b)))
+	return e.writeRaw(b)
+}
+
+// writeRaw writes bytes as they are, with no head.
+func (e *emitter) writeRaw(b []byte) error {
+	if len(b) > flushSize {
+		if err := e.flush(); err != nil {
+			return err
+		}
+		_, err := e.w.Write(b)
+		return err
+	}
+	e.buf = append(e.buf, b...)
+	return e.maybeFlush()
+}
@@ -5,10 +5,6 @@ import (
 	"io"
 	"sort"
 
-	"github.com/polydawn/refmt/cbor"
-	"github.com/polydawn/refmt/shared"
-	"github.com/polydawn/refmt/tok"
-
 	"github.com/ipld/go-ipld-prime/codec"
 	"github.com/ipld/go-ipld-prime/datamodel"
 	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
@@ -27,6 +23,12 @@ type EncodeOptions struct {
 
 	// Control the sorting of map keys, using one of the `codec.MapSortMode_*` constants.
 	MapSortMode codec.MapSortMode
+
+	// LinkEncoder, if set, gives the bytes encoded in tag(42) for each link
+	// (after the leading zero byte, which is always present).
+	// If nil, only cidlink.Link is supported, and encoded as a binary CID.
+	// (This is how link implementations other than cidlink can be used with DAG-CBOR; see the linking/sha256link package for an example.)
+	LinkEncoder func(datamodel.Link) ([]byte, error)
 }
 
 // Encode walks the given datamodel.Node and serializes it to the given io.Writer.
@@ -38,41 +40,40 @@ func (cfg EncodeOptions) Encode(n datamodel.Node, w io.Writer) error {
 	type detectFastPath interface {
 		EncodeDagCbor(io.Writer) error
 	}
-	if n2, ok := n.(detectFastPath); ok {
+	if n2, ok := n.(detectFastPath); ok && cfg.LinkEncoder == nil {
 		return n2.EncodeDagCbor(w)
 	}
 	// Okay, generic inspection path.
-	return Marshal(n, cbor.NewEncoder(w), cfg)
+	return Marshal(n, w, cfg)
 }
 
-// Future work: we would like to remove the Marshal function,
-// and in particular, stop seeing types from refmt (like shared.TokenSink) be visible.
-// Right now, some kinds of configuration (e.g. for whitespace and prettyprint) are only available through interacting with the refmt types;
-// we should improve our API so that this can be done with only our own types in this package.
-
 // Marshal is a deprecated function.
 // Please consider switching to EncodeOptions.Encode instead.
-func Marshal(n datamodel.Node, sink shared.TokenSink, options EncodeOptions) error {
-	var tk tok.Token
-	return marshal(n, &tk, sink, options)
+//
+// Unlike Encode, Marshal has no fast paths.
+func Marshal(n datamodel.Node, w io.Writer, options EncodeOptions) error {
+	e := newEmitter(w)
+	if err := marshal(n, e, options); err != nil {
+		return err
+	}
+	return e.flush()
 }
 
-func marshal(n datamodel.Node, tk *tok.Token, sink shared.TokenSink, options EncodeOptions) error {
+func marshal(n datamodel.Node, e *emitter, options EncodeOptions) error {
 	switch n.Kind() {
 	case datamodel.Kind_Invalid:
 		return fmt.Errorf("cannot traverse a node that is absent")
 	case datamodel.Kind_Null:
-		tk.Type = tok.TNull
-		_, err := sink.Step(tk)
-		return err
+		return e.writeNull()
 	case datamodel.Kind_Map:
-		return marshalMap(n, tk, sink, options)
+		return marshalMap(n, e, options)
 	case datamodel.Kind_List:
 		// Emit start of list.
-		tk.Type = tok.TArrOpen
 		l := n.Length()
-		tk.Length = int(l) // TODO: overflow check
-		if _, err := sink.Step(tk); err != nil {
+		if l < 0 {
+			return fmt.Errorf("cannot Marshal a list of unknown length")
+		}
+		if err := e.writeHead(majorList, uint64(l)); err != nil {
 			return err
 		}
 		// Emit list contents (and recurse).
@@ -81,59 +82,41 @@ func marshal(n datamodel.Node, tk *tok.Token, sink shared.TokenSink, options Enc
 			if err != nil {
 				return err
 			}
-			if err := marshal(v, tk, sink, options); err != nil {
+			if err := marshal(v, e, options); err != nil {
 				return err
 			}
 		}
-		// Emit list close.
-		tk.Type = tok.TArrClose
-		_, err := sink.Step(tk)
-		return err
+		return nil
 	case datamodel.Kind_Bool:
 		v, err := n.AsBool()
 		if err != nil {
 			return err
 		}
-		tk.Type = tok.TBool
-		tk.Bool = v
-		_, err = sink.Step(tk)
-		return err
+		return e.writeBool(v)
 	case datamodel.Kind_Int:
 		v, err := n.AsInt()
 		if err != nil {
 			return err
 		}
-		tk.Type = tok.TInt
-		tk.Int = int64(v)
-		_, err = sink.Step(tk)
-		return err
+		return e.writeInt(v)
 	case datamodel.Kind_Float:
 		v, err := n.AsFloat()
 		if err != nil {
 			return err
 		}
-		tk.Type = tok.TFloat64
-		tk.Float64 = v
-		_, err = sink.Step(tk)
-		return err
+		return e.writeFloat(v)
 	case datamodel.Kind_String:
 		v, err := n.AsString()
 		if err != nil {
 			return err
 		}
-		tk.Type = tok.TString
-		tk.Str = v
-		_, err = sink.Step(tk)
-		return err
+		return e.writeString(v)
 	case datamodel.Kind_Bytes:
 		v, err := n.AsBytes()
 		if err != nil {
 			return err
 		}
-		tk.Type = tok.TBytes
-		tk.Bytes = v
-		_, err = sink.Step(tk)
-		return err
+		return e.writeBytes(v)
 	case datamodel.Kind_Link:
 		if !options.AllowLinks {
 			return fmt.Errorf("cannot Marshal ipld links to CBOR")
@@ -142,28 +125,33 @@ func marshal(n datamodel.Node, tk *tok.Token, sink shared.TokenSink, options Enc
 		if err != nil {
 			return err
 		}
-		switch lnk := v.(type) {
-		case cidlink.Link:
-			tk.Type = tok.TBytes
-			tk.Bytes = append([]byte{0}, lnk.Bytes()...)
-			tk.Tagged = true
-			tk.Tag = linkTag
-			_, err = sink.Step(tk)
-			tk.Tagged = false
-			return err
-		default:
+		var bs []byte
+		if options.LinkEncoder != nil {
+			if bs, err = options.LinkEncoder(v); err != nil {
+				return err
+			}
+		} else if lnk, ok := v.(cidlink.Link); ok {
+			bs = lnk.Bytes()
+		} else {
 			return fmt.Errorf("schemafree link emission only supported by this codec for CID type links")
 		}
+		// Tag 42, then the bytes, with a leading zero byte.
+		e.appendHead(majorTag, linkTag)
+		e.appendHead(majorBytes, uint64(len(bs)+1))
+		e.buf = append(e.buf, 0)
+		return e.writeRaw(bs)
 	default:
 		panic("unreachable")
 	}
 }
 
-func marshalMap(n datamodel.Node, tk *tok.Token, sink shared.TokenSink, options EncodeOptions) error {
+func marshalMap(n datamodel.Node, e *emitter, options EncodeOptions) error {
 	// Emit start of map.
-	tk.Type = tok.TMapOpen
-	tk.Length = int(n.Length()) // TODO: overflow check
-	if _, err := sink.Step(tk); err != nil {
+	l := n.Length()
+	if l < 0 {
+		return fmt.Errorf("cannot Marshal a map of unknown length")
+	}
+	if err := e.writeHead(majorMap, uint64(l)); err != nil {
 		return err
 	}
 	if options.MapSortMode != codec.MapSortMode_None {
@@ -172,7 +160,7 @@ func marshalMap(n datamodel.Node, tk *tok.Token, sink shared.TokenSink, options
 			key   string
 			value datamodel.Node
 		}
-		entries := []entry{}
+		entries := make([]entry, 0, l)
 		for itr := n.MapIterator(); !itr.Done(); {
 			k, v, err := itr.Next()
 			if err != nil {
@@ -201,38 +189,32 @@ func marshalMap(n datamodel.Node, tk *tok.Token, sink shared.TokenSink, options
 			})
 		}
 		// Emit map contents (and recurse).
-		for _, e := range entries {
-			tk.Type = tok.TString
-			tk.Str = e.key
-			if _, err := sink.Step(tk); err != nil {
+		for _, ent := range entries {
+			if err := e.writeString(ent.key); err != nil {
 				return err
 			}
-			if err := marshal(e.value, tk, sink, options); err != nil {
+			if err := marshal(ent.value, e, options); err != nil {
 				return err
 			}
 		}
-	} else { // no sorting
-		// Emit map contents (and recurse).
-		for itr := n.MapIterator(); !itr.Done(); {
-			k, v, err := itr.Next()
-			if err != nil {
-				return err
-			}
-			tk.Type = tok.TString
-			tk.Str, err = k.AsString()
-			if err != nil {
-				return err
-			}
-			if _, err := sink.Step(tk); err != nil {
-				return err
-			}
-			if err := marshal(v, tk, sink, options); err != nil {
-				return err
-			}
+		return nil
+	}
+	// no sorting: emit map contents (and recurse).
+	for itr := n.MapIterator(); !itr.Done(); {
+		k, v, err := itr.Next()
+		if err != nil {
+			return err
+		}
+		ks, err := k.AsString()
+		if err != nil {
+			return err
+		}
+		if err := e.writeString(ks); err != nil {
+			return err
+		}
+		if err := marshal(v, e, options); err != nil {
+			return err
 		}
 	}
-	// Emit map close.
-	tk.Type = tok.TMapClose
-	_, err := sink.Step(tk)
-	return err
+	return nil
 }
@@ -0,0 +1,184 @@
+package dagcbor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// The tokenizer reads CBOR from an io.Reader, one data item head at a time
+// (leaving it to the caller to read the content of strings and bytes, and to recurse into maps and lists).
+// It never reads any further than the end of the item being decoded,
+// so several items can be decoded from one reader in turn.
+
+// head is the initial byte of a data item, split into its major type and additional information,
+// together with the argument those give (for integers, the value; for strings, bytes, lists, and maps, the length; and for tags, the tag).
+// For major type 7, the argument is the bits of the float, or the simple value.
+type head struct {
+	major byte
+	info  byte
+	arg   uint64
+}
+
+func (h head) indefinite() bool { return h.info == infoIndefinite }
+func (h head) isBreak() bool    { return h.major == majorSimple && h.info == infoIndefinite }
+
+// largeRead is the size above which strings and bytes are read in pieces, rather than into a buffer allocated up front,
+// so that a corrupt length can't make us allocate much more memory than the data really holds.
+const largeRead = 1 << 16
+
+type tokenizer struct {
+	r       io.Reader
+	br      io.ByteReader // The reader, if it's also an io.ByteReader; otherwise nil.
+	scratch [8]byte
+	buf     []byte // Reused for reading strings, which are copied out of it.
+}
+
+func newTokenizer(r io.Reader) *tokenizer {
+	tz := &tokenizer{r: r}
+	tz.br, _ = r.(io.ByteReader)
+	return tz
+}
+
+// readByte reads one byte, returning io.EOF if there's none.
+func (tz *tokenizer) readByte() (byte, error) {
+	if tz.br != nil {
+		return tz.br.ReadByte()
+	}
+	_, err := io.ReadFull(tz.r, tz.scratch[:1])
+	return tz.scratch[0], err
+}
+
+// readHead reads the head of the next data item.
+// It returns io.EOF only if the data ends before the head starts.
+func (tz *tokenizer) readHead() (head, error) {
+	b, err := tz.readByte()
+	if err != nil {
+		return head{}, err
+	}
+	h := head{major: b >> 5, info: b & 0x1f}
+	var size int
+	switch {
+	case h.info < infoUint8:
+		h.arg = uint64(h.info)
+		return h, nil
+	case h.info == infoUint8:
+		size = 1
+	case h.info == infoUint16:
+		size = 2
+	case h.info == infoUint32:
+		size = 4
+	case h.info == infoUint64:
+		size = 8
+	case h.info == infoIndefinite:
+		switch h.major {
+		case majorBytes, majorString, majorList, majorMap, majorSimple:
+			return h, nil
+		}
+		return head{}, fmt.Errorf("invalid cbor: indefinite length for major type %d", h.major)
+	default:
+		return head{}, fmt.Errorf("invalid cbor: reserved additional information %d", h.info)
+	}
+	if _, err := io.ReadFull(tz.r, tz.scratch[:size]); err != nil {
+		return head{}, noEOF(err)
+	}
+	switch size {
+	case 1:
+		h.arg = uint64(tz.scratch[0])
+	case 2:
+		h.arg = uint64(binary.BigEndian.Uint16(tz.scratch[:2]))
+	case 4:
+		h.arg = uint64(binary.BigEndian.Uint32(tz.scratch[:4]))
+	case 8:
+		h.arg = binary.BigEndian.Uint64(tz.scratch[:8])
+	}
+	return h, nil
+}
+
+// readString reads n bytes of string content.
+func (tz *tokenizer) readString(n int) (string, error) {
+	if n > largeRead {
+		b, err := tz.readLarge(n)
+		return string(b), err
+	}
+	if cap(tz.buf) < n {
+		tz.buf = make([]byte, n)
+	}
+	tz.buf = tz.buf[:n]
+	if _, err := io.ReadFull(tz.r, tz.buf); err != nil {
+		return "", noEOF(err)
+	}
+	return string(tz.buf), nil
+}
+
+// readBytes reads n bytes, into a new slice.
+func (tz *tokenizer) readBytes(n int) ([]byte, error) {
+	if n > largeRead {
+		return tz.readLarge(n)
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(tz.r, b); err != nil {
+		return nil, noEOF(err)
+	}
+	return b, nil
+}
+
+// readLarge reads n bytes, growing its buffer as the data arrives.
+func (tz *tokenizer) readLarge(n int) ([]byte, error) {
+	var buf bytes.Buffer
+	if _, err := io.CopyN(&buf, tz.r, int64(n)); err != nil {
+		return nil, noEOF(err)
+	}
+	return buf.Bytes(), nil
+}
+
+// length converts a head's argument to a length, checking it fits in an int.
+func length(h head) (int, error) {
+	if h.arg > uint64(maxInt) {
+		return 0, fmt.Errorf("invalid cbor: length %d is too large", h.arg)
+	}
+	return int(h.arg), nil
+}
+
+// float gives the value of a float head (one of major type 7, with 2, 4, or 8 bytes of argument).
+func float(h head) float64 {
+	switch h.info {
+	case infoUint16:
+		return float16ToFloat64(uint16(h.arg))
+	case infoUint32:
+		return float64(math.Float32frombits(uint32(h.arg)))
+	default:
+		return math.Float64frombits(h.arg)
+	}
+}
+
+// float16ToFloat64 converts the bits of a half-precision float to a float64.
+func float16ToFloat64(bits uint16) float64 {
+	sign := 1.0
+	if bits&0x8000 != 0 {
+		sign = -1.0
+	}
+	exp := int(bits>>10) & 0x1f
+	frac := float64(bits & 0x3ff)
+	switch exp {
+	case 0: // Zero, and the subnormals.
+		return sign * math.Ldexp(frac, -24)
+	case 0x1f:
+		if frac == 0 {
+			return math.Inf(int(sign))
+		}
+		return math.NaN()
+	default:
+		return sign * math.Ldexp(frac+1024, exp-25)
+	}
+}
+
+// noEOF turns io.EOF into io.ErrUnexpectedEOF, for reads in the middle of an item.
+func noEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -1,23 +1,23 @@
 package dagcbor
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"math"
 
 	cid "github.com/ipfs/go-cid"
-	"github.com/polydawn/refmt/cbor"
-	"github.com/polydawn/refmt/shared"
-	"github.com/polydawn/refmt/tok"
 
+	"github.com/ipld/go-ipld-prime/codec"
 	"github.com/ipld/go-ipld-prime/datamodel"
 	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
 )
 
 var (
-	ErrInvalidMultibase         = errors.New("invalid multibase on IPLD link")
-	ErrAllocationBudgetExceeded = errors.New("message structure demanded too many resources to process")
+	ErrInvalidMultibase               = errors.New("invalid multibase on IPLD link")
+	ErrAllocationBudgetExceeded error = codec.ErrBudgetExhausted{Budget: codec.BudgetAllocation}
 )
 
 const (
@@ -26,7 +26,7 @@ const (
 )
 
 // This file should be identical to the general feature in the parent package,
-// except for the `case tok.TBytes` block,
+// except for the `case majorTag` block,
 // which has dag-cbor's special sauce for detecting schemafree links.
 
 // DecodeOptions can be used to customize the behavior of a decoding function.
@@ -34,6 +34,36 @@ const (
 type DecodeOptions struct {
 	// If true, parse DAG-CBOR tag(42) as Link nodes, otherwise reject them
 	AllowLinks bool
+
+	// AllocationBudget limits the memory the decoded data may demand, very roughly in bytes.
+	// If zero, codec.DefaultAllocationBudget is used; if negative, there's no limit.
+	// Exceeding it returns ErrAllocationBudgetExceeded (which is a codec.ErrBudgetExhausted).
+	AllocationBudget int
+
+	// MaxDepth limits how deeply maps and lists may be nested.
+	// If zero, there's no limit.
+	MaxDepth int
+
+	// MaxStringLength limits the length of any one string, bytes, or map key, in bytes.
+	// If zero, there's no limit.
+	// (This is checked before the string is read, so nothing is allocated for strings which are too long.)
+	MaxStringLength int
+
+	// LinkDecoder, if set, is used to parse the bytes in tag(42) into a link
+	// (after the leading zero byte, which is always checked for and removed).
+	// If nil, the bytes are parsed as a binary CID, giving a cidlink.Link.
+	LinkDecoder func([]byte) (datamodel.Link, error)
+
+	// Strict makes the decoder reject any data which isn't in the canonical form the DAG-CBOR spec requires,
+	// so that any data it accepts will be encoded by Encode to exactly the same bytes.
+	// That means rejecting map keys which aren't sorted (by length, then bytewise) or which are repeated,
+	// integers and lengths which aren't in their shortest form, integers outside the range of int64,
+	// floats which aren't 64 bits, NaN and infinities, indefinite-length items, tags other than 42,
+	// simple values other than true, false, and null, strings which aren't UTF-8, and data after the end of the item.
+	// These are reported as a codec.ErrNotCanonical, saying which rule was broken, and where.
+	//
+	// The whole of the data is read into memory and checked before any of it is decoded.
+	Strict bool
 }
 
 // Decode deserializes data from the given io.Reader and feeds it into the given datamodel.NodeAssembler.
@@ -41,60 +71,87 @@ type DecodeOptions struct {
 //
 // The behavior of the decoder can be customized by setting fields in the DecodeOptions struct before calling this method.
 func (cfg DecodeOptions) Decode(na datamodel.NodeAssembler, r io.Reader) error {
+	if cfg.Strict {
+		data, err := ioutil.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		if err := checkCanonical(data, cfg); err != nil {
+			return err
+		}
+		r = bytes.NewReader(data)
+	}
 	// Probe for a builtin fast path.  Shortcut to that if possible.
 	type detectFastPath interface {
 		DecodeDagCbor(io.Reader) error
 	}
-	if na2, ok := na.(detectFastPath); ok {
+	if na2, ok := na.(detectFastPath); ok && cfg.LinkDecoder == nil {
 		return na2.DecodeDagCbor(r)
 	}
 	// Okay, generic builder path.
-	return Unmarshal(na, cbor.NewDecoder(cbor.DecodeOptions{}, r), cfg)
+	return Unmarshal(na, r, cfg)
 }
 
-// Future work: we would like to remove the Unmarshal function,
-// and in particular, stop seeing types from refmt (like shared.TokenSource) be visible.
-// Right now, some kinds of configuration (e.g. for whitespace and prettyprint) are only available through interacting with the refmt types;
-// we should improve our API so that this can be done with only our own types in this package.
-
 // Unmarshal is a deprecated function.
 // Please consider switching to DecodeOptions.Decode instead.
-func Unmarshal(na datamodel.NodeAssembler, tokSrc shared.TokenSource, options DecodeOptions) error {
+//
+// Unlike Decode, Unmarshal has no fast paths, and ignores Strict.
+func Unmarshal(na datamodel.NodeAssembler, r io.Reader, options DecodeOptions) error {
 	// Have a gas budget, which will be decremented as we allocate memory, and an error returned when execeeded (or about to be exceeded).
 	//  This is a DoS defense mechanism.
 	//  It's *roughly* in units of bytes (but only very, VERY roughly) -- it also treats words as 1 in many cases.
-	// FUTURE: this ought be configurable somehow.  (How, and at what granularity though?)
-	var gas int = 1048576 * 10
-	return unmarshal1(na, tokSrc, &gas, options)
+	gas := options.AllocationBudget
+	if gas == 0 {
+		gas = codec.DefaultAllocationBudget
+	} else if gas < 0 {
+		gas = maxInt
+	}
+	return unmarshal1(na, newTokenizer(r), &gas, 0, options)
 }
 
-func unmarshal1(na datamodel.NodeAssembler, tokSrc shared.TokenSource, gas *int, options DecodeOptions) error {
-	var tk tok.Token
-	done, err := tokSrc.Step(&tk)
-	if err == io.EOF {
-		return io.ErrUnexpectedEOF
+const maxInt = int(^uint(0) >> 1)
+
+// checkString checks a string (or bytes, or map key) against the length limit, and charges it against the gas budget.
+// It's called before the string is read, so nothing is allocated for strings which are too long.
+func checkString(length int, gas *int, options DecodeOptions) error {
+	if options.MaxStringLength > 0 && length > options.MaxStringLength {
+		return codec.ErrBudgetExhausted{Budget: codec.BudgetStringLength}
 	}
-	if err != nil {
-		return err
+	*gas -= length
+	if *gas < 0 {
+		return ErrAllocationBudgetExceeded
 	}
-	if done && !tk.Type.IsValue() && tk.Type != tok.TNull {
-		return fmt.Errorf("unexpected eof")
+	return nil
+}
+
+// depth is the number of maps and lists enclosing the value being decoded.
+func unmarshal1(na datamodel.NodeAssembler, tz *tokenizer, gas *int, depth int, options DecodeOptions) error {
+	h, err := tz.readHead()
+	if err != nil {
+		return noEOF(err)
 	}
-	return unmarshal2(na, tokSrc, &tk, gas, options)
+	return unmarshal2(na, tz, h, gas, depth, options)
 }
 
-// starts with the first token already primed.  Necessary to get recursion
+// starts with the head of the item already read.  Necessary to get recursion
 //  to flow right without a peek+unpeek system.
-func unmarshal2(na datamodel.NodeAssembler, tokSrc shared.TokenSource, tk *tok.Token, gas *int, options DecodeOptions) error {
+func unmarshal2(na datamodel.NodeAssembler, tz *tokenizer, h head, gas *int, depth int, options DecodeOptions) error {
 	// FUTURE: check for schema.TypedNodeBuilder that's going to parse a Link (they can slurp any token kind they want).
-	switch tk.Type {
-	case tok.TMapOpen:
-		expectLen := tk.Length
-		allocLen := tk.Length
-		if tk.Length == -1 {
-			expectLen = math.MaxInt32
-			allocLen = 0
-		} else {
+	switch h.major {
+	case majorMap, majorList:
+		if options.MaxDepth > 0 && depth >= options.MaxDepth {
+			return codec.ErrBudgetExhausted{Budget: codec.BudgetDepth}
+		}
+	}
+	switch h.major {
+	case majorMap:
+		expectLen, allocLen := 0, 0
+		if !h.indefinite() {
+			n, err := length(h)
+			if err != nil {
+				return err
+			}
+			expectLen, allocLen = n, n
 			if *gas-allocLen < 0 { // halt early if this will clearly demand too many resources
 				return ErrAllocationBudgetExceeded
 			}
@@ -103,49 +160,43 @@ func unmarshal2(na datamodel.NodeAssembler, tokSrc shared.TokenSource, tk *tok.T
 		if err != nil {
 			return err
 		}
-		observedLen := 0
-		for {
-			_, err := tokSrc.Step(tk)
+		for observedLen := 0; h.indefinite() || observedLen < expectLen; observedLen++ {
+			kh, err := tz.readHead()
+			if err != nil {
+				return noEOF(err)
+			}
+			if h.indefinite() && kh.isBreak() {
+				break
+			}
+			if kh.major != majorString {
+				return fmt.Errorf("unexpected %s while expecting map key", describe(kh))
+			}
+			k, err := readString(tz, kh, gas, options)
 			if err != nil {
 				return err
 			}
-			switch tk.Type {
-			case tok.TMapClose:
-				if expectLen != math.MaxInt32 && observedLen != expectLen {
-					return fmt.Errorf("unexpected mapClose before declared length")
-				}
-				return ma.Finish()
-			case tok.TString:
-				*gas -= len(tk.Str) + mapEntryGasScore
-				if *gas < 0 {
-					return ErrAllocationBudgetExceeded
-				}
-				// continue
-			default:
-				return fmt.Errorf("unexpected %s token while expecting map key", tk.Type)
-			}
-			observedLen++
-			if observedLen > expectLen {
-				return fmt.Errorf("unexpected continuation of map elements beyond declared length")
-			}
-			mva, err := ma.AssembleEntry(tk.Str)
+			*gas -= mapEntryGasScore
+			if *gas < 0 {
+				return ErrAllocationBudgetExceeded
+			}
+			mva, err := ma.AssembleEntry(k)
 			if err != nil { // return in error if the key was rejected
 				return err
 			}
-			err = unmarshal1(mva, tokSrc, gas, options)
+			err = unmarshal1(mva, tz, gas, depth+1, options)
 			if err != nil { // return in error if some part of the recursion errored
 				return err
 			}
 		}
-	case tok.TMapClose:
-		return fmt.Errorf("unexpected mapClose token")
-	case tok.TArrOpen:
-		expectLen := tk.Length
-		allocLen := tk.Length
-		if tk.Length == -1 {
-			expectLen = math.MaxInt32
-			allocLen = 0
-		} else {
+		return ma.Finish()
+	case majorList:
+		expectLen, allocLen := 0, 0
+		if !h.indefinite() {
+			n, err := length(h)
+			if err != nil {
+				return err
+			}
+			expectLen, allocLen = n, n
 			if *gas-allocLen < 0 { // halt early if this will clearly demand too many resources
 				return ErrAllocationBudgetExceeded
 			}
@@ -154,92 +205,198 @@ func unmarshal2(na datamodel.NodeAssembler, tokSrc shared.TokenSource, tk *tok.T
 		if err != nil {
 			return err
 		}
-		observedLen := 0
-		for {
-			_, err := tokSrc.Step(tk)
+		for observedLen := 0; h.indefinite() || observedLen < expectLen; observedLen++ {
+			vh, err := tz.readHead()
 			if err != nil {
+				return noEOF(err)
+			}
+			if h.indefinite() && vh.isBreak() {
+				break
+			}
+			*gas -= listEntryGasScore
+			if *gas < 0 {
+				return ErrAllocationBudgetExceeded
+			}
+			err = unmarshal2(la.AssembleValue(), tz, vh, gas, depth+1, options)
+			if err != nil { // return in error if some part of the recursion errored
 				return err
 			}
-			switch tk.Type {
-			case tok.TArrClose:
-				if expectLen != math.MaxInt32 && observedLen != expectLen {
-					return fmt.Errorf("unexpected arrClose before declared length")
-				}
-				return la.Finish()
-			default:
-				*gas -= listEntryGasScore
-				if *gas < 0 {
-					return ErrAllocationBudgetExceeded
-				}
-				observedLen++
-				if observedLen > expectLen {
-					return fmt.Errorf("unexpected continuation of array elements beyond declared length")
-				}
-				err := unmarshal2(la.AssembleValue(), tokSrc, tk, gas, options)
-				if err != nil { // return in error if some part of the recursion errored
-					return err
-				}
-			}
-		}
-	case tok.TArrClose:
-		return fmt.Errorf("unexpected arrClose token")
-	case tok.TNull:
-		return na.AssignNull()
-	case tok.TString:
-		*gas -= len(tk.Str)
-		if *gas < 0 {
-			return ErrAllocationBudgetExceeded
 		}
-		return na.AssignString(tk.Str)
-	case tok.TBytes:
-		*gas -= len(tk.Bytes)
-		if *gas < 0 {
-			return ErrAllocationBudgetExceeded
+		return la.Finish()
+	case majorString:
+		s, err := readString(tz, h, gas, options)
+		if err != nil {
+			return err
 		}
-		if !tk.Tagged {
-			return na.AssignBytes(tk.Bytes)
+		return na.AssignString(s)
+	case majorBytes:
+		bs, err := readBytes(tz, h, gas, options)
+		if err != nil {
+			return err
 		}
-		switch tk.Tag {
-		case linkTag:
-			if !options.AllowLinks {
-				return fmt.Errorf("unhandled cbor tag %d", tk.Tag)
-			}
-			if len(tk.Bytes) < 1 || tk.Bytes[0] != 0 {
-				return ErrInvalidMultibase
-			}
-			elCid, err := cid.Cast(tk.Bytes[1:])
+		return na.AssignBytes(bs)
+	case majorTag:
+		th, err := tz.readHead()
+		if err != nil {
+			return noEOF(err)
+		}
+		if th.major == majorTag {
+			return fmt.Errorf("unsupported multiple tags on a single data item")
+		}
+		if th.major != majorBytes {
+			// Tags on anything but bytes have always been ignored; only Strict rejects them.
+			return unmarshal2(na, tz, th, gas, depth, options)
+		}
+		if h.arg != linkTag || !options.AllowLinks {
+			return fmt.Errorf("unhandled cbor tag %d", h.arg)
+		}
+		bs, err := readBytes(tz, th, gas, options)
+		if err != nil {
+			return err
+		}
+		if len(bs) < 1 || bs[0] != 0 {
+			return ErrInvalidMultibase
+		}
+		if options.LinkDecoder != nil {
+			lnk, err := options.LinkDecoder(bs[1:])
 			if err != nil {
 				return err
 			}
-			return na.AssignLink(cidlink.Link{Cid: elCid})
-		default:
-			return fmt.Errorf("unhandled cbor tag %d", tk.Tag)
+			return na.AssignLink(lnk)
 		}
-	case tok.TBool:
-		*gas -= 1
-		if *gas < 0 {
-			return ErrAllocationBudgetExceeded
+		elCid, err := cid.Cast(bs[1:])
+		if err != nil {
+			return err
 		}
-		return na.AssignBool(tk.Bool)
-	case tok.TInt:
+		return na.AssignLink(cidlink.Link{Cid: elCid})
+	case majorUint:
 		*gas -= 1
 		if *gas < 0 {
 			return ErrAllocationBudgetExceeded
 		}
-		return na.AssignInt(tk.Int)
-	case tok.TUint:
-		*gas -= 1
-		if *gas < 0 {
-			return ErrAllocationBudgetExceeded
+		if h.arg > math.MaxInt64 {
+			return fmt.Errorf("cbor: positive integer %d out of range of int64 type", h.arg)
 		}
-		return na.AssignInt(int64(tk.Uint)) // FIXME overflow check
-	case tok.TFloat64:
+		return na.AssignInt(int64(h.arg))
+	case majorNegInt:
 		*gas -= 1
 		if *gas < 0 {
 			return ErrAllocationBudgetExceeded
 		}
-		return na.AssignFloat(tk.Float64)
-	default:
-		panic("unreachable")
+		if h.arg > math.MaxInt64 {
+			return fmt.Errorf("cbor: negative integer out of range of int64 type")
+		}
+		return na.AssignInt(-1 - int64(h.arg))
+	case majorSimple:
+		switch h.info {
+		case simpleNull:
+			return na.AssignNull()
+		case simpleFalse, simpleTrue:
+			*gas -= 1
+			if *gas < 0 {
+				return ErrAllocationBudgetExceeded
+			}
+			return na.AssignBool(h.info == simpleTrue)
+		case infoUint16, infoUint32, infoUint64:
+			*gas -= 1
+			if *gas < 0 {
+				return ErrAllocationBudgetExceeded
+			}
+			return na.AssignFloat(float(h))
+		}
+	}
+	return fmt.Errorf("unexpected %s", describe(h))
+}
+
+// readString reads the content of a string whose head has been read, checking it against the limits first.
+func readString(tz *tokenizer, h head, gas *int, options DecodeOptions) (string, error) {
+	if h.indefinite() {
+		bs, err := readChunks(tz, h, gas, options)
+		return string(bs), err
+	}
+	n, err := length(h)
+	if err != nil {
+		return "", err
+	}
+	if err := checkString(n, gas, options); err != nil {
+		return "", err
+	}
+	return tz.readString(n)
+}
+
+// readBytes reads the content of bytes whose head has been read, checking it against the limits first.
+func readBytes(tz *tokenizer, h head, gas *int, options DecodeOptions) ([]byte, error) {
+	if h.indefinite() {
+		return readChunks(tz, h, gas, options)
+	}
+	n, err := length(h)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkString(n, gas, options); err != nil {
+		return nil, err
+	}
+	return tz.readBytes(n)
+}
+
+// readChunks reads the content of indefinite-length bytes or string, which comes in definite-length chunks of the same major type.
+// The total length is checked against the limits as the chunks are read.
+func readChunks(tz *tokenizer, h head, gas *int, options DecodeOptions) ([]byte, error) {
+	var bs []byte
+	for {
+		ch, err := tz.readHead()
+		if err != nil {
+			return nil, noEOF(err)
+		}
+		if ch.isBreak() {
+			return bs, nil
+		}
+		if ch.major != h.major || ch.indefinite() {
+			return nil, fmt.Errorf("unexpected %s in indefinite-length %s", describe(ch), describe(h))
+		}
+		n, err := length(ch)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkString(len(bs)+n, gas, options); err != nil {
+			return nil, err
+		}
+		*gas += len(bs) // Only this chunk is newly charged; the ones before it already were.
+		chunk, err := tz.readBytes(n)
+		if err != nil {
+			return nil, err
+		}
+		bs = append(bs, chunk...)
+	}
+}
+
+// describe names the kind of item a head starts, for error messages.
+func describe(h head) string {
+	switch h.major {
+	case majorUint, majorNegInt:
+		return "int"
+	case majorBytes:
+		return "bytes"
+	case majorString:
+		return "string"
+	case majorList:
+		return "list"
+	case majorMap:
+		return "map"
+	case majorTag:
+		return "tag"
+	}
+	switch h.info {
+	case simpleFalse, simpleTrue:
+		return "bool"
+	case simpleNull:
+		return "null"
+	case simpleUndefined:
+		return "undefined"
+	case infoUint16, infoUint32, infoUint64:
+		return "float"
+	case infoIndefinite:
+		return "break"
 	}
+	return fmt.Sprintf("simple value %d", h.arg)
 }
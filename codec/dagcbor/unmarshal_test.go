@@ -1,11 +1,14 @@
 package dagcbor
 
 import (
+	"bytes"
+	"encoding/hex"
 	"strings"
 	"testing"
 
 	. "github.com/warpfork/go-wish"
 
+	"github.com/ipld/go-ipld-prime/codec"
 	"github.com/ipld/go-ipld-prime/node/basicnode"
 )
 
@@ -39,3 +42,146 @@ func TestFunBlocks(t *testing.T) {
 		Require(t, err, ShouldEqual, ErrAllocationBudgetExceeded)
 	})
 }
+
+func TestDecodeBudgets(t *testing.T) {
+	decode := func(opts DecodeOptions) error {
+		return opts.Decode(basicnode.Prototype.Any.NewBuilder(), strings.NewReader(serial))
+	}
+
+	t.Run("within limits", func(t *testing.T) {
+		Wish(t, decode(DecodeOptions{AllocationBudget: 200, MaxDepth: 3, MaxStringLength: 11}), ShouldEqual, nil)
+	})
+	t.Run("no allocation limit", func(t *testing.T) {
+		Wish(t, decode(DecodeOptions{AllocationBudget: -1}), ShouldEqual, nil)
+	})
+	t.Run("allocation", func(t *testing.T) {
+		err := decode(DecodeOptions{AllocationBudget: 20})
+		Wish(t, err, ShouldEqual, ErrAllocationBudgetExceeded)
+		Wish(t, err, ShouldEqual, codec.ErrBudgetExhausted{Budget: codec.BudgetAllocation})
+	})
+	t.Run("depth", func(t *testing.T) {
+		Wish(t, decode(DecodeOptions{MaxDepth: 2}), ShouldEqual, codec.ErrBudgetExhausted{Budget: codec.BudgetDepth})
+	})
+	t.Run("string length", func(t *testing.T) {
+		Wish(t, decode(DecodeOptions{MaxStringLength: 10}), ShouldEqual, codec.ErrBudgetExhausted{Budget: codec.BudgetStringLength})
+	})
+}
+
+func TestDecodeStrict(t *testing.T) {
+	decode := func(hexData string) error {
+		data, err := hex.DecodeString(hexData)
+		Require(t, err, ShouldEqual, nil)
+		nb := basicnode.Prototype.Any.NewBuilder()
+		return DecodeOptions{AllowLinks: true, Strict: true}.Decode(nb, bytes.NewReader(data))
+	}
+	t.Run("canonical data roundtrips", func(t *testing.T) {
+		for _, fixture := range []string{
+			"a3616101626262f5636363638218ff3903e7", // {"a":1,"bb":true,"ccc":[255,-1000]}
+			"a26161fb3ff8000000000000616282d82a58230012200000000000000000000000000000000000000000000000000000000000000000f6", // {"a":1.5,"b":[link,null]}
+			"1b7fffffffffffffff", // max int64
+			"3b7fffffffffffffff", // min int64
+			"6668c3a96c6c6f",     // "héllo"
+		} {
+			data, _ := hex.DecodeString(fixture)
+			nb := basicnode.Prototype.Any.NewBuilder()
+			err := DecodeOptions{AllowLinks: true, Strict: true}.Decode(nb, bytes.NewReader(data))
+			Require(t, err, ShouldEqual, nil)
+			var buf bytes.Buffer
+			Require(t, Encode(nb.Build(), &buf), ShouldEqual, nil)
+			Wish(t, hex.EncodeToString(buf.Bytes()), ShouldEqual, fixture)
+		}
+	})
+	for _, tc := range []struct {
+		name   string
+		data   string
+		offset int64
+		reason codec.NonCanonical
+	}{
+		{"unsorted keys", "a2616201616101", 4, codec.NonCanonicalMapKeyOrder},
+		{"longer key first", "a262626201616100", 5, codec.NonCanonicalMapKeyOrder},
+		{"duplicate keys", "a2616101616102", 4, codec.NonCanonicalDuplicateMapKey},
+		{"non-minimal int", "1817", 0, codec.NonCanonicalInteger},
+		{"non-minimal int, two bytes", "1900ff", 0, codec.NonCanonicalInteger},
+		{"non-minimal length", "780161", 0, codec.NonCanonicalInteger},
+		{"int beyond int64", "1b8000000000000000", 0, codec.NonCanonicalIntegerRange},
+		{"negative int beyond int64", "3b8000000000000000", 0, codec.NonCanonicalIntegerRange},
+		{"half float", "f93c00", 0, codec.NonCanonicalFloat},
+		{"single float", "fa3f800000", 0, codec.NonCanonicalFloat},
+		{"NaN", "fb7ff8000000000000", 0, codec.NonCanonicalFloatSpecial},
+		{"infinity", "fbfff0000000000000", 0, codec.NonCanonicalFloatSpecial},
+		{"indefinite list", "9f01ff", 0, codec.NonCanonicalIndefiniteLength},
+		{"indefinite map, nested", "81bf6161ff", 1, codec.NonCanonicalIndefiniteLength},
+		{"other tag", "c11a00000000", 0, codec.NonCanonicalTag},
+		{"tag 42 on a string", "d82a6161", 0, codec.NonCanonicalTag},
+		{"undefined", "f7", 0, codec.NonCanonicalSimpleValue},
+		{"invalid utf-8", "62c328", 0, codec.NonCanonicalString},
+		{"trailing data", "0101", 1, codec.NonCanonicalTrailingData},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			Wish(t, decode(tc.data), ShouldEqual, codec.ErrNotCanonical{Offset: tc.offset, Reason: tc.reason})
+		})
+	}
+	t.Run("non-strict decoding is lenient", func(t *testing.T) {
+		data, _ := hex.DecodeString("a2616201616101")
+		Wish(t, Decode(basicnode.Prototype.Any.NewBuilder(), bytes.NewReader(data)), ShouldEqual, nil)
+	})
+}
+
+func TestDecodeLenient(t *testing.T) {
+	// Without Strict, data that isn't in canonical form is still accepted, and reads as its canonical equivalent.
+	for _, tc := range []struct {
+		name      string
+		data      string
+		canonical string
+	}{
+		{"half float", "f93c00", "fb3ff0000000000000"},
+		{"half float, subnormal", "f90001", "fb3e70000000000000"},
+		{"single float", "fa3f800000", "fb3ff0000000000000"},
+		{"non-minimal int", "1900ff", "18ff"},
+		{"indefinite string", "7f6161626263ff", "63616263"},
+		{"indefinite bytes", "5f41014102ff", "420102"},
+		{"indefinite list", "9f01029f03ffff", "8301028103"},
+		{"indefinite map", "bf616101ff", "a1616101"},
+		{"tag on an int", "c11a00000000", "00"},
+		{"unsorted keys", "a2616201616101", "a2616101616201"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			data, _ := hex.DecodeString(tc.data)
+			nb := basicnode.Prototype.Any.NewBuilder()
+			Require(t, Decode(nb, bytes.NewReader(data)), ShouldEqual, nil)
+			var buf bytes.Buffer
+			Require(t, Encode(nb.Build(), &buf), ShouldEqual, nil)
+			Wish(t, hex.EncodeToString(buf.Bytes()), ShouldEqual, tc.canonical)
+		})
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		data string
+		err  string
+	}{
+		{"empty", "", "unexpected EOF"},
+		{"truncated head", "19ff", "unexpected EOF"},
+		{"truncated string", "6361", "unexpected EOF"},
+		{"truncated map", "a16161", "unexpected EOF"},
+		{"int beyond int64", "1b8000000000000000", "cbor: positive integer 9223372036854775808 out of range of int64 type"},
+		{"undefined", "f7", "unexpected undefined"},
+		{"two tags", "c1c100", "unsupported multiple tags on a single data item"},
+		{"mixed chunks", "7f4161ff", "unexpected bytes in indefinite-length string"},
+		{"unknown tag on bytes", "d82b4100", "unhandled cbor tag 43"},
+		{"non-string key", "a10101", "unexpected int while expecting map key"},
+		{"reserved additional information", "1c", "invalid cbor: reserved additional information 28"},
+		{"stray break", "ff", "unexpected break"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			data, _ := hex.DecodeString(tc.data)
+			err := DecodeOptions{AllowLinks: true}.Decode(basicnode.Prototype.Any.NewBuilder(), bytes.NewReader(data))
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			Wish(t, err.Error(), ShouldEqual, tc.err)
+		})
+	}
+}
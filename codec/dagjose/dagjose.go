@@ -0,0 +1,264 @@
+package dagjose
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+
+	cid "github.com/ipfs/go-cid"
+
+	"github.com/ipld/go-ipld-prime/codec/dagcbor"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+)
+
+// b64 is the base64url encoding JOSE uses: without padding, and (here) rejecting non-canonical trailing bits,
+// so that decoding and re-encoding any block gives back the same bytes.
+var b64 = base64.RawURLEncoding.Strict()
+
+// fieldKind says how a field of a JOSE object differs between the encoded and decoded forms.
+type fieldKind uint8
+
+const (
+	kindBytes fieldKind = iota // Bytes when encoded, base64url strings when decoded.
+	kindMap                    // The same in both forms.  (These are JOSE headers.)
+	kindList                   // Lists of objects with the fields given by elem.
+)
+
+type field struct {
+	kind     fieldKind
+	required bool
+	elem     fields
+}
+
+type fields map[string]field
+
+var (
+	jwsFields = fields{
+		"payload":    {kind: kindBytes, required: true},
+		"signatures": {kind: kindList, required: true, elem: signatureFields},
+	}
+	signatureFields = fields{
+		"header":    {kind: kindMap},
+		"protected": {kind: kindBytes},
+		"signature": {kind: kindBytes, required: true},
+	}
+	jweFields = fields{
+		"aad":         {kind: kindBytes},
+		"ciphertext":  {kind: kindBytes, required: true},
+		"iv":          {kind: kindBytes},
+		"protected":   {kind: kindBytes},
+		"recipients":  {kind: kindList, elem: recipientFields},
+		"tag":         {kind: kindBytes},
+		"unprotected": {kind: kindMap},
+	}
+	recipientFields = fields{
+		"encrypted_key": {kind: kindBytes},
+		"header":        {kind: kindMap},
+	}
+)
+
+// Decode deserializes a DAG-JOSE block from the given io.Reader and feeds it into the given datamodel.NodeAssembler,
+// in the decoded form described in the package documentation.
+// Decode fits the codec.Decoder function interface.
+func Decode(na datamodel.NodeAssembler, r io.Reader) error {
+	nb := basicnode.Prototype.Any.NewBuilder()
+	if err := dagcbor.Decode(nb, r); err != nil {
+		return err
+	}
+	n := nb.Build()
+	jws, err := isJWS(n)
+	if err != nil {
+		return err
+	}
+	ma, err := na.BeginMap(n.Length() + 1)
+	if err != nil {
+		return err
+	}
+	if !jws {
+		if err := convertMap(ma, n, jweFields, true, ""); err != nil {
+			return err
+		}
+		return ma.Finish()
+	}
+	if err := convertMap(ma, n, jwsFields, true, ""); err != nil {
+		return err
+	}
+	payload, _ := n.LookupByString("payload")
+	data, _ := payload.AsBytes()
+	c, err := cid.Cast(data)
+	if err != nil {
+		return fmt.Errorf("dagjose: JWS payload is not a CID: %w", err)
+	}
+	va, err := ma.AssembleEntry("link")
+	if err != nil {
+		return err
+	}
+	if err := va.AssignLink(cidlink.Link{Cid: c}); err != nil {
+		return err
+	}
+	return ma.Finish()
+}
+
+// Encode serializes a JWS or JWE, in the decoded form described in the package documentation, to the given io.Writer.
+// Encode fits the codec.Encoder function interface.
+func Encode(n datamodel.Node, w io.Writer) error {
+	jws, err := isJWS(n)
+	if err != nil {
+		return err
+	}
+	nb := basicnode.Prototype.Any.NewBuilder()
+	ma, err := nb.BeginMap(n.Length())
+	if err != nil {
+		return err
+	}
+	if !jws {
+		err = convertMap(ma, n, jweFields, false, "")
+	} else if err = convertMap(ma, n, jwsFields, false, "link"); err == nil {
+		err = checkLink(n)
+	}
+	if err != nil {
+		return err
+	}
+	if err := ma.Finish(); err != nil {
+		return err
+	}
+	return dagcbor.Encode(nb.Build(), w)
+}
+
+// isJWS says whether a JOSE object (in either form) is a JWS, or else a JWE.
+func isJWS(n datamodel.Node) (bool, error) {
+	if n.Kind() != datamodel.Kind_Map {
+		return false, fmt.Errorf("dagjose: JOSE object must be a map, not %s", n.Kind())
+	}
+	_, errPayload := n.LookupByString("payload")
+	_, errCiphertext := n.LookupByString("ciphertext")
+	switch {
+	case errPayload == nil && errCiphertext != nil:
+		return true, nil
+	case errPayload != nil && errCiphertext == nil:
+		return false, nil
+	default:
+		return false, fmt.Errorf("dagjose: JOSE object must have exactly one of payload (for a JWS) or ciphertext (for a JWE)")
+	}
+}
+
+// checkLink checks that the link in a decoded JWS, if there is one, is the CID in its payload,
+// and that there is a CID in its payload.
+func checkLink(n datamodel.Node) error {
+	payload, _ := n.LookupByString("payload")
+	s, _ := payload.AsString()
+	data, _ := b64.DecodeString(s)
+	c, err := cid.Cast(data)
+	if err != nil {
+		return fmt.Errorf("dagjose: JWS payload is not a CID: %w", err)
+	}
+	ln, err := n.LookupByString("link")
+	if err != nil {
+		return nil
+	}
+	lnk, err := ln.AsLink()
+	if err != nil {
+		return fmt.Errorf("dagjose: JWS link must be a link: %w", err)
+	}
+	if lnk.String() != c.String() {
+		return fmt.Errorf("dagjose: JWS link %s does not match its payload, %s", lnk, c)
+	}
+	return nil
+}
+
+// convertMap copies the entries of n, a JOSE object with the given fields, into ma,
+// converting its bytes fields to base64url strings (if decoding) or back (if not).
+// The field named by ignore (if any) is skipped.
+func convertMap(ma datamodel.MapAssembler, n datamodel.Node, fs fields, decoding bool, ignore string) error {
+	seen := make(map[string]bool, len(fs))
+	for itr := n.MapIterator(); !itr.Done(); {
+		k, v, err := itr.Next()
+		if err != nil {
+			return err
+		}
+		ks, err := k.AsString()
+		if err != nil {
+			return err
+		}
+		if ks == ignore {
+			continue
+		}
+		f, ok := fs[ks]
+		if !ok {
+			return fmt.Errorf("dagjose: unknown field %q", ks)
+		}
+		seen[ks] = true
+		va, err := ma.AssembleEntry(ks)
+		if err != nil {
+			return err
+		}
+		if err := convertField(va, v, f, decoding); err != nil {
+			return fmt.Errorf("dagjose: field %q: %w", ks, err)
+		}
+	}
+	for name, f := range fs {
+		if f.required && !seen[name] {
+			return fmt.Errorf("dagjose: missing required field %q", name)
+		}
+	}
+	return nil
+}
+
+func convertField(na datamodel.NodeAssembler, v datamodel.Node, f field, decoding bool) error {
+	switch f.kind {
+	case kindBytes:
+		if decoding {
+			data, err := v.AsBytes()
+			if err != nil {
+				return err
+			}
+			return na.AssignString(b64.EncodeToString(data))
+		}
+		s, err := v.AsString()
+		if err != nil {
+			return err
+		}
+		data, err := b64.DecodeString(s)
+		if err != nil {
+			return fmt.Errorf("not base64url: %w", err)
+		}
+		return na.AssignBytes(data)
+	case kindMap:
+		if v.Kind() != datamodel.Kind_Map {
+			return fmt.Errorf("must be a map, not %s", v.Kind())
+		}
+		return na.AssignNode(v)
+	case kindList:
+		if v.Kind() != datamodel.Kind_List {
+			return fmt.Errorf("must be a list, not %s", v.Kind())
+		}
+		la, err := na.BeginList(v.Length())
+		if err != nil {
+			return err
+		}
+		for itr := v.ListIterator(); !itr.Done(); {
+			_, elem, err := itr.Next()
+			if err != nil {
+				return err
+			}
+			if elem.Kind() != datamodel.Kind_Map {
+				return fmt.Errorf("entries must be maps, not %s", elem.Kind())
+			}
+			ma, err := la.AssembleValue().BeginMap(elem.Length())
+			if err != nil {
+				return err
+			}
+			if err := convertMap(ma, elem, f.elem, decoding, ""); err != nil {
+				return err
+			}
+			if err := ma.Finish(); err != nil {
+				return err
+			}
+		}
+		return la.Finish()
+	default:
+		panic("unreachable")
+	}
+}
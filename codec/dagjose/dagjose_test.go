@@ -0,0 +1,224 @@
+package dagjose_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+	cid "github.com/ipfs/go-cid"
+
+	"github.com/ipld/go-ipld-prime/codec/dagcbor"
+	"github.com/ipld/go-ipld-prime/codec/dagjose"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/fluent/qp"
+	"github.com/ipld/go-ipld-prime/linking"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	"github.com/ipld/go-ipld-prime/storage"
+)
+
+var b64 = base64.RawURLEncoding
+
+func payloadCid(t *testing.T) cid.Cid {
+	c, err := cid.Prefix{Version: 1, Codec: 0x71, MhType: 0x12, MhLength: 32}.Sum([]byte("payload"))
+	qt.Assert(t, err, qt.IsNil)
+	return c
+}
+
+func build(t *testing.T, fn func(datamodel.MapAssembler)) datamodel.Node {
+	n, err := qp.BuildMap(basicnode.Prototype.Any, -1, fn)
+	qt.Assert(t, err, qt.IsNil)
+	return n
+}
+
+func decode(t *testing.T, data []byte) (datamodel.Node, error) {
+	nb := basicnode.Prototype.Any.NewBuilder()
+	if err := dagjose.Decode(nb, bytes.NewReader(data)); err != nil {
+		return nil, err
+	}
+	return nb.Build(), nil
+}
+
+func encode(t *testing.T, n datamodel.Node) []byte {
+	var buf bytes.Buffer
+	qt.Assert(t, dagjose.Encode(n, &buf), qt.IsNil)
+	return buf.Bytes()
+}
+
+func TestJWSRoundtrip(t *testing.T) {
+	c := payloadCid(t)
+	jws := build(t, func(ma datamodel.MapAssembler) {
+		qp.MapEntry(ma, "payload", qp.String(b64.EncodeToString(c.Bytes())))
+		qp.MapEntry(ma, "signatures", qp.List(1, func(la datamodel.ListAssembler) {
+			qp.ListEntry(la, qp.Map(3, func(ma datamodel.MapAssembler) {
+				qp.MapEntry(ma, "header", qp.Map(1, func(ma datamodel.MapAssembler) {
+					qp.MapEntry(ma, "kid", qp.String("key-1"))
+				}))
+				qp.MapEntry(ma, "protected", qp.String(b64.EncodeToString([]byte(`{"alg":"EdDSA"}`))))
+				qp.MapEntry(ma, "signature", qp.String(b64.EncodeToString([]byte{1, 2, 3})))
+			}))
+		}))
+		qp.MapEntry(ma, "link", qp.Link(cidlink.Link{Cid: c}))
+	})
+	encoded := encode(t, jws)
+
+	// The encoded form is dag-cbor, with bytes, and without the link.
+	nb := basicnode.Prototype.Any.NewBuilder()
+	qt.Assert(t, dagcbor.Decode(nb, bytes.NewReader(encoded)), qt.IsNil)
+	raw := nb.Build()
+	payload, err := raw.LookupByString("payload")
+	qt.Assert(t, err, qt.IsNil)
+	payloadBytes, err := payload.AsBytes()
+	qt.Assert(t, err, qt.IsNil)
+	qt.Check(t, payloadBytes, qt.DeepEquals, c.Bytes())
+	_, err = raw.LookupByString("link")
+	qt.Check(t, err, qt.Not(qt.IsNil))
+
+	decoded, err := decode(t, encoded)
+	qt.Assert(t, err, qt.IsNil)
+	ln, err := decoded.LookupByString("link")
+	qt.Assert(t, err, qt.IsNil)
+	lnk, err := ln.AsLink()
+	qt.Assert(t, err, qt.IsNil)
+	qt.Check(t, lnk, qt.Equals, cidlink.Link{Cid: c})
+	sig, err := decoded.LookupBySegment(datamodel.PathSegmentOfString("signatures"))
+	qt.Assert(t, err, qt.IsNil)
+	sig0, err := sig.LookupByIndex(0)
+	qt.Assert(t, err, qt.IsNil)
+	kid, err := traverseString(sig0, "header", "kid")
+	qt.Assert(t, err, qt.IsNil)
+	qt.Check(t, kid, qt.Equals, "key-1")
+
+	// Re-encoding gives the same bytes; and the link is optional when encoding.
+	qt.Check(t, encode(t, decoded), qt.DeepEquals, encoded)
+	withoutLink := build(t, func(ma datamodel.MapAssembler) {
+		for itr := jws.MapIterator(); !itr.Done(); {
+			k, v, _ := itr.Next()
+			if ks, _ := k.AsString(); ks != "link" {
+				qp.MapEntry(ma, ks, qp.Node(v))
+			}
+		}
+	})
+	qt.Check(t, encode(t, withoutLink), qt.DeepEquals, encoded)
+}
+
+func traverseString(n datamodel.Node, keys ...string) (string, error) {
+	for _, k := range keys {
+		var err error
+		if n, err = n.LookupByString(k); err != nil {
+			return "", err
+		}
+	}
+	return n.AsString()
+}
+
+func TestJWERoundtrip(t *testing.T) {
+	// The entries are in the order dag-cbor sorts them in, which Decode will produce them in too.
+	jwe := build(t, func(ma datamodel.MapAssembler) {
+		qp.MapEntry(ma, "iv", qp.String(b64.EncodeToString([]byte("iv"))))
+		qp.MapEntry(ma, "tag", qp.String(b64.EncodeToString([]byte("tag"))))
+		qp.MapEntry(ma, "protected", qp.String(b64.EncodeToString([]byte(`{"enc":"A256GCM"}`))))
+		qp.MapEntry(ma, "ciphertext", qp.String(b64.EncodeToString([]byte("secret stuff"))))
+		qp.MapEntry(ma, "recipients", qp.List(1, func(la datamodel.ListAssembler) {
+			qp.ListEntry(la, qp.Map(2, func(ma datamodel.MapAssembler) {
+				qp.MapEntry(ma, "header", qp.Map(1, func(ma datamodel.MapAssembler) {
+					qp.MapEntry(ma, "alg", qp.String("A256KW"))
+				}))
+				qp.MapEntry(ma, "encrypted_key", qp.String(b64.EncodeToString([]byte("key"))))
+			}))
+		}))
+	})
+	encoded := encode(t, jwe)
+	decoded, err := decode(t, encoded)
+	qt.Assert(t, err, qt.IsNil)
+	qt.Check(t, datamodel.DeepEqual(decoded, jwe), qt.IsTrue)
+	qt.Check(t, encode(t, decoded), qt.DeepEquals, encoded)
+}
+
+func TestRejections(t *testing.T) {
+	c := payloadCid(t)
+	payload := qp.String(b64.EncodeToString(c.Bytes()))
+	signatures := qp.List(1, func(la datamodel.ListAssembler) {
+		qp.ListEntry(la, qp.Map(1, func(ma datamodel.MapAssembler) {
+			qp.MapEntry(ma, "signature", qp.String("AQID"))
+		}))
+	})
+	for _, tc := range []struct {
+		name string
+		fn   func(datamodel.MapAssembler)
+	}{
+		{"neither jws nor jwe", func(ma datamodel.MapAssembler) {
+			qp.MapEntry(ma, "signatures", signatures)
+		}},
+		{"both jws and jwe", func(ma datamodel.MapAssembler) {
+			qp.MapEntry(ma, "payload", payload)
+			qp.MapEntry(ma, "signatures", signatures)
+			qp.MapEntry(ma, "ciphertext", qp.String("AQID"))
+		}},
+		{"unknown field", func(ma datamodel.MapAssembler) {
+			qp.MapEntry(ma, "payload", payload)
+			qp.MapEntry(ma, "signatures", signatures)
+			qp.MapEntry(ma, "extra", qp.Int(1))
+		}},
+		{"missing signatures", func(ma datamodel.MapAssembler) {
+			qp.MapEntry(ma, "payload", payload)
+		}},
+		{"payload not base64url", func(ma datamodel.MapAssembler) {
+			qp.MapEntry(ma, "payload", qp.String("not base64!"))
+			qp.MapEntry(ma, "signatures", signatures)
+		}},
+		{"payload not a cid", func(ma datamodel.MapAssembler) {
+			qp.MapEntry(ma, "payload", qp.String(b64.EncodeToString([]byte("nope"))))
+			qp.MapEntry(ma, "signatures", signatures)
+		}},
+		{"link mismatch", func(ma datamodel.MapAssembler) {
+			qp.MapEntry(ma, "payload", payload)
+			qp.MapEntry(ma, "signatures", signatures)
+			qp.MapEntry(ma, "link", qp.Link(cidlink.Link{Cid: cid.NewCidV1(0x55, c.Hash())}))
+		}},
+		{"header not a map", func(ma datamodel.MapAssembler) {
+			qp.MapEntry(ma, "ciphertext", qp.String("AQID"))
+			qp.MapEntry(ma, "unprotected", qp.String("{}"))
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			n := build(t, tc.fn)
+			qt.Check(t, dagjose.Encode(n, &bytes.Buffer{}), qt.Not(qt.IsNil))
+		})
+	}
+
+	t.Run("decoding", func(t *testing.T) {
+		// Blocks holding the decoded form, or anything else, are rejected.
+		for _, n := range []datamodel.Node{
+			basicnode.NewString("nope"),
+			build(t, func(ma datamodel.MapAssembler) {
+				qp.MapEntry(ma, "payload", payload)
+				qp.MapEntry(ma, "signatures", signatures)
+			}),
+		} {
+			var buf bytes.Buffer
+			qt.Assert(t, dagcbor.Encode(n, &buf), qt.IsNil)
+			_, err := decode(t, buf.Bytes())
+			qt.Check(t, err, qt.Not(qt.IsNil))
+		}
+	})
+}
+
+func TestLinkSystem(t *testing.T) {
+	// The codec is registered, so the default LinkSystem can store and load dag-jose blocks.
+	c := payloadCid(t)
+	jwe := build(t, func(ma datamodel.MapAssembler) {
+		qp.MapEntry(ma, "ciphertext", qp.String(b64.EncodeToString(c.Bytes())))
+	})
+	lp := cidlink.LinkPrototype{Prefix: cid.Prefix{Version: 1, Codec: 0x85, MhType: 0x12, MhLength: 32}}
+	store := storage.Memory{}
+	lsys := cidlink.DefaultLinkSystem()
+	lsys.StorageReadOpener = store.OpenRead
+	lsys.StorageWriteOpener = store.OpenWrite
+	lnk, err := lsys.Store(linking.LinkContext{}, lp, jwe)
+	qt.Assert(t, err, qt.IsNil)
+	n, err := lsys.Load(linking.LinkContext{}, lnk, basicnode.Prototype.Any)
+	qt.Assert(t, err, qt.IsNil)
+	qt.Check(t, datamodel.DeepEqual(n, jwe), qt.IsTrue)
+}
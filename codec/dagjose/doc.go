@@ -0,0 +1,45 @@
+/*
+Package dagjose implements the DAG-JOSE codec, for signed (JWS) and encrypted (JWE) objects.
+
+Blocks are encoded as DAG-CBOR, with the binary fields of the JOSE general serialization held as bytes.
+Decode presents them in the data model in the shape of the general JSON serialization,
+where those fields are base64url strings (without padding), which is the form JOSE libraries expect;
+Encode accepts that shape, and turns it back into the encoded form.
+For a JWS, the payload is the bytes of a CID, and the decoded form has that as a Link too, in an extra "link" field:
+
+	type JWS struct {
+		payload String         # base64url, of the bytes of a CID.
+		signatures [Signature]
+		link Link              # The CID in the payload.  Not stored: Encode checks it matches the payload, if present.
+	}
+
+	type Signature struct {
+		header optional {String:Any}
+		protected optional String  # base64url, of JSON.
+		signature String           # base64url.
+	}
+
+	type JWE struct {
+		aad optional String
+		ciphertext String
+		iv optional String
+		protected optional String
+		recipients optional [Recipient]
+		tag optional String
+		unprotected optional {String:Any}
+	}
+
+	type Recipient struct {
+		encrypted_key optional String
+		header optional {String:Any}
+	}
+
+Any fields other than these are rejected, both by Decode and Encode.
+
+The data the payload links to is not part of the block, so it is loaded (or not) like any other linked data.
+VerifyJWS and VerifySignature check the signatures of a decoded JWS, with keys from the standard library's crypto packages.
+Decrypting JWEs isn't supported by this package.
+
+See https://ipld.io/specs/codecs/dag-jose/spec/ for the specification.
+*/
+package dagjose
@@ -0,0 +1,16 @@
+package dagjose
+
+import (
+	"github.com/ipld/go-ipld-prime/codec"
+	"github.com/ipld/go-ipld-prime/multicodec"
+)
+
+var (
+	_ codec.Decoder = Decode
+	_ codec.Encoder = Encode
+)
+
+func init() {
+	multicodec.RegisterEncoder(0x85, Encode)
+	multicodec.RegisterDecoder(0x85, Decode)
+}
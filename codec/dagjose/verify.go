@@ -0,0 +1,222 @@
+package dagjose
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rsa"
+	_ "crypto/sha256" // For crypto.SHA256.
+	_ "crypto/sha512" // For crypto.SHA384 and crypto.SHA512.
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ipld/go-ipld-prime/datamodel"
+)
+
+// ErrInvalidSignature is returned (perhaps wrapped) by VerifySignature and VerifyJWS
+// when a signature was checked, and it isn't valid for the key.
+var ErrInvalidSignature = errors.New("dagjose: invalid signature")
+
+// ErrUnsupportedAlgorithm is returned by VerifySignature and VerifyJWS
+// when a signature uses an algorithm which this package can't verify.
+type ErrUnsupportedAlgorithm struct {
+	Alg string
+}
+
+func (e ErrUnsupportedAlgorithm) Error() string {
+	return fmt.Sprintf("dagjose: unsupported signature algorithm %q", e.Alg)
+}
+
+// VerifyJWS checks the signatures of a JWS (in the form Decode produces) with the given key,
+// and returns the index of the first which is valid for it.
+// If none are, the error for the last signature is returned.
+//
+// See VerifySignature for the keys which can be used.
+func VerifyJWS(jws datamodel.Node, key crypto.PublicKey) (int64, error) {
+	sigs, err := jws.LookupByString("signatures")
+	if err != nil {
+		return -1, fmt.Errorf("dagjose: JWS has no signatures: %w", err)
+	}
+	err = errors.New("dagjose: JWS has no signatures")
+	for i := int64(0); i < sigs.Length(); i++ {
+		if err = VerifySignature(jws, i, key); err == nil {
+			return i, nil
+		}
+	}
+	return -1, err
+}
+
+// VerifySignature checks one of the signatures of a JWS (in the form Decode produces) with the given key.
+// It returns nil if the signature is valid, an error wrapping ErrInvalidSignature if it's not,
+// and other errors if it can't be checked at all
+// (for example, because the key isn't of a type which can be used with the signature's algorithm).
+//
+// The algorithm is taken from the "alg" header parameter, as usual for JWS.
+// These algorithms are supported, with these types of key:
+//
+//	HS256, HS384, HS512:     []byte
+//	RS256, RS384, RS512:     *rsa.PublicKey
+//	PS256, PS384, PS512:     *rsa.PublicKey
+//	ES256, ES384, ES512:     *ecdsa.PublicKey (on the P-256, P-384, or P-521 curve, respectively)
+//	EdDSA:                   ed25519.PublicKey
+//
+// Note that checking a signature only shows that the holder of the key signed the payload's link.
+// It's still up to the caller to load the payload through that link (which verifies the payload's hash),
+// and to decide whether it trusts the key for the purpose at hand.
+func VerifySignature(jws datamodel.Node, index int64, key crypto.PublicKey) error {
+	payload, err := lookupString(jws, "payload", false)
+	if err != nil {
+		return err
+	}
+	sigs, err := jws.LookupByString("signatures")
+	if err != nil {
+		return fmt.Errorf("dagjose: JWS has no signatures: %w", err)
+	}
+	sig, err := sigs.LookupByIndex(index)
+	if err != nil {
+		return err
+	}
+	protected, err := lookupString(sig, "protected", true)
+	if err != nil {
+		return err
+	}
+	signature, err := lookupString(sig, "signature", false)
+	if err != nil {
+		return err
+	}
+	sigBytes, err := b64.DecodeString(signature)
+	if err != nil {
+		return fmt.Errorf("dagjose: signature is not base64url: %w", err)
+	}
+	alg, err := algorithm(protected, sig)
+	if err != nil {
+		return err
+	}
+	return verify(alg, key, []byte(protected+"."+payload), sigBytes)
+}
+
+func lookupString(n datamodel.Node, key string, optional bool) (string, error) {
+	v, err := n.LookupByString(key)
+	if err != nil {
+		if optional {
+			return "", nil
+		}
+		return "", fmt.Errorf("dagjose: missing %q: %w", key, err)
+	}
+	s, err := v.AsString()
+	if err != nil {
+		return "", fmt.Errorf("dagjose: %q must be a string: %w", key, err)
+	}
+	return s, nil
+}
+
+// algorithm finds the "alg" header parameter of a signature, in its protected header, or else its unprotected one.
+func algorithm(protected string, sig datamodel.Node) (string, error) {
+	if protected != "" {
+		data, err := b64.DecodeString(protected)
+		if err != nil {
+			return "", fmt.Errorf("dagjose: protected header is not base64url: %w", err)
+		}
+		var header struct {
+			Alg  string          `json:"alg"`
+			Crit json.RawMessage `json:"crit"`
+		}
+		if err := json.Unmarshal(data, &header); err != nil {
+			return "", fmt.Errorf("dagjose: protected header is not a JSON object: %w", err)
+		}
+		if header.Crit != nil {
+			return "", fmt.Errorf("dagjose: protected header has critical parameters %s, which aren't supported", header.Crit)
+		}
+		if header.Alg != "" {
+			return header.Alg, nil
+		}
+	}
+	if header, err := sig.LookupByString("header"); err == nil {
+		if alg, err := lookupString(header, "alg", false); err == nil {
+			return alg, nil
+		}
+	}
+	return "", fmt.Errorf("dagjose: signature has no alg header parameter")
+}
+
+func verify(alg string, key crypto.PublicKey, input, sig []byte) error {
+	var hash crypto.Hash
+	switch alg {
+	case "HS256", "RS256", "PS256", "ES256":
+		hash = crypto.SHA256
+	case "HS384", "RS384", "PS384", "ES384":
+		hash = crypto.SHA384
+	case "HS512", "RS512", "PS512", "ES512":
+		hash = crypto.SHA512
+	case "EdDSA":
+		k, ok := key.(ed25519.PublicKey)
+		if !ok {
+			return wrongKey(alg, key)
+		}
+		if !ed25519.Verify(k, input, sig) {
+			return ErrInvalidSignature
+		}
+		return nil
+	default:
+		return ErrUnsupportedAlgorithm{Alg: alg}
+	}
+	h := hash.New()
+	h.Write(input)
+	digest := h.Sum(nil)
+	switch alg[:2] {
+	case "HS":
+		k, ok := key.([]byte)
+		if !ok {
+			return wrongKey(alg, key)
+		}
+		mac := hmac.New(hash.New, k)
+		mac.Write(input)
+		if !hmac.Equal(mac.Sum(nil), sig) {
+			return ErrInvalidSignature
+		}
+	case "RS":
+		k, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return wrongKey(alg, key)
+		}
+		if err := rsa.VerifyPKCS1v15(k, hash, digest, sig); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+		}
+	case "PS":
+		k, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return wrongKey(alg, key)
+		}
+		if err := rsa.VerifyPSS(k, hash, digest, sig, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash}); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+		}
+	case "ES":
+		k, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return wrongKey(alg, key)
+		}
+		if k.Curve.Params().Name != esCurves[alg] {
+			return fmt.Errorf("dagjose: %s signatures can't be made with a %s key", alg, k.Curve.Params().Name)
+		}
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if len(sig) != 2*size {
+			return fmt.Errorf("%w: %s signature should be %d bytes, not %d", ErrInvalidSignature, alg, 2*size, len(sig))
+		}
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		if !ecdsa.Verify(k, digest, r, s) {
+			return ErrInvalidSignature
+		}
+	}
+	return nil
+}
+
+// esCurves is the curve each ECDSA algorithm uses.
+var esCurves = map[string]string{"ES256": "P-256", "ES384": "P-384", "ES512": "P-521"}
+
+func wrongKey(alg string, key crypto.PublicKey) error {
+	return fmt.Errorf("dagjose: a key of type %T can't verify %s signatures", key, alg)
+}
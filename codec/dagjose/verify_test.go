@@ -0,0 +1,151 @@
+package dagjose_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/ipld/go-ipld-prime/codec/dagjose"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/fluent/qp"
+)
+
+// signedJWS builds a JWS with a signature made by sign, over the payload and the given protected header.
+func signedJWS(t *testing.T, payload, protectedHeader string, sign func(input []byte) []byte) datamodel.Node {
+	protected := b64.EncodeToString([]byte(protectedHeader))
+	input := []byte(protected + "." + payload)
+	return build(t, func(ma datamodel.MapAssembler) {
+		qp.MapEntry(ma, "payload", qp.String(payload))
+		qp.MapEntry(ma, "signatures", qp.List(1, func(la datamodel.ListAssembler) {
+			qp.ListEntry(la, qp.Map(2, func(ma datamodel.MapAssembler) {
+				qp.MapEntry(ma, "protected", qp.String(protected))
+				qp.MapEntry(ma, "signature", qp.String(b64.EncodeToString(sign(input))))
+			}))
+		}))
+	})
+}
+
+func digest(hash crypto.Hash, input []byte) []byte {
+	h := hash.New()
+	h.Write(input)
+	return h.Sum(nil)
+}
+
+func TestVerify(t *testing.T) {
+	payload := b64.EncodeToString(payloadCid(t).Bytes())
+	otherPayload := b64.EncodeToString([]byte("something else"))
+
+	hmacKey := []byte("a shared secret")
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	qt.Assert(t, err, qt.IsNil)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	qt.Assert(t, err, qt.IsNil)
+	ec384Key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	qt.Assert(t, err, qt.IsNil)
+	edPub, edPriv, err := ed25519.GenerateKey(rand.Reader)
+	qt.Assert(t, err, qt.IsNil)
+
+	ecSign := func(key *ecdsa.PrivateKey, hash crypto.Hash) func([]byte) []byte {
+		return func(input []byte) []byte {
+			r, s, err := ecdsa.Sign(rand.Reader, key, digest(hash, input))
+			qt.Assert(t, err, qt.IsNil)
+			size := (key.Curve.Params().BitSize + 7) / 8
+			sig := make([]byte, 2*size)
+			r.FillBytes(sig[:size])
+			s.FillBytes(sig[size:])
+			return sig
+		}
+	}
+
+	for _, tc := range []struct {
+		alg  string
+		sign func([]byte) []byte
+		key  crypto.PublicKey
+	}{
+		{"HS256", func(input []byte) []byte {
+			mac := hmac.New(crypto.SHA256.New, hmacKey)
+			mac.Write(input)
+			return mac.Sum(nil)
+		}, hmacKey},
+		{"RS256", func(input []byte) []byte {
+			sig, err := rsa.SignPKCS1v15(rand.Reader, rsaKey, crypto.SHA256, digest(crypto.SHA256, input))
+			qt.Assert(t, err, qt.IsNil)
+			return sig
+		}, &rsaKey.PublicKey},
+		{"PS512", func(input []byte) []byte {
+			sig, err := rsa.SignPSS(rand.Reader, rsaKey, crypto.SHA512, digest(crypto.SHA512, input), &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+			qt.Assert(t, err, qt.IsNil)
+			return sig
+		}, &rsaKey.PublicKey},
+		{"ES256", ecSign(ecKey, crypto.SHA256), &ecKey.PublicKey},
+		{"ES384", ecSign(ec384Key, crypto.SHA384), &ec384Key.PublicKey},
+		{"EdDSA", func(input []byte) []byte {
+			return ed25519.Sign(edPriv, input)
+		}, edPub},
+	} {
+		t.Run(tc.alg, func(t *testing.T) {
+			header := `{"alg":"` + tc.alg + `"}`
+			jws := signedJWS(t, payload, header, tc.sign)
+			idx, err := dagjose.VerifyJWS(jws, tc.key)
+			qt.Check(t, err, qt.IsNil)
+			qt.Check(t, idx, qt.Equals, int64(0))
+
+			// A signature over something else doesn't verify.
+			forged := signedJWS(t, payload, header, func([]byte) []byte {
+				return tc.sign([]byte(b64.EncodeToString([]byte(header)) + "." + otherPayload))
+			})
+			_, err = dagjose.VerifyJWS(forged, tc.key)
+			qt.Check(t, errors.Is(err, dagjose.ErrInvalidSignature), qt.IsTrue, qt.Commentf("%v", err))
+
+			// Nor does it with a key of the wrong type.
+			err = dagjose.VerifySignature(jws, 0, "not a key")
+			qt.Check(t, err, qt.ErrorMatches, "dagjose: a key of type string can't verify .* signatures")
+		})
+	}
+
+	t.Run("wrong curve", func(t *testing.T) {
+		jws := signedJWS(t, payload, `{"alg":"ES256"}`, ecSign(ecKey, crypto.SHA256))
+		err := dagjose.VerifySignature(jws, 0, &ec384Key.PublicKey)
+		qt.Check(t, err, qt.ErrorMatches, "dagjose: ES256 signatures can't be made with a P-384 key")
+	})
+	t.Run("unsupported algorithm", func(t *testing.T) {
+		jws := signedJWS(t, payload, `{"alg":"ES256K"}`, func([]byte) []byte { return []byte{1} })
+		err := dagjose.VerifySignature(jws, 0, &ecKey.PublicKey)
+		qt.Check(t, errors.As(err, &dagjose.ErrUnsupportedAlgorithm{}), qt.IsTrue)
+	})
+	t.Run("critical header", func(t *testing.T) {
+		jws := signedJWS(t, payload, `{"alg":"EdDSA","crit":["exp"]}`, func(input []byte) []byte { return ed25519.Sign(edPriv, input) })
+		err := dagjose.VerifySignature(jws, 0, edPub)
+		qt.Check(t, err, qt.ErrorMatches, "dagjose: protected header has critical parameters .*")
+	})
+	t.Run("alg in unprotected header", func(t *testing.T) {
+		sig := ed25519.Sign(edPriv, []byte("."+payload))
+		jws := build(t, func(ma datamodel.MapAssembler) {
+			qp.MapEntry(ma, "payload", qp.String(payload))
+			qp.MapEntry(ma, "signatures", qp.List(1, func(la datamodel.ListAssembler) {
+				qp.ListEntry(la, qp.Map(2, func(ma datamodel.MapAssembler) {
+					qp.MapEntry(ma, "header", qp.Map(1, func(ma datamodel.MapAssembler) {
+						qp.MapEntry(ma, "alg", qp.String("EdDSA"))
+					}))
+					qp.MapEntry(ma, "signature", qp.String(b64.EncodeToString(sig)))
+				}))
+			}))
+		})
+		qt.Check(t, dagjose.VerifySignature(jws, 0, edPub), qt.IsNil)
+	})
+	t.Run("after a roundtrip", func(t *testing.T) {
+		jws := signedJWS(t, payload, `{"alg":"EdDSA"}`, func(input []byte) []byte { return ed25519.Sign(edPriv, input) })
+		decoded, err := decode(t, encode(t, jws))
+		qt.Assert(t, err, qt.IsNil)
+		_, err = dagjose.VerifyJWS(decoded, edPub)
+		qt.Check(t, err, qt.IsNil)
+	})
+}
@@ -0,0 +1,459 @@
+package dagjson
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	cid "github.com/ipfs/go-cid"
+
+	"github.com/ipld/go-ipld-prime/codec"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+)
+
+// checkCanonical checks that data holds exactly one value of DAG-JSON in its canonical form:
+// the form Encode produces, byte for byte.
+// That means no whitespace, map keys sorted bytewise (and not repeated),
+// integers and floats written as Encode writes them, strings escaped as Encode escapes them,
+// and links and bytes (when they're being parsed) written in the same form as Encode writes them.
+// It's used by DecodeOptions.Decode when Strict is set, before decoding.
+//
+// Syntax errors stop the check, and are reported as plain errors.
+// Links and bytes which can't be parsed at all are left for the decoder to report.
+func checkCanonical(data []byte, options DecodeOptions) error {
+	c := canonicalChecker{data: data, options: options}
+	if _, err := c.value(0); err != nil {
+		return err
+	}
+	if c.off != len(data) {
+		if isWhitespace(data[c.off]) {
+			return c.fail(c.off, codec.NonCanonicalWhitespace)
+		}
+		return c.fail(c.off, codec.NonCanonicalTrailingData)
+	}
+	return nil
+}
+
+type canonicalChecker struct {
+	data    []byte
+	off     int
+	options DecodeOptions
+}
+
+// scanned says what a value was, as far as the checks for links and bytes need to know.
+type scanned struct {
+	isString bool
+	str      string // The string, if isString.
+	isBytes  bool   // True if the value was a map of the form {"bytes":"..."}.
+	bytes    string // The string in that map, if isBytes.
+}
+
+func isWhitespace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\n' || b == '\r'
+}
+
+func (c *canonicalChecker) fail(off int, reason codec.NonCanonical) error {
+	return codec.ErrNotCanonical{Offset: int64(off), Reason: reason}
+}
+
+// peek returns the next byte, failing on whitespace or the end of the data.
+func (c *canonicalChecker) peek() (byte, error) {
+	if c.off >= len(c.data) {
+		return 0, io.ErrUnexpectedEOF
+	}
+	b := c.data[c.off]
+	if isWhitespace(b) {
+		return 0, c.fail(c.off, codec.NonCanonicalWhitespace)
+	}
+	return b, nil
+}
+
+func (c *canonicalChecker) syntaxError() error {
+	return fmt.Errorf("invalid json: unexpected %q at offset %d", c.data[c.off], c.off)
+}
+
+func (c *canonicalChecker) value(depth int) (scanned, error) {
+	b, err := c.peek()
+	if err != nil {
+		return scanned{}, err
+	}
+	switch {
+	case b == '{':
+		return c.object(depth)
+	case b == '[':
+		return scanned{}, c.array(depth)
+	case b == '"':
+		s, err := c.string()
+		return scanned{isString: true, str: s}, err
+	case b == 't':
+		return scanned{}, c.literal("true")
+	case b == 'f':
+		return scanned{}, c.literal("false")
+	case b == 'n':
+		return scanned{}, c.literal("null")
+	case b == '-' || (b >= '0' && b <= '9'):
+		return scanned{}, c.number()
+	default:
+		return scanned{}, c.syntaxError()
+	}
+}
+
+func (c *canonicalChecker) literal(lit string) error {
+	if len(c.data)-c.off < len(lit) {
+		return io.ErrUnexpectedEOF
+	}
+	if string(c.data[c.off:c.off+len(lit)]) != lit {
+		return c.syntaxError()
+	}
+	c.off += len(lit)
+	return nil
+}
+
+func (c *canonicalChecker) enter(depth int) error {
+	if c.options.MaxDepth > 0 && depth >= c.options.MaxDepth {
+		return codec.ErrBudgetExhausted{Budget: codec.BudgetDepth}
+	}
+	return nil
+}
+
+func (c *canonicalChecker) array(depth int) error {
+	if err := c.enter(depth); err != nil {
+		return err
+	}
+	c.off++ // The '['.
+	if b, err := c.peek(); err != nil {
+		return err
+	} else if b == ']' {
+		c.off++
+		return nil
+	}
+	for {
+		if _, err := c.value(depth + 1); err != nil {
+			return err
+		}
+		b, err := c.peek()
+		if err != nil {
+			return err
+		}
+		c.off++
+		switch b {
+		case ',':
+		case ']':
+			return nil
+		default:
+			c.off--
+			return c.syntaxError()
+		}
+	}
+}
+
+func (c *canonicalChecker) object(depth int) (scanned, error) {
+	if err := c.enter(depth); err != nil {
+		return scanned{}, err
+	}
+	c.off++ // The '{'.
+	if b, err := c.peek(); err != nil {
+		return scanned{}, err
+	} else if b == '}' {
+		c.off++
+		return scanned{}, nil
+	}
+	var first, prev string
+	var firstValue scanned
+	var firstValueStart int
+	for i := 0; ; i++ {
+		keyStart := c.off
+		if b, err := c.peek(); err != nil {
+			return scanned{}, err
+		} else if b != '"' {
+			return scanned{}, c.syntaxError()
+		}
+		key, err := c.string()
+		if err != nil {
+			return scanned{}, err
+		}
+		if i > 0 {
+			switch {
+			case key == prev:
+				return scanned{}, c.fail(keyStart, codec.NonCanonicalDuplicateMapKey)
+			case key < prev:
+				return scanned{}, c.fail(keyStart, codec.NonCanonicalMapKeyOrder)
+			}
+		}
+		prev = key
+		if b, err := c.peek(); err != nil {
+			return scanned{}, err
+		} else if b != ':' {
+			return scanned{}, c.syntaxError()
+		}
+		c.off++
+		valueStart := c.off
+		v, err := c.value(depth + 1)
+		if err != nil {
+			return scanned{}, err
+		}
+		if i == 0 {
+			first, firstValue, firstValueStart = key, v, valueStart
+		}
+		b, err := c.peek()
+		if err != nil {
+			return scanned{}, err
+		}
+		c.off++
+		switch b {
+		case ',':
+			continue
+		case '}':
+		default:
+			c.off--
+			return scanned{}, c.syntaxError()
+		}
+		// The end of the map: if it had just one entry, it may have been a link, or bytes (or the inside of bytes).
+		if i > 0 {
+			return scanned{}, nil
+		}
+		switch {
+		case first == "/" && firstValue.isString && c.options.ParseLinks:
+			if !c.canonicalLink(firstValue.str) {
+				return scanned{}, c.fail(firstValueStart, codec.NonCanonicalLink)
+			}
+		case first == "/" && firstValue.isBytes && c.options.ParseBytes:
+			if _, err := base64.RawStdEncoding.DecodeString(firstValue.bytes); err == nil {
+				if _, err := base64.RawStdEncoding.Strict().DecodeString(firstValue.bytes); err != nil {
+					return scanned{}, c.fail(firstValueStart, codec.NonCanonicalLink)
+				}
+			}
+		case first == "bytes" && firstValue.isString:
+			return scanned{isBytes: true, bytes: firstValue.str}, nil
+		}
+		return scanned{}, nil
+	}
+}
+
+// canonicalLink says whether a link's string is written the way Encode would write it.
+// Strings which can't be parsed as links at all are left for the decoder to report, so they're passed here.
+func (c *canonicalChecker) canonicalLink(s string) bool {
+	var lnk datamodel.Link
+	if c.options.LinkDecoder != nil {
+		var err error
+		if lnk, err = c.options.LinkDecoder(s); err != nil {
+			return true
+		}
+	} else {
+		elCid, err := cid.Decode(s)
+		if err != nil {
+			return true
+		}
+		lnk = cidlink.Link{Cid: elCid}
+	}
+	return lnk.String() == s
+}
+
+func (c *canonicalChecker) number() error {
+	start := c.off
+	digits := func() error {
+		n := 0
+		for c.off < len(c.data) && c.data[c.off] >= '0' && c.data[c.off] <= '9' {
+			c.off++
+			n++
+		}
+		if n == 0 {
+			if c.off >= len(c.data) {
+				return io.ErrUnexpectedEOF
+			}
+			return c.syntaxError()
+		}
+		return nil
+	}
+	isFloat := false
+	if c.data[c.off] == '-' {
+		c.off++
+	}
+	if err := digits(); err != nil {
+		return err
+	}
+	if c.off < len(c.data) && c.data[c.off] == '.' {
+		isFloat = true
+		c.off++
+		if err := digits(); err != nil {
+			return err
+		}
+	}
+	if c.off < len(c.data) && (c.data[c.off] == 'e' || c.data[c.off] == 'E') {
+		isFloat = true
+		c.off++
+		if c.off < len(c.data) && (c.data[c.off] == '+' || c.data[c.off] == '-') {
+			c.off++
+		}
+		if err := digits(); err != nil {
+			return err
+		}
+	}
+	text := string(c.data[start:c.off])
+	if !isFloat {
+		v, err := strconv.ParseInt(text, 10, 64)
+		if err != nil {
+			return c.fail(start, codec.NonCanonicalIntegerRange)
+		}
+		if strconv.FormatInt(v, 10) != text {
+			return c.fail(start, codec.NonCanonicalInteger)
+		}
+		return nil
+	}
+	f, err := strconv.ParseFloat(text, 64)
+	if err != nil || string(appendFloat(nil, f)) != text {
+		return c.fail(start, codec.NonCanonicalFloat)
+	}
+	return nil
+}
+
+// string reads a string, starting at its opening quote, and returns its value.
+func (c *canonicalChecker) string() (string, error) {
+	start := c.off
+	c.off++ // The opening quote.
+	var sb []byte
+	for {
+		if c.off >= len(c.data) {
+			return "", io.ErrUnexpectedEOF
+		}
+		b := c.data[c.off]
+		if b == '"' {
+			c.off++
+			break
+		}
+		if b != '\\' {
+			sb = append(sb, b)
+			c.off++
+			continue
+		}
+		if len(c.data)-c.off < 2 {
+			return "", io.ErrUnexpectedEOF
+		}
+		switch e := c.data[c.off+1]; e {
+		case '"', '\\', '/':
+			sb = append(sb, e)
+		case 'b':
+			sb = append(sb, '\b')
+		case 'f':
+			sb = append(sb, '\f')
+		case 'n':
+			sb = append(sb, '\n')
+		case 'r':
+			sb = append(sb, '\r')
+		case 't':
+			sb = append(sb, '\t')
+		case 'u':
+			r, ok := c.hex4(c.off + 2)
+			if !ok {
+				c.off++
+				return "", c.syntaxError()
+			}
+			if utf16.IsSurrogate(r) {
+				if r2, ok := c.hex4(c.off + 8); ok && c.data[c.off+6] == '\\' && c.data[c.off+7] == 'u' {
+					if dec := utf16.DecodeRune(r, r2); dec != utf8.RuneError {
+						r = dec
+						c.off += 6
+					}
+				}
+			}
+			var buf [utf8.UTFMax]byte
+			sb = append(sb, buf[:utf8.EncodeRune(buf[:], r)]...)
+			c.off += 4
+		default:
+			c.off++
+			return "", c.syntaxError()
+		}
+		c.off += 2
+	}
+	s := string(sb)
+	if string(appendString(nil, s)) != string(c.data[start:c.off]) {
+		return "", c.fail(start, codec.NonCanonicalString)
+	}
+	return s, nil
+}
+
+// hex4 parses the four hex digits at off, if there are four there.
+func (c *canonicalChecker) hex4(off int) (rune, bool) {
+	if len(c.data)-off < 4 {
+		return 0, false
+	}
+	v, err := strconv.ParseUint(string(c.data[off:off+4]), 16, 32)
+	return rune(v), err == nil
+}
+
+// appendString appends s to b as a JSON string, escaped as Encode escapes strings:
+// with short escapes for quote, backslash, newline, carriage return, and tab;
+// \u escapes for other control characters, and for U+2028 and U+2029;
+// invalid UTF-8 replaced by \ufffd; and everything else as it is.
+func appendString(b []byte, s string) []byte {
+	const hex = "0123456789abcdef"
+	b = append(b, '"')
+	start := 0
+	for i := 0; i < len(s); {
+		if c := s[i]; c < utf8.RuneSelf {
+			if 0x20 <= c && c != '\\' && c != '"' {
+				i++
+				continue
+			}
+			b = append(b, s[start:i]...)
+			switch c {
+			case '\\', '"':
+				b = append(b, '\\', c)
+			case '\n':
+				b = append(b, '\\', 'n')
+			case '\r':
+				b = append(b, '\\', 'r')
+			case '\t':
+				b = append(b, '\\', 't')
+			default:
+				b = append(b, '\\', 'u', '0', '0', hex[c>>4], hex[c&0xF])
+			}
+			i++
+			start = i
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			b = append(b, s[start:i]...)
+			b = append(b, `\ufffd`...)
+			i += size
+			start = i
+			continue
+		}
+		if r == '\u2028' || r == '\u2029' {
+			b = append(b, s[start:i]...)
+			b = append(b, '\\', 'u', '2', '0', '2', hex[r&0xF])
+			i += size
+			start = i
+			continue
+		}
+		i += size
+	}
+	b = append(b, s[start:]...)
+	return append(b, '"')
+}
+
+// appendFloat appends f to b as Encode writes floats:
+// as by the ES6 number-to-string conversion, which is the shortest form that parses back to the same float.
+// NaN and infinities can't be written at all, and mustn't be given.
+func appendFloat(b []byte, f float64) []byte {
+	format := byte('f')
+	if abs := math.Abs(f); abs != 0 && (abs < 1e-6 || abs >= 1e21) {
+		format = 'e'
+	}
+	b = strconv.AppendFloat(b, f, format, -1, 64)
+	if format == 'e' {
+		// Clean up e-09 to e-9.
+		n := len(b)
+		if n >= 4 && b[n-4] == 'e' && b[n-3] == '-' && b[n-2] == '0' {
+			b[n-2] = b[n-1]
+			b = b[:n-1]
+		}
+	}
+	return b
+}
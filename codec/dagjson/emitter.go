@@ -0,0 +1,144 @@
+package dagjson
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+)
+
+// The emitter writes JSON to an io.Writer, adding the commas, colons, and (if configured) the line breaks and indentation.
+// It gathers what it writes in a buffer, and writes the buffer whenever it's full,
+// so that the writer sees few, large writes.
+// The caller must call flush when done.
+
+// flushSize is the size the emitter's buffer may reach before it's written out.
+const flushSize = 4096
+
+type emitter struct {
+	w       io.Writer
+	line    []byte // Written before each entry in a map or list, and before their closing brackets.
+	indent  []byte // Written after each line, once for each enclosing map or list.
+	depth   int    // The number of maps and lists open.
+	some    bool   // Whether the innermost map or list has had any entries yet.
+	buf     []byte
+	scratch [128]byte // Initial storage for buf, so that small documents don't need another allocation.
+}
+
+func newEmitter(w io.Writer, line, indent []byte) *emitter {
+	e := &emitter{w: w, line: line, indent: indent}
+	e.buf = e.scratch[:0]
+	return e
+}
+
+// flush writes out whatever is buffered.
+func (e *emitter) flush() error {
+	if len(e.buf) == 0 {
+		return nil
+	}
+	_, err := e.w.Write(e.buf)
+	e.buf = e.buf[:0]
+	return err
+}
+
+// maybeFlush flushes, if the buffer is full.
+func (e *emitter) maybeFlush() error {
+	if len(e.buf) >= flushSize {
+		return e.flush()
+	}
+	return nil
+}
+
+// newline starts a new line, indented to the given depth.
+func (e *emitter) newline(depth int) {
+	e.buf = append(e.buf, e.line...)
+	for i := 0; i < depth; i++ {
+		e.buf = append(e.buf, e.indent...)
+	}
+}
+
+// entry separates an entry of a map or list from the one before.
+func (e *emitter) entry() {
+	if e.some {
+		e.buf = append(e.buf, ',')
+	}
+	e.some = true
+	e.newline(e.depth)
+}
+
+func (e *emitter) beginMap() {
+	e.buf = append(e.buf, '{')
+	e.depth++
+	e.some = false
+}
+
+func (e *emitter) beginList() {
+	e.buf = append(e.buf, '[')
+	e.depth++
+	e.some = false
+}
+
+// mapKey writes a map key, and the colon after it.
+func (e *emitter) mapKey(k string) error {
+	e.entry()
+	e.buf = appendString(e.buf, k)
+	e.buf = append(e.buf, ':')
+	if e.line != nil {
+		e.buf = append(e.buf, ' ')
+	}
+	return e.maybeFlush()
+}
+
+// listEntry is called before each value in a list.
+func (e *emitter) listEntry() {
+	e.entry()
+}
+
+func (e *emitter) endMap() error {
+	return e.end('}')
+}
+
+func (e *emitter) endList() error {
+	return e.end(']')
+}
+
+func (e *emitter) end(closing byte) error {
+	e.depth--
+	if e.some {
+		e.newline(e.depth)
+	}
+	e.buf = append(e.buf, closing)
+	e.some = true
+	if e.depth == 0 {
+		e.buf = append(e.buf, e.line...)
+	}
+	return e.maybeFlush()
+}
+
+func (e *emitter) writeNull() error {
+	e.buf = append(e.buf, "null"...)
+	return e.maybeFlush()
+}
+
+func (e *emitter) writeBool(v bool) error {
+	e.buf = strconv.AppendBool(e.buf, v)
+	return e.maybeFlush()
+}
+
+func (e *emitter) writeInt(v int64) error {
+	e.buf = strconv.AppendInt(e.buf, v, 10)
+	return e.maybeFlush()
+}
+
+func (e *emitter) writeFloat(v float64) error {
+	if math.IsInf(v, 0) || math.IsNaN(v) {
+		return fmt.Errorf("unsupported value: %s", strconv.FormatFloat(v, 'g', -1, 64))
+	}
+	e.buf = appendFloat(e.buf, v)
+	return e.maybeFlush()
+}
+
+func (e *emitter) writeString(s string) error {
+	e.buf = appendString(e.buf, s)
+	return e.maybeFlush()
+}
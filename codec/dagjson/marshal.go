@@ -6,10 +6,6 @@ import (
 	"io"
 	"sort"
 
-	"github.com/polydawn/refmt/json"
-	"github.com/polydawn/refmt/shared"
-	"github.com/polydawn/refmt/tok"
-
 	"github.com/ipld/go-ipld-prime/codec"
 	"github.com/ipld/go-ipld-prime/datamodel"
 	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
@@ -32,6 +28,21 @@ type EncodeOptions struct {
 
 	// Control the sorting of map keys, using one of the `codec.MapSortMode_*` constants.
 	MapSortMode codec.MapSortMode
+
+	// LinkEncoder, if set, gives the string encoded in the `{"/":"..."}` form for each link.
+	// If nil, only cidlink.Link is supported, and encoded as a CID string.
+	// (This is how link implementations other than cidlink can be used with DAG-JSON; see the linking/sha256link package for an example.)
+	LinkEncoder func(datamodel.Link) (string, error)
+
+	// Line and Indent control whitespace, for pretty-printing.
+	// If Line is set, it's written before each entry of a map or list, and before the closing bracket of each non-empty one,
+	// followed by Indent once for each map or list that's open;
+	// a space is written after the colon following each map key;
+	// and Line is written once more at the very end, if the value is a map or list.
+	// If both are nil, no whitespace is written at all.
+	// (Note that DAG-JSON's canonical form has no whitespace, so this is only for JSON meant for humans.)
+	Line   []byte
+	Indent []byte
 }
 
 // Encode walks the given datamodel.Node and serializes it to the given io.Writer.
@@ -39,32 +50,28 @@ type EncodeOptions struct {
 //
 // The behavior of the encoder can be customized by setting fields in the EncodeOptions struct before calling this method.
 func (cfg EncodeOptions) Encode(n datamodel.Node, w io.Writer) error {
-	return Marshal(n, json.NewEncoder(w, json.EncodeOptions{}), cfg)
+	return Marshal(n, w, cfg)
 }
 
-// Future work: we would like to remove the Marshal function,
-// and in particular, stop seeing types from refmt (like shared.TokenSink) be visible.
-// Right now, some kinds of configuration (e.g. for whitespace and prettyprint) are only available through interacting with the refmt types;
-// we should improve our API so that this can be done with only our own types in this package.
-
 // Marshal is a deprecated function.
 // Please consider switching to EncodeOptions.Encode instead.
-func Marshal(n datamodel.Node, sink shared.TokenSink, options EncodeOptions) error {
-	var tk tok.Token
+func Marshal(n datamodel.Node, w io.Writer, options EncodeOptions) error {
+	e := newEmitter(w, options.Line, options.Indent)
+	if err := marshal(n, e, options); err != nil {
+		return err
+	}
+	return e.flush()
+}
+
+func marshal(n datamodel.Node, e *emitter, options EncodeOptions) error {
 	switch n.Kind() {
 	case datamodel.Kind_Invalid:
 		return fmt.Errorf("cannot traverse a node that is absent")
 	case datamodel.Kind_Null:
-		tk.Type = tok.TNull
-		_, err := sink.Step(&tk)
-		return err
+		return e.writeNull()
 	case datamodel.Kind_Map:
 		// Emit start of map.
-		tk.Type = tok.TMapOpen
-		tk.Length = int(n.Length()) // TODO: overflow check
-		if _, err := sink.Step(&tk); err != nil {
-			return err
-		}
+		e.beginMap()
 		if options.MapSortMode != codec.MapSortMode_None {
 			// Collect map entries, then sort by key
 			type entry struct {
@@ -100,13 +107,11 @@ func Marshal(n datamodel.Node, sink shared.TokenSink, options EncodeOptions) err
 				})
 			}
 			// Emit map contents (and recurse).
-			for _, e := range entries {
-				tk.Type = tok.TString
-				tk.Str = e.key
-				if _, err := sink.Step(&tk); err != nil {
+			for _, ent := range entries {
+				if err := e.mapKey(ent.key); err != nil {
 					return err
 				}
-				if err := Marshal(e.value, sink, options); err != nil {
+				if err := marshal(ent.value, e, options); err != nil {
 					return err
 				}
 			}
@@ -117,127 +122,85 @@ func Marshal(n datamodel.Node, sink shared.TokenSink, options EncodeOptions) err
 				if err != nil {
 					return err
 				}
-				tk.Type = tok.TString
-				tk.Str, err = k.AsString()
+				ks, err := k.AsString()
 				if err != nil {
 					return err
 				}
-				if _, err := sink.Step(&tk); err != nil {
+				if err := e.mapKey(ks); err != nil {
 					return err
 				}
-				if err := Marshal(v, sink, options); err != nil {
+				if err := marshal(v, e, options); err != nil {
 					return err
 				}
 			}
 		}
 		// Emit map close.
-		tk.Type = tok.TMapClose
-		_, err := sink.Step(&tk)
-		return err
+		return e.endMap()
 	case datamodel.Kind_List:
 		// Emit start of list.
-		tk.Type = tok.TArrOpen
+		e.beginList()
 		l := n.Length()
-		tk.Length = int(l) // TODO: overflow check
-		if _, err := sink.Step(&tk); err != nil {
-			return err
-		}
 		// Emit list contents (and recurse).
 		for i := int64(0); i < l; i++ {
 			v, err := n.LookupByIndex(i)
 			if err != nil {
 				return err
 			}
-			if err := Marshal(v, sink, options); err != nil {
+			e.listEntry()
+			if err := marshal(v, e, options); err != nil {
 				return err
 			}
 		}
 		// Emit list close.
-		tk.Type = tok.TArrClose
-		_, err := sink.Step(&tk)
-		return err
+		return e.endList()
 	case datamodel.Kind_Bool:
 		v, err := n.AsBool()
 		if err != nil {
 			return err
 		}
-		tk.Type = tok.TBool
-		tk.Bool = v
-		_, err = sink.Step(&tk)
-		return err
+		return e.writeBool(v)
 	case datamodel.Kind_Int:
 		v, err := n.AsInt()
 		if err != nil {
 			return err
 		}
-		tk.Type = tok.TInt
-		tk.Int = int64(v)
-		_, err = sink.Step(&tk)
-		return err
+		return e.writeInt(v)
 	case datamodel.Kind_Float:
 		v, err := n.AsFloat()
 		if err != nil {
 			return err
 		}
-		tk.Type = tok.TFloat64
-		tk.Float64 = v
-		_, err = sink.Step(&tk)
-		return err
+		return e.writeFloat(v)
 	case datamodel.Kind_String:
 		v, err := n.AsString()
 		if err != nil {
 			return err
 		}
-		tk.Type = tok.TString
-		tk.Str = v
-		_, err = sink.Step(&tk)
-		return err
+		return e.writeString(v)
 	case datamodel.Kind_Bytes:
+		if !options.EncodeBytes {
+			return fmt.Errorf("cannot Marshal bytes to JSON")
+		}
 		v, err := n.AsBytes()
 		if err != nil {
 			return err
 		}
-		if options.EncodeBytes {
-			// Precisely seven tokens to emit:
-			tk.Type = tok.TMapOpen
-			tk.Length = 1
-			if _, err = sink.Step(&tk); err != nil {
-				return err
-			}
-			tk.Type = tok.TString
-			tk.Str = "/"
-			if _, err = sink.Step(&tk); err != nil {
-				return err
-			}
-			tk.Type = tok.TMapOpen
-			tk.Length = 1
-			if _, err = sink.Step(&tk); err != nil {
-				return err
-			}
-			tk.Type = tok.TString
-			tk.Str = "bytes"
-			if _, err = sink.Step(&tk); err != nil {
-				return err
-			}
-			tk.Str = base64.RawStdEncoding.EncodeToString(v)
-			if _, err = sink.Step(&tk); err != nil {
-				return err
-			}
-			tk.Type = tok.TMapClose
-			if _, err = sink.Step(&tk); err != nil {
-				return err
-			}
-			tk.Type = tok.TMapClose
-			if _, err = sink.Step(&tk); err != nil {
-				return err
-			}
-			return nil
-		} else {
-			tk.Type = tok.TBytes
-			tk.Bytes = v
-			_, err = sink.Step(&tk)
+		// The form is {"/":{"bytes":"..."}}.
+		e.beginMap()
+		if err := e.mapKey("/"); err != nil {
+			return err
+		}
+		e.beginMap()
+		if err := e.mapKey("bytes"); err != nil {
+			return err
+		}
+		if err := e.writeString(base64.RawStdEncoding.EncodeToString(v)); err != nil {
 			return err
 		}
+		if err := e.endMap(); err != nil {
+			return err
+		}
+		return e.endMap()
 	case datamodel.Kind_Link:
 		if !options.EncodeLinks {
 			return fmt.Errorf("cannot Marshal ipld links to JSON")
@@ -246,31 +209,25 @@ func Marshal(n datamodel.Node, sink shared.TokenSink, options EncodeOptions) err
 		if err != nil {
 			return err
 		}
-		switch lnk := v.(type) {
-		case cidlink.Link:
-			// Precisely four tokens to emit:
-			tk.Type = tok.TMapOpen
-			tk.Length = 1
-			if _, err = sink.Step(&tk); err != nil {
-				return err
-			}
-			tk.Type = tok.TString
-			tk.Str = "/"
-			if _, err = sink.Step(&tk); err != nil {
+		var str string
+		if options.LinkEncoder != nil {
+			if str, err = options.LinkEncoder(v); err != nil {
 				return err
 			}
-			tk.Str = lnk.Cid.String()
-			if _, err = sink.Step(&tk); err != nil {
-				return err
-			}
-			tk.Type = tok.TMapClose
-			if _, err = sink.Step(&tk); err != nil {
-				return err
-			}
-			return nil
-		default:
+		} else if lnk, ok := v.(cidlink.Link); ok {
+			str = lnk.Cid.String()
+		} else {
 			return fmt.Errorf("schemafree link emission only supported by this codec for CID type links")
 		}
+		// The form is {"/":"..."}.
+		e.beginMap()
+		if err := e.mapKey("/"); err != nil {
+			return err
+		}
+		if err := e.writeString(str); err != nil {
+			return err
+		}
+		return e.endMap()
 	default:
 		panic("unreachable")
 	}
@@ -4,9 +4,11 @@ import (
 	"bytes"
 	"strings"
 	"testing"
+	"testing/iotest"
 
 	. "github.com/warpfork/go-wish"
 
+	"github.com/ipld/go-ipld-prime/codec"
 	"github.com/ipld/go-ipld-prime/fluent"
 	"github.com/ipld/go-ipld-prime/node/basicnode"
 )
@@ -59,6 +61,39 @@ func TestRoundtrip(t *testing.T) {
 		Require(t, err, ShouldEqual, nil)
 		Wish(t, nb.Build(), ShouldEqual, nSorted)
 	})
+	t.Run("decoding from a reader without ReadByte", func(t *testing.T) {
+		nb := basicnode.Prototype.Map.NewBuilder()
+		err := Decode(nb, iotest.OneByteReader(strings.NewReader(serial)))
+		Require(t, err, ShouldEqual, nil)
+		Wish(t, nb.Build(), ShouldEqual, nSorted)
+	})
+}
+
+func TestEncodeWhitespace(t *testing.T) {
+	var buf bytes.Buffer
+	err := EncodeOptions{
+		MapSortMode: codec.MapSortMode_Lexical,
+		Line:        []byte{'\n'},
+		Indent:      []byte{'\t'},
+	}.Encode(n, &buf)
+	Require(t, err, ShouldEqual, nil)
+	Wish(t, buf.String(), ShouldEqual, `{
+	"list": [
+		"three",
+		"four"
+	],
+	"map": {
+		"one": 1,
+		"two": 2
+	},
+	"nested": {
+		"deeper": [
+			"things"
+		]
+	},
+	"plain": "olde string"
+}
+`)
 }
 
 func TestRoundtripScalar(t *testing.T) {
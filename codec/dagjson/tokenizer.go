@@ -0,0 +1,481 @@
+package dagjson
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/ipld/go-ipld-prime/codec"
+)
+
+// The tokenizer reads JSON from an io.Reader, one token at a time.
+// It checks the structure of the JSON as it goes (the commas and colons, and the matching of brackets),
+// so the tokens it yields are always in a sensible order.
+//
+// It reads from the reader one byte at a time if the reader is an io.ByteReader;
+// otherwise, it reads through a bufio.Reader, and may read past the end of the JSON value.
+
+type tokenKind uint8
+
+const (
+	tokenMapOpen tokenKind = iota + 1
+	tokenMapClose
+	tokenListOpen
+	tokenListClose
+	tokenNull
+	tokenBool
+	tokenInt
+	tokenFloat
+	tokenString
+)
+
+func (k tokenKind) String() string {
+	switch k {
+	case tokenMapOpen:
+		return "map open"
+	case tokenMapClose:
+		return "map close"
+	case tokenListOpen:
+		return "list open"
+	case tokenListClose:
+		return "list close"
+	case tokenNull:
+		return "null"
+	case tokenBool:
+		return "bool"
+	case tokenInt:
+		return "int"
+	case tokenFloat:
+		return "float"
+	case tokenString:
+		return "string"
+	default:
+		return "invalid"
+	}
+}
+
+// token is one token of JSON.  Only the field for its kind is meaningful.
+type token struct {
+	kind  tokenKind
+	str   string
+	int   int64
+	float float64
+	bool  bool
+}
+
+// Where the tokenizer is, within the innermost map or list.
+const (
+	stateFirst      = iota // Just after the opening bracket.
+	stateAfterKey          // Just after a map key, so before a colon.
+	stateAfterValue        // Just after a value.
+)
+
+type tokenizer struct {
+	r       io.ByteReader
+	peeked  bool // If true, the last byte read is to be read again.
+	last    byte
+	stack   []byte // The opening bracket of each enclosing map and list.
+	state   int
+	buf     []byte // Reused for reading strings and numbers.
+	scratch [8]byte
+
+	// maxString, if more than zero, limits the length of strings, in bytes after decoding escapes.
+	// Reading a longer string stops as soon as it passes the limit, and fails with codec.ErrBudgetExhausted.
+	maxString int
+}
+
+func newTokenizer(r io.Reader) *tokenizer {
+	tz := &tokenizer{}
+	if br, ok := r.(io.ByteReader); ok {
+		tz.r = br
+	} else {
+		tz.r = bufio.NewReader(r)
+	}
+	tz.stack = tz.scratch[:0]
+	return tz
+}
+
+func (tz *tokenizer) readByte() (byte, error) {
+	if tz.peeked {
+		tz.peeked = false
+		return tz.last, nil
+	}
+	b, err := tz.r.ReadByte()
+	tz.last = b
+	return b, err
+}
+
+func (tz *tokenizer) unreadByte() {
+	tz.peeked = true
+}
+
+func isSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\n' || b == '\r'
+}
+
+// readNonSpace reads the next byte which isn't whitespace.
+func (tz *tokenizer) readNonSpace() (byte, error) {
+	for {
+		b, err := tz.readByte()
+		if err != nil || !isSpace(b) {
+			return b, err
+		}
+	}
+}
+
+// step reads the next token into tk.
+// It returns io.EOF only if the data ends before the token starts, when no map or list is open.
+func (tz *tokenizer) step(tk *token) error {
+	b, err := tz.readNonSpace()
+	if err != nil {
+		if err == io.EOF && len(tz.stack) > 0 {
+			return io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	if len(tz.stack) > 0 {
+		open := tz.stack[len(tz.stack)-1]
+		closing, closeKind := byte('}'), tokenMapClose
+		if open == '[' {
+			closing, closeKind = ']', tokenListClose
+		}
+		switch tz.state {
+		case stateFirst, stateAfterValue:
+			if b == closing {
+				tz.stack = tz.stack[:len(tz.stack)-1]
+				tz.state = stateAfterValue
+				tk.kind = closeKind
+				return nil
+			}
+			if tz.state == stateAfterValue {
+				if b != ',' {
+					return fmt.Errorf("invalid json: expected ',' or '%c', found %q", closing, b)
+				}
+				if b, err = tz.readNonSpace(); err != nil {
+					return noEOF(err)
+				}
+			}
+			if open == '{' {
+				if b != '"' {
+					return fmt.Errorf("invalid json: expected a string map key, found %q", b)
+				}
+				tz.state = stateAfterKey
+				tk.kind = tokenString
+				tk.str, err = tz.readString(tz.maxString)
+				return err
+			}
+		case stateAfterKey:
+			if b != ':' {
+				return fmt.Errorf("invalid json: expected ':' after map key, found %q", b)
+			}
+			if b, err = tz.readNonSpace(); err != nil {
+				return noEOF(err)
+			}
+		}
+	}
+	tz.state = stateAfterValue
+	switch b {
+	case '{':
+		tz.stack = append(tz.stack, b)
+		tz.state = stateFirst
+		tk.kind = tokenMapOpen
+		return nil
+	case '[':
+		tz.stack = append(tz.stack, b)
+		tz.state = stateFirst
+		tk.kind = tokenListOpen
+		return nil
+	case '"':
+		tk.kind = tokenString
+		tk.str, err = tz.readString(tz.maxString)
+		return err
+	case 'n':
+		tk.kind = tokenNull
+		return tz.readLiteral("ull")
+	case 't':
+		tk.kind, tk.bool = tokenBool, true
+		return tz.readLiteral("rue")
+	case 'f':
+		tk.kind, tk.bool = tokenBool, false
+		return tz.readLiteral("alse")
+	case '-', '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
+		return tz.readNumber(b, tk)
+	default:
+		return fmt.Errorf("invalid json: unexpected %q while expecting start of value", b)
+	}
+}
+
+// readLiteral reads the rest of true, false, or null.
+func (tz *tokenizer) readLiteral(rest string) error {
+	for i := 0; i < len(rest); i++ {
+		b, err := tz.readByte()
+		if err != nil {
+			return noEOF(err)
+		}
+		if b != rest[i] {
+			return fmt.Errorf("invalid json: unexpected %q in literal", b)
+		}
+	}
+	return nil
+}
+
+// next reads the next byte, if there is one.
+func (tz *tokenizer) next() (byte, bool, error) {
+	b, err := tz.readByte()
+	if err == io.EOF {
+		return 0, false, nil
+	}
+	return b, err == nil, err
+}
+
+// readDigits reads as many digits as there are, into buf, and returns how many there were.
+func (tz *tokenizer) readDigits() (int, error) {
+	n := 0
+	for {
+		b, ok, err := tz.next()
+		if err != nil {
+			return n, err
+		}
+		if !ok {
+			return n, nil
+		}
+		if b < '0' || b > '9' {
+			tz.unreadByte()
+			return n, nil
+		}
+		tz.buf = append(tz.buf, b)
+		n++
+	}
+}
+
+// readNumber reads a number, whose first byte has been read.
+// It gives an int if the number has no fraction or exponent, and a float otherwise.
+func (tz *tokenizer) readNumber(first byte, tk *token) error {
+	tz.buf = append(tz.buf[:0], first)
+	isFloat := false
+	// The integer part: either a zero alone, or digits not starting with zero.
+	intStart := first
+	if first == '-' {
+		b, ok, err := tz.next()
+		if err != nil {
+			return err
+		}
+		if !ok || b < '0' || b > '9' {
+			return fmt.Errorf("invalid json: expected a digit after '-'")
+		}
+		tz.buf = append(tz.buf, b)
+		intStart = b
+	}
+	if intStart != '0' {
+		if _, err := tz.readDigits(); err != nil {
+			return err
+		}
+	}
+	// The fraction and the exponent, if there are any.
+	b, ok, err := tz.next()
+	if err != nil {
+		return err
+	}
+	if ok && b == '.' {
+		isFloat = true
+		tz.buf = append(tz.buf, b)
+		if n, err := tz.readDigits(); err != nil {
+			return err
+		} else if n == 0 {
+			return fmt.Errorf("invalid json: expected a digit after '.' in number %s", tz.buf)
+		}
+		if b, ok, err = tz.next(); err != nil {
+			return err
+		}
+	}
+	if ok && (b == 'e' || b == 'E') {
+		isFloat = true
+		tz.buf = append(tz.buf, b)
+		if b, ok, err = tz.next(); err != nil {
+			return err
+		}
+		if ok && (b == '+' || b == '-') {
+			tz.buf = append(tz.buf, b)
+			if b, ok, err = tz.next(); err != nil {
+				return err
+			}
+		}
+		if !ok || b < '0' || b > '9' {
+			return fmt.Errorf("invalid json: expected a digit in the exponent of number %s", tz.buf)
+		}
+		tz.unreadByte()
+		if _, err := tz.readDigits(); err != nil {
+			return err
+		}
+		if b, ok, err = tz.next(); err != nil {
+			return err
+		}
+	}
+	if ok {
+		tz.unreadByte()
+	}
+	if !isFloat {
+		v, err := strconv.ParseInt(string(tz.buf), 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid json: integer %s out of range of int64", tz.buf)
+		}
+		tk.kind, tk.int = tokenInt, v
+		return nil
+	}
+	v, err := strconv.ParseFloat(string(tz.buf), 64)
+	if err != nil {
+		return fmt.Errorf("invalid json: float %s out of range of float64", tz.buf)
+	}
+	tk.kind, tk.float = tokenFloat, v
+	return nil
+}
+
+// readString reads a string, after its opening quote, and returns its value.
+// Escapes are decoded, and invalid UTF-8 (including unpaired surrogates) is replaced with U+FFFD.
+// If limit is more than zero, strings longer than that fail with codec.ErrBudgetExhausted, without being read any further.
+func (tz *tokenizer) readString(limit int) (string, error) {
+	buf := tz.buf[:0]
+	defer func() { tz.buf = buf }()
+	for {
+		if limit > 0 && len(buf) > limit {
+			return "", codec.ErrBudgetExhausted{Budget: codec.BudgetStringLength}
+		}
+		b, err := tz.readByte()
+		if err != nil {
+			return "", noEOF(err)
+		}
+		switch {
+		case b == '"':
+			if !utf8.Valid(buf) {
+				return toValidUTF8(buf), nil
+			}
+			return string(buf), nil
+		case b < 0x20:
+			return "", fmt.Errorf("invalid json: unescaped control character 0x%02x in string", b)
+		case b != '\\':
+			buf = append(buf, b)
+			continue
+		}
+		e, err := tz.readByte()
+		if err != nil {
+			return "", noEOF(err)
+		}
+		if e != 'u' {
+			var ok bool
+			if buf, ok = appendEscape(buf, e); !ok {
+				return "", fmt.Errorf("invalid json: invalid escape '\\%c' in string", e)
+			}
+			continue
+		}
+		r, err := tz.readHex4()
+		if err != nil {
+			return "", err
+		}
+		if !utf16.IsSurrogate(r) {
+			buf = appendRune(buf, r)
+			continue
+		}
+		// A surrogate should be followed by the other half of its pair, as another \u escape.
+		// If it isn't, it's replaced with U+FFFD, and whatever does follow it is handled as usual.
+		if b, err = tz.readByte(); err != nil {
+			return "", noEOF(err)
+		}
+		if b != '\\' {
+			tz.unreadByte()
+			buf = appendRune(buf, utf8.RuneError)
+			continue
+		}
+		if e, err = tz.readByte(); err != nil {
+			return "", noEOF(err)
+		}
+		if e != 'u' {
+			buf = appendRune(buf, utf8.RuneError)
+			var ok bool
+			if buf, ok = appendEscape(buf, e); !ok {
+				return "", fmt.Errorf("invalid json: invalid escape '\\%c' in string", e)
+			}
+			continue
+		}
+		r2, err := tz.readHex4()
+		if err != nil {
+			return "", err
+		}
+		if pair := utf16.DecodeRune(r, r2); pair != utf8.RuneError {
+			buf = appendRune(buf, pair)
+			continue
+		}
+		buf = appendRune(buf, utf8.RuneError)
+		buf = appendRune(buf, r2) // If this is a surrogate too, it also becomes U+FFFD.
+	}
+}
+
+// readHex4 reads the four hex digits of a \u escape.
+func (tz *tokenizer) readHex4() (rune, error) {
+	var r rune
+	for i := 0; i < 4; i++ {
+		b, err := tz.readByte()
+		if err != nil {
+			return 0, noEOF(err)
+		}
+		switch {
+		case '0' <= b && b <= '9':
+			b -= '0'
+		case 'a' <= b && b <= 'f':
+			b -= 'a' - 10
+		case 'A' <= b && b <= 'F':
+			b -= 'A' - 10
+		default:
+			return 0, fmt.Errorf("invalid json: invalid hex digit %q in \\u escape", b)
+		}
+		r = r<<4 | rune(b)
+	}
+	return r, nil
+}
+
+// appendEscape appends the character which a single character escape stands for.
+// It returns false if there's no such escape.
+func appendEscape(buf []byte, e byte) ([]byte, bool) {
+	switch e {
+	case '"', '\\', '/':
+		return append(buf, e), true
+	case 'b':
+		return append(buf, '\b'), true
+	case 'f':
+		return append(buf, '\f'), true
+	case 'n':
+		return append(buf, '\n'), true
+	case 'r':
+		return append(buf, '\r'), true
+	case 't':
+		return append(buf, '\t'), true
+	default:
+		return buf, false
+	}
+}
+
+func appendRune(buf []byte, r rune) []byte {
+	var enc [utf8.UTFMax]byte
+	return append(buf, enc[:utf8.EncodeRune(enc[:], r)]...)
+}
+
+// toValidUTF8 replaces each byte of invalid UTF-8 with U+FFFD.
+func toValidUTF8(b []byte) string {
+	valid := make([]byte, 0, len(b)+8)
+	for len(b) > 0 {
+		r, size := utf8.DecodeRune(b)
+		valid = appendRune(valid, r)
+		b = b[size:]
+	}
+	return string(valid)
+}
+
+// noEOF turns io.EOF into io.ErrUnexpectedEOF, for reads in the middle of a token.
+func noEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
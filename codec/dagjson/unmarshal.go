@@ -1,15 +1,15 @@
 package dagjson
 
 import (
+	"bytes"
 	"encoding/base64"
 	"fmt"
 	"io"
+	"io/ioutil"
 
 	cid "github.com/ipfs/go-cid"
-	"github.com/polydawn/refmt/json"
-	"github.com/polydawn/refmt/shared"
-	"github.com/polydawn/refmt/tok"
 
+	"github.com/ipld/go-ipld-prime/codec"
 	"github.com/ipld/go-ipld-prime/datamodel"
 	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
 )
@@ -32,15 +32,67 @@ type DecodeOptions struct {
 	// If true, parse DAG-JSON `{"/":{"bytes":"base64 bytes..."}}` as a Bytes kind
 	// node rather than nested plain maps
 	ParseBytes bool
+
+	// LinkDecoder, if set, is used to parse the string in the `{"/":"..."}` form into a link
+	// (when ParseLinks is true).
+	// If nil, the string is parsed as a CID, giving a cidlink.Link.
+	LinkDecoder func(string) (datamodel.Link, error)
+
+	// AllocationBudget limits the memory the decoded data may demand, very roughly in bytes.
+	// If zero (or negative), there's no limit.
+	AllocationBudget int
+
+	// MaxDepth limits how deeply maps and lists may be nested.
+	// If zero, there's no limit.
+	MaxDepth int
+
+	// MaxStringLength limits the length of any one string, bytes, or map key, in bytes.
+	// If zero, there's no limit.
+	// Reading a string stops as soon as it's too long, so not much more than the limit is ever held in memory.
+	// (With ParseBytes, strings are allowed to be as long as the base64 of bytes of the limit's length, until they're decoded.)
+	MaxStringLength int
+
+	// Strict rejects any data which isn't in the canonical form of DAG-JSON:
+	// that is, anything which Encode (with its default options) wouldn't re-encode to exactly the same bytes.
+	// That rules out:
+	//   - whitespace, anywhere outside of strings (including before or after the value);
+	//   - map keys which aren't sorted bytewise, and repeated map keys;
+	//   - integers with leading zeros, or "-0", and integers which don't fit in an int64;
+	//   - floats not written in their shortest form (so, also floats with integral values, such as "1.0");
+	//   - strings escaped any other way than Encode escapes them;
+	//   - links whose string isn't the one the link gives back, when ParseLinks is set,
+	//     and bytes with padding or stray bits in their base64, when ParseBytes is set;
+	//   - and anything after the value.
+	// Each rejection is a codec.ErrNotCanonical, saying why, and where.
+	//
+	// To check the data, Decode reads all of it into memory first.
+	Strict bool
 }
 
+// Exceeding any of the limits in DecodeOptions returns a codec.ErrBudgetExhausted saying which.
+
+const (
+	mapEntryGasScore  = 8
+	listEntryGasScore = 4
+)
+
 // Decode deserializes data from the given io.Reader and feeds it into the given datamodel.NodeAssembler.
 // Decode fits the codec.Decoder function interface.
 //
 // The behavior of the decoder can be customized by setting fields in the DecodeOptions struct before calling this method.
 func (cfg DecodeOptions) Decode(na datamodel.NodeAssembler, r io.Reader) error {
-	err := Unmarshal(na, json.NewDecoder(r), cfg)
-	if err != nil {
+	if cfg.Strict {
+		data, err := ioutil.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		if err := checkCanonical(data, cfg); err != nil {
+			return err
+		}
+		r = bytes.NewReader(data)
+	}
+	tz := newTokenizer(r)
+	if err := unmarshal(na, tz, cfg); err != nil {
 		return err
 	}
 	// Slurp any remaining whitespace.
@@ -50,51 +102,84 @@ func (cfg DecodeOptions) Decode(na datamodel.NodeAssembler, r io.Reader) error {
 	//  (We can't actually support multiple objects per reader from here;
 	//   we can't unpeek if we find a non-whitespace token, so our only
 	//    option is to error if this reader seems to contain more content.)
-	var buf [1]byte
 	for {
-		_, err := r.Read(buf[:])
-		switch buf[0] {
+		b, err := tz.readByte()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		switch b {
 		case ' ', 0x0, '\t', '\r', '\n': // continue
 		default:
 			return fmt.Errorf("unexpected content after end of json object")
 		}
-		if err == nil {
-			continue
-		} else if err == io.EOF {
-			return nil
-		} else {
-			return err
-		}
 	}
 }
 
-// Future work: we would like to remove the Unmarshal function,
-// and in particular, stop seeing types from refmt (like shared.TokenSource) be visible.
-// Right now, some kinds of configuration (e.g. for whitespace and prettyprint) are only available through interacting with the refmt types;
-// we should improve our API so that this can be done with only our own types in this package.
-
 // Unmarshal is a deprecated function.
 // Please consider switching to DecodeOptions.Decode instead.
-func Unmarshal(na datamodel.NodeAssembler, tokSrc shared.TokenSource, options DecodeOptions) error {
+//
+// Unlike Decode, Unmarshal ignores Strict, and doesn't check for data after the end of the value.
+// If r isn't an io.ByteReader, Unmarshal may read past the end of the value.
+func Unmarshal(na datamodel.NodeAssembler, r io.Reader, options DecodeOptions) error {
+	return unmarshal(na, newTokenizer(r), options)
+}
+
+func unmarshal(na datamodel.NodeAssembler, tz *tokenizer, options DecodeOptions) error {
 	var st unmarshalState
 	st.options = options
-	done, err := tokSrc.Step(&st.tk[0])
-	if err == io.EOF {
-		return io.ErrUnexpectedEOF
-	}
-	if err != nil {
-		return err
+	st.gas = options.AllocationBudget
+	if st.gas <= 0 {
+		st.gas = int(^uint(0) >> 1)
+	}
+	tz.maxString = options.MaxStringLength
+	if options.ParseBytes && tz.maxString > 0 {
+		// Bytes are checked against the limit once decoded, so their base64 can be longer;
+		// and the "bytes" key in their encapsulation isn't checked at all.
+		tz.maxString = base64.RawStdEncoding.EncodedLen(tz.maxString)
+		if tz.maxString < len("bytes") {
+			tz.maxString = len("bytes")
+		}
 	}
-	if done && !st.tk[0].Type.IsValue() && st.tk[0].Type != tok.TNull {
-		return fmt.Errorf("unexpected eof")
+	if err := tz.step(&st.tk[0]); err != nil {
+		return noEOF(err)
 	}
-	return st.unmarshal(na, tokSrc)
+	return st.unmarshal(na, tz)
 }
 
 type unmarshalState struct {
-	tk      [7]tok.Token // mostly, only 0'th is used... but [1:7] are used during lookahead for links.
-	shift   int          // how many times to slide something out of tk[1:7] instead of getting a new token.
+	tk      [7]token // mostly, only 0'th is used... but [1:7] are used during lookahead for links.
+	shift   int      // how many times to slide something out of tk[1:7] instead of getting a new token.
 	options DecodeOptions
+	gas     int // Remaining allocation budget.
+	depth   int // How many maps and lists enclose the value being decoded.
+}
+
+// spend charges some gas against the allocation budget.
+func (st *unmarshalState) spend(gas int) error {
+	st.gas -= gas
+	if st.gas < 0 {
+		return codec.ErrBudgetExhausted{Budget: codec.BudgetAllocation}
+	}
+	return nil
+}
+
+// spendString checks a string (or bytes, or map key) against the length limit, and charges it against the allocation budget.
+func (st *unmarshalState) spendString(length int) error {
+	if st.options.MaxStringLength > 0 && length > st.options.MaxStringLength {
+		return codec.ErrBudgetExhausted{Budget: codec.BudgetStringLength}
+	}
+	return st.spend(length)
+}
+
+// enter is called when a map or list begins, and checks the depth limit.  The caller must defer a decrement of st.depth.
+func (st *unmarshalState) enter() error {
+	if st.options.MaxDepth > 0 && st.depth >= st.options.MaxDepth {
+		return codec.ErrBudgetExhausted{Budget: codec.BudgetDepth}
+	}
+	st.depth++
+	return nil
 }
 
 // step leaves a "new" token in tk[0],
@@ -108,11 +193,10 @@ type unmarshalState struct {
 //   - the second map key
 // and so (fortunately! whew!) we can do this in a fixed amount of memory,
 // since none of those states can reach a recursion.
-func (st *unmarshalState) step(tokSrc shared.TokenSource) error {
+func (st *unmarshalState) step(tz *tokenizer) error {
 	switch st.shift {
 	case 0:
-		_, err := tokSrc.Step(&st.tk[0])
-		return err
+		return noEOF(tz.step(&st.tk[0]))
 	case 1:
 		st.tk[0] = st.tk[1]
 		st.shift--
@@ -158,10 +242,10 @@ func (st *unmarshalState) step(tokSrc shared.TokenSource) error {
 }
 
 // ensure checks that the token lookahead-ahead (tk[lookhead]) is loaded from the underlying source.
-func (st *unmarshalState) ensure(tokSrc shared.TokenSource, lookahead int) error {
+func (st *unmarshalState) ensure(tz *tokenizer, lookahead int) error {
 	if st.shift < lookahead {
-		if _, err := tokSrc.Step(&st.tk[lookahead]); err != nil {
-			return err
+		if err := tz.step(&st.tk[lookahead]); err != nil {
+			return noEOF(err)
 		}
 		st.shift = lookahead
 	}
@@ -175,41 +259,53 @@ func (st *unmarshalState) ensure(tokSrc shared.TokenSource, lookahead int) error
 // in case of error, the error should just rise.
 // If the bool return is true, we got a link, and you should not
 // continue to attempt to build a map.
-func (st *unmarshalState) linkLookahead(na datamodel.NodeAssembler, tokSrc shared.TokenSource) (bool, error) {
+func (st *unmarshalState) linkLookahead(na datamodel.NodeAssembler, tz *tokenizer) (bool, error) {
 	// Peek next token.  If it's a "/" string, link is still a possibility
-	if err := st.ensure(tokSrc, 1); err != nil {
+	if err := st.ensure(tz, 1); err != nil {
 		return false, err
 	}
-	if st.tk[1].Type != tok.TString {
+	if st.tk[1].kind != tokenString {
 		return false, nil
 	}
-	if st.tk[1].Str != "/" {
+	if st.tk[1].str != "/" {
 		return false, nil
 	}
 	// Peek next token.  If it's a string, link is still a possibility.
 	//  We won't try to parse it as a CID until we're sure it's the only thing in the map, though.
-	if err := st.ensure(tokSrc, 2); err != nil {
+	if err := st.ensure(tz, 2); err != nil {
 		return false, err
 	}
-	if st.tk[2].Type != tok.TString {
+	if st.tk[2].kind != tokenString {
 		return false, nil
 	}
 	// Peek next token.  If it's map close, we've got a link!
 	//  (Otherwise it had better be a string, because another map key is the
 	//   only other valid transition here... but we'll leave that check to the caller.
-	if err := st.ensure(tokSrc, 3); err != nil {
+	if err := st.ensure(tz, 3); err != nil {
 		return false, err
 	}
-	if st.tk[3].Type != tok.TMapClose {
+	if st.tk[3].kind != tokenMapClose {
 		return false, nil
 	}
 	// Okay, we made it -- this looks like a link.  Parse it.
-	//  If it *doesn't* parse as a CID, we treat this as an error.
-	elCid, err := cid.Decode(st.tk[2].Str)
-	if err != nil {
+	//  If it *doesn't* parse as a CID (or whatever the LinkDecoder expects), we treat this as an error.
+	if err := st.spendString(len(st.tk[2].str)); err != nil {
 		return false, err
 	}
-	if err := na.AssignLink(cidlink.Link{Cid: elCid}); err != nil {
+	var lnk datamodel.Link
+	if st.options.LinkDecoder != nil {
+		var err error
+		if lnk, err = st.options.LinkDecoder(st.tk[2].str); err != nil {
+			return false, err
+		}
+	} else {
+		elCid, err := cid.Decode(st.tk[2].str)
+		if err != nil {
+			return false, err
+		}
+		lnk = cidlink.Link{Cid: elCid}
+	}
+	if err := na.AssignLink(lnk); err != nil {
 		return false, err
 	}
 	// consume the look-ahead tokens
@@ -217,57 +313,60 @@ func (st *unmarshalState) linkLookahead(na datamodel.NodeAssembler, tokSrc share
 	return true, nil
 }
 
-func (st *unmarshalState) bytesLookahead(na datamodel.NodeAssembler, tokSrc shared.TokenSource) (bool, error) {
+func (st *unmarshalState) bytesLookahead(na datamodel.NodeAssembler, tz *tokenizer) (bool, error) {
 	// Peek next token.  If it's a "/" string, bytes is still a possibility
-	if err := st.ensure(tokSrc, 1); err != nil {
+	if err := st.ensure(tz, 1); err != nil {
 		return false, err
 	}
-	if st.tk[1].Type != tok.TString {
+	if st.tk[1].kind != tokenString {
 		return false, nil
 	}
-	if st.tk[1].Str != "/" {
+	if st.tk[1].str != "/" {
 		return false, nil
 	}
 	// Peek next token.  If it's a map, bytes is still a possibility.
-	if err := st.ensure(tokSrc, 2); err != nil {
+	if err := st.ensure(tz, 2); err != nil {
 		return false, err
 	}
-	if st.tk[2].Type != tok.TMapOpen {
+	if st.tk[2].kind != tokenMapOpen {
 		return false, nil
 	}
 	// peek next token. If it's the string "bytes", we're on track.
-	if err := st.ensure(tokSrc, 3); err != nil {
+	if err := st.ensure(tz, 3); err != nil {
 		return false, err
 	}
-	if st.tk[3].Type != tok.TString {
+	if st.tk[3].kind != tokenString {
 		return false, nil
 	}
-	if st.tk[3].Str != "bytes" {
+	if st.tk[3].str != "bytes" {
 		return false, nil
 	}
 	// peek next token. if it's a string, we're on track.
-	if err := st.ensure(tokSrc, 4); err != nil {
+	if err := st.ensure(tz, 4); err != nil {
 		return false, err
 	}
-	if st.tk[4].Type != tok.TString {
+	if st.tk[4].kind != tokenString {
 		return false, nil
 	}
 	// peek next token. if it's the first map close we're on track.
-	if err := st.ensure(tokSrc, 5); err != nil {
+	if err := st.ensure(tz, 5); err != nil {
 		return false, err
 	}
-	if st.tk[5].Type != tok.TMapClose {
+	if st.tk[5].kind != tokenMapClose {
 		return false, nil
 	}
 	// Peek next token.  If it's map close, we've got bytes!
-	if err := st.ensure(tokSrc, 6); err != nil {
+	if err := st.ensure(tz, 6); err != nil {
 		return false, err
 	}
-	if st.tk[6].Type != tok.TMapClose {
+	if st.tk[6].kind != tokenMapClose {
 		return false, nil
 	}
 	// Okay, we made it -- this looks like bytes.  Parse it.
-	elBytes, err := base64.RawStdEncoding.DecodeString(st.tk[4].Str)
+	if err := st.spendString(base64.RawStdEncoding.DecodedLen(len(st.tk[4].str))); err != nil {
+		return false, err
+	}
+	elBytes, err := base64.RawStdEncoding.DecodeString(st.tk[4].str)
 	if err != nil {
 		return false, err
 	}
@@ -281,14 +380,14 @@ func (st *unmarshalState) bytesLookahead(na datamodel.NodeAssembler, tokSrc shar
 
 // starts with the first token already primed.  Necessary to get recursion
 //  to flow right without a peek+unpeek system.
-func (st *unmarshalState) unmarshal(na datamodel.NodeAssembler, tokSrc shared.TokenSource) error {
+func (st *unmarshalState) unmarshal(na datamodel.NodeAssembler, tz *tokenizer) error {
 	// FUTURE: check for schema.TypedNodeBuilder that's going to parse a Link (they can slurp any token kind they want).
-	switch st.tk[0].Type {
-	case tok.TMapOpen:
+	switch st.tk[0].kind {
+	case tokenMapOpen:
 		// dag-json has special needs: we pump a few tokens ahead to look for dag-json's "link" pattern.
 		//  We can't actually call BeginMap until we're sure it's not gonna turn out to be a link.
 		if st.options.ParseLinks {
-			gotLink, err := st.linkLookahead(na, tokSrc)
+			gotLink, err := st.linkLookahead(na, tz)
 			if err != nil { // return in error if any token peeks failed or if structure looked like a link but failed to parse as CID.
 				return err
 			}
@@ -298,7 +397,7 @@ func (st *unmarshalState) unmarshal(na datamodel.NodeAssembler, tokSrc shared.To
 		}
 
 		if st.options.ParseBytes {
-			gotBytes, err := st.bytesLookahead(na, tokSrc)
+			gotBytes, err := st.bytesLookahead(na, tz)
 			if err != nil {
 				return err
 			}
@@ -308,75 +407,99 @@ func (st *unmarshalState) unmarshal(na datamodel.NodeAssembler, tokSrc shared.To
 		}
 
 		// Okay, now back to regularly scheduled map logic.
+		if err := st.enter(); err != nil {
+			return err
+		}
+		defer func() { st.depth-- }()
 		ma, err := na.BeginMap(-1)
 		if err != nil {
 			return err
 		}
 		for {
-			err := st.step(tokSrc) // shift next token into slot 0.
-			if err != nil {        // return in error if next token unreadable
+			err := st.step(tz) // shift next token into slot 0.
+			if err != nil {    // return in error if next token unreadable
 				return err
 			}
-			switch st.tk[0].Type {
-			case tok.TMapClose:
+			switch st.tk[0].kind {
+			case tokenMapClose:
 				return ma.Finish()
-			case tok.TString:
+			case tokenString:
+				if err := st.spendString(len(st.tk[0].str)); err != nil {
+					return err
+				}
+				if err := st.spend(mapEntryGasScore); err != nil {
+					return err
+				}
 				// continue
 			default:
-				return fmt.Errorf("unexpected %s token while expecting map key", st.tk[0].Type)
+				return fmt.Errorf("unexpected %s token while expecting map key", st.tk[0].kind)
 			}
-			mva, err := ma.AssembleEntry(st.tk[0].Str)
+			mva, err := ma.AssembleEntry(st.tk[0].str)
 			if err != nil { // return in error if the key was rejected
 				return err
 			}
 			// Do another shift so the next token is primed before we recurse.
-			err = st.step(tokSrc)
+			err = st.step(tz)
 			if err != nil { // return in error if next token unreadable
 				return err
 			}
-			err = st.unmarshal(mva, tokSrc)
+			err = st.unmarshal(mva, tz)
 			if err != nil { // return in error if some part of the recursion errored
 				return err
 			}
 		}
-	case tok.TMapClose:
+	case tokenMapClose:
 		return fmt.Errorf("unexpected mapClose token")
-	case tok.TArrOpen:
+	case tokenListOpen:
+		if err := st.enter(); err != nil {
+			return err
+		}
+		defer func() { st.depth-- }()
 		la, err := na.BeginList(-1)
 		if err != nil {
 			return err
 		}
 		for {
-			_, err := tokSrc.Step(&st.tk[0])
-			if err != nil {
-				return err
+			if err := tz.step(&st.tk[0]); err != nil {
+				return noEOF(err)
 			}
-			switch st.tk[0].Type {
-			case tok.TArrClose:
+			switch st.tk[0].kind {
+			case tokenListClose:
 				return la.Finish()
 			default:
-				err := st.unmarshal(la.AssembleValue(), tokSrc)
+				if err := st.spend(listEntryGasScore); err != nil {
+					return err
+				}
+				err := st.unmarshal(la.AssembleValue(), tz)
 				if err != nil { // return in error if some part of the recursion errored
 					return err
 				}
 			}
 		}
-	case tok.TArrClose:
+	case tokenListClose:
 		return fmt.Errorf("unexpected arrClose token")
-	case tok.TNull:
+	case tokenNull:
 		return na.AssignNull()
-	case tok.TString:
-		return na.AssignString(st.tk[0].Str)
-	case tok.TBytes:
-		return na.AssignBytes(st.tk[0].Bytes)
-	case tok.TBool:
-		return na.AssignBool(st.tk[0].Bool)
-	case tok.TInt:
-		return na.AssignInt(st.tk[0].Int)
-	case tok.TUint:
-		return na.AssignInt(int64(st.tk[0].Uint)) // FIXME overflow check
-	case tok.TFloat64:
-		return na.AssignFloat(st.tk[0].Float64)
+	case tokenString:
+		if err := st.spendString(len(st.tk[0].str)); err != nil {
+			return err
+		}
+		return na.AssignString(st.tk[0].str)
+	case tokenBool:
+		if err := st.spend(1); err != nil {
+			return err
+		}
+		return na.AssignBool(st.tk[0].bool)
+	case tokenInt:
+		if err := st.spend(1); err != nil {
+			return err
+		}
+		return na.AssignInt(st.tk[0].int)
+	case tokenFloat:
+		if err := st.spend(1); err != nil {
+			return err
+		}
+		return na.AssignFloat(st.tk[0].float)
 	default:
 		panic("unreachable")
 	}
@@ -0,0 +1,168 @@
+package dagjson
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	. "github.com/warpfork/go-wish"
+
+	"github.com/ipld/go-ipld-prime/codec"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+)
+
+func TestDecodeBudgets(t *testing.T) {
+	decode := func(opts DecodeOptions) error {
+		return opts.Decode(basicnode.Prototype.Any.NewBuilder(), strings.NewReader(serial))
+	}
+
+	t.Run("within limits", func(t *testing.T) {
+		Wish(t, decode(DecodeOptions{AllocationBudget: 200, MaxDepth: 3, MaxStringLength: 11}), ShouldEqual, nil)
+	})
+	t.Run("no allocation limit", func(t *testing.T) {
+		Wish(t, decode(DecodeOptions{AllocationBudget: -1}), ShouldEqual, nil)
+	})
+	t.Run("no allocation limit by default", func(t *testing.T) {
+		// Larger than codec.DefaultAllocationBudget, which only dag-cbor applies by default.
+		big := `"` + strings.Repeat("x", codec.DefaultAllocationBudget+1) + `"`
+		Wish(t, Decode(basicnode.Prototype.Any.NewBuilder(), strings.NewReader(big)), ShouldEqual, nil)
+	})
+	t.Run("allocation", func(t *testing.T) {
+		Wish(t, decode(DecodeOptions{AllocationBudget: 20}), ShouldEqual, codec.ErrBudgetExhausted{Budget: codec.BudgetAllocation})
+	})
+	t.Run("depth", func(t *testing.T) {
+		Wish(t, decode(DecodeOptions{MaxDepth: 2}), ShouldEqual, codec.ErrBudgetExhausted{Budget: codec.BudgetDepth})
+	})
+	t.Run("string length", func(t *testing.T) {
+		Wish(t, decode(DecodeOptions{MaxStringLength: 10}), ShouldEqual, codec.ErrBudgetExhausted{Budget: codec.BudgetStringLength})
+	})
+	t.Run("string length is checked while reading", func(t *testing.T) {
+		r := strings.NewReader(`"` + strings.Repeat("x", 1<<20) + `"`)
+		err := DecodeOptions{MaxStringLength: 10}.Decode(basicnode.Prototype.Any.NewBuilder(), r)
+		Wish(t, err, ShouldEqual, codec.ErrBudgetExhausted{Budget: codec.BudgetStringLength})
+		Wish(t, r.Len() > 1<<19, ShouldEqual, true)
+	})
+	t.Run("string length applies to bytes", func(t *testing.T) {
+		err := DecodeOptions{ParseBytes: true, MaxStringLength: 2}.Decode(basicnode.Prototype.Any.NewBuilder(), strings.NewReader(`{"/":{"bytes":"AQID"}}`))
+		Wish(t, err, ShouldEqual, codec.ErrBudgetExhausted{Budget: codec.BudgetStringLength})
+		err = DecodeOptions{ParseBytes: true, MaxStringLength: 3}.Decode(basicnode.Prototype.Any.NewBuilder(), strings.NewReader(`{"/":{"bytes":"AQID"}}`))
+		Wish(t, err, ShouldEqual, nil)
+	})
+}
+
+func TestDecodeStrict(t *testing.T) {
+	decode := func(data string) error {
+		nb := basicnode.Prototype.Any.NewBuilder()
+		return DecodeOptions{ParseLinks: true, ParseBytes: true, Strict: true}.Decode(nb, strings.NewReader(data))
+	}
+	t.Run("canonical data roundtrips", func(t *testing.T) {
+		for _, fixture := range []string{
+			`{"a":1,"b":[1.5,null,true],"c":"x\ny"}`,
+			`{"a":{"/":"bafkqaaa"},"b":{"/":{"bytes":"AQID"}}}`,
+			`9223372036854775807`,
+			`-9223372036854775808`,
+			`[1e-7,1e+21,0.000001,-2.5]`,
+			`"\u0001\u2028\\\"\té"`,
+			`{"":"","a":{},"b":[]}`,
+		} {
+			nb := basicnode.Prototype.Any.NewBuilder()
+			err := DecodeOptions{ParseLinks: true, ParseBytes: true, Strict: true}.Decode(nb, strings.NewReader(fixture))
+			Require(t, err, ShouldEqual, nil)
+			var buf bytes.Buffer
+			Require(t, Encode(nb.Build(), &buf), ShouldEqual, nil)
+			Wish(t, buf.String(), ShouldEqual, fixture)
+		}
+	})
+	for _, tc := range []struct {
+		name   string
+		data   string
+		offset int64
+		reason codec.NonCanonical
+	}{
+		{"unsorted keys", `{"b":1,"a":2}`, 7, codec.NonCanonicalMapKeyOrder},
+		{"keys sorted by length", `{"b":1,"aa":2}`, 7, codec.NonCanonicalMapKeyOrder},
+		{"duplicate keys", `{"a":1,"a":2}`, 7, codec.NonCanonicalDuplicateMapKey},
+		{"leading whitespace", ` 1`, 0, codec.NonCanonicalWhitespace},
+		{"trailing whitespace", "1\n", 1, codec.NonCanonicalWhitespace},
+		{"whitespace in a map", `{"a": 1}`, 5, codec.NonCanonicalWhitespace},
+		{"whitespace in a list", `[1 ,2]`, 2, codec.NonCanonicalWhitespace},
+		{"leading zero", `[01]`, 1, codec.NonCanonicalInteger},
+		{"negative zero", `-0`, 0, codec.NonCanonicalInteger},
+		{"int beyond int64", `9223372036854775808`, 0, codec.NonCanonicalIntegerRange},
+		{"integral float", `1.0`, 0, codec.NonCanonicalFloat},
+		{"float with exponent", `[1.5e0]`, 1, codec.NonCanonicalFloat},
+		{"float too long", `0.10000000000000001`, 0, codec.NonCanonicalFloat},
+		{"float beyond float64", `1e400`, 0, codec.NonCanonicalFloat},
+		{"needless escape", `"\/"`, 0, codec.NonCanonicalString},
+		{"unicode escape", `{"a":"\u0061"}`, 5, codec.NonCanonicalString},
+		{"unescaped control character", "\"\x01\"", 0, codec.NonCanonicalString},
+		{"link not in base32", `{"/":"z2yYDV"}`, 5, codec.NonCanonicalLink},
+		{"stray bits in bytes", `{"/":{"bytes":"AQJ"}}`, 5, codec.NonCanonicalLink},
+		{"more data after whitespace", `1 2`, 1, codec.NonCanonicalWhitespace},
+		{"trailing value", `{}{}`, 2, codec.NonCanonicalTrailingData},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			Wish(t, decode(tc.data), ShouldEqual, codec.ErrNotCanonical{Offset: tc.offset, Reason: tc.reason})
+		})
+	}
+	t.Run("depth limit", func(t *testing.T) {
+		err := DecodeOptions{Strict: true, MaxDepth: 2}.Decode(basicnode.Prototype.Any.NewBuilder(), strings.NewReader(`[[[]]]`))
+		Wish(t, err, ShouldEqual, codec.ErrBudgetExhausted{Budget: codec.BudgetDepth})
+	})
+	t.Run("non-strict decoding is lenient", func(t *testing.T) {
+		Wish(t, Decode(basicnode.Prototype.Any.NewBuilder(), strings.NewReader(`{"b": 1.0, "a":2}`)), ShouldEqual, nil)
+	})
+}
+
+func TestDecodeStrings(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		data   string
+		expect string
+	}{
+		{"plain", `"abc"`, "abc"},
+		{"escapes", `"\"\\\/\b\f\n\r\t"`, "\"\\/\b\f\n\r\t"},
+		{"unicode escape", `"a\u00e9\u2028"`, "a\u00e9\u2028"},
+		{"surrogate pair", `"\ud83d\ude00"`, "\U0001F600"},
+		{"lone surrogate", `"\ud83dx"`, "\ufffdx"},
+		{"invalid utf-8", "\"a\xffb\"", "a\ufffdb"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			nb := basicnode.Prototype.String.NewBuilder()
+			Require(t, Decode(nb, strings.NewReader(tc.data)), ShouldEqual, nil)
+			s, _ := nb.Build().AsString()
+			Wish(t, s, ShouldEqual, tc.expect)
+		})
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		data string
+		err  string
+	}{
+		{"empty", ``, "unexpected EOF"},
+		{"truncated map", `{"a":1`, "unexpected EOF"},
+		{"truncated string", `"abc`, "unexpected EOF"},
+		{"missing comma", `[1 2]`, "invalid json: expected ',' or ']', found '2'"},
+		{"missing colon", `{"a" 1}`, "invalid json: expected ':' after map key, found '1'"},
+		{"trailing comma", `[1,]`, "invalid json: unexpected ']' while expecting start of value"},
+		{"non-string key", `{1:2}`, "invalid json: expected a string map key, found '1'"},
+		{"mismatched brackets", `[1}`, "invalid json: expected ',' or ']', found '}'"},
+		{"bad literal", `nulx`, "invalid json: unexpected 'x' in literal"},
+		{"leading zero", `[01]`, "invalid json: expected ',' or ']', found '1'"},
+		{"bare minus", `-`, "invalid json: expected a digit after '-'"},
+		{"bad escape", `"\x"`, "invalid json: invalid escape '\\x' in string"},
+		{"int beyond int64", `9223372036854775808`, "invalid json: integer 9223372036854775808 out of range of int64"},
+		{"trailing data", `{} x`, "unexpected content after end of json object"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := Decode(basicnode.Prototype.Any.NewBuilder(), strings.NewReader(tc.data))
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			Wish(t, err.Error(), ShouldEqual, tc.err)
+		})
+	}
+}
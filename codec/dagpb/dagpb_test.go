@@ -0,0 +1,225 @@
+package dagpb_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+	cid "github.com/ipfs/go-cid"
+
+	"github.com/ipld/go-ipld-prime/codec/dagpb"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/fluent/qp"
+	"github.com/ipld/go-ipld-prime/linking"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	"github.com/ipld/go-ipld-prime/storage"
+)
+
+func mustCid(t *testing.T, s string) cid.Cid {
+	c, err := cid.Prefix{Version: 1, Codec: 0x55, MhType: 0x12, MhLength: 32}.Sum([]byte(s))
+	qt.Assert(t, err, qt.IsNil)
+	return c
+}
+
+func mustHex(t *testing.T, s string) []byte {
+	b, err := hex.DecodeString(s)
+	qt.Assert(t, err, qt.IsNil)
+	return b
+}
+
+// pbLinkBytes hand-assembles a PBLink (without the outer key and length), with a 36 byte CID.
+func pbLinkBytes(c cid.Cid, rest ...byte) []byte {
+	b := append([]byte{0x0a, byte(len(c.Bytes()))}, c.Bytes()...)
+	return append(b, rest...)
+}
+
+func wrapLink(link []byte) []byte {
+	return append([]byte{0x12, byte(len(link))}, link...)
+}
+
+func TestRoundtrip(t *testing.T) {
+	c1, c2 := mustCid(t, "one"), mustCid(t, "two")
+	for _, tc := range []struct {
+		name    string
+		encoded []byte
+		node    datamodel.Node
+	}{
+		{
+			name:    "empty",
+			encoded: []byte{},
+			node: fluentMap(t, func(ma datamodel.MapAssembler) {
+				qp.MapEntry(ma, "Links", qp.List(0, func(datamodel.ListAssembler) {}))
+			}),
+		},
+		{
+			name:    "data only",
+			encoded: mustHex(t, "0a03616263"),
+			node: fluentMap(t, func(ma datamodel.MapAssembler) {
+				qp.MapEntry(ma, "Links", qp.List(0, func(datamodel.ListAssembler) {}))
+				qp.MapEntry(ma, "Data", qp.Bytes([]byte("abc")))
+			}),
+		},
+		{
+			name:    "empty data",
+			encoded: mustHex(t, "0a00"),
+			node: fluentMap(t, func(ma datamodel.MapAssembler) {
+				qp.MapEntry(ma, "Links", qp.List(0, func(datamodel.ListAssembler) {}))
+				qp.MapEntry(ma, "Data", qp.Bytes([]byte{}))
+			}),
+		},
+		{
+			name: "links and data",
+			encoded: concat(
+				wrapLink(pbLinkBytes(c1, 0x12, 0x01, 'a', 0x18, 0x80, 0x01)),
+				wrapLink(pbLinkBytes(c2)),
+				[]byte{0x0a, 0x01, 0x08},
+			),
+			node: fluentMap(t, func(ma datamodel.MapAssembler) {
+				qp.MapEntry(ma, "Links", qp.List(2, func(la datamodel.ListAssembler) {
+					qp.ListEntry(la, qp.Map(3, func(ma datamodel.MapAssembler) {
+						qp.MapEntry(ma, "Hash", qp.Link(cidlink.Link{Cid: c1}))
+						qp.MapEntry(ma, "Name", qp.String("a"))
+						qp.MapEntry(ma, "Tsize", qp.Int(128))
+					}))
+					qp.ListEntry(la, qp.Map(1, func(ma datamodel.MapAssembler) {
+						qp.MapEntry(ma, "Hash", qp.Link(cidlink.Link{Cid: c2}))
+					}))
+				}))
+				qp.MapEntry(ma, "Data", qp.Bytes([]byte{0x08}))
+			}),
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			nb := basicnode.Prototype.Any.NewBuilder()
+			qt.Assert(t, dagpb.Decode(nb, bytes.NewReader(tc.encoded)), qt.IsNil)
+			qt.Check(t, datamodel.DeepEqual(nb.Build(), tc.node), qt.IsTrue)
+
+			var buf bytes.Buffer
+			qt.Assert(t, dagpb.Encode(tc.node, &buf), qt.IsNil)
+			qt.Check(t, bytes.Equal(buf.Bytes(), tc.encoded), qt.IsTrue, qt.Commentf("%x", buf.Bytes()))
+		})
+	}
+}
+
+func TestEncodeKeyOrder(t *testing.T) {
+	// Keys can be given in any order; the encoding is the same.
+	c := mustCid(t, "one")
+	n := fluentMap(t, func(ma datamodel.MapAssembler) {
+		qp.MapEntry(ma, "Data", qp.Bytes([]byte("x")))
+		qp.MapEntry(ma, "Links", qp.List(1, func(la datamodel.ListAssembler) {
+			qp.ListEntry(la, qp.Map(2, func(ma datamodel.MapAssembler) {
+				qp.MapEntry(ma, "Tsize", qp.Int(3))
+				qp.MapEntry(ma, "Hash", qp.Link(cidlink.Link{Cid: c}))
+			}))
+		}))
+	})
+	var buf bytes.Buffer
+	qt.Assert(t, dagpb.Encode(n, &buf), qt.IsNil)
+	qt.Check(t, buf.Bytes(), qt.DeepEquals, concat(wrapLink(pbLinkBytes(c, 0x18, 0x03)), []byte{0x0a, 0x01, 'x'}))
+}
+
+func TestDecodeStrictness(t *testing.T) {
+	c := mustCid(t, "one")
+	for _, tc := range []struct {
+		name    string
+		encoded []byte
+	}{
+		{"links after data", concat([]byte{0x0a, 0x00}, wrapLink(pbLinkBytes(c)))},
+		{"duplicate data", []byte{0x0a, 0x00, 0x0a, 0x00}},
+		{"unknown node field", []byte{0x1a, 0x00}},
+		{"wrong node wire type", []byte{0x08, 0x01}},
+		{"link without hash", wrapLink([]byte{0x12, 0x01, 'a'})},
+		{"link fields out of order", wrapLink(concat([]byte{0x12, 0x01, 'a'}, pbLinkBytes(c)))},
+		{"duplicate link field", wrapLink(pbLinkBytes(c, 0x18, 0x01, 0x18, 0x01))},
+		{"unknown link field", wrapLink(pbLinkBytes(c, 0x20, 0x01))},
+		{"non-minimal varint", wrapLink(pbLinkBytes(c, 0x18, 0x81, 0x00))},
+		{"bad cid", wrapLink([]byte{0x0a, 0x02, 0x01, 0x02})},
+		{"truncated length", []byte{0x0a, 0x05, 'a'}},
+		{"truncated key", []byte{0x8a}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := dagpb.Decode(basicnode.Prototype.Any.NewBuilder(), bytes.NewReader(tc.encoded))
+			qt.Check(t, errors.Is(err, dagpb.ErrInvalid), qt.IsTrue, qt.Commentf("%v", err))
+		})
+	}
+}
+
+func TestEncodeRejectsOtherShapes(t *testing.T) {
+	c := mustCid(t, "one")
+	for _, tc := range []struct {
+		name string
+		node datamodel.Node
+	}{
+		{"not a map", basicnode.NewString("nope")},
+		{"no links", fluentMap(t, func(ma datamodel.MapAssembler) {
+			qp.MapEntry(ma, "Data", qp.Bytes(nil))
+		})},
+		{"unknown field", fluentMap(t, func(ma datamodel.MapAssembler) {
+			qp.MapEntry(ma, "Links", qp.List(0, func(datamodel.ListAssembler) {}))
+			qp.MapEntry(ma, "Extra", qp.Int(1))
+		})},
+		{"data not bytes", fluentMap(t, func(ma datamodel.MapAssembler) {
+			qp.MapEntry(ma, "Links", qp.List(0, func(datamodel.ListAssembler) {}))
+			qp.MapEntry(ma, "Data", qp.String("abc"))
+		})},
+		{"link without hash", fluentMap(t, func(ma datamodel.MapAssembler) {
+			qp.MapEntry(ma, "Links", qp.List(1, func(la datamodel.ListAssembler) {
+				qp.ListEntry(la, qp.Map(1, func(ma datamodel.MapAssembler) {
+					qp.MapEntry(ma, "Name", qp.String("a"))
+				}))
+			}))
+		})},
+		{"negative tsize", fluentMap(t, func(ma datamodel.MapAssembler) {
+			qp.MapEntry(ma, "Links", qp.List(1, func(la datamodel.ListAssembler) {
+				qp.ListEntry(la, qp.Map(2, func(ma datamodel.MapAssembler) {
+					qp.MapEntry(ma, "Hash", qp.Link(cidlink.Link{Cid: c}))
+					qp.MapEntry(ma, "Tsize", qp.Int(-1))
+				}))
+			}))
+		})},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			qt.Check(t, dagpb.Encode(tc.node, &bytes.Buffer{}), qt.Not(qt.IsNil))
+		})
+	}
+}
+
+func TestLinkSystem(t *testing.T) {
+	// The codec is registered, so the default LinkSystem can store and load dag-pb blocks.
+	lp := cidlink.LinkPrototype{Prefix: cid.Prefix{Version: 1, Codec: 0x70, MhType: 0x12, MhLength: 32}}
+	store := storage.Memory{}
+	lsys := cidlink.DefaultLinkSystem()
+	lsys.StorageReadOpener = store.OpenRead
+	lsys.StorageWriteOpener = store.OpenWrite
+
+	n := fluentMap(t, func(ma datamodel.MapAssembler) {
+		qp.MapEntry(ma, "Links", qp.List(1, func(la datamodel.ListAssembler) {
+			qp.ListEntry(la, qp.Map(1, func(ma datamodel.MapAssembler) {
+				qp.MapEntry(ma, "Hash", qp.Link(cidlink.Link{Cid: mustCid(t, "one")}))
+			}))
+		}))
+		qp.MapEntry(ma, "Data", qp.Bytes([]byte("hello")))
+	})
+	lnk, err := lsys.Store(linking.LinkContext{}, lp, n)
+	qt.Assert(t, err, qt.IsNil)
+	n2, err := lsys.Load(linking.LinkContext{}, lnk, basicnode.Prototype.Any)
+	qt.Assert(t, err, qt.IsNil)
+	qt.Check(t, datamodel.DeepEqual(n, n2), qt.IsTrue)
+}
+
+func fluentMap(t *testing.T, fn func(datamodel.MapAssembler)) datamodel.Node {
+	n, err := qp.BuildMap(basicnode.Prototype.Any, -1, fn)
+	qt.Assert(t, err, qt.IsNil)
+	return n
+}
+
+func concat(bs ...[]byte) []byte {
+	var out []byte
+	for _, b := range bs {
+		out = append(out, b...)
+	}
+	return out
+}
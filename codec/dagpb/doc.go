@@ -0,0 +1,28 @@
+/*
+Package dagpb implements the DAG-PB codec: the protobuf-based format used by UnixFS,
+and by most of the data in IPFS.
+
+DAG-PB can only represent data of one shape, which in the data model is:
+
+	type PBNode struct {
+		Links [PBLink]
+		Data optional Bytes
+	}
+
+	type PBLink struct {
+		Hash Link
+		Name optional String
+		Tsize optional Int
+	}
+
+Decode produces maps of this shape (with the keys in the order above, and absent optional fields left out),
+and Encode accepts maps of this shape (with keys in any order) and nothing else.
+
+Decoding is strict: the only blocks accepted are those which Encode would produce exactly,
+so that decoding and re-encoding any block gives back the same bytes (and so the same CID).
+In particular, fields must appear in the canonical order (all the links, then the data; and within each link, Hash, Name, Tsize),
+unknown or repeated fields are rejected, and varints must be minimally encoded.
+
+See https://ipld.io/specs/codecs/dag-pb/spec/ for the specification.
+*/
+package dagpb
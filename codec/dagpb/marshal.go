@@ -0,0 +1,169 @@
+package dagpb
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/ipld/go-ipld-prime/datamodel"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+)
+
+// Encode serializes a Node of the PBNode shape (see the package documentation) as DAG-PB, to the given io.Writer.
+// Encode fits the codec.Encoder function interface.
+//
+// Nodes of any other shape are rejected.
+// Links are encoded in the order they're listed in; Encode does not sort them.
+func Encode(n datamodel.Node, w io.Writer) error {
+	node, err := readNode(n)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(marshalNode(nil, node))
+	return err
+}
+
+// readNode reads a Node of the PBNode shape into a pbNode, checking the shape as it goes.
+func readNode(n datamodel.Node) (pbNode, error) {
+	var node pbNode
+	if n.Kind() != datamodel.Kind_Map {
+		return node, fmt.Errorf("dagpb: PBNode must be a map, not %s", n.Kind())
+	}
+	var links datamodel.Node
+	for itr := n.MapIterator(); !itr.Done(); {
+		k, v, err := itr.Next()
+		if err != nil {
+			return node, err
+		}
+		ks, err := k.AsString()
+		if err != nil {
+			return node, err
+		}
+		if v.IsAbsent() {
+			continue
+		}
+		switch ks {
+		case "Links":
+			links = v
+		case "Data":
+			if node.data, err = v.AsBytes(); err != nil {
+				return node, fmt.Errorf("dagpb: PBNode Data must be bytes: %w", err)
+			}
+			node.hasData = true
+		default:
+			return node, fmt.Errorf("dagpb: PBNode has unknown field %q", ks)
+		}
+	}
+	if links == nil {
+		return node, fmt.Errorf("dagpb: PBNode must have Links (even if empty)")
+	}
+	if links.Kind() != datamodel.Kind_List {
+		return node, fmt.Errorf("dagpb: PBNode Links must be a list, not %s", links.Kind())
+	}
+	node.links = make([]pbLink, 0, links.Length())
+	for itr := links.ListIterator(); !itr.Done(); {
+		_, v, err := itr.Next()
+		if err != nil {
+			return node, err
+		}
+		link, err := readLink(v)
+		if err != nil {
+			return node, err
+		}
+		node.links = append(node.links, link)
+	}
+	return node, nil
+}
+
+func readLink(n datamodel.Node) (pbLink, error) {
+	var link pbLink
+	if n.Kind() != datamodel.Kind_Map {
+		return link, fmt.Errorf("dagpb: PBLink must be a map, not %s", n.Kind())
+	}
+	for itr := n.MapIterator(); !itr.Done(); {
+		k, v, err := itr.Next()
+		if err != nil {
+			return link, err
+		}
+		ks, err := k.AsString()
+		if err != nil {
+			return link, err
+		}
+		if v.IsAbsent() {
+			continue
+		}
+		switch ks {
+		case "Hash":
+			lnk, err := v.AsLink()
+			if err != nil {
+				return link, fmt.Errorf("dagpb: PBLink Hash must be a link: %w", err)
+			}
+			cl, ok := lnk.(cidlink.Link)
+			if !ok {
+				return link, fmt.Errorf("dagpb: PBLink Hash must be a CID, not %T", lnk)
+			}
+			link.hash = cl.Cid
+		case "Name":
+			if link.name, err = v.AsString(); err != nil {
+				return link, fmt.Errorf("dagpb: PBLink Name must be a string: %w", err)
+			}
+			link.hasName = true
+		case "Tsize":
+			tsize, err := v.AsInt()
+			if err != nil {
+				return link, fmt.Errorf("dagpb: PBLink Tsize must be an int: %w", err)
+			}
+			if tsize < 0 {
+				return link, fmt.Errorf("dagpb: PBLink Tsize must not be negative")
+			}
+			link.tsize, link.hasTsize = uint64(tsize), true
+		default:
+			return link, fmt.Errorf("dagpb: PBLink has unknown field %q", ks)
+		}
+	}
+	if !link.hash.Defined() {
+		return link, fmt.Errorf("dagpb: PBLink must have a Hash")
+	}
+	return link, nil
+}
+
+// marshalNode appends the encoding of a pbNode to buf.
+// Links come before Data: that's the canonical order for DAG-PB, even though it's not field number order.
+func marshalNode(buf []byte, node pbNode) []byte {
+	for _, link := range node.links {
+		encoded := marshalLink(nil, link)
+		buf = appendVarint(buf, 2<<3|wireBytes)
+		buf = appendVarint(buf, uint64(len(encoded)))
+		buf = append(buf, encoded...)
+	}
+	if node.hasData {
+		buf = appendVarint(buf, 1<<3|wireBytes)
+		buf = appendVarint(buf, uint64(len(node.data)))
+		buf = append(buf, node.data...)
+	}
+	return buf
+}
+
+func marshalLink(buf []byte, link pbLink) []byte {
+	hash := link.hash.Bytes()
+	buf = appendVarint(buf, 1<<3|wireBytes)
+	buf = appendVarint(buf, uint64(len(hash)))
+	buf = append(buf, hash...)
+	if link.hasName {
+		buf = appendVarint(buf, 2<<3|wireBytes)
+		buf = appendVarint(buf, uint64(len(link.name)))
+		buf = append(buf, link.name...)
+	}
+	if link.hasTsize {
+		buf = appendVarint(buf, 3<<3|wireVarint)
+		buf = appendVarint(buf, link.tsize)
+	}
+	return buf
+}
+
+func appendVarint(buf []byte, v uint64) []byte {
+	for v >= 0x80 {
+		buf = append(buf, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(buf, byte(v))
+}
@@ -0,0 +1,16 @@
+package dagpb
+
+import (
+	"github.com/ipld/go-ipld-prime/codec"
+	"github.com/ipld/go-ipld-prime/multicodec"
+)
+
+var (
+	_ codec.Decoder = Decode
+	_ codec.Encoder = Encode
+)
+
+func init() {
+	multicodec.RegisterEncoder(0x70, Encode)
+	multicodec.RegisterDecoder(0x70, Decode)
+}
@@ -0,0 +1,279 @@
+package dagpb
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+
+	cid "github.com/ipfs/go-cid"
+
+	"github.com/ipld/go-ipld-prime/datamodel"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+)
+
+// ErrInvalid is wrapped by all the errors Decode returns for blocks which aren't valid DAG-PB.
+var ErrInvalid = errors.New("invalid dag-pb")
+
+func invalid(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrInvalid, fmt.Sprintf(format, args...))
+}
+
+// Protobuf wire types used by DAG-PB.
+const (
+	wireVarint = 0
+	wireBytes  = 2
+)
+
+// pbNode and pbLink hold a decoded block, before it's fed to a NodeAssembler (or after it's read from a Node, for encoding).
+type pbNode struct {
+	links   []pbLink
+	data    []byte
+	hasData bool
+}
+
+type pbLink struct {
+	hash     cid.Cid
+	name     string
+	hasName  bool
+	tsize    uint64
+	hasTsize bool
+}
+
+// Decode deserializes a DAG-PB block from the given io.Reader and feeds it into the given datamodel.NodeAssembler.
+// Decode fits the codec.Decoder function interface.
+//
+// Blocks which aren't strictly canonical DAG-PB are rejected with an error wrapping ErrInvalid.
+func Decode(na datamodel.NodeAssembler, r io.Reader) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	var node pbNode
+	if err := unmarshalNode(data, &node); err != nil {
+		return err
+	}
+	return assembleNode(na, node)
+}
+
+func unmarshalNode(buf []byte, node *pbNode) error {
+	for len(buf) > 0 {
+		field, wireType, n, err := decodeKey(buf)
+		if err != nil {
+			return err
+		}
+		buf = buf[n:]
+		if wireType != wireBytes {
+			return invalid("PBNode field %d has wire type %d, not %d", field, wireType, wireBytes)
+		}
+		chunk, n, err := decodeBytes(buf)
+		if err != nil {
+			return err
+		}
+		buf = buf[n:]
+		switch field {
+		case 1:
+			if node.hasData {
+				return invalid("PBNode has more than one Data field")
+			}
+			node.data, node.hasData = chunk, true
+		case 2:
+			if node.hasData {
+				return invalid("PBNode has a Links field after its Data field")
+			}
+			var link pbLink
+			if err := unmarshalLink(chunk, &link); err != nil {
+				return err
+			}
+			node.links = append(node.links, link)
+		default:
+			return invalid("PBNode has unknown field %d", field)
+		}
+	}
+	return nil
+}
+
+func unmarshalLink(buf []byte, link *pbLink) error {
+	var last uint64 // The last field seen, to check they're in order.
+	for len(buf) > 0 {
+		field, wireType, n, err := decodeKey(buf)
+		if err != nil {
+			return err
+		}
+		buf = buf[n:]
+		if field <= last {
+			if field == last {
+				return invalid("PBLink has more than one field %d", field)
+			}
+			return invalid("PBLink has field %d after field %d", field, last)
+		}
+		last = field
+		switch field {
+		case 1, 2:
+			if wireType != wireBytes {
+				return invalid("PBLink field %d has wire type %d, not %d", field, wireType, wireBytes)
+			}
+			chunk, n, err := decodeBytes(buf)
+			if err != nil {
+				return err
+			}
+			buf = buf[n:]
+			if field == 1 {
+				c, err := cid.Cast(chunk)
+				if err != nil {
+					return invalid("PBLink has an invalid Hash: %v", err)
+				}
+				link.hash = c
+			} else {
+				link.name, link.hasName = string(chunk), true
+			}
+		case 3:
+			if wireType != wireVarint {
+				return invalid("PBLink field %d has wire type %d, not %d", field, wireType, wireVarint)
+			}
+			v, n, err := decodeVarint(buf)
+			if err != nil {
+				return err
+			}
+			buf = buf[n:]
+			if v > math.MaxInt64 {
+				return invalid("PBLink Tsize %d is too large", v)
+			}
+			link.tsize, link.hasTsize = v, true
+		default:
+			return invalid("PBLink has unknown field %d", field)
+		}
+	}
+	if !link.hash.Defined() {
+		return invalid("PBLink has no Hash field")
+	}
+	return nil
+}
+
+// decodeKey decodes a protobuf field key, giving the field number and wire type, and the number of bytes read.
+func decodeKey(buf []byte) (field uint64, wireType int, n int, err error) {
+	v, n, err := decodeVarint(buf)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	field, wireType = v>>3, int(v&7)
+	if field == 0 {
+		return 0, 0, 0, invalid("field number 0")
+	}
+	return field, wireType, n, nil
+}
+
+// decodeBytes decodes a length-prefixed protobuf value, giving the value (not copied) and the number of bytes read.
+func decodeBytes(buf []byte) ([]byte, int, error) {
+	length, n, err := decodeVarint(buf)
+	if err != nil {
+		return nil, 0, err
+	}
+	if length > uint64(len(buf)-n) {
+		return nil, 0, invalid("length %d runs past the end of the block", length)
+	}
+	end := n + int(length)
+	return buf[n:end], end, nil
+}
+
+// decodeVarint decodes a protobuf varint, giving the value and the number of bytes read.
+// Varints which aren't minimally encoded are rejected.
+func decodeVarint(buf []byte) (uint64, int, error) {
+	var v uint64
+	for i := 0; i < len(buf); i++ {
+		if i == 10 {
+			return 0, 0, invalid("varint too long")
+		}
+		b := buf[i]
+		if i == 9 && b > 1 {
+			return 0, 0, invalid("varint overflows 64 bits")
+		}
+		v |= uint64(b&0x7f) << (7 * uint(i))
+		if b < 0x80 {
+			if b == 0 && i > 0 {
+				return 0, 0, invalid("varint not minimally encoded")
+			}
+			return v, i + 1, nil
+		}
+	}
+	return 0, 0, invalid("unexpected end of block in varint")
+}
+
+// assembleNode feeds a decoded block into a NodeAssembler, in the PBNode shape.
+func assembleNode(na datamodel.NodeAssembler, node pbNode) error {
+	size := int64(1)
+	if node.hasData {
+		size = 2
+	}
+	ma, err := na.BeginMap(size)
+	if err != nil {
+		return err
+	}
+	va, err := ma.AssembleEntry("Links")
+	if err != nil {
+		return err
+	}
+	la, err := va.BeginList(int64(len(node.links)))
+	if err != nil {
+		return err
+	}
+	for _, link := range node.links {
+		if err := assembleLink(la.AssembleValue(), link); err != nil {
+			return err
+		}
+	}
+	if err := la.Finish(); err != nil {
+		return err
+	}
+	if node.hasData {
+		va, err := ma.AssembleEntry("Data")
+		if err != nil {
+			return err
+		}
+		if err := va.AssignBytes(node.data); err != nil {
+			return err
+		}
+	}
+	return ma.Finish()
+}
+
+func assembleLink(na datamodel.NodeAssembler, link pbLink) error {
+	size := int64(1)
+	if link.hasName {
+		size++
+	}
+	if link.hasTsize {
+		size++
+	}
+	ma, err := na.BeginMap(size)
+	if err != nil {
+		return err
+	}
+	va, err := ma.AssembleEntry("Hash")
+	if err != nil {
+		return err
+	}
+	if err := va.AssignLink(cidlink.Link{Cid: link.hash}); err != nil {
+		return err
+	}
+	if link.hasName {
+		va, err := ma.AssembleEntry("Name")
+		if err != nil {
+			return err
+		}
+		if err := va.AssignString(link.name); err != nil {
+			return err
+		}
+	}
+	if link.hasTsize {
+		va, err := ma.AssembleEntry("Tsize")
+		if err != nil {
+			return err
+		}
+		if err := va.AssignInt(int64(link.tsize)); err != nil {
+			return err
+		}
+	}
+	return ma.Finish()
+}
@@ -3,8 +3,6 @@ package json
 import (
 	"io"
 
-	rfmtjson "github.com/polydawn/refmt/json"
-
 	"github.com/ipld/go-ipld-prime/codec"
 	"github.com/ipld/go-ipld-prime/codec/dagjson"
 	"github.com/ipld/go-ipld-prime/datamodel"
@@ -40,12 +38,11 @@ func Encode(n datamodel.Node, w io.Writer) error {
 	// Shell out directly to generic inspection path.
 	//  (There's not really any fastpaths of note for json.)
 	// Write another function if you need to tune encoding options about whitespace.
-	return dagjson.Marshal(n, rfmtjson.NewEncoder(w, rfmtjson.EncodeOptions{
-		Line:   []byte{'\n'},
-		Indent: []byte{'\t'},
-	}), dagjson.EncodeOptions{
+	return dagjson.EncodeOptions{
 		EncodeLinks: false,
 		EncodeBytes: false,
 		MapSortMode: codec.MapSortMode_None,
-	})
+		Line:        []byte{'\n'},
+		Indent:      []byte{'\t'},
+	}.Encode(n, w)
 }
@@ -1,5 +1,9 @@
 package datamodel
 
+import (
+	"io"
+)
+
 // Node represents a value in IPLD.  Any point in a tree of data is a node:
 // scalar values (like int64, string, etc) are nodes, and
 // so are recursive values (like map and list).
@@ -165,6 +169,21 @@ type Node interface {
 	Prototype() NodePrototype
 }
 
+// LargeBytesNode is a feature-detection interface for bytes-kinded nodes
+// which can offer their content as a stream, rather than as a single slice.
+//
+// Advanced Data Layouts which present very large byte sequences
+// (for example, files spread across many blocks) will typically implement this,
+// because AsBytes has to load and hold the whole content in memory at once,
+// whereas the reader returned by AsLargeBytes can fetch it incrementally.
+//
+// Each call to AsLargeBytes returns a new reader, positioned at the start of the content.
+type LargeBytesNode interface {
+	Node
+
+	AsLargeBytes() (io.ReadSeeker, error)
+}
+
 // NodePrototype describes a node implementation (all Node have a NodePrototype),
 // and a NodePrototype can always be used to get a NodeBuilder.
 //
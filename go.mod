@@ -7,8 +7,6 @@ require (
 	github.com/ipfs/go-cid v0.0.4
 	github.com/multiformats/go-multicodec v0.3.0
 	github.com/multiformats/go-multihash v0.0.15
-	github.com/polydawn/refmt v0.0.0-20201211092308-30ac6d18308e
-	github.com/smartystreets/goconvey v1.6.4 // indirect
 	github.com/warpfork/go-testmark v0.3.0
 	github.com/warpfork/go-wish v0.0.0-20200122115046-b9ea61034e4a
 )
@@ -0,0 +1,268 @@
+package linking
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ipld/go-ipld-prime/datamodel"
+)
+
+// StoreRequest is one node to be stored by LinkSystem.StoreBatch.
+type StoreRequest struct {
+	LinkContext   LinkContext // May be zero.  If its Ctx is nil, the Ctx given to StoreBatch is used.
+	LinkPrototype datamodel.LinkPrototype
+	Node          datamodel.Node
+}
+
+// BatchOptions configures LinkSystem.StoreBatch.
+type BatchOptions struct {
+	// Concurrency is the number of nodes encoded and hashed at once.
+	// If zero, runtime.GOMAXPROCS is used.
+	Concurrency int
+
+	// OrderedCommits makes blocks get written to storage in the same order as the requests,
+	// with all calls to the StorageWriteOpener and its BlockWriteCommitters made from a single goroutine.
+	// Use this if the storage is not safe for concurrent use, or if it cares about the order blocks arrive in
+	// (for example, because it's appending them to a file meant to be read back in order).
+	//
+	// Otherwise, each block is written as soon as it's encoded, by whichever goroutine encoded it,
+	// so the StorageWriteOpener must be safe for concurrent use.
+	OrderedCommits bool
+
+	// Window bounds how far encoding may run ahead of the commits, when OrderedCommits is set,
+	// which bounds the memory used for encoded nodes waiting for a slow one earlier in the order.
+	// If zero, four times Concurrency is used.
+	// (Without OrderedCommits, each node is committed as soon as it's encoded, so no window is needed.)
+	Window int
+}
+
+// StoreBatch stores many nodes, encoding and hashing several of them at once,
+// and passing the results to storage as they're ready.
+// It's equivalent to calling Store for each request, but much faster for large numbers of nodes.
+//
+// The returned links are in the same order as the requests.
+// If any request fails, the returned errors has the same length as the requests,
+// and holds the error for each request at the same position (nil for those that succeeded);
+// if all succeed, the returned errors is nil.
+// A failure storing one node does not stop the others from being stored.
+// The link for a failed request may still be set, if the failure happened after the link was known
+// (for example, when committing to storage).
+//
+// If ctx is cancelled, requests not yet started fail with the context's error.
+//
+// Each encoded node is held in memory until it's committed; see BatchOptions.Window.
+//
+// With a single node, or when nodes are tiny, the coordination has a cost, and Store may be just as fast.
+func (lsys *LinkSystem) StoreBatch(ctx context.Context, reqs []StoreRequest, opts BatchOptions) ([]datamodel.Link, []error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = runtime.GOMAXPROCS(0)
+	}
+	if opts.Window <= 0 {
+		opts.Window = 4 * opts.Concurrency
+	}
+
+	lnks := make([]datamodel.Link, len(reqs))
+	errs := make([]error, len(reqs))
+	var failed int32
+	fail := func(i int, err error) {
+		errs[i] = err
+		atomic.StoreInt32(&failed, 1)
+	}
+	linkContext := func(i int) LinkContext {
+		lnkCtx := reqs[i].LinkContext
+		if lnkCtx.Ctx == nil {
+			lnkCtx.Ctx = ctx
+		}
+		return lnkCtx
+	}
+
+	// Workers claim requests in order, by incrementing a shared counter.
+	next := int64(-1)
+	claim := func() (int, bool) {
+		i := int(atomic.AddInt64(&next, 1))
+		return i, i < len(reqs)
+	}
+
+	var workers sync.WaitGroup
+	if !opts.OrderedCommits {
+		// Each worker commits what it encodes, straight away, so nothing accumulates.
+		for w := 0; w < opts.Concurrency; w++ {
+			workers.Add(1)
+			go func() {
+				defer workers.Done()
+				for i, ok := claim(); ok; i, ok = claim() {
+					var start time.Time
+					if lsys.OnStore != nil {
+						start = time.Now()
+					}
+					var lnk datamodel.Link
+					var data []byte
+					var inline bool
+					err := ctx.Err()
+					if err == nil {
+						lnk, data, inline, err = lsys.encodeAndHash(linkContext(i), reqs[i].LinkPrototype, reqs[i].Node)
+						lnks[i] = lnk
+					}
+					if err == nil && !inline {
+						err = lsys.commitEncoded(linkContext(i), lnk, data)
+					}
+					if err != nil {
+						fail(i, err)
+					}
+					if lsys.OnStore != nil {
+						lsys.observeStore(linkContext(i), lnk, data, time.Since(start), err)
+					}
+				}
+			}()
+		}
+		workers.Wait()
+	} else {
+		// Workers encode, and this goroutine commits, in order.
+		// Workers don't run further ahead of the commits than the window allows.
+		var mu sync.Mutex
+		cond := sync.NewCond(&mu)
+		committed := 0 // Count of requests committed (or skipped, due to errors) so far.
+		ready := make([]bool, len(reqs))
+		encoded := make([][]byte, len(reqs))
+		inlined := make([]bool, len(reqs))
+		var took []time.Duration // Time spent encoding each node, for observers.
+		if lsys.OnStore != nil {
+			took = make([]time.Duration, len(reqs))
+		}
+		for w := 0; w < opts.Concurrency; w++ {
+			workers.Add(1)
+			go func() {
+				defer workers.Done()
+				for i, ok := claim(); ok; i, ok = claim() {
+					mu.Lock()
+					for i >= committed+opts.Window {
+						cond.Wait()
+					}
+					mu.Unlock()
+					var start time.Time
+					if took != nil {
+						start = time.Now()
+					}
+					var data []byte
+					if err := ctx.Err(); err != nil {
+						fail(i, err)
+					} else {
+						var lnk datamodel.Link
+						lnk, data, inlined[i], err = lsys.encodeAndHash(linkContext(i), reqs[i].LinkPrototype, reqs[i].Node)
+						lnks[i] = lnk
+						if err != nil {
+							fail(i, err)
+						}
+					}
+					if took != nil {
+						took[i] = time.Since(start)
+					}
+					mu.Lock()
+					ready[i], encoded[i] = true, data
+					cond.Broadcast()
+					mu.Unlock()
+				}
+			}()
+		}
+		for i := range reqs {
+			mu.Lock()
+			for !ready[i] {
+				cond.Wait()
+			}
+			data := encoded[i]
+			encoded[i] = nil
+			mu.Unlock()
+			var start time.Time
+			if took != nil {
+				start = time.Now()
+			}
+			if errs[i] == nil && !inlined[i] {
+				if err := lsys.commitEncoded(linkContext(i), lnks[i], data); err != nil {
+					fail(i, err)
+				}
+			}
+			if took != nil {
+				// The time spent waiting for earlier nodes to be committed isn't counted.
+				lsys.observeStore(linkContext(i), lnks[i], data, took[i]+time.Since(start), errs[i])
+			}
+			mu.Lock()
+			committed = i + 1
+			cond.Broadcast()
+			mu.Unlock()
+		}
+		workers.Wait()
+	}
+
+	if atomic.LoadInt32(&failed) == 0 {
+		return lnks, nil
+	}
+	return lnks, errs
+}
+
+// observeStore reports a store made by StoreBatch to the OnStore observer.
+func (lsys *LinkSystem) observeStore(lnkCtx LinkContext, lnk datamodel.Link, data []byte, took time.Duration, err error) {
+	evt := BlockEvent{Link: lnk, Size: int64(len(data)), Duration: took, Err: err}
+	if lnk != nil {
+		evt.Codec = codecOf(lnk)
+	}
+	lsys.OnStore(lnkCtx, evt)
+}
+
+// encodeAndHash encodes a node into memory, and computes its link.
+// If the LinkSystem's InlineChooser says the block should be inlined, inline is true, and the block needn't be stored.
+// The LinkContext is only given to the StorePolicy.
+func (lsys *LinkSystem) encodeAndHash(lnkCtx LinkContext, lp datamodel.LinkPrototype, n datamodel.Node) (lnk datamodel.Link, data []byte, inline bool, err error) {
+	if err := lsys.checkStorePolicy(lnkCtx, lp); err != nil {
+		return nil, nil, false, err
+	}
+	if lnk, data, ok := retainedBlock(n, lp); ok {
+		if ilp, limit := lsys.chooseInline(lp); ilp != nil && len(data) <= limit {
+			lnk, err := lsys.inlineLink(ilp, data)
+			return lnk, data, err == nil, err
+		}
+		return lnk, data, false, nil
+	}
+	encoder, err := lsys.EncoderChooser(lp)
+	if err != nil {
+		return nil, nil, false, ErrLinkingSetup{"could not choose an encoder", err}
+	}
+	hasher, err := lsys.HasherChooser(lp)
+	if err != nil {
+		return nil, nil, false, ErrLinkingSetup{"could not choose a hasher", err}
+	}
+	var buf bytes.Buffer
+	if err := encoder(n, io.MultiWriter(&buf, hasher)); err != nil {
+		return nil, nil, false, err
+	}
+	if ilp, limit := lsys.chooseInline(lp); ilp != nil && buf.Len() <= limit {
+		lnk, err := lsys.inlineLink(ilp, buf.Bytes())
+		return lnk, buf.Bytes(), err == nil, err
+	}
+	return lp.BuildLink(hasher.Sum(nil)), buf.Bytes(), false, nil
+}
+
+// commitEncoded writes an already encoded block to storage.
+func (lsys *LinkSystem) commitEncoded(lnkCtx LinkContext, lnk datamodel.Link, data []byte) error {
+	if lsys.StorageWriteOpener == nil {
+		return ErrLinkingSetup{"no storage configured for writing", io.ErrClosedPipe}
+	}
+	writer, commitFn, err := lsys.StorageWriteOpener(lnkCtx)
+	if err != nil {
+		return ErrStorage{Link: lnk, Path: lnkCtx.LinkPath, Cause: err}
+	}
+	if _, err := writer.Write(data); err != nil {
+		return ErrStorage{Link: lnk, Path: lnkCtx.LinkPath, Cause: err}
+	}
+	if err := commitFn(lnk); err != nil {
+		return ErrStorage{Link: lnk, Path: lnkCtx.LinkPath, Cause: err}
+	}
+	return nil
+}
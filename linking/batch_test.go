@@ -0,0 +1,181 @@
+package linking_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+	"github.com/ipfs/go-cid"
+
+	_ "github.com/ipld/go-ipld-prime/codec/dagcbor"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/linking"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	"github.com/ipld/go-ipld-prime/storage"
+)
+
+var batchLp = cidlink.LinkPrototype{Prefix: cid.Prefix{
+	Version:  1,
+	Codec:    0x71, // dag-cbor
+	MhType:   0x12, // sha2-256
+	MhLength: 32,
+}}
+
+func batchRequests(n int) []linking.StoreRequest {
+	reqs := make([]linking.StoreRequest, n)
+	for i := range reqs {
+		reqs[i] = linking.StoreRequest{LinkPrototype: batchLp, Node: basicnode.NewString(fmt.Sprintf("node %d", i))}
+	}
+	return reqs
+}
+
+// lockedMemory makes a Memory store safe for concurrent writes.
+type lockedMemory struct {
+	mu    sync.Mutex
+	store storage.Memory
+}
+
+func (m *lockedMemory) OpenWrite(lnkCtx linking.LinkContext) (io.Writer, linking.BlockWriteCommitter, error) {
+	var buf bytes.Buffer
+	return &buf, func(lnk datamodel.Link) error {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		w, commit, err := m.store.OpenWrite(lnkCtx)
+		if err != nil {
+			return err
+		}
+		w.Write(buf.Bytes())
+		return commit(lnk)
+	}, nil
+}
+
+func TestStoreBatch(t *testing.T) {
+	t.Run("links match Store, in input order", func(t *testing.T) {
+		mem := &lockedMemory{}
+		lsys := cidlink.DefaultLinkSystem()
+		lsys.StorageWriteOpener = mem.OpenWrite
+		reqs := batchRequests(500)
+		lnks, errs := lsys.StoreBatch(context.Background(), reqs, linking.BatchOptions{Concurrency: 8})
+		qt.Assert(t, errs, qt.IsNil)
+		qt.Assert(t, lnks, qt.HasLen, len(reqs))
+		for i, req := range reqs {
+			qt.Check(t, lnks[i], qt.Equals, lsys.MustComputeLink(req.LinkPrototype, req.Node))
+		}
+		qt.Check(t, mem.store.Bag, qt.HasLen, len(reqs))
+
+		lsys.StorageReadOpener = mem.store.OpenRead
+		n, err := lsys.Load(linking.LinkContext{}, lnks[123], basicnode.Prototype.Any)
+		qt.Assert(t, err, qt.IsNil)
+		qt.Check(t, datamodel.DeepEqual(n, reqs[123].Node), qt.IsTrue)
+	})
+	t.Run("ordered commits", func(t *testing.T) {
+		var order []datamodel.Link
+		var active int32
+		lsys := cidlink.DefaultLinkSystem()
+		lsys.StorageWriteOpener = func(linking.LinkContext) (io.Writer, linking.BlockWriteCommitter, error) {
+			// Deliberately not safe for concurrent use; catch it if it's used that way.
+			if atomic.AddInt32(&active, 1) != 1 {
+				t.Errorf("storage used concurrently")
+			}
+			defer atomic.AddInt32(&active, -1)
+			return ioutil.Discard, func(lnk datamodel.Link) error {
+				order = append(order, lnk)
+				return nil
+			}, nil
+		}
+		reqs := batchRequests(500)
+		lnks, errs := lsys.StoreBatch(context.Background(), reqs, linking.BatchOptions{Concurrency: 8, Window: 8, OrderedCommits: true})
+		qt.Assert(t, errs, qt.IsNil)
+		qt.Check(t, fmt.Sprint(order), qt.Equals, fmt.Sprint(lnks))
+	})
+	t.Run("per-item errors", func(t *testing.T) {
+		mem := &lockedMemory{}
+		lsys := cidlink.DefaultLinkSystem()
+		refuse := lsys.MustComputeLink(batchLp, basicnode.NewString("node 7"))
+		lsys.StorageWriteOpener = func(lnkCtx linking.LinkContext) (io.Writer, linking.BlockWriteCommitter, error) {
+			w, commit, err := mem.OpenWrite(lnkCtx)
+			return w, func(lnk datamodel.Link) error {
+				if lnk == refuse {
+					return fmt.Errorf("refused")
+				}
+				return commit(lnk)
+			}, err
+		}
+		reqs := batchRequests(10)
+		reqs[3].LinkPrototype = cidlink.LinkPrototype{Prefix: cid.Prefix{Version: 1, Codec: 0x9999, MhType: 0x12, MhLength: 32}}
+		for _, ordered := range []bool{false, true} {
+			lnks, errs := lsys.StoreBatch(context.Background(), reqs, linking.BatchOptions{OrderedCommits: ordered})
+			qt.Assert(t, errs, qt.HasLen, len(reqs))
+			for i, err := range errs {
+				switch i {
+				case 3:
+					qt.Check(t, errors.As(err, &linking.ErrLinkingSetup{}), qt.IsTrue)
+					qt.Check(t, lnks[i], qt.IsNil)
+				case 7:
+					qt.Check(t, err, qt.ErrorMatches, `storage error for .*: refused`)
+					qt.Check(t, lnks[i], qt.Equals, refuse)
+				default:
+					qt.Check(t, err, qt.IsNil)
+					qt.Check(t, mem.store.Bag[lnks[i]], qt.Not(qt.IsNil))
+				}
+			}
+		}
+	})
+	t.Run("cancelled", func(t *testing.T) {
+		var writes int32
+		lsys := cidlink.DefaultLinkSystem()
+		lsys.StorageWriteOpener = func(linking.LinkContext) (io.Writer, linking.BlockWriteCommitter, error) {
+			atomic.AddInt32(&writes, 1)
+			return ioutil.Discard, func(datamodel.Link) error { return nil }, nil
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		for _, ordered := range []bool{false, true} {
+			_, errs := lsys.StoreBatch(ctx, batchRequests(100), linking.BatchOptions{OrderedCommits: ordered})
+			qt.Assert(t, errs, qt.HasLen, 100)
+			for _, err := range errs {
+				qt.Check(t, err, qt.Equals, context.Canceled)
+			}
+		}
+		qt.Check(t, writes, qt.Equals, int32(0))
+	})
+}
+
+func BenchmarkStore(b *testing.B) {
+	lsys := cidlink.DefaultLinkSystem()
+	lsys.StorageWriteOpener = func(linking.LinkContext) (io.Writer, linking.BlockWriteCommitter, error) {
+		return ioutil.Discard, func(datamodel.Link) error { return nil }, nil
+	}
+	reqs := batchRequests(1000)
+	b.Run("Store", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for _, req := range reqs {
+				if _, err := lsys.Store(req.LinkContext, req.LinkPrototype, req.Node); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+	b.Run("StoreBatch", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, errs := lsys.StoreBatch(context.Background(), reqs, linking.BatchOptions{}); errs != nil {
+				b.Fatal(errs)
+			}
+		}
+	})
+	b.Run("StoreBatch/ordered", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, errs := lsys.StoreBatch(context.Background(), reqs, linking.BatchOptions{OrderedCommits: true}); errs != nil {
+				b.Fatal(errs)
+			}
+		}
+	})
+}
@@ -31,6 +31,11 @@ func (lnk Link) String() string {
 	return lnk.Cid.String()
 }
 
+// Codec returns the multicodec indicator of the codec the link's data is encoded with.
+func (lnk Link) Codec() uint64 {
+	return lnk.Cid.Type()
+}
+
 type LinkPrototype struct {
 	cid.Prefix
 }
@@ -0,0 +1,62 @@
+package cidlink
+
+import (
+	"math"
+
+	cid "github.com/ipfs/go-cid"
+	multihash "github.com/multiformats/go-multihash"
+
+	"github.com/ipld/go-ipld-prime/datamodel"
+)
+
+// identityData returns the data carried inside a CID which uses the "identity" multihash.
+// It's the InlineData function of the LinkSystems made by this package,
+// so that loading such links never touches storage.
+func identityData(lnk datamodel.Link) ([]byte, bool) {
+	cl, ok := lnk.(Link)
+	if !ok || !cl.Cid.Defined() || cl.Cid.Prefix().MhType != multihash.IDENTITY {
+		return nil, false
+	}
+	dmh, err := multihash.Decode(cl.Cid.Hash())
+	if err != nil {
+		return nil, false
+	}
+	return dmh.Digest, true
+}
+
+// InlineIdentity returns a function suitable for use as a LinkSystem's InlineChooser,
+// which inlines blocks into CIDs using the "identity" multihash.
+//
+// Storing with a LinkPrototype which already uses the identity multihash never writes to storage,
+// whatever the size of the block.
+// (This is how the LinkSystems made by this package behave by default: they use InlineIdentity(0).)
+//
+// If maxSize is more than zero, then blocks which encode to no more than maxSize bytes
+// are also given an identity CID -- with the same codec, and CIDv1 -- instead of the CID they'd otherwise have had,
+// and aren't written to storage either.  Larger blocks are stored as usual.
+// Bear in mind that this changes the links of small blocks, and so the links (and hashes) of everything linking to them.
+//
+// For example, to inline blocks of up to 32 bytes:
+//
+//		lsys := cidlink.DefaultLinkSystem()
+//		lsys.InlineChooser = cidlink.InlineIdentity(32)
+func InlineIdentity(maxSize int) func(datamodel.LinkPrototype) (datamodel.LinkPrototype, int) {
+	return func(lp datamodel.LinkPrototype) (datamodel.LinkPrototype, int) {
+		clp, ok := lp.(LinkPrototype)
+		if !ok {
+			return nil, 0
+		}
+		if clp.MhType == multihash.IDENTITY {
+			return clp, math.MaxInt32
+		}
+		if maxSize <= 0 {
+			return nil, 0
+		}
+		return LinkPrototype{cid.Prefix{
+			Version:  1,
+			Codec:    clp.Codec,
+			MhType:   multihash.IDENTITY,
+			MhLength: -1,
+		}}, maxSize
+	}
+}
@@ -17,6 +17,10 @@ import (
 // and uses the default global multicodec registry (see the go-ipld-prime/multicodec package) for resolving codec implementations,
 // and the default global multihash registry (see the go-multihash/core package) for resolving multihash implementations.
 //
+// Links using the "identity" multihash carry their data within themselves,
+// so the returned LinkSystem loads those without consulting storage, and storing with such a LinkPrototype doesn't write to storage.
+// To also inline small blocks automatically, see InlineIdentity.
+//
 // No storage functions are present in the returned LinkSystem.
 // The caller can assign those themselves as desired.
 func DefaultLinkSystem() linking.LinkSystem {
@@ -67,5 +71,7 @@ func LinkSystemUsingMulticodecRegistry(mcReg multicodec.Registry) linking.LinkSy
 				return nil, fmt.Errorf("this hasherChooser can only handle cidlink.LinkPrototype; got %T", lp)
 			}
 		},
+		InlineData:    identityData,
+		InlineChooser: InlineIdentity(0),
 	}
 }
@@ -0,0 +1,92 @@
+package cidlink
+
+import (
+	"fmt"
+
+	"github.com/ipld/go-ipld-prime/datamodel"
+)
+
+// Policy says which codecs and multihashes are acceptable in CIDs.
+// Its Check method can be used as a LinkSystem's LoadPolicy or StorePolicy,
+// and they can be different -- for example, a program might load data in any format it can,
+// but refuse to load from untrusted peers anything other than a few DAG codecs with strong hashes:
+//
+//		lsys := cidlink.DefaultLinkSystem()
+//		lsys.LoadPolicy = cidlink.StrictPolicy().Check
+//		lsys.StorePolicy = cidlink.Policy{Codecs: []uint64{0x71}, Multihashes: []uint64{0x12}}.Check
+//
+// Refused links are reported as linking.ErrPolicy, wrapping ErrCodecNotAllowed or ErrMultihashNotAllowed.
+type Policy struct {
+	// Codecs lists the multicodec indicators of the codecs allowed.  If nil, any codec is allowed.
+	Codecs []uint64
+
+	// Multihashes lists the multicodec indicators of the multihash functions allowed.  If nil, any is allowed.
+	Multihashes []uint64
+}
+
+// StrictPolicy returns a Policy allowing only the DAG codecs (dag-cbor, dag-json, dag-pb) and raw,
+// and only cryptographically strong hash functions (plus identity, whose "hash" is the data itself).
+// Notably, it refuses the plain json and cbor codecs, which can't represent links,
+// and weak hash functions like sha1 and md5.
+func StrictPolicy() Policy {
+	return Policy{
+		Codecs: []uint64{
+			0x55,   // raw
+			0x70,   // dag-pb
+			0x71,   // dag-cbor
+			0x0129, // dag-json
+		},
+		Multihashes: []uint64{
+			0x00,   // identity
+			0x12,   // sha2-256
+			0x13,   // sha2-512
+			0x14,   // sha3-512
+			0x16,   // sha3-256
+			0x1e,   // blake3
+			0xb220, // blake2b-256
+		},
+	}
+}
+
+// Check returns nil if the policy allows a LinkPrototype, and otherwise an error saying why not.
+// Only LinkPrototype is allowed; other implementations of datamodel.LinkPrototype are refused.
+func (p Policy) Check(lp datamodel.LinkPrototype) error {
+	clp, ok := lp.(LinkPrototype)
+	if !ok {
+		return fmt.Errorf("cidlink policy can only check cidlink.LinkPrototype; got %T", lp)
+	}
+	if p.Codecs != nil && !contains(p.Codecs, clp.Codec) {
+		return ErrCodecNotAllowed{Codec: clp.Codec}
+	}
+	if p.Multihashes != nil && !contains(p.Multihashes, clp.MhType) {
+		return ErrMultihashNotAllowed{Multihash: clp.MhType}
+	}
+	return nil
+}
+
+func contains(list []uint64, v uint64) bool {
+	for _, v2 := range list {
+		if v2 == v {
+			return true
+		}
+	}
+	return false
+}
+
+// ErrCodecNotAllowed is the error from Policy.Check when a CID's codec isn't allowed.
+type ErrCodecNotAllowed struct {
+	Codec uint64
+}
+
+func (e ErrCodecNotAllowed) Error() string {
+	return fmt.Sprintf("codec 0x%x is not allowed", e.Codec)
+}
+
+// ErrMultihashNotAllowed is the error from Policy.Check when a CID's multihash function isn't allowed.
+type ErrMultihashNotAllowed struct {
+	Multihash uint64
+}
+
+func (e ErrMultihashNotAllowed) Error() string {
+	return fmt.Sprintf("multihash 0x%x is not allowed", e.Multihash)
+}
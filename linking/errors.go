@@ -8,7 +8,7 @@ import (
 
 // ErrLinkingSetup is returned by methods on LinkSystem when some part of the system is not set up correctly,
 // or when one of the components refuses to handle a Link or LinkPrototype given.
-// (It is not yielded for errors from the storage nor codec systems once they've started; those errors rise without interference.)
+// (It is not yielded for errors from the storage nor codec systems once they've started; those are reported as ErrNotFound, ErrStorage, or ErrDecode.)
 type ErrLinkingSetup struct {
 	Detail string // Perhaps an enum here as well, which states which internal function was to blame?
 	Cause  error
@@ -28,3 +28,80 @@ type ErrHashMismatch struct {
 func (e ErrHashMismatch) Error() string {
 	return fmt.Sprintf("hash mismatch!  %v (actual) != %v (expected)", e.Actual, e.Expected)
 }
+
+// ErrNotFound is the error returned when storage has no data for a Link.
+//
+// BlockReadOpener implementations should return this error (or an error that wraps it) when they simply don't have the data,
+// so that callers can distinguish that situation from other failures.
+// LinkSystem.Load and LinkSystem.Fill will pass it through, so it can be detected with errors.As
+// (also when it has been further wrapped, such as by the traversal package).
+type ErrNotFound struct {
+	Link datamodel.Link
+	Path datamodel.Path // Path where the link was encountered, if known.  May be zero.
+}
+
+func (e ErrNotFound) Error() string {
+	if e.Path.Len() == 0 {
+		return fmt.Sprintf("block not found: %v", e.Link)
+	}
+	return fmt.Sprintf("block not found: %v (at path %q)", e.Link, e.Path)
+}
+
+// ErrStorage is the error returned by LinkSystem methods when the storage functions
+// (the BlockReadOpener or BlockWriteOpener, or the readers, writers, and committers they return)
+// fail for any reason other than the data being absent (which is signalled by ErrNotFound).
+//
+// The original error is available as Cause, and via Unwrap.
+type ErrStorage struct {
+	Link  datamodel.Link // May be nil when storing, if the failure occurred before the link was known.
+	Path  datamodel.Path // Path where the link was encountered, if known.  May be zero.
+	Cause error
+}
+
+func (e ErrStorage) Error() string {
+	if e.Path.Len() == 0 {
+		return fmt.Sprintf("storage error for %v: %v", e.Link, e.Cause)
+	}
+	return fmt.Sprintf("storage error for %v (at path %q): %v", e.Link, e.Path, e.Cause)
+}
+func (e ErrStorage) Unwrap() error { return e.Cause }
+
+// ErrDecode is the error returned by LinkSystem.Load and LinkSystem.Fill when the data was loaded
+// (and its hash verified, unless the storage is trusted), but the decoder rejected it.
+//
+// The original error from the codec is available as Cause, and via Unwrap.
+type ErrDecode struct {
+	Link  datamodel.Link
+	Path  datamodel.Path // Path where the link was encountered, if known.  May be zero.
+	Cause error
+}
+
+func (e ErrDecode) Error() string {
+	if e.Path.Len() == 0 {
+		return fmt.Sprintf("could not decode %v: %v", e.Link, e.Cause)
+	}
+	return fmt.Sprintf("could not decode %v (at path %q): %v", e.Link, e.Path, e.Cause)
+}
+func (e ErrDecode) Unwrap() error { return e.Cause }
+
+// ErrPolicy is the error returned by LinkSystem methods when the LinkSystem's LoadPolicy refuses a link,
+// or its StorePolicy refuses a LinkPrototype.
+// Nothing is read from or written to storage in either case.
+//
+// The error from the policy function (which says what was wrong) is available as Cause, and via Unwrap.
+type ErrPolicy struct {
+	Link  datamodel.Link // The link refused, for loads.  Nil for stores.
+	Path  datamodel.Path // Path where the link was encountered, if known.  May be zero.
+	Cause error
+}
+
+func (e ErrPolicy) Error() string {
+	if e.Link == nil {
+		return fmt.Sprintf("refused by store policy: %v", e.Cause)
+	}
+	if e.Path.Len() == 0 {
+		return fmt.Sprintf("refused by load policy: %v: %v", e.Link, e.Cause)
+	}
+	return fmt.Sprintf("refused by load policy: %v (at path %q): %v", e.Link, e.Path, e.Cause)
+}
+func (e ErrPolicy) Unwrap() error { return e.Cause }
@@ -0,0 +1,110 @@
+package linking_test
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+	"github.com/ipfs/go-cid"
+
+	_ "github.com/ipld/go-ipld-prime/codec/dagjson"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/fluent/qp"
+	"github.com/ipld/go-ipld-prime/linking"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	"github.com/ipld/go-ipld-prime/storage"
+	"github.com/ipld/go-ipld-prime/traversal"
+)
+
+func TestLoadErrors(t *testing.T) {
+	lp := cidlink.LinkPrototype{Prefix: cid.Prefix{
+		Version:  1,
+		Codec:    0x0129, // dag-json
+		MhType:   0x12,   // sha2-256
+		MhLength: 32,
+	}}
+	store := storage.Memory{}
+	lsys := cidlink.DefaultLinkSystem()
+	lsys.StorageReadOpener = store.OpenRead
+	lsys.StorageWriteOpener = store.OpenWrite
+
+	leaf := lsys.MustStore(linking.LinkContext{}, lp, basicnode.NewString("leaf"))
+	missing := lsys.MustComputeLink(lp, basicnode.NewString("missing"))
+	// A block which hashes correctly, but isn't valid dag-json.
+	garbage := lp.BuildLink(mustHash(t, lsys, lp, []byte(`{"unterminated`)))
+	store.Bag[garbage] = []byte(`{"unterminated`)
+	root := lsys.MustStore(linking.LinkContext{}, lp, mustBuildMap(t, func(ma datamodel.MapAssembler) {
+		qp.MapEntry(ma, "leaf", qp.Link(leaf))
+		qp.MapEntry(ma, "missing", qp.Link(missing))
+		qp.MapEntry(ma, "garbage", qp.Link(garbage))
+	}))
+
+	t.Run("not found", func(t *testing.T) {
+		_, err := lsys.Load(linking.LinkContext{}, missing, basicnode.Prototype.Any)
+		var nf linking.ErrNotFound
+		qt.Assert(t, errors.As(err, &nf), qt.IsTrue)
+		qt.Check(t, nf.Link, qt.Equals, missing)
+	})
+	t.Run("decode failure", func(t *testing.T) {
+		_, err := lsys.Load(linking.LinkContext{}, garbage, basicnode.Prototype.Any)
+		var de linking.ErrDecode
+		qt.Assert(t, errors.As(err, &de), qt.IsTrue)
+		qt.Check(t, de.Link, qt.Equals, garbage)
+		qt.Check(t, errors.As(err, &linking.ErrNotFound{}), qt.IsFalse)
+	})
+	t.Run("hash mismatch", func(t *testing.T) {
+		original := store.Bag[leaf]
+		store.Bag[leaf] = []byte(`"tampered"`)
+		defer func() { store.Bag[leaf] = original }()
+		_, err := lsys.Load(linking.LinkContext{}, leaf, basicnode.Prototype.Any)
+		qt.Check(t, errors.As(err, &linking.ErrHashMismatch{}), qt.IsTrue)
+	})
+	t.Run("storage failure", func(t *testing.T) {
+		lsys := lsys
+		lsys.StorageReadOpener = func(linking.LinkContext, datamodel.Link) (io.Reader, error) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		_, err := lsys.Load(linking.LinkContext{}, leaf, basicnode.Prototype.Any)
+		var se linking.ErrStorage
+		qt.Assert(t, errors.As(err, &se), qt.IsTrue)
+		qt.Check(t, se.Link, qt.Equals, leaf)
+		qt.Check(t, errors.Is(err, io.ErrUnexpectedEOF), qt.IsTrue)
+	})
+	t.Run("through traversal, with paths", func(t *testing.T) {
+		rootNode, err := lsys.Load(linking.LinkContext{}, root, basicnode.Prototype.Any)
+		qt.Assert(t, err, qt.IsNil)
+		prog := traversal.Progress{Cfg: &traversal.Config{
+			LinkSystem: lsys,
+			LinkTargetNodePrototypeChooser: func(datamodel.Link, linking.LinkContext) (datamodel.NodePrototype, error) {
+				return basicnode.Prototype.Any, nil
+			},
+		}}
+
+		_, err = prog.Get(rootNode, datamodel.ParsePath("missing"))
+		var nf linking.ErrNotFound
+		qt.Assert(t, errors.As(err, &nf), qt.IsTrue)
+		qt.Check(t, nf.Path.String(), qt.Equals, "missing")
+
+		_, err = prog.Get(rootNode, datamodel.ParsePath("garbage"))
+		var de linking.ErrDecode
+		qt.Assert(t, errors.As(err, &de), qt.IsTrue)
+		qt.Check(t, de.Path.String(), qt.Equals, "garbage")
+	})
+}
+
+func mustHash(t *testing.T, lsys linking.LinkSystem, lp datamodel.LinkPrototype, data []byte) []byte {
+	h, err := lsys.HasherChooser(lp)
+	qt.Assert(t, err, qt.IsNil)
+	_, err = io.Copy(h, strings.NewReader(string(data)))
+	qt.Assert(t, err, qt.IsNil)
+	return h.Sum(nil)
+}
+
+func mustBuildMap(t *testing.T, fn func(datamodel.MapAssembler)) datamodel.Node {
+	n, err := qp.BuildMap(basicnode.Prototype.Any, -1, fn)
+	qt.Assert(t, err, qt.IsNil)
+	return n
+}
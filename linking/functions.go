@@ -1,9 +1,15 @@
 package linking
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"hash"
 	"io"
+	"io/ioutil"
+	"time"
 
+	"github.com/ipld/go-ipld-prime/codec"
 	"github.com/ipld/go-ipld-prime/datamodel"
 )
 
@@ -23,10 +29,17 @@ import (
 
 func (lsys *LinkSystem) Load(lnkCtx LinkContext, lnk datamodel.Link, np datamodel.NodePrototype) (datamodel.Node, error) {
 	nb := np.NewBuilder()
-	if err := lsys.Fill(lnkCtx, lnk, nb); err != nil {
+	var retained *[]byte
+	if lsys.RetainBlocks && lsys.NodeReifier == nil {
+		retained = new([]byte)
+	}
+	if err := lsys.fillObserved(lnkCtx, lnk, nb, retained); err != nil {
 		return nil, err
 	}
 	nd := nb.Build()
+	if retained != nil {
+		return retain(nd, lnk, *retained), nil
+	}
 	if lsys.NodeReifier == nil {
 		return nd, nil
 	}
@@ -42,9 +55,33 @@ func (lsys *LinkSystem) MustLoad(lnkCtx LinkContext, lnk datamodel.Link, np data
 }
 
 func (lsys *LinkSystem) Fill(lnkCtx LinkContext, lnk datamodel.Link, na datamodel.NodeAssembler) error {
+	return lsys.fillObserved(lnkCtx, lnk, na, nil)
+}
+
+// fillObserved is Fill, with the option of retaining the block's data (see fill).
+func (lsys *LinkSystem) fillObserved(lnkCtx LinkContext, lnk datamodel.Link, na datamodel.NodeAssembler, retained *[]byte) error {
 	if lnkCtx.Ctx == nil {
 		lnkCtx.Ctx = context.Background()
 	}
+	if lsys.OnLoad == nil {
+		return lsys.fill(lnkCtx, lnk, na, nil, retained)
+	}
+	start := time.Now()
+	evt := BlockEvent{Link: lnk, Codec: codecOf(lnk)}
+	evt.Err = lsys.fill(lnkCtx, lnk, na, &evt, retained)
+	evt.Duration = time.Since(start)
+	lsys.OnLoad(lnkCtx, evt)
+	return evt.Err
+}
+
+// fill does the work of Fill.
+// If evt is not nil, the size of the block and the outcome of the hash check are recorded in it.
+// If retained is not nil, the whole block is read into memory before decoding, and kept there;
+// all of it is hashed (not just what the decoder reads), since all of it may later be stored again under the same link.
+func (lsys *LinkSystem) fill(lnkCtx LinkContext, lnk datamodel.Link, na datamodel.NodeAssembler, evt *BlockEvent, retained *[]byte) error {
+	if err := lsys.checkLoadPolicy(lnkCtx, lnk); err != nil {
+		return err
+	}
 	// Choose all the parts.
 	decoder, err := lsys.DecoderChooser(lnk)
 	if err != nil {
@@ -54,18 +91,45 @@ func (lsys *LinkSystem) Fill(lnkCtx LinkContext, lnk datamodel.Link, na datamode
 	if err != nil {
 		return ErrLinkingSetup{"could not choose a hasher", err}
 	}
-	if lsys.StorageReadOpener == nil {
-		return ErrLinkingSetup{"no storage configured for reading", io.ErrClosedPipe} // REVIEW: better cause?
-	}
 	// Open storage, read it, verify it, and feed the codec to assemble the nodes.
-	reader, err := lsys.StorageReadOpener(lnkCtx, lnk)
+	reader, err := lsys.openRead(lnkCtx, lnk)
 	if err != nil {
 		return err
 	}
+	limiter := lsys.limitReader(&reader)
+	if evt != nil {
+		reader = &countingReader{reader, &evt.Size}
+	}
+	if retained != nil {
+		data, err := ioutil.ReadAll(reader)
+		if limiter.exceeded() {
+			return codec.ErrBudgetExhausted{Budget: codec.BudgetBlockSize}
+		}
+		if err != nil {
+			return storageReadError(lnkCtx, lnk, err)
+		}
+		if !lsys.TrustedStorage {
+			hasher.Write(data)
+			if err := checkHash(lnk, hasher, evt); err != nil {
+				return err
+			}
+		}
+		if err := decoder(na, bytes.NewReader(data)); err != nil {
+			return ErrDecode{Link: lnk, Path: lnkCtx.LinkPath, Cause: err}
+		}
+		*retained = data
+		return nil
+	}
 	// TrustaedStorage indicates the data coming out of this reader has already been hashed and verified earlier.
 	// As a result, we can skip rehashing it
 	if lsys.TrustedStorage {
-		return decoder(na, reader)
+		if err := decoder(na, reader); err != nil {
+			if limiter.exceeded() {
+				return codec.ErrBudgetExhausted{Budget: codec.BudgetBlockSize}
+			}
+			return ErrDecode{Link: lnk, Path: lnkCtx.LinkPath, Cause: err}
+		}
+		return nil
 	}
 	// Tee the stream so that the hasher is fed as the unmarshal progresses through the stream.
 	tee := io.TeeReader(reader, hasher)
@@ -73,32 +137,236 @@ func (lsys *LinkSystem) Fill(lnkCtx LinkContext, lnk datamodel.Link, na datamode
 	if decodeErr != nil { // It is important to security to check the hash before returning any other observation about the content.
 		// This copy is for data remaining the block that wasn't already pulled through the TeeReader by the decoder.
 		_, err := io.Copy(hasher, reader)
+		if limiter.exceeded() {
+			return codec.ErrBudgetExhausted{Budget: codec.BudgetBlockSize}
+		}
 		if err != nil {
-			return err
+			return storageReadError(lnkCtx, lnk, err)
 		}
 	}
-	hash := hasher.Sum(nil)
+	if err := checkHash(lnk, hasher, evt); err != nil {
+		return err
+	}
+	if decodeErr != nil {
+		return ErrDecode{Link: lnk, Path: lnkCtx.LinkPath, Cause: decodeErr}
+	}
+	return nil
+}
+
+// openRead opens a reader for the data of a link:
+// from the link itself, if it carries its own data, or otherwise from storage.
+func (lsys *LinkSystem) openRead(lnkCtx LinkContext, lnk datamodel.Link) (io.Reader, error) {
+	if lsys.InlineData != nil {
+		if data, ok := lsys.InlineData(lnk); ok {
+			return bytes.NewReader(data), nil
+		}
+	}
+	if lsys.StorageReadOpener == nil {
+		return nil, ErrLinkingSetup{"no storage configured for reading", io.ErrClosedPipe} // REVIEW: better cause?
+	}
+	reader, err := lsys.StorageReadOpener(lnkCtx, lnk)
+	if err != nil {
+		return nil, storageReadError(lnkCtx, lnk, err)
+	}
+	return reader, nil
+}
+
+// limitReader wraps a reader so that it fails once more than MaxBlockSize bytes have been read from it,
+// if the LinkSystem has a MaxBlockSize.
+// The returned limitedReader can be asked whether that happened; it's nil (and says not) if there's no limit.
+func (lsys *LinkSystem) limitReader(reader *io.Reader) *limitedReader {
+	if lsys.MaxBlockSize <= 0 {
+		return nil
+	}
+	lr := &limitedReader{*reader, lsys.MaxBlockSize}
+	*reader = lr
+	return lr
+}
+
+// limitedReader is like io.LimitedReader, but reading past the limit is an error, rather than EOF.
+type limitedReader struct {
+	r         io.Reader
+	remaining int64 // Goes negative when the limit is exceeded.
+}
+
+func (lr *limitedReader) Read(p []byte) (int, error) {
+	if lr.remaining < 0 {
+		return 0, codec.ErrBudgetExhausted{Budget: codec.BudgetBlockSize}
+	}
+	if int64(len(p)) > lr.remaining+1 {
+		p = p[:lr.remaining+1] // Reading one more byte than allowed is enough to tell.
+	}
+	n, err := lr.r.Read(p)
+	lr.remaining -= int64(n)
+	if lr.remaining < 0 {
+		return 0, codec.ErrBudgetExhausted{Budget: codec.BudgetBlockSize}
+	}
+	return n, err
+}
+
+func (lr *limitedReader) exceeded() bool {
+	return lr != nil && lr.remaining < 0
+}
+
+// checkHash checks that a hasher, which has been fed all of a block, agrees with the block's link.
+// If evt is not nil, the outcome is recorded in it.
+func checkHash(lnk datamodel.Link, hasher hash.Hash, evt *BlockEvent) error {
 	// Bit of a jig to get something we can do the hash equality check on.
-	lnk2 := lnk.Prototype().BuildLink(hash)
+	lnk2 := lnk.Prototype().BuildLink(hasher.Sum(nil))
 	if lnk2 != lnk {
+		if evt != nil {
+			evt.HashCheck = HashMismatched
+		}
 		return ErrHashMismatch{Actual: lnk2, Expected: lnk}
 	}
-	if decodeErr != nil {
-		return decodeErr
+	if evt != nil {
+		evt.HashCheck = HashMatched
 	}
 	return nil
 }
 
+// checkLoadPolicy applies the LoadPolicy, if any, to a link about to be loaded.
+func (lsys *LinkSystem) checkLoadPolicy(lnkCtx LinkContext, lnk datamodel.Link) error {
+	if lsys.LoadPolicy == nil {
+		return nil
+	}
+	if err := lsys.LoadPolicy(lnk.Prototype()); err != nil {
+		return ErrPolicy{Link: lnk, Path: lnkCtx.LinkPath, Cause: err}
+	}
+	return nil
+}
+
+// checkStorePolicy applies the StorePolicy, if any, to a LinkPrototype about to be used to store (or compute a link).
+func (lsys *LinkSystem) checkStorePolicy(lnkCtx LinkContext, lp datamodel.LinkPrototype) error {
+	if lsys.StorePolicy == nil {
+		return nil
+	}
+	if err := lsys.StorePolicy(lp); err != nil {
+		return ErrPolicy{Path: lnkCtx.LinkPath, Cause: err}
+	}
+	return nil
+}
+
+// storageReadError wraps errors from storage in ErrStorage,
+// except for ErrNotFound, which is passed through as-is (with the path filled in, if the storage didn't already do so),
+// and errors which are already ErrStorage.
+func storageReadError(lnkCtx LinkContext, lnk datamodel.Link, err error) error {
+	if e, ok := err.(ErrNotFound); ok {
+		if e.Link == nil {
+			e.Link = lnk
+		}
+		if e.Path.Len() == 0 {
+			e.Path = lnkCtx.LinkPath
+		}
+		return e
+	}
+	if errors.As(err, &ErrNotFound{}) || errors.As(err, &ErrStorage{}) {
+		return err
+	}
+	return ErrStorage{Link: lnk, Path: lnkCtx.LinkPath, Cause: err}
+}
+
 func (lsys *LinkSystem) MustFill(lnkCtx LinkContext, lnk datamodel.Link, na datamodel.NodeAssembler) {
 	if err := lsys.Fill(lnkCtx, lnk, na); err != nil {
 		panic(err)
 	}
 }
 
+// LoadRaw returns the serial data of the block a link points to, without decoding it.
+// The data is verified against the link's hash (unless the LinkSystem has TrustedStorage),
+// using the same HasherChooser, storage, and observers as Load.
+//
+// This is useful when it's the bytes that are wanted, rather than a Node:
+// for example, to pass blocks on to somewhere else, or to write them into a CAR file.
+func (lsys *LinkSystem) LoadRaw(lnkCtx LinkContext, lnk datamodel.Link) ([]byte, error) {
+	if lnkCtx.Ctx == nil {
+		lnkCtx.Ctx = context.Background()
+	}
+	if lsys.OnLoad == nil {
+		return lsys.loadRaw(lnkCtx, lnk, nil)
+	}
+	start := time.Now()
+	evt := BlockEvent{Link: lnk, Codec: codecOf(lnk)}
+	data, err := lsys.loadRaw(lnkCtx, lnk, &evt)
+	evt.Err = err
+	evt.Duration = time.Since(start)
+	lsys.OnLoad(lnkCtx, evt)
+	return data, err
+}
+
+// loadRaw does the work of LoadRaw.
+// If evt is not nil, the size of the block and the outcome of the hash check are recorded in it.
+func (lsys *LinkSystem) loadRaw(lnkCtx LinkContext, lnk datamodel.Link, evt *BlockEvent) ([]byte, error) {
+	if err := lsys.checkLoadPolicy(lnkCtx, lnk); err != nil {
+		return nil, err
+	}
+	hasher, err := lsys.HasherChooser(lnk.Prototype())
+	if err != nil {
+		return nil, ErrLinkingSetup{"could not choose a hasher", err}
+	}
+	reader, err := lsys.openRead(lnkCtx, lnk)
+	if err != nil {
+		return nil, err
+	}
+	limiter := lsys.limitReader(&reader)
+	data, err := ioutil.ReadAll(reader)
+	if evt != nil {
+		evt.Size = int64(len(data))
+	}
+	if limiter.exceeded() {
+		return nil, codec.ErrBudgetExhausted{Budget: codec.BudgetBlockSize}
+	}
+	if err != nil {
+		return nil, storageReadError(lnkCtx, lnk, err)
+	}
+	if lsys.TrustedStorage {
+		return data, nil
+	}
+	hasher.Write(data)
+	if err := checkHash(lnk, hasher, evt); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (lsys *LinkSystem) MustLoadRaw(lnkCtx LinkContext, lnk datamodel.Link) []byte {
+	if data, err := lsys.LoadRaw(lnkCtx, lnk); err != nil {
+		panic(err)
+	} else {
+		return data
+	}
+}
+
 func (lsys *LinkSystem) Store(lnkCtx LinkContext, lp datamodel.LinkPrototype, n datamodel.Node) (datamodel.Link, error) {
 	if lnkCtx.Ctx == nil {
 		lnkCtx.Ctx = context.Background()
 	}
+	if lsys.OnStore == nil {
+		return lsys.store(lnkCtx, lp, n, nil)
+	}
+	start := time.Now()
+	var evt BlockEvent
+	evt.Link, evt.Err = lsys.store(lnkCtx, lp, n, &evt)
+	if evt.Link != nil {
+		evt.Codec = codecOf(evt.Link)
+	}
+	evt.Duration = time.Since(start)
+	lsys.OnStore(lnkCtx, evt)
+	return evt.Link, evt.Err
+}
+
+// store does the work of Store.
+// If evt is not nil, the size of the block is recorded in it.
+func (lsys *LinkSystem) store(lnkCtx LinkContext, lp datamodel.LinkPrototype, n datamodel.Node, evt *BlockEvent) (datamodel.Link, error) {
+	if err := lsys.checkStorePolicy(lnkCtx, lp); err != nil {
+		return nil, err
+	}
+	if lnk, data, ok := retainedBlock(n, lp); ok {
+		if evt != nil {
+			evt.Size = int64(len(data))
+		}
+		return lsys.storeRetained(lnkCtx, lp, lnk, data, true)
+	}
 	// Choose all the parts.
 	encoder, err := lsys.EncoderChooser(lp)
 	if err != nil {
@@ -108,21 +376,30 @@ func (lsys *LinkSystem) Store(lnkCtx LinkContext, lp datamodel.LinkPrototype, n
 	if err != nil {
 		return nil, ErrLinkingSetup{"could not choose a hasher", err}
 	}
+	if ilp, limit := lsys.chooseInline(lp); ilp != nil {
+		return lsys.storeInlinable(lnkCtx, lp, n, evt, encoder, hasher, ilp, limit)
+	}
 	if lsys.StorageWriteOpener == nil {
 		return nil, ErrLinkingSetup{"no storage configured for writing", io.ErrClosedPipe} // REVIEW: better cause?
 	}
 	// Open storage write stream, feed serial data to the storage and the hasher, and funnel the codec output into both.
 	writer, commitFn, err := lsys.StorageWriteOpener(lnkCtx)
 	if err != nil {
-		return nil, err
+		return nil, ErrStorage{Path: lnkCtx.LinkPath, Cause: err}
 	}
 	tee := io.MultiWriter(writer, hasher)
+	if evt != nil {
+		tee = &countingWriter{tee, &evt.Size}
+	}
 	err = encoder(n, tee)
 	if err != nil {
 		return nil, err
 	}
 	lnk := lp.BuildLink(hasher.Sum(nil))
-	return lnk, commitFn(lnk)
+	if err := commitFn(lnk); err != nil {
+		return lnk, ErrStorage{Link: lnk, Path: lnkCtx.LinkPath, Cause: err}
+	}
+	return lnk, nil
 }
 
 func (lsys *LinkSystem) MustStore(lnkCtx LinkContext, lp datamodel.LinkPrototype, n datamodel.Node) datamodel.Link {
@@ -133,9 +410,66 @@ func (lsys *LinkSystem) MustStore(lnkCtx LinkContext, lp datamodel.LinkPrototype
 	}
 }
 
+// StoreRaw stores data which is already encoded, and returns its link.
+// The link is made with the given LinkPrototype, using the same HasherChooser, storage, and observers as Store;
+// and if the LinkSystem's InlineChooser would inline a block of this size, StoreRaw does too.
+//
+// The data isn't checked to actually be in the codec the LinkPrototype describes: that's up to the caller.
+func (lsys *LinkSystem) StoreRaw(lnkCtx LinkContext, lp datamodel.LinkPrototype, data []byte) (datamodel.Link, error) {
+	if lnkCtx.Ctx == nil {
+		lnkCtx.Ctx = context.Background()
+	}
+	if lsys.OnStore == nil {
+		return lsys.storeRaw(lnkCtx, lp, data)
+	}
+	start := time.Now()
+	evt := BlockEvent{Size: int64(len(data))}
+	evt.Link, evt.Err = lsys.storeRaw(lnkCtx, lp, data)
+	if evt.Link != nil {
+		evt.Codec = codecOf(evt.Link)
+	}
+	evt.Duration = time.Since(start)
+	lsys.OnStore(lnkCtx, evt)
+	return evt.Link, evt.Err
+}
+
+// storeRaw does the work of StoreRaw.
+func (lsys *LinkSystem) storeRaw(lnkCtx LinkContext, lp datamodel.LinkPrototype, data []byte) (datamodel.Link, error) {
+	if err := lsys.checkStorePolicy(lnkCtx, lp); err != nil {
+		return nil, err
+	}
+	if ilp, limit := lsys.chooseInline(lp); ilp != nil && len(data) <= limit {
+		return lsys.inlineLink(ilp, data)
+	}
+	hasher, err := lsys.HasherChooser(lp)
+	if err != nil {
+		return nil, ErrLinkingSetup{"could not choose a hasher", err}
+	}
+	hasher.Write(data)
+	lnk := lp.BuildLink(hasher.Sum(nil))
+	if err := lsys.commitEncoded(lnkCtx, lnk, data); err != nil {
+		return lnk, err
+	}
+	return lnk, nil
+}
+
+func (lsys *LinkSystem) MustStoreRaw(lnkCtx LinkContext, lp datamodel.LinkPrototype, data []byte) datamodel.Link {
+	if lnk, err := lsys.StoreRaw(lnkCtx, lp, data); err != nil {
+		panic(err)
+	} else {
+		return lnk
+	}
+}
+
 // ComputeLink returns a Link for the given data, but doesn't do anything else
 // (e.g. it doesn't try to store any of the serial-form data anywhere else).
 func (lsys *LinkSystem) ComputeLink(lp datamodel.LinkPrototype, n datamodel.Node) (datamodel.Link, error) {
+	if err := lsys.checkStorePolicy(LinkContext{}, lp); err != nil {
+		return nil, err
+	}
+	if lnk, data, ok := retainedBlock(n, lp); ok {
+		return lsys.storeRetained(LinkContext{}, lp, lnk, data, false)
+	}
 	encoder, err := lsys.EncoderChooser(lp)
 	if err != nil {
 		return nil, ErrLinkingSetup{"could not choose an encoder", err}
@@ -144,6 +478,17 @@ func (lsys *LinkSystem) ComputeLink(lp datamodel.LinkPrototype, n datamodel.Node
 	if err != nil {
 		return nil, ErrLinkingSetup{"could not choose a hasher", err}
 	}
+	if ilp, limit := lsys.chooseInline(lp); ilp != nil {
+		// Work out whether Store would inline this, so the link is the same as Store would give.
+		iw := &inlineWriter{limit: limit, open: func() (io.Writer, error) { return ioutil.Discard, nil }}
+		if err := encoder(n, io.MultiWriter(iw, hasher)); err != nil {
+			return nil, err
+		}
+		if iw.w == nil {
+			return lsys.inlineLink(ilp, iw.buf.Bytes())
+		}
+		return lp.BuildLink(hasher.Sum(nil)), nil
+	}
 	err = encoder(n, hasher)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,99 @@
+package linking
+
+import (
+	"bytes"
+	"hash"
+	"io"
+
+	"github.com/ipld/go-ipld-prime/codec"
+	"github.com/ipld/go-ipld-prime/datamodel"
+)
+
+// Some links can carry their block's data within themselves, rather than a hash of it --
+// CIDs using the "identity" multihash are the common example.
+// Such links need no storage at all: LinkSystem.InlineData lets loads take the data straight from the link,
+// and LinkSystem.InlineChooser lets stores produce such links instead of writing to storage.
+
+// chooseInline asks the InlineChooser (if any) whether blocks stored with lp may be inlined, and up to what size.
+// An inline prototype which the StorePolicy refuses is never used.
+func (lsys *LinkSystem) chooseInline(lp datamodel.LinkPrototype) (datamodel.LinkPrototype, int) {
+	if lsys.InlineChooser == nil {
+		return nil, 0
+	}
+	ilp, limit := lsys.InlineChooser(lp)
+	if ilp != nil && lsys.StorePolicy != nil && lsys.StorePolicy(ilp) != nil {
+		return nil, 0
+	}
+	return ilp, limit
+}
+
+// storeInlinable is Store, for when the LinkSystem's InlineChooser has offered an inline prototype.
+// The encoded data is held in memory until it's larger than the limit;
+// if it never is, the block is inlined, and storage is never touched.
+// Otherwise, storage is opened, and the block stored as usual.
+func (lsys *LinkSystem) storeInlinable(lnkCtx LinkContext, lp datamodel.LinkPrototype, n datamodel.Node, evt *BlockEvent, encoder codec.Encoder, hasher hash.Hash, ilp datamodel.LinkPrototype, limit int) (datamodel.Link, error) {
+	var commitFn BlockWriteCommitter
+	iw := &inlineWriter{limit: limit, open: func() (io.Writer, error) {
+		if lsys.StorageWriteOpener == nil {
+			return nil, ErrLinkingSetup{"no storage configured for writing", io.ErrClosedPipe}
+		}
+		writer, c, err := lsys.StorageWriteOpener(lnkCtx)
+		if err != nil {
+			return nil, ErrStorage{Path: lnkCtx.LinkPath, Cause: err}
+		}
+		commitFn = c
+		return writer, nil
+	}}
+	var w io.Writer = io.MultiWriter(iw, hasher)
+	if evt != nil {
+		w = &countingWriter{w, &evt.Size}
+	}
+	if err := encoder(n, w); err != nil {
+		return nil, err
+	}
+	if iw.w == nil {
+		return lsys.inlineLink(ilp, iw.buf.Bytes())
+	}
+	lnk := lp.BuildLink(hasher.Sum(nil))
+	if err := commitFn(lnk); err != nil {
+		return lnk, ErrStorage{Link: lnk, Path: lnkCtx.LinkPath, Cause: err}
+	}
+	return lnk, nil
+}
+
+// inlineLink builds the link which carries some data inline.
+func (lsys *LinkSystem) inlineLink(ilp datamodel.LinkPrototype, data []byte) (datamodel.Link, error) {
+	hasher, err := lsys.HasherChooser(ilp)
+	if err != nil {
+		return nil, ErrLinkingSetup{"could not choose a hasher", err}
+	}
+	hasher.Write(data)
+	return ilp.BuildLink(hasher.Sum(nil)), nil
+}
+
+// inlineWriter holds on to what's written to it, until there's more than limit bytes;
+// then it opens the real destination, and passes everything on to that.
+type inlineWriter struct {
+	limit int
+	buf   bytes.Buffer
+	open  func() (io.Writer, error)
+	w     io.Writer // Nil until opened.
+}
+
+func (iw *inlineWriter) Write(p []byte) (int, error) {
+	if iw.w == nil {
+		if iw.buf.Len()+len(p) <= iw.limit {
+			return iw.buf.Write(p)
+		}
+		w, err := iw.open()
+		if err != nil {
+			return 0, err
+		}
+		if _, err := w.Write(iw.buf.Bytes()); err != nil {
+			return 0, err
+		}
+		iw.w = w
+		iw.buf = bytes.Buffer{}
+	}
+	return iw.w.Write(p)
+}
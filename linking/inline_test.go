@@ -0,0 +1,119 @@
+package linking_test
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+	"github.com/ipfs/go-cid"
+
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/linking"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	"github.com/ipld/go-ipld-prime/storage"
+)
+
+var identityLp = cidlink.LinkPrototype{Prefix: cid.Prefix{
+	Version:  1,
+	Codec:    0x71, // dag-cbor
+	MhType:   0x00, // identity
+	MhLength: -1,
+}}
+
+// noStorage is a LinkSystem whose storage fails the test if it's touched at all.
+func noStorage(t *testing.T) linking.LinkSystem {
+	lsys := cidlink.DefaultLinkSystem()
+	lsys.StorageReadOpener = func(linking.LinkContext, datamodel.Link) (io.Reader, error) {
+		t.Errorf("storage read")
+		return nil, io.ErrUnexpectedEOF
+	}
+	lsys.StorageWriteOpener = func(linking.LinkContext) (io.Writer, linking.BlockWriteCommitter, error) {
+		t.Errorf("storage write")
+		return nil, nil, io.ErrUnexpectedEOF
+	}
+	return lsys
+}
+
+func TestIdentityLinks(t *testing.T) {
+	lsys := noStorage(t)
+	n := basicnode.NewString(strings.Repeat("inline ", 100))
+
+	lnk, err := lsys.Store(linking.LinkContext{}, identityLp, n)
+	qt.Assert(t, err, qt.IsNil)
+	qt.Check(t, lnk, qt.Equals, lsys.MustComputeLink(identityLp, n))
+	qt.Check(t, lnk.(cidlink.Link).Prefix().MhType, qt.Equals, uint64(0x00))
+
+	n2, err := lsys.Load(linking.LinkContext{}, lnk, basicnode.Prototype.Any)
+	qt.Assert(t, err, qt.IsNil)
+	qt.Check(t, datamodel.DeepEqual(n, n2), qt.IsTrue)
+
+	t.Run("observed", func(t *testing.T) {
+		lsys := lsys
+		var loads recorder
+		lsys.OnLoad = loads.observe
+		_, err := lsys.Load(linking.LinkContext{}, lnk, basicnode.Prototype.Any)
+		qt.Assert(t, err, qt.IsNil)
+		events := loads.take()
+		qt.Assert(t, events, qt.HasLen, 1)
+		qt.Check(t, events[0].evt.Size, qt.Equals, int64(len(lnk.(cidlink.Link).Hash())-3)) // Less the multihash code and length varints.
+		qt.Check(t, events[0].evt.HashCheck, qt.Equals, linking.HashMatched)
+	})
+}
+
+func TestInlineIdentity(t *testing.T) {
+	small := basicnode.NewString("small")
+	large := basicnode.NewString(strings.Repeat("large", 20))
+
+	store := storage.Memory{}
+	lsys := cidlink.DefaultLinkSystem()
+	lsys.StorageReadOpener = store.OpenRead
+	lsys.StorageWriteOpener = store.OpenWrite
+	lsys.InlineChooser = cidlink.InlineIdentity(32)
+	var stores recorder
+	lsys.OnStore = stores.observe
+
+	smallLnk, err := lsys.Store(linking.LinkContext{}, batchLp, small)
+	qt.Assert(t, err, qt.IsNil)
+	qt.Check(t, smallLnk.(cidlink.Link).Prefix().MhType, qt.Equals, uint64(0x00))
+	qt.Check(t, smallLnk.(cidlink.Link).Prefix().Codec, qt.Equals, uint64(0x71))
+	qt.Check(t, smallLnk, qt.Equals, lsys.MustComputeLink(batchLp, small))
+	qt.Check(t, store.Bag, qt.HasLen, 0)
+
+	largeLnk, err := lsys.Store(linking.LinkContext{}, batchLp, large)
+	qt.Assert(t, err, qt.IsNil)
+	qt.Check(t, largeLnk.(cidlink.Link).Prefix().MhType, qt.Equals, uint64(0x12))
+	qt.Check(t, largeLnk, qt.Equals, lsys.MustComputeLink(batchLp, large))
+	qt.Check(t, store.Bag, qt.HasLen, 1)
+
+	events := stores.take()
+	qt.Assert(t, events, qt.HasLen, 2)
+	qt.Check(t, events[0].evt.Size, qt.Equals, int64(len("small")+1))
+	qt.Check(t, events[1].evt.Size, qt.Equals, int64(len("large")*20+2))
+
+	for lnk, n := range map[datamodel.Link]datamodel.Node{smallLnk: small, largeLnk: large} {
+		n2, err := lsys.Load(linking.LinkContext{}, lnk, basicnode.Prototype.Any)
+		qt.Assert(t, err, qt.IsNil)
+		qt.Check(t, datamodel.DeepEqual(n, n2), qt.IsTrue)
+	}
+
+	t.Run("store batch", func(t *testing.T) {
+		mem := &lockedMemory{}
+		lsys := lsys
+		lsys.StorageWriteOpener = mem.OpenWrite
+		lsys.OnStore = nil
+		reqs := []linking.StoreRequest{
+			{LinkPrototype: batchLp, Node: small},
+			{LinkPrototype: batchLp, Node: large},
+		}
+		for _, ordered := range []bool{false, true} {
+			lnks, errs := lsys.StoreBatch(context.Background(), reqs, linking.BatchOptions{OrderedCommits: ordered})
+			qt.Assert(t, errs, qt.IsNil)
+			qt.Check(t, lnks[0], qt.Equals, smallLnk)
+			qt.Check(t, lnks[1], qt.Equals, largeLnk)
+			qt.Check(t, mem.store.Bag, qt.HasLen, 1)
+		}
+	})
+}
@@ -0,0 +1,77 @@
+package linking_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/ipld/go-ipld-prime/codec"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/linking"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	"github.com/ipld/go-ipld-prime/storage"
+)
+
+// endlessReader is a block which never ends.
+type endlessReader struct{ read int64 }
+
+func (r *endlessReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 'a'
+	}
+	r.read += int64(len(p))
+	return len(p), nil
+}
+
+func TestMaxBlockSize(t *testing.T) {
+	store := storage.Memory{}
+	lsys := cidlink.DefaultLinkSystem()
+	lsys.StorageReadOpener = store.OpenRead
+	lsys.StorageWriteOpener = store.OpenWrite
+	lsys.MaxBlockSize = 100
+
+	small := basicnode.NewString(strings.Repeat("a", 90))
+	large := basicnode.NewString(strings.Repeat("a", 200))
+	smallLnk := lsys.MustStore(linking.LinkContext{}, batchLp, small)
+	largeLnk := lsys.MustStore(linking.LinkContext{}, batchLp, large)
+	budgetErr := codec.ErrBudgetExhausted{Budget: codec.BudgetBlockSize}
+
+	for _, trusted := range []bool{false, true} {
+		lsys := lsys
+		lsys.TrustedStorage = trusted
+		n, err := lsys.Load(linking.LinkContext{}, smallLnk, basicnode.Prototype.Any)
+		qt.Assert(t, err, qt.IsNil)
+		qt.Check(t, datamodel.DeepEqual(n, small), qt.IsTrue)
+		_, err = lsys.Load(linking.LinkContext{}, largeLnk, basicnode.Prototype.Any)
+		qt.Check(t, err, qt.Equals, budgetErr)
+
+		_, err = lsys.LoadRaw(linking.LinkContext{}, smallLnk)
+		qt.Check(t, err, qt.IsNil)
+		_, err = lsys.LoadRaw(linking.LinkContext{}, largeLnk)
+		qt.Check(t, err, qt.Equals, budgetErr)
+	}
+
+	t.Run("reads stop early", func(t *testing.T) {
+		lsys := lsys
+		var endless endlessReader
+		lsys.StorageReadOpener = func(linking.LinkContext, datamodel.Link) (io.Reader, error) {
+			return &endless, nil
+		}
+		_, err := lsys.LoadRaw(linking.LinkContext{}, largeLnk)
+		qt.Check(t, errors.As(err, &codec.ErrBudgetExhausted{}), qt.IsTrue)
+		qt.Check(t, endless.read <= lsys.MaxBlockSize+1, qt.IsTrue)
+
+		endless.read = 0
+		lsys.StorageReadOpener = func(linking.LinkContext, datamodel.Link) (io.Reader, error) {
+			return io.MultiReader(bytes.NewReader([]byte{0x7a, 0xff, 0xff, 0xff, 0xff}), &endless), nil // A string header claiming 4GiB.
+		}
+		_, err = lsys.Load(linking.LinkContext{}, largeLnk, basicnode.Prototype.Any)
+		qt.Check(t, errors.As(err, &codec.ErrBudgetExhausted{}), qt.IsTrue)
+		qt.Check(t, endless.read <= lsys.MaxBlockSize+1, qt.IsTrue)
+	})
+}
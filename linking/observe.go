@@ -0,0 +1,89 @@
+package linking
+
+import (
+	"io"
+	"time"
+
+	"github.com/ipld/go-ipld-prime/datamodel"
+)
+
+// BlockEvent describes a single load or store of a block.
+// It's what the LinkSystem.OnLoad and LinkSystem.OnStore observers are given.
+type BlockEvent struct {
+	// Link is the link of the block.
+	// For a store which failed before the data was fully encoded and hashed, it's nil.
+	Link datamodel.Link
+
+	// Codec is the multicodec indicator of the block's codec,
+	// if the link implementation reveals it (by having a `Codec() uint64` method, as cidlink.Link does).
+	// Otherwise (or if Link is nil) it's zero.
+	Codec uint64
+
+	// Size is the number of bytes read from or written to storage.
+	// (For blocks whose data is inline in their link, it's the number of bytes read from or encoded into the link.)
+	// For loads with TrustedStorage, this is only as much of the block as the decoder needed to read.
+	Size int64
+
+	// Duration is the time the whole load or store took, including decoding or encoding.
+	Duration time.Duration
+
+	// HashCheck is the outcome of checking the hash of a loaded block.  For stores, it's always HashNotChecked.
+	HashCheck HashCheck
+
+	// Err is the error the load or store returned, if any.
+	Err error
+}
+
+// HashCheck is the outcome of checking that a loaded block matches its link.
+type HashCheck uint8
+
+const (
+	HashNotChecked HashCheck = iota // The hash wasn't checked: the LinkSystem has TrustedStorage, or the load failed before the whole block was read.
+	HashMatched                     // The block matched its link.
+	HashMismatched                  // The block did not match its link; the load failed with ErrHashMismatch.
+)
+
+func (hc HashCheck) String() string {
+	switch hc {
+	case HashNotChecked:
+		return "not checked"
+	case HashMatched:
+		return "matched"
+	case HashMismatched:
+		return "mismatched"
+	default:
+		return "invalid"
+	}
+}
+
+// codecOf returns the multicodec indicator of the codec of a link, if it reveals it, or zero.
+func codecOf(lnk datamodel.Link) uint64 {
+	if c, ok := lnk.(interface{ Codec() uint64 }); ok {
+		return c.Codec()
+	}
+	return 0
+}
+
+// countingReader counts the bytes read through it, for observers.
+type countingReader struct {
+	r io.Reader
+	n *int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	*cr.n += int64(n)
+	return n, err
+}
+
+// countingWriter counts the bytes written through it, for observers.
+type countingWriter struct {
+	w io.Writer
+	n *int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	*cw.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,141 @@
+package linking_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+	"github.com/ipfs/go-cid"
+
+	_ "github.com/ipld/go-ipld-prime/codec/dagjson"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/linking"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	"github.com/ipld/go-ipld-prime/storage"
+)
+
+type ctxKey struct{}
+
+type observed struct {
+	lnkCtx linking.LinkContext
+	evt    linking.BlockEvent
+}
+
+type recorder struct {
+	mu     sync.Mutex
+	events []observed
+}
+
+func (r *recorder) observe(lnkCtx linking.LinkContext, evt linking.BlockEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, observed{lnkCtx, evt})
+}
+
+func (r *recorder) take() []observed {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	events := r.events
+	r.events = nil
+	return events
+}
+
+func TestObservers(t *testing.T) {
+	lp := cidlink.LinkPrototype{Prefix: cid.Prefix{
+		Version:  1,
+		Codec:    0x0129, // dag-json
+		MhType:   0x12,   // sha2-256
+		MhLength: 32,
+	}}
+	store := storage.Memory{}
+	lsys := cidlink.DefaultLinkSystem()
+	lsys.StorageReadOpener = store.OpenRead
+	lsys.StorageWriteOpener = store.OpenWrite
+	var loads, stores recorder
+	lsys.OnLoad = loads.observe
+	lsys.OnStore = stores.observe
+
+	ctx := context.WithValue(context.Background(), ctxKey{}, "traced")
+	path := datamodel.ParsePath("some/path")
+
+	var lnk datamodel.Link
+	t.Run("store", func(t *testing.T) {
+		var err error
+		lnk, err = lsys.Store(linking.LinkContext{Ctx: ctx, LinkPath: path}, lp, basicnode.NewString("observed"))
+		qt.Assert(t, err, qt.IsNil)
+		events := stores.take()
+		qt.Assert(t, events, qt.HasLen, 1)
+		evt := events[0].evt
+		qt.Check(t, evt.Link, qt.Equals, lnk)
+		qt.Check(t, evt.Codec, qt.Equals, uint64(0x0129))
+		qt.Check(t, evt.Size, qt.Equals, int64(len(`"observed"`)))
+		qt.Check(t, evt.HashCheck, qt.Equals, linking.HashNotChecked)
+		qt.Check(t, evt.Err, qt.IsNil)
+		qt.Check(t, events[0].lnkCtx.Ctx.Value(ctxKey{}), qt.Equals, "traced")
+		qt.Check(t, events[0].lnkCtx.LinkPath.String(), qt.Equals, "some/path")
+	})
+	t.Run("load", func(t *testing.T) {
+		_, err := lsys.Load(linking.LinkContext{Ctx: ctx, LinkPath: path}, lnk, basicnode.Prototype.Any)
+		qt.Assert(t, err, qt.IsNil)
+		events := loads.take()
+		qt.Assert(t, events, qt.HasLen, 1)
+		evt := events[0].evt
+		qt.Check(t, evt.Link, qt.Equals, lnk)
+		qt.Check(t, evt.Codec, qt.Equals, uint64(0x0129))
+		qt.Check(t, evt.Size, qt.Equals, int64(len(`"observed"`)))
+		qt.Check(t, evt.HashCheck, qt.Equals, linking.HashMatched)
+		qt.Check(t, evt.Err, qt.IsNil)
+		qt.Check(t, events[0].lnkCtx.Ctx.Value(ctxKey{}), qt.Equals, "traced")
+		qt.Check(t, events[0].lnkCtx.LinkPath.String(), qt.Equals, "some/path")
+	})
+	t.Run("load failures", func(t *testing.T) {
+		missing := lsys.MustComputeLink(lp, basicnode.NewString("missing"))
+		_, err := lsys.Load(linking.LinkContext{}, missing, basicnode.Prototype.Any)
+		qt.Assert(t, err, qt.Not(qt.IsNil))
+		events := loads.take()
+		qt.Assert(t, events, qt.HasLen, 1)
+		qt.Check(t, events[0].evt.HashCheck, qt.Equals, linking.HashNotChecked)
+		qt.Check(t, errors.As(events[0].evt.Err, &linking.ErrNotFound{}), qt.IsTrue)
+
+		store.Bag[missing] = []byte(`"tampered"`)
+		_, err = lsys.Load(linking.LinkContext{}, missing, basicnode.Prototype.Any)
+		qt.Assert(t, err, qt.Not(qt.IsNil))
+		events = loads.take()
+		qt.Assert(t, events, qt.HasLen, 1)
+		qt.Check(t, events[0].evt.HashCheck, qt.Equals, linking.HashMismatched)
+		qt.Check(t, events[0].evt.Err, qt.Equals, err)
+	})
+	t.Run("trusted storage", func(t *testing.T) {
+		lsys := lsys
+		lsys.TrustedStorage = true
+		_, err := lsys.Load(linking.LinkContext{}, lnk, basicnode.Prototype.Any)
+		qt.Assert(t, err, qt.IsNil)
+		events := loads.take()
+		qt.Assert(t, events, qt.HasLen, 1)
+		qt.Check(t, events[0].evt.HashCheck, qt.Equals, linking.HashNotChecked)
+	})
+	t.Run("store batch", func(t *testing.T) {
+		mem := &lockedMemory{}
+		lsys := lsys
+		lsys.StorageWriteOpener = mem.OpenWrite
+		for _, ordered := range []bool{false, true} {
+			lnks, errs := lsys.StoreBatch(ctx, batchRequests(20), linking.BatchOptions{OrderedCommits: ordered})
+			qt.Assert(t, errs, qt.IsNil)
+			events := stores.take()
+			qt.Assert(t, events, qt.HasLen, 20)
+			seen := map[datamodel.Link]bool{}
+			for _, o := range events {
+				seen[o.evt.Link] = true
+				qt.Check(t, o.evt.Codec, qt.Equals, uint64(0x71))
+				qt.Check(t, o.evt.Size > 0, qt.IsTrue)
+				qt.Check(t, o.lnkCtx.Ctx.Value(ctxKey{}), qt.Equals, "traced")
+			}
+			for _, lnk := range lnks {
+				qt.Check(t, seen[lnk], qt.IsTrue)
+			}
+		}
+	})
+}
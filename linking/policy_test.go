@@ -0,0 +1,92 @@
+package linking_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+	"github.com/ipfs/go-cid"
+
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/linking"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	"github.com/ipld/go-ipld-prime/storage"
+)
+
+func TestPolicy(t *testing.T) {
+	sha1Lp := cidlink.LinkPrototype{Prefix: cid.Prefix{Version: 1, Codec: 0x71, MhType: 0x11, MhLength: 20}}
+	cborLp := cidlink.LinkPrototype{Prefix: cid.Prefix{Version: 1, Codec: 0x51, MhType: 0x12, MhLength: 32}}
+	n := basicnode.NewString("policy")
+
+	// Links made without any policy, to try loading.
+	store := storage.Memory{}
+	lsys := cidlink.DefaultLinkSystem()
+	lsys.StorageReadOpener = store.OpenRead
+	lsys.StorageWriteOpener = store.OpenWrite
+	goodLnk := lsys.MustStore(linking.LinkContext{}, batchLp, n)
+	sha1Lnk := lsys.MustStore(linking.LinkContext{}, sha1Lp, n)
+
+	t.Run("load", func(t *testing.T) {
+		lsys := noStorage(t)
+		lsys.LoadPolicy = cidlink.StrictPolicy().Check
+		path := datamodel.ParsePath("some/path")
+
+		_, err := lsys.Load(linking.LinkContext{LinkPath: path}, sha1Lnk, basicnode.Prototype.Any)
+		var perr linking.ErrPolicy
+		qt.Assert(t, errors.As(err, &perr), qt.IsTrue)
+		qt.Check(t, perr.Link, qt.Equals, sha1Lnk)
+		qt.Check(t, perr.Path.String(), qt.Equals, "some/path")
+		qt.Check(t, perr.Cause, qt.Equals, cidlink.ErrMultihashNotAllowed{Multihash: 0x11})
+
+		_, err = lsys.LoadRaw(linking.LinkContext{}, sha1Lnk)
+		qt.Check(t, errors.As(err, &cidlink.ErrMultihashNotAllowed{}), qt.IsTrue)
+	})
+	t.Run("load allowed", func(t *testing.T) {
+		lsys := lsys
+		lsys.LoadPolicy = cidlink.StrictPolicy().Check
+		_, err := lsys.Load(linking.LinkContext{}, goodLnk, basicnode.Prototype.Any)
+		qt.Check(t, err, qt.IsNil)
+	})
+	t.Run("store", func(t *testing.T) {
+		lsys := noStorage(t)
+		lsys.StorePolicy = cidlink.StrictPolicy().Check
+		_, err := lsys.Store(linking.LinkContext{}, cborLp, n)
+		qt.Check(t, errors.As(err, &linking.ErrPolicy{}), qt.IsTrue)
+		qt.Check(t, errors.As(err, &cidlink.ErrCodecNotAllowed{}), qt.IsTrue)
+		_, err = lsys.StoreRaw(linking.LinkContext{}, sha1Lp, []byte{0x60})
+		qt.Check(t, errors.As(err, &cidlink.ErrMultihashNotAllowed{}), qt.IsTrue)
+		_, err = lsys.ComputeLink(sha1Lp, n)
+		qt.Check(t, errors.As(err, &linking.ErrPolicy{}), qt.IsTrue)
+		path := datamodel.ParsePath("some/path")
+		var perr linking.ErrPolicy
+		_, err = lsys.Store(linking.LinkContext{LinkPath: path}, sha1Lp, n)
+		qt.Assert(t, errors.As(err, &perr), qt.IsTrue)
+		qt.Check(t, perr.Path.String(), qt.Equals, "some/path")
+		for _, ordered := range []bool{false, true} {
+			req := linking.StoreRequest{LinkContext: linking.LinkContext{LinkPath: path}, LinkPrototype: sha1Lp, Node: n}
+			_, errs := lsys.StoreBatch(context.Background(), []linking.StoreRequest{req}, linking.BatchOptions{OrderedCommits: ordered})
+			qt.Assert(t, errs, qt.HasLen, 1)
+			qt.Assert(t, errors.As(errs[0], &perr), qt.IsTrue)
+			qt.Check(t, perr.Path.String(), qt.Equals, "some/path", qt.Commentf("ordered: %v", ordered))
+		}
+	})
+	t.Run("separate for loads and stores", func(t *testing.T) {
+		lsys := lsys
+		lsys.LoadPolicy = cidlink.Policy{}.Check
+		lsys.StorePolicy = cidlink.Policy{Multihashes: []uint64{0x12}}.Check
+		_, err := lsys.Load(linking.LinkContext{}, sha1Lnk, basicnode.Prototype.Any)
+		qt.Check(t, err, qt.IsNil)
+		_, err = lsys.Store(linking.LinkContext{}, sha1Lp, n)
+		qt.Check(t, errors.As(err, &linking.ErrPolicy{}), qt.IsTrue)
+	})
+	t.Run("refused inline prototype is not used", func(t *testing.T) {
+		lsys := lsys
+		lsys.InlineChooser = cidlink.InlineIdentity(100)
+		lsys.StorePolicy = cidlink.Policy{Multihashes: []uint64{0x12}}.Check
+		lnk, err := lsys.Store(linking.LinkContext{}, batchLp, n)
+		qt.Assert(t, err, qt.IsNil)
+		qt.Check(t, lnk, qt.Equals, goodLnk)
+	})
+}
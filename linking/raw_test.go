@@ -0,0 +1,75 @@
+package linking_test
+
+import (
+	"errors"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/linking"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	"github.com/ipld/go-ipld-prime/storage"
+)
+
+func TestRaw(t *testing.T) {
+	store := storage.Memory{}
+	lsys := cidlink.DefaultLinkSystem()
+	lsys.StorageReadOpener = store.OpenRead
+	lsys.StorageWriteOpener = store.OpenWrite
+
+	n := basicnode.NewString("raw")
+	data := []byte{0x63, 'r', 'a', 'w'}
+
+	t.Run("store raw matches store", func(t *testing.T) {
+		lnk, err := lsys.StoreRaw(linking.LinkContext{}, batchLp, data)
+		qt.Assert(t, err, qt.IsNil)
+		qt.Check(t, lnk, qt.Equals, lsys.MustComputeLink(batchLp, n))
+		qt.Check(t, store.Bag[lnk], qt.DeepEquals, data)
+
+		n2, err := lsys.Load(linking.LinkContext{}, lnk, basicnode.Prototype.Any)
+		qt.Assert(t, err, qt.IsNil)
+		qt.Check(t, datamodel.DeepEqual(n, n2), qt.IsTrue)
+	})
+	t.Run("load raw", func(t *testing.T) {
+		lnk := lsys.MustStore(linking.LinkContext{}, batchLp, n)
+		data2, err := lsys.LoadRaw(linking.LinkContext{}, lnk)
+		qt.Assert(t, err, qt.IsNil)
+		qt.Check(t, data2, qt.DeepEquals, data)
+
+		var loads recorder
+		lsys := lsys
+		lsys.OnLoad = loads.observe
+		lsys.MustLoadRaw(linking.LinkContext{}, lnk)
+		events := loads.take()
+		qt.Assert(t, events, qt.HasLen, 1)
+		qt.Check(t, events[0].evt.Size, qt.Equals, int64(len(data)))
+		qt.Check(t, events[0].evt.HashCheck, qt.Equals, linking.HashMatched)
+	})
+	t.Run("load raw verifies", func(t *testing.T) {
+		lnk := lsys.MustComputeLink(batchLp, basicnode.NewString("honest"))
+		store.Bag[lnk] = []byte{0x63, 'b', 'a', 'd'}
+		_, err := lsys.LoadRaw(linking.LinkContext{}, lnk)
+		qt.Check(t, errors.As(err, &linking.ErrHashMismatch{}), qt.IsTrue)
+
+		lsys := lsys
+		lsys.TrustedStorage = true
+		data, err := lsys.LoadRaw(linking.LinkContext{}, lnk)
+		qt.Assert(t, err, qt.IsNil)
+		qt.Check(t, data, qt.DeepEquals, []byte{0x63, 'b', 'a', 'd'})
+	})
+	t.Run("load raw missing", func(t *testing.T) {
+		lnk := lsys.MustComputeLink(batchLp, basicnode.NewString("missing"))
+		_, err := lsys.LoadRaw(linking.LinkContext{}, lnk)
+		qt.Check(t, errors.As(err, &linking.ErrNotFound{}), qt.IsTrue)
+	})
+	t.Run("inline", func(t *testing.T) {
+		lsys := noStorage(t)
+		lsys.InlineChooser = cidlink.InlineIdentity(len(data))
+		lnk, err := lsys.StoreRaw(linking.LinkContext{}, batchLp, data)
+		qt.Assert(t, err, qt.IsNil)
+		qt.Check(t, lnk, qt.Equals, lsys.MustComputeLink(batchLp, n))
+		qt.Check(t, lsys.MustLoadRaw(linking.LinkContext{}, lnk), qt.DeepEquals, data)
+	})
+}
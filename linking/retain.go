@@ -0,0 +1,78 @@
+package linking
+
+import (
+	"reflect"
+
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/schema"
+)
+
+// BlockNode is implemented by nodes which know the block they were decoded from:
+// its link, and its serial data.
+// LinkSystem.Load returns nodes implementing BlockNode when the LinkSystem has RetainBlocks set.
+//
+// When a node returned by Load is given to LinkSystem.Store (or ComputeLink, or StoreBatch) with a LinkPrototype equal to that of its link,
+// the node isn't encoded again: its link and data are used as they are.
+// (With any other LinkPrototype, the node is encoded as usual.)
+// Since nodes are immutable, a node returned by Load always still matches its block.
+// Other implementations of BlockNode get no such shortcut -- they're encoded as usual --
+// since there's no telling whether the data they claim really is the block of their link.
+//
+// Note that the nodes Load returns in this case wrap the node built by the NodePrototype given to Load,
+// so type assertions on them to a concrete node implementation won't succeed.
+type BlockNode interface {
+	datamodel.Node
+
+	// Block returns the link the node was loaded from, and the block's serial data.
+	// The data must not be modified.
+	Block() (datamodel.Link, []byte)
+}
+
+// retainedNode is the BlockNode returned by Load.
+type retainedNode struct {
+	datamodel.Node
+	lnk  datamodel.Link
+	data []byte
+}
+
+func (n retainedNode) Block() (datamodel.Link, []byte) {
+	return n.lnk, n.data
+}
+
+// retain wraps a freshly loaded node so it remembers its block.
+// Typed nodes are left as they are, since wrapping them would hide their schema.TypedNode methods.
+func retain(n datamodel.Node, lnk datamodel.Link, data []byte) datamodel.Node {
+	if _, ok := n.(schema.TypedNode); ok {
+		return n
+	}
+	return retainedNode{n, lnk, data}
+}
+
+// retainedBlock returns the link and data of a node, if it's one returned by Load with RetainBlocks, and its link has the given LinkPrototype.
+func retainedBlock(n datamodel.Node, lp datamodel.LinkPrototype) (datamodel.Link, []byte, bool) {
+	rn, ok := n.(retainedNode)
+	if !ok {
+		return nil, nil, false
+	}
+	lnk, data := rn.lnk, rn.data
+	// LinkPrototypes are usually comparable, as cidlink.LinkPrototype is; if they're not, we can't tell, so don't take the shortcut.
+	lnkLp := lnk.Prototype()
+	if reflect.TypeOf(lnkLp) != reflect.TypeOf(lp) || !reflect.TypeOf(lp).Comparable() || lnkLp != lp {
+		return nil, nil, false
+	}
+	return lnk, data, true
+}
+
+// storeRetained is Store, for a node whose link and data are already known.
+// It stores the data (if commit is true), unless the InlineChooser says to inline it instead.
+func (lsys *LinkSystem) storeRetained(lnkCtx LinkContext, lp datamodel.LinkPrototype, lnk datamodel.Link, data []byte, commit bool) (datamodel.Link, error) {
+	if ilp, limit := lsys.chooseInline(lp); ilp != nil && len(data) <= limit {
+		return lsys.inlineLink(ilp, data)
+	}
+	if commit {
+		if err := lsys.commitEncoded(lnkCtx, lnk, data); err != nil {
+			return lnk, err
+		}
+	}
+	return lnk, nil
+}
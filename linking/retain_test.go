@@ -0,0 +1,115 @@
+package linking_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+	"github.com/ipfs/go-cid"
+
+	"github.com/ipld/go-ipld-prime/codec"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/linking"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	"github.com/ipld/go-ipld-prime/storage"
+)
+
+func TestRetainBlocks(t *testing.T) {
+	jsonLp := cidlink.LinkPrototype{Prefix: cid.Prefix{Version: 1, Codec: 0x0129, MhType: 0x12, MhLength: 32}}
+
+	// Some dag-json that isn't in canonical form: re-encoding it would give different bytes, and a different link.
+	src := storage.Memory{}
+	lsys := cidlink.DefaultLinkSystem()
+	lsys.StorageReadOpener = src.OpenRead
+	lsys.StorageWriteOpener = src.OpenWrite
+	lsys.RetainBlocks = true
+	data := []byte(`{"b": 1, "a": 2}`)
+	lnk := lsys.MustStoreRaw(linking.LinkContext{}, jsonLp, data)
+
+	n, err := lsys.Load(linking.LinkContext{}, lnk, basicnode.Prototype.Any)
+	qt.Assert(t, err, qt.IsNil)
+	bn, ok := n.(linking.BlockNode)
+	qt.Assert(t, ok, qt.IsTrue)
+	lnk2, data2 := bn.Block()
+	qt.Check(t, lnk2, qt.Equals, lnk)
+	qt.Check(t, data2, qt.DeepEquals, data)
+
+	// Copying to other storage uses the retained data, without encoding.
+	encodes := 0
+	dst := storage.Memory{}
+	lsys.StorageWriteOpener = dst.OpenWrite
+	realChooser := lsys.EncoderChooser
+	lsys.EncoderChooser = func(lp datamodel.LinkPrototype) (codec.Encoder, error) {
+		encodes++
+		return realChooser(lp)
+	}
+	lnk3, err := lsys.Store(linking.LinkContext{}, jsonLp, n)
+	qt.Assert(t, err, qt.IsNil)
+	qt.Check(t, lnk3, qt.Equals, lnk)
+	qt.Check(t, dst.Bag[lnk], qt.DeepEquals, data)
+	qt.Check(t, lsys.MustComputeLink(jsonLp, n), qt.Equals, lnk)
+	lnks, errs := lsys.StoreBatch(context.Background(), []linking.StoreRequest{{LinkPrototype: jsonLp, Node: n}}, linking.BatchOptions{})
+	qt.Assert(t, errs, qt.IsNil)
+	qt.Check(t, lnks[0], qt.Equals, lnk)
+	qt.Check(t, encodes, qt.Equals, 0)
+
+	t.Run("other link prototypes re-encode", func(t *testing.T) {
+		lsys := lsys
+		lnk4, err := lsys.Store(linking.LinkContext{}, batchLp, n)
+		qt.Assert(t, err, qt.IsNil)
+		qt.Check(t, encodes, qt.Equals, 1)
+		qt.Check(t, lnk4.(cidlink.Link).Codec(), qt.Equals, uint64(0x71))
+		lsys.StorageReadOpener = dst.OpenRead
+		n4, err := lsys.Load(linking.LinkContext{}, lnk4, basicnode.Prototype.Any)
+		qt.Assert(t, err, qt.IsNil)
+		a, err := n4.LookupByString("a")
+		qt.Assert(t, err, qt.IsNil)
+		qt.Check(t, datamodel.DeepEqual(a, basicnode.NewInt(2)), qt.IsTrue)
+	})
+	t.Run("off by default", func(t *testing.T) {
+		lsys := lsys
+		lsys.RetainBlocks = false
+		n, err := lsys.Load(linking.LinkContext{}, lnk, basicnode.Prototype.Any)
+		qt.Assert(t, err, qt.IsNil)
+		_, ok := n.(linking.BlockNode)
+		qt.Check(t, ok, qt.IsFalse)
+		lnk5, err := lsys.ComputeLink(jsonLp, n)
+		qt.Assert(t, err, qt.IsNil)
+		qt.Check(t, lnk5, qt.Not(qt.Equals), lnk) // Re-encoded canonically.
+	})
+	t.Run("whole block is hash checked", func(t *testing.T) {
+		// The decoder stops at the end of the dag-cbor item, but the trailing data would be retained (and stored again) too.
+		store := storage.Memory{}
+		lsys := lsys
+		lsys.StorageReadOpener = store.OpenRead
+		lsys.StorageWriteOpener = store.OpenWrite
+		lnk := lsys.MustStore(linking.LinkContext{}, batchLp, basicnode.NewString("trailing"))
+		store.Bag[lnk] = append(store.Bag[lnk], 0xff)
+		_, err := lsys.Load(linking.LinkContext{}, lnk, basicnode.Prototype.Any)
+		qt.Check(t, errors.As(err, &linking.ErrHashMismatch{}), qt.IsTrue)
+	})
+	t.Run("other BlockNodes are not trusted", func(t *testing.T) {
+		lsys := lsys
+		lsys.StorageWriteOpener = dst.OpenWrite
+		before := encodes
+		liar := fakeBlockNode{basicnode.NewString("liar"), lnk, data}
+		lnk6, err := lsys.Store(linking.LinkContext{}, jsonLp, liar)
+		qt.Assert(t, err, qt.IsNil)
+		qt.Check(t, lnk6, qt.Not(qt.Equals), lnk)
+		qt.Check(t, encodes, qt.Equals, before+1)
+		qt.Check(t, string(dst.Bag[lnk6]), qt.Equals, `"liar"`)
+	})
+}
+
+// fakeBlockNode claims to have been loaded from a block that it has nothing to do with.
+type fakeBlockNode struct {
+	datamodel.Node
+	lnk  datamodel.Link
+	data []byte
+}
+
+func (n fakeBlockNode) Block() (datamodel.Link, []byte) {
+	return n.lnk, n.data
+}
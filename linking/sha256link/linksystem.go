@@ -0,0 +1,125 @@
+package sha256link
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"io"
+
+	"github.com/ipld/go-ipld-prime/codec"
+	"github.com/ipld/go-ipld-prime/codec/dagcbor"
+	"github.com/ipld/go-ipld-prime/codec/dagjson"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/linking"
+)
+
+// In DAG-JSON, a Link is written in its String form, as in `{"/":"sha256:<hex>"}`.
+// In DAG-CBOR, a Link is written as its 32-byte digest in tag(42).
+// (Neither is a valid CID, so a CID-expecting decoder will reject these links rather than misread them.)
+
+func encodeJSONLink(lnk datamodel.Link) (string, error) {
+	l, ok := lnk.(Link)
+	if !ok {
+		return "", fmt.Errorf("sha256link: cannot encode link of type %T", lnk)
+	}
+	return l.String(), nil
+}
+
+func decodeJSONLink(s string) (datamodel.Link, error) {
+	return Parse(s)
+}
+
+func encodeCBORLink(lnk datamodel.Link) ([]byte, error) {
+	l, ok := lnk.(Link)
+	if !ok {
+		return nil, fmt.Errorf("sha256link: cannot encode link of type %T", lnk)
+	}
+	return l[:], nil
+}
+
+func decodeCBORLink(bs []byte) (datamodel.Link, error) {
+	var lnk Link
+	if len(bs) != len(lnk) {
+		return nil, fmt.Errorf("sha256link: link of %d bytes is not a sha256 digest", len(bs))
+	}
+	copy(lnk[:], bs)
+	return lnk, nil
+}
+
+// EncodeDagJSON and DecodeDagJSON are the DAG-JSON codec, using Link for links.
+func EncodeDagJSON(n datamodel.Node, w io.Writer) error {
+	return dagjson.EncodeOptions{
+		EncodeLinks: true,
+		EncodeBytes: true,
+		MapSortMode: codec.MapSortMode_Lexical,
+		LinkEncoder: encodeJSONLink,
+	}.Encode(n, w)
+}
+
+func DecodeDagJSON(na datamodel.NodeAssembler, r io.Reader) error {
+	return dagjson.DecodeOptions{
+		ParseLinks:  true,
+		ParseBytes:  true,
+		LinkDecoder: decodeJSONLink,
+	}.Decode(na, r)
+}
+
+// EncodeDagCBOR and DecodeDagCBOR are the DAG-CBOR codec, using Link for links.
+func EncodeDagCBOR(n datamodel.Node, w io.Writer) error {
+	return dagcbor.EncodeOptions{
+		AllowLinks:  true,
+		MapSortMode: codec.MapSortMode_RFC7049,
+		LinkEncoder: encodeCBORLink,
+	}.Encode(n, w)
+}
+
+func DecodeDagCBOR(na datamodel.NodeAssembler, r io.Reader) error {
+	return dagcbor.DecodeOptions{
+		AllowLinks:  true,
+		LinkDecoder: decodeCBORLink,
+	}.Decode(na, r)
+}
+
+// DagCBORLinkSystem returns a linking.LinkSystem which uses Link for datamodel.Link,
+// and encodes all blocks with DAG-CBOR.
+//
+// No storage functions are present in the returned LinkSystem.
+// The caller can assign those themselves as desired.
+func DagCBORLinkSystem() linking.LinkSystem {
+	return LinkSystem(EncodeDagCBOR, DecodeDagCBOR)
+}
+
+// DagJSONLinkSystem is like DagCBORLinkSystem, but encodes all blocks with DAG-JSON.
+func DagJSONLinkSystem() linking.LinkSystem {
+	return LinkSystem(EncodeDagJSON, DecodeDagJSON)
+}
+
+// LinkSystem returns a linking.LinkSystem which uses Link for datamodel.Link,
+// and encodes all blocks with the given codec.
+// The codec must be able to encode and decode Link, if the data is to contain links;
+// the DAG-CBOR and DAG-JSON codecs from this package can.
+//
+// No storage functions are present in the returned LinkSystem.
+// The caller can assign those themselves as desired.
+func LinkSystem(encoder codec.Encoder, decoder codec.Decoder) linking.LinkSystem {
+	return linking.LinkSystem{
+		EncoderChooser: func(lp datamodel.LinkPrototype) (codec.Encoder, error) {
+			if _, ok := lp.(LinkPrototype); !ok {
+				return nil, fmt.Errorf("this encoderChooser can only handle sha256link.LinkPrototype; got %T", lp)
+			}
+			return encoder, nil
+		},
+		DecoderChooser: func(lnk datamodel.Link) (codec.Decoder, error) {
+			if _, ok := lnk.(Link); !ok {
+				return nil, fmt.Errorf("this decoderChooser can only handle sha256link.Link; got %T", lnk)
+			}
+			return decoder, nil
+		},
+		HasherChooser: func(lp datamodel.LinkPrototype) (hash.Hash, error) {
+			if _, ok := lp.(LinkPrototype); !ok {
+				return nil, fmt.Errorf("this hasherChooser can only handle sha256link.LinkPrototype; got %T", lp)
+			}
+			return sha256.New(), nil
+		},
+	}
+}
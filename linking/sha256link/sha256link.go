@@ -0,0 +1,94 @@
+/*
+Package sha256link implements datamodel.Link using a bare SHA-256 digest,
+written as "sha256:" followed by the digest in lowercase hex.
+
+These links are much simpler than CIDs: they say nothing about the codec of the data they point to,
+nor permit any other hash function.  That makes them a good fit for systems which use one codec
+for everything and have no need to interoperate with IPFS.
+(It also makes this package a demonstration that the rest of go-ipld-prime
+doesn't depend on links being CIDs: traversal, selectors, and storage all work with these links just as well.)
+
+Since the links don't carry a codec, a LinkSystem using them is told which codec to use when it's made;
+see DagCBORLinkSystem, DagJSONLinkSystem, and LinkSystem.
+The DAG-CBOR and DAG-JSON codecs need to be told how to encode these links, too:
+the Encode and Decode functions in this package are those codecs, configured to do so.
+*/
+package sha256link
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/ipld/go-ipld-prime/datamodel"
+)
+
+var (
+	_ datamodel.Link          = Link{}
+	_ datamodel.LinkPrototype = LinkPrototype{}
+)
+
+// prefix begins the string form of every Link.
+const prefix = "sha256:"
+
+// Link implements the datamodel.Link interface using a SHA-256 digest.
+//
+// Like cidlink.Link, it should be used as `Link`, and not `*Link`,
+// so that it's useful as a map key.
+type Link [sha256.Size]byte
+
+func (lnk Link) Prototype() datamodel.LinkPrototype {
+	return LinkPrototype{}
+}
+
+// String returns the link in its "sha256:<hex>" form, which Parse accepts.
+func (lnk Link) String() string {
+	return prefix + hex.EncodeToString(lnk[:])
+}
+
+// Parse parses the "sha256:<hex>" form of a link, as returned by Link.String.
+func Parse(s string) (Link, error) {
+	var lnk Link
+	if !strings.HasPrefix(s, prefix) {
+		return lnk, fmt.Errorf("sha256link: %q does not begin with %q", s, prefix)
+	}
+	hx := s[len(prefix):]
+	if hex.DecodedLen(len(hx)) != len(lnk) {
+		return lnk, fmt.Errorf("sha256link: %q has a digest of the wrong length", s)
+	}
+	if strings.ToLower(hx) != hx {
+		return lnk, fmt.Errorf("sha256link: %q is not lowercase", s)
+	}
+	if _, err := hex.Decode(lnk[:], []byte(hx)); err != nil {
+		return lnk, fmt.Errorf("sha256link: %q: %w", s, err)
+	}
+	return lnk, nil
+}
+
+// LinkPrototype implements the datamodel.LinkPrototype interface for Link.
+// Since every Link is made the same way, it has no parameters.
+type LinkPrototype struct{}
+
+func (LinkPrototype) BuildLink(hashsum []byte) datamodel.Link {
+	var lnk Link
+	if len(hashsum) != len(lnk) {
+		panic(fmt.Errorf("sha256link: hash of %d bytes is not a sha256 digest", len(hashsum)))
+	}
+	copy(lnk[:], hashsum)
+	return lnk
+}
+
+// LinkKey is a Filesystem KeyFunc for Link: it gives the digest in hex.
+func LinkKey(lnk datamodel.Link) (string, error) {
+	l, ok := lnk.(Link)
+	if !ok {
+		return "", fmt.Errorf("sha256link: cannot derive a key for link of type %T", lnk)
+	}
+	return hex.EncodeToString(l[:]), nil
+}
+
+// KeyLink is a Filesystem LinkFunc for Link, and the inverse of LinkKey.
+func KeyLink(key string) (datamodel.Link, error) {
+	return Parse(prefix + key)
+}
@@ -0,0 +1,162 @@
+package sha256link_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/fluent/qp"
+	"github.com/ipld/go-ipld-prime/linking"
+	"github.com/ipld/go-ipld-prime/linking/sha256link"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	"github.com/ipld/go-ipld-prime/storage"
+	"github.com/ipld/go-ipld-prime/traversal"
+	"github.com/ipld/go-ipld-prime/traversal/selector"
+)
+
+func TestParse(t *testing.T) {
+	digest := sha256.Sum256([]byte("hello"))
+	lnk := sha256link.Link(digest)
+	qt.Check(t, lnk.String(), qt.Equals, "sha256:2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824")
+
+	lnk2, err := sha256link.Parse(lnk.String())
+	qt.Assert(t, err, qt.IsNil)
+	qt.Check(t, lnk2, qt.Equals, lnk)
+
+	for _, bad := range []string{
+		"",
+		"2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824",
+		"sha512:2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824",
+		"sha256:2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b98",
+		"sha256:2CF24DBA5FB0A30E26E83B2AC5B9E29E1B161E5C1FA7425E73043362938B9824",
+		"sha256:zzf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824",
+	} {
+		_, err := sha256link.Parse(bad)
+		qt.Check(t, err, qt.Not(qt.IsNil), qt.Commentf("%q", bad))
+	}
+}
+
+// buildTree stores a little tree of blocks: a root linking to a mid block and a leaf, and the mid block linking to another leaf.
+func buildTree(t *testing.T, lsys linking.LinkSystem) (root, mid, leaf1, leaf2 datamodel.Link) {
+	lp := sha256link.LinkPrototype{}
+	leaf1 = lsys.MustStore(linking.LinkContext{}, lp, basicnode.NewString("alpha"))
+	leaf2 = lsys.MustStore(linking.LinkContext{}, lp, basicnode.NewString("beta"))
+	midNode, err := qp.BuildMap(basicnode.Prototype.Any, 1, func(ma datamodel.MapAssembler) {
+		qp.MapEntry(ma, "leaf", qp.Link(leaf1))
+	})
+	qt.Assert(t, err, qt.IsNil)
+	mid = lsys.MustStore(linking.LinkContext{}, lp, midNode)
+	rootNode, err := qp.BuildMap(basicnode.Prototype.Any, 2, func(ma datamodel.MapAssembler) {
+		qp.MapEntry(ma, "mid", qp.Link(mid))
+		qp.MapEntry(ma, "other", qp.Link(leaf2))
+	})
+	qt.Assert(t, err, qt.IsNil)
+	root = lsys.MustStore(linking.LinkContext{}, lp, rootNode)
+	return
+}
+
+func TestLinkSystems(t *testing.T) {
+	for name, lsys := range map[string]linking.LinkSystem{
+		"dag-cbor": sha256link.DagCBORLinkSystem(),
+		"dag-json": sha256link.DagJSONLinkSystem(),
+	} {
+		lsys := lsys
+		t.Run(name, func(t *testing.T) {
+			store := storage.Memory{}
+			loaded := map[datamodel.Link]int{}
+			lsys.StorageReadOpener = func(lnkCtx linking.LinkContext, lnk datamodel.Link) (io.Reader, error) {
+				loaded[lnk]++
+				return store.OpenRead(lnkCtx, lnk)
+			}
+			lsys.StorageWriteOpener = store.OpenWrite
+			root, mid, leaf1, leaf2 := buildTree(t, lsys)
+
+			t.Run("links are hashes of the blocks", func(t *testing.T) {
+				for lnk, data := range store.Bag {
+					qt.Check(t, lnk, qt.Equals, sha256link.Link(sha256.Sum256(data)))
+				}
+				if name == "dag-json" {
+					qt.Check(t, string(store.Bag[mid]), qt.Equals, fmt.Sprintf(`{"leaf":{"/":"%s"}}`, leaf1))
+				}
+			})
+			t.Run("load", func(t *testing.T) {
+				n, err := lsys.Load(linking.LinkContext{}, root, basicnode.Prototype.Any)
+				qt.Assert(t, err, qt.IsNil)
+				n, err = n.LookupByString("mid")
+				qt.Assert(t, err, qt.IsNil)
+				lnk, err := n.AsLink()
+				qt.Assert(t, err, qt.IsNil)
+				qt.Check(t, lnk, qt.Equals, mid)
+			})
+			t.Run("traversal with a stop-at condition", func(t *testing.T) {
+				// The selector is itself decoded with this package's codec, so the condition holds a sha256link.Link.
+				var selJSON bytes.Buffer
+				fmt.Fprintf(&selJSON, `{"R":{"l":{"none":{}},":>":{"|":[{".":{}},{"a":{">":{"@":{}}}}]},"!":{"/":{"/":"%s"}}}}`, leaf2)
+				nb := basicnode.Prototype.Any.NewBuilder()
+				qt.Assert(t, sha256link.DecodeDagJSON(nb, &selJSON), qt.IsNil)
+				sel, err := selector.CompileSelector(nb.Build())
+				qt.Assert(t, err, qt.IsNil)
+
+				for k := range loaded {
+					delete(loaded, k)
+				}
+				rootNode := lsys.MustLoad(linking.LinkContext{}, root, basicnode.Prototype.Any)
+				var visited []string
+				err = traversal.Progress{Cfg: &traversal.Config{
+					Ctx:        context.Background(),
+					LinkSystem: lsys,
+					LinkTargetNodePrototypeChooser: func(datamodel.Link, linking.LinkContext) (datamodel.NodePrototype, error) {
+						return basicnode.Prototype.Any, nil
+					},
+				}}.WalkMatching(rootNode, sel, func(prog traversal.Progress, n datamodel.Node) error {
+					visited = append(visited, prog.Path.String())
+					return nil
+				})
+				qt.Assert(t, err, qt.IsNil)
+				sort.Strings(visited)
+				qt.Check(t, strings.Join(visited, ","), qt.Equals, ",mid,mid/leaf") // Not "other": the condition stopped it.
+				qt.Check(t, loaded[mid], qt.Equals, 1)
+				qt.Check(t, loaded[leaf1], qt.Equals, 1)
+				qt.Check(t, loaded[leaf2], qt.Equals, 0)
+			})
+			t.Run("select links", func(t *testing.T) {
+				n := lsys.MustLoad(linking.LinkContext{}, root, basicnode.Prototype.Any)
+				lnks, err := traversal.SelectLinks(n)
+				qt.Assert(t, err, qt.IsNil)
+				qt.Check(t, lnks, qt.DeepEquals, []datamodel.Link{mid, leaf2})
+			})
+		})
+	}
+}
+
+func TestFilesystem(t *testing.T) {
+	store := storage.Filesystem{
+		Root:     t.TempDir(),
+		KeyFunc:  sha256link.LinkKey,
+		LinkFunc: sha256link.KeyLink,
+	}
+	lsys := sha256link.DagCBORLinkSystem()
+	lsys.StorageReadOpener = store.OpenRead
+	lsys.StorageWriteOpener = store.OpenWrite
+	root, mid, leaf1, leaf2 := buildTree(t, lsys)
+
+	seen := map[datamodel.Link]bool{}
+	err := store.Enumerate(context.Background(), func(lnk datamodel.Link, size int64) error {
+		seen[lnk] = true
+		return nil
+	})
+	qt.Assert(t, err, qt.IsNil)
+	qt.Check(t, seen, qt.DeepEquals, map[datamodel.Link]bool{root: true, mid: true, leaf1: true, leaf2: true})
+
+	n, err := lsys.Load(linking.LinkContext{}, leaf1, basicnode.Prototype.Any)
+	qt.Assert(t, err, qt.IsNil)
+	qt.Check(t, datamodel.DeepEqual(n, basicnode.NewString("alpha")), qt.IsTrue)
+}
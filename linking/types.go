@@ -29,6 +29,40 @@ import (
 // found in the storage package.  Applications are also free to write their own.
 // Custom wrapping of BlockWriteOpener and BlockReadOpener are also common,
 // and may be reasonable if one wants to build application features that are block-aware.
+//
+// MaxBlockSize, if more than zero, limits the size of the blocks that will be loaded:
+// reading stops as soon as a block turns out to be larger, and the load returns codec.ErrBudgetExhausted.
+// (This limits only the raw size of the block; see the DecodeOptions of each codec for limits on the decoded data.)
+//
+// RetainBlocks, if true, makes Load return nodes which remember the link they were loaded from and the block's serial data
+// (they implement BlockNode).  Storing such a node again with the same LinkPrototype -- for example, to copy it to other storage --
+// then needs no encoding or hashing: Store (and ComputeLink, and StoreBatch) use the retained link and data directly.
+// This costs the memory to keep the data, for as long as the node is kept.
+// It isn't done for schema.TypedNode; and if the LinkSystem has a NodeReifier, RetainBlocks has no effect at all,
+// since the reifier could change the nodes.
+// See BlockNode for more.
+//
+// LoadPolicy and StorePolicy, if set, are asked to approve the LinkPrototype of every link before it's loaded,
+// and every LinkPrototype before it's used to store (or to compute a link), respectively.
+// They run before any of the choosers, and if they return an error, nothing further happens: the error is returned, wrapped in ErrPolicy.
+// They're meant for refusing codecs or hash functions which aren't wanted (for example, in data from untrusted sources);
+// the linking/cid package has a Policy type which makes them for CIDs.
+// (A StorePolicy is also asked about the prototype an InlineChooser offers; if it's refused, blocks simply aren't inlined.)
+//
+// InlineData and InlineChooser are optional, and deal with links which carry their data within themselves
+// (such as CIDs using the "identity" multihash).
+// InlineData is asked about each link before loading it; if it returns the data, storage isn't consulted.
+// InlineChooser is asked about the LinkPrototype for each store: if it returns a prototype for inline links,
+// then blocks which encode to no more than the returned number of bytes are given links with that prototype instead,
+// and aren't written to storage.  (ComputeLink gives the same links as Store.)
+// The LinkSystems from the linking/cid package set these up for identity CIDs.
+//
+// OnLoad and OnStore are optional observers, called after every load (by Fill, and so also Load)
+// and every store (by Store and StoreBatch), whether it succeeded or not.
+// They're meant for metrics and tracing; see BlockEvent for what they're told.
+// When they're nil, there's no cost to having them.
+// Observers are called synchronously, so should be quick,
+// and must be safe for concurrent use if the LinkSystem is used concurrently (as StoreBatch does).
 type LinkSystem struct {
 	EncoderChooser     func(datamodel.LinkPrototype) (codec.Encoder, error)
 	DecoderChooser     func(datamodel.Link) (codec.Decoder, error)
@@ -36,7 +70,15 @@ type LinkSystem struct {
 	StorageWriteOpener BlockWriteOpener
 	StorageReadOpener  BlockReadOpener
 	TrustedStorage     bool
+	MaxBlockSize       int64
+	RetainBlocks       bool
+	LoadPolicy         func(datamodel.LinkPrototype) error
+	StorePolicy        func(datamodel.LinkPrototype) error
 	NodeReifier        NodeReifier
+	InlineData         func(datamodel.Link) ([]byte, bool)
+	InlineChooser      func(datamodel.LinkPrototype) (datamodel.LinkPrototype, int)
+	OnLoad             BlockObserver
+	OnStore            BlockObserver
 }
 
 // The following three types are the key functionality we need from a "blockstore".
@@ -152,6 +194,13 @@ type (
 	// went wrong when we tried to do so
 	//
 	NodeReifier func(LinkContext, datamodel.Node, *LinkSystem) (datamodel.Node, error)
+
+	// BlockObserver defines the shape of a function which is told about block loads and stores,
+	// for the OnLoad and OnStore fields of LinkSystem.
+	//
+	// The LinkContext is the one the load or store was made with,
+	// so the path, and any values carried by its Ctx (such as tracing spans), are available.
+	BlockObserver func(LinkContext, BlockEvent)
 )
 
 // LinkContext is a structure carrying ancilary information that may be used
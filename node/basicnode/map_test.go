@@ -39,6 +39,18 @@ func BenchmarkSpec_Marshal_Map3StrInt(b *testing.B) {
 func BenchmarkSpec_Marshal_MapNStrMap3StrInt(b *testing.B) {
 	tests.BenchmarkSpec_Marshal_MapNStrMap3StrInt(b, basicnode.Prototype.Map)
 }
+func BenchmarkSpec_MarshalDagJson_Map3StrInt(b *testing.B) {
+	tests.BenchmarkSpec_MarshalDagJson_Map3StrInt(b, basicnode.Prototype.Map)
+}
+func BenchmarkSpec_MarshalDagJson_MapNStrMap3StrInt(b *testing.B) {
+	tests.BenchmarkSpec_MarshalDagJson_MapNStrMap3StrInt(b, basicnode.Prototype.Map)
+}
+func BenchmarkSpec_MarshalDagCbor_Map3StrInt(b *testing.B) {
+	tests.BenchmarkSpec_MarshalDagCbor_Map3StrInt(b, basicnode.Prototype.Map)
+}
+func BenchmarkSpec_MarshalDagCbor_MapNStrMap3StrInt(b *testing.B) {
+	tests.BenchmarkSpec_MarshalDagCbor_MapNStrMap3StrInt(b, basicnode.Prototype.Map)
+}
 
 func BenchmarkSpec_Unmarshal_Map3StrInt(b *testing.B) {
 	tests.BenchmarkSpec_Unmarshal_Map3StrInt(b, basicnode.Prototype.Map)
@@ -46,3 +58,15 @@ func BenchmarkSpec_Unmarshal_Map3StrInt(b *testing.B) {
 func BenchmarkSpec_Unmarshal_MapNStrMap3StrInt(b *testing.B) {
 	tests.BenchmarkSpec_Unmarshal_MapNStrMap3StrInt(b, basicnode.Prototype.Map)
 }
+func BenchmarkSpec_UnmarshalDagJson_Map3StrInt(b *testing.B) {
+	tests.BenchmarkSpec_UnmarshalDagJson_Map3StrInt(b, basicnode.Prototype.Map)
+}
+func BenchmarkSpec_UnmarshalDagJson_MapNStrMap3StrInt(b *testing.B) {
+	tests.BenchmarkSpec_UnmarshalDagJson_MapNStrMap3StrInt(b, basicnode.Prototype.Map)
+}
+func BenchmarkSpec_UnmarshalDagCbor_Map3StrInt(b *testing.B) {
+	tests.BenchmarkSpec_UnmarshalDagCbor_Map3StrInt(b, basicnode.Prototype.Map)
+}
+func BenchmarkSpec_UnmarshalDagCbor_MapNStrMap3StrInt(b *testing.B) {
+	tests.BenchmarkSpec_UnmarshalDagCbor_MapNStrMap3StrInt(b, basicnode.Prototype.Map)
+}
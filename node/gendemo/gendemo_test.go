@@ -29,6 +29,31 @@ func BenchmarkSpec_Unmarshal_MapNStrMap3StrInt(b *testing.B) {
 	tests.BenchmarkSpec_Unmarshal_MapNStrMap3StrInt(b, _Map__String__Msg3__Prototype{})
 }
 
+func BenchmarkSpec_MarshalDagJson_Map3StrInt(b *testing.B) {
+	tests.BenchmarkSpec_MarshalDagJson_Map3StrInt(b, _Msg3__Prototype{})
+}
+func BenchmarkSpec_UnmarshalDagJson_Map3StrInt(b *testing.B) {
+	tests.BenchmarkSpec_UnmarshalDagJson_Map3StrInt(b, _Msg3__Prototype{})
+}
+func BenchmarkSpec_MarshalDagJson_MapNStrMap3StrInt(b *testing.B) {
+	tests.BenchmarkSpec_MarshalDagJson_MapNStrMap3StrInt(b, _Map__String__Msg3__Prototype{})
+}
+func BenchmarkSpec_UnmarshalDagJson_MapNStrMap3StrInt(b *testing.B) {
+	tests.BenchmarkSpec_UnmarshalDagJson_MapNStrMap3StrInt(b, _Map__String__Msg3__Prototype{})
+}
+func BenchmarkSpec_MarshalDagCbor_Map3StrInt(b *testing.B) {
+	tests.BenchmarkSpec_MarshalDagCbor_Map3StrInt(b, _Msg3__Prototype{})
+}
+func BenchmarkSpec_UnmarshalDagCbor_Map3StrInt(b *testing.B) {
+	tests.BenchmarkSpec_UnmarshalDagCbor_Map3StrInt(b, _Msg3__Prototype{})
+}
+func BenchmarkSpec_MarshalDagCbor_MapNStrMap3StrInt(b *testing.B) {
+	tests.BenchmarkSpec_MarshalDagCbor_MapNStrMap3StrInt(b, _Map__String__Msg3__Prototype{})
+}
+func BenchmarkSpec_UnmarshalDagCbor_MapNStrMap3StrInt(b *testing.B) {
+	tests.BenchmarkSpec_UnmarshalDagCbor_MapNStrMap3StrInt(b, _Map__String__Msg3__Prototype{})
+}
+
 // the standard 'walk' benchmarks don't work yet because those use selectors and use the prototype we give them for that, which...
 //  does not fly: cramming selector keys into assemblers meant for struct types from our test corpus?  nope.
 //   this is a known shortcut-become-bug with the design of the 'walk' benchmarks; we'll have to fix soon.
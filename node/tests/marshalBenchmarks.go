@@ -2,13 +2,19 @@ package tests
 
 import (
 	"bytes"
+	stdjson "encoding/json"
 	"fmt"
+	"io"
 	"strings"
 	"testing"
 
+	"github.com/ipld/go-ipld-prime/codec"
+	"github.com/ipld/go-ipld-prime/codec/dagcbor"
+	"github.com/ipld/go-ipld-prime/codec/dagjson"
 	"github.com/ipld/go-ipld-prime/codec/json"
 	"github.com/ipld/go-ipld-prime/datamodel"
 	"github.com/ipld/go-ipld-prime/must"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
 	"github.com/ipld/go-ipld-prime/node/tests/corpus"
 )
 
@@ -20,6 +26,9 @@ import (
 //    versus how much time is spent in the serialization efforts;
 // - we can make direct comparisons to the standard library json marshalling
 //    and unmarshalling, thus having a back-of-the-envelope baseline to compare.
+//
+// Each spec also has DagJson and DagCbor variants, which measure the same thing with compact DAG-JSON and with DAG-CBOR,
+// for comparing the codecs to each other.
 
 func BenchmarkSpec_Marshal_Map3StrInt(b *testing.B, np datamodel.NodePrototype) {
 	nb := np.NewBuilder()
@@ -36,6 +45,12 @@ func BenchmarkSpec_Marshal_Map3StrInt(b *testing.B, np datamodel.NodePrototype)
 		panic(err)
 	}
 }
+func BenchmarkSpec_MarshalDagJson_Map3StrInt(b *testing.B, np datamodel.NodePrototype) {
+	benchmarkMarshal(b, np, corpus.Map3StrInt(), []byte(corpus.Map3StrInt()), encodeDagJson)
+}
+func BenchmarkSpec_MarshalDagCbor_Map3StrInt(b *testing.B, np datamodel.NodePrototype) {
+	benchmarkMarshal(b, np, corpus.Map3StrInt(), mustDagCborFromJsonString(corpus.Map3StrInt()), encodeDagCbor)
+}
 
 func BenchmarkSpec_Marshal_MapNStrMap3StrInt(b *testing.B, np datamodel.NodePrototype) {
 	for _, n := range []int{0, 1, 2, 4, 8, 16, 32} {
@@ -55,9 +70,74 @@ func BenchmarkSpec_Marshal_MapNStrMap3StrInt(b *testing.B, np datamodel.NodeProt
 			if err != nil {
 				b.Fatalf("encode errored: %s", err)
 			}
-			if buf.String() != msg {
+			if buf.String() != prettyJson(msg) {
 				b.Fatalf("encode result didn't match corpus")
 			}
 		})
 	}
 }
+func BenchmarkSpec_MarshalDagJson_MapNStrMap3StrInt(b *testing.B, np datamodel.NodePrototype) {
+	for _, n := range []int{0, 1, 2, 4, 8, 16, 32} {
+		b.Run(fmt.Sprintf("n=%d", n), func(b *testing.B) {
+			msg := corpus.MapNStrMap3StrInt(n)
+			benchmarkMarshal(b, np, msg, []byte(msg), encodeDagJson)
+		})
+	}
+}
+func BenchmarkSpec_MarshalDagCbor_MapNStrMap3StrInt(b *testing.B, np datamodel.NodePrototype) {
+	for _, n := range []int{0, 1, 2, 4, 8, 16, 32} {
+		b.Run(fmt.Sprintf("n=%d", n), func(b *testing.B) {
+			msg := corpus.MapNStrMap3StrInt(n)
+			benchmarkMarshal(b, np, msg, mustDagCborFromJsonString(msg), encodeDagCbor)
+		})
+	}
+}
+
+// benchmarkMarshal is the body of the DagJson and DagCbor marshalling specs.
+// The node is built from msg (in JSON), and must encode to expect.
+func benchmarkMarshal(b *testing.B, np datamodel.NodePrototype, msg string, expect []byte, encode codec.Encoder) {
+	node := mustNodeFromJsonString(np, msg)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	var buf bytes.Buffer
+	var err error
+	for i := 0; i < b.N; i++ {
+		buf = bytes.Buffer{}
+		err = encode(node, &buf)
+	}
+
+	b.StopTimer()
+	if err != nil {
+		b.Fatalf("encode errored: %s", err)
+	}
+	if !bytes.Equal(buf.Bytes(), expect) {
+		b.Fatalf("encode result didn't match corpus")
+	}
+}
+
+// encodeDagJson and encodeDagCbor encode compactly, and keep map order, so their results can be checked against the corpus.
+func encodeDagJson(n datamodel.Node, w io.Writer) error {
+	return dagjson.EncodeOptions{MapSortMode: codec.MapSortMode_None}.Encode(n, w)
+}
+func encodeDagCbor(n datamodel.Node, w io.Writer) error {
+	return dagcbor.EncodeOptions{MapSortMode: codec.MapSortMode_None}.Encode(n, w)
+}
+
+// prettyJson lays out a corpus string the way the json codec does: with linebreaks and tab indentation,
+// and a linebreak at the end.
+func prettyJson(msg string) string {
+	var buf bytes.Buffer
+	must.NotError(stdjson.Indent(&buf, []byte(msg), "", "\t"))
+	buf.WriteByte('\n')
+	return buf.String()
+}
+
+// mustDagCborFromJsonString converts a corpus string to DAG-CBOR.
+func mustDagCborFromJsonString(str string) []byte {
+	nb := basicnode.Prototype.Any.NewBuilder()
+	must.NotError(json.Decode(nb, strings.NewReader(str)))
+	var buf bytes.Buffer
+	must.NotError(encodeDagCbor(nb.Build(), &buf))
+	return buf.Bytes()
+}
@@ -6,13 +6,12 @@ import (
 	"strings"
 	"testing"
 
-	"github.com/polydawn/refmt/json"
-	"github.com/polydawn/refmt/shared"
 	. "github.com/warpfork/go-wish"
 
 	"github.com/ipld/go-ipld-prime/codec"
 	"github.com/ipld/go-ipld-prime/codec/dagjson"
 	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
 	"github.com/ipld/go-ipld-prime/schema"
 	"github.com/ipld/go-ipld-prime/traversal"
 )
@@ -252,17 +251,18 @@ func testUnmarshal(t *testing.T, np datamodel.NodePrototype, data string, expect
 func testMarshal(t *testing.T, n datamodel.Node, data string) {
 	t.Helper()
 	// We'll marshal with "pretty" linebreaks and indents (and re-format the fixture to the same) for better diffing.
-	prettyprint := json.EncodeOptions{Line: []byte{'\n'}, Indent: []byte{'\t'}}
 	var buf bytes.Buffer
-	err := dagjson.Marshal(n, json.NewEncoder(&buf, prettyprint), dagjson.EncodeOptions{
+	err := dagjson.EncodeOptions{
 		EncodeLinks: true,
 		EncodeBytes: true,
 		MapSortMode: codec.MapSortMode_Lexical,
-	})
+		Line:        []byte{'\n'},
+		Indent:      []byte{'\t'},
+	}.Encode(n, &buf)
 	if err != nil {
 		t.Errorf("marshal failed: %s", err)
 	}
-	Wish(t, buf.String(), ShouldEqual, reformat(data, prettyprint))
+	Wish(t, buf.String(), ShouldEqual, reformat(data))
 }
 
 func wishPoint(t *testing.T, n datamodel.Node, point testcasePoint) {
@@ -319,12 +319,19 @@ func closeEnough(actual, expected interface{}) (string, bool) {
 	}
 }
 
-func reformat(x string, opts json.EncodeOptions) string {
+// reformat re-encodes a json fixture with the same linebreaks and indents as testMarshal uses,
+// leaving everything else (including the order of map keys) as it was.
+func reformat(x string) string {
+	nb := basicnode.Prototype.Any.NewBuilder()
+	if err := (dagjson.DecodeOptions{}).Decode(nb, strings.NewReader(x)); err != nil {
+		panic(err)
+	}
 	var buf bytes.Buffer
-	if err := (shared.TokenPump{
-		TokenSource: json.NewDecoder(strings.NewReader(x)),
-		TokenSink:   json.NewEncoder(&buf, opts),
-	}).Run(); err != nil {
+	if err := (dagjson.EncodeOptions{
+		MapSortMode: codec.MapSortMode_None,
+		Line:        []byte{'\n'},
+		Indent:      []byte{'\t'},
+	}).Encode(nb.Build(), &buf); err != nil {
 		panic(err)
 	}
 	return buf.String()
@@ -6,6 +6,9 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/ipld/go-ipld-prime/codec"
+	"github.com/ipld/go-ipld-prime/codec/dagcbor"
+	"github.com/ipld/go-ipld-prime/codec/dagjson"
 	"github.com/ipld/go-ipld-prime/codec/json"
 	"github.com/ipld/go-ipld-prime/datamodel"
 	"github.com/ipld/go-ipld-prime/node/tests/corpus"
@@ -19,6 +22,8 @@ import (
 //    versus how much time is spent in the serialization efforts;
 // - we can make direct comparisons to the standard library json marshalling
 //    and unmarshalling, thus having a back-of-the-envelope baseline to compare.
+//
+// As with marshalling, each spec also has DagJson and DagCbor variants.
 
 func BenchmarkSpec_Unmarshal_Map3StrInt(b *testing.B, np datamodel.NodePrototype) {
 	var err error
@@ -31,6 +36,12 @@ func BenchmarkSpec_Unmarshal_Map3StrInt(b *testing.B, np datamodel.NodePrototype
 		panic(err)
 	}
 }
+func BenchmarkSpec_UnmarshalDagJson_Map3StrInt(b *testing.B, np datamodel.NodePrototype) {
+	benchmarkUnmarshal(b, np, []byte(corpus.Map3StrInt()), dagjson.Decode, encodeDagJson)
+}
+func BenchmarkSpec_UnmarshalDagCbor_Map3StrInt(b *testing.B, np datamodel.NodePrototype) {
+	benchmarkUnmarshal(b, np, mustDagCborFromJsonString(corpus.Map3StrInt()), dagcbor.Decode, encodeDagCbor)
+}
 
 func BenchmarkSpec_Unmarshal_MapNStrMap3StrInt(b *testing.B, np datamodel.NodePrototype) {
 	for _, n := range []int{0, 1, 2, 4, 8, 16, 32} {
@@ -53,9 +64,49 @@ func BenchmarkSpec_Unmarshal_MapNStrMap3StrInt(b *testing.B, np datamodel.NodePr
 			}
 			var buf bytes.Buffer
 			json.Encode(node, &buf)
-			if buf.String() != msg {
+			if buf.String() != prettyJson(msg) {
 				b.Fatalf("re-encode result didn't match corpus")
 			}
 		})
 	}
 }
+func BenchmarkSpec_UnmarshalDagJson_MapNStrMap3StrInt(b *testing.B, np datamodel.NodePrototype) {
+	for _, n := range []int{0, 1, 2, 4, 8, 16, 32} {
+		b.Run(fmt.Sprintf("n=%d", n), func(b *testing.B) {
+			benchmarkUnmarshal(b, np, []byte(corpus.MapNStrMap3StrInt(n)), dagjson.Decode, encodeDagJson)
+		})
+	}
+}
+func BenchmarkSpec_UnmarshalDagCbor_MapNStrMap3StrInt(b *testing.B, np datamodel.NodePrototype) {
+	for _, n := range []int{0, 1, 2, 4, 8, 16, 32} {
+		b.Run(fmt.Sprintf("n=%d", n), func(b *testing.B) {
+			benchmarkUnmarshal(b, np, mustDagCborFromJsonString(corpus.MapNStrMap3StrInt(n)), dagcbor.Decode, encodeDagCbor)
+		})
+	}
+}
+
+// benchmarkUnmarshal is the body of the DagJson and DagCbor unmarshalling specs.
+// The result must re-encode to msg again.
+func benchmarkUnmarshal(b *testing.B, np datamodel.NodePrototype, msg []byte, decode codec.Decoder, encode codec.Encoder) {
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	var node datamodel.Node
+	var err error
+	nb := np.NewBuilder()
+	for i := 0; i < b.N; i++ {
+		err = decode(nb, bytes.NewReader(msg))
+		node = nb.Build()
+		nb.Reset()
+	}
+
+	b.StopTimer()
+	if err != nil {
+		b.Fatalf("decode errored: %s", err)
+	}
+	var buf bytes.Buffer
+	encode(node, &buf)
+	if !bytes.Equal(buf.Bytes(), msg) {
+		b.Fatalf("re-encode result didn't match corpus")
+	}
+}
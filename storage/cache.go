@@ -0,0 +1,147 @@
+package storage
+
+import (
+	"bytes"
+	"container/list"
+	"io"
+	"io/ioutil"
+	"sync"
+
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/linking"
+)
+
+// Cache is an in-memory, least-recently-used cache of block data, bounded by a total size in bytes.
+// It's used by wrapping the functions of some other storage system:
+//
+//		cache := storage.NewCache(64 << 20)
+//		lsys.StorageReadOpener = cache.WrapReadOpener(store.OpenRead)
+//		lsys.StorageWriteOpener = cache.WrapWriteOpener(store.OpenWrite)
+//
+// Reads which miss the cache are read fully from the wrapped BlockReadOpener, and then remembered.
+// Writes through a wrapped BlockWriteOpener are remembered once they're successfully committed,
+// so data that was just stored can be loaded again without going back to storage.
+// When the total size of remembered blocks exceeds the budget, the least recently used blocks are evicted.
+// Blocks larger than the whole budget are never cached.
+//
+// The cache doesn't verify data as it's filled; a LinkSystem will still verify the hash of data served from the cache
+// (unless it's configured with TrustedStorage).
+//
+// Cache is safe for concurrent use.
+// The same Cache can wrap several read and write openers; they'll all share the same budget and contents
+// (so this should only be done if they all refer to the same underlying data).
+type Cache struct {
+	mu       sync.Mutex
+	maxBytes int64
+	bytes    int64
+	lru      *list.List // of *cacheEntry; front is most recently used.
+	entries  map[datamodel.Link]*list.Element
+	stats    CacheStats
+}
+
+type cacheEntry struct {
+	lnk  datamodel.Link
+	data []byte
+}
+
+// CacheStats describes the current state and the activity of a Cache.
+type CacheStats struct {
+	Hits      uint64 // Reads served from the cache.
+	Misses    uint64 // Reads that had to go to the wrapped storage.
+	Evictions uint64 // Blocks removed from the cache to stay within budget.
+	Blocks    int    // Number of blocks currently cached.
+	Bytes     int64  // Total size of blocks currently cached.
+}
+
+// NewCache returns a Cache which will hold up to maxBytes of block data.
+func NewCache(maxBytes int64) *Cache {
+	return &Cache{
+		maxBytes: maxBytes,
+		lru:      list.New(),
+		entries:  make(map[datamodel.Link]*list.Element),
+	}
+}
+
+// Stats returns a snapshot of the cache's counters.
+func (c *Cache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	st := c.stats
+	st.Blocks = len(c.entries)
+	st.Bytes = c.bytes
+	return st
+}
+
+// WrapReadOpener returns a BlockReadOpener that serves data from the cache when possible,
+// and otherwise reads from the given BlockReadOpener and caches the result.
+func (c *Cache) WrapReadOpener(bro linking.BlockReadOpener) linking.BlockReadOpener {
+	return func(lnkCtx linking.LinkContext, lnk datamodel.Link) (io.Reader, error) {
+		if data, ok := c.get(lnk); ok {
+			return bytes.NewReader(data), nil
+		}
+		r, err := bro(lnkCtx, lnk)
+		if err != nil {
+			return nil, err
+		}
+		data, err := ioutil.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		c.put(lnk, data)
+		return bytes.NewReader(data), nil
+	}
+}
+
+// WrapWriteOpener returns a BlockWriteOpener that writes to the given BlockWriteOpener,
+// and also adds the data to the cache when the write is committed.
+func (c *Cache) WrapWriteOpener(bwo linking.BlockWriteOpener) linking.BlockWriteOpener {
+	return func(lnkCtx linking.LinkContext) (io.Writer, linking.BlockWriteCommitter, error) {
+		w, commit, err := bwo(lnkCtx)
+		if err != nil {
+			return nil, nil, err
+		}
+		var buf bytes.Buffer
+		return io.MultiWriter(w, &buf), func(lnk datamodel.Link) error {
+			if err := commit(lnk); err != nil {
+				return err
+			}
+			c.put(lnk, buf.Bytes())
+			return nil
+		}, nil
+	}
+}
+
+func (c *Cache) get(lnk datamodel.Link) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, exists := c.entries[lnk]
+	if !exists {
+		c.stats.Misses++
+		return nil, false
+	}
+	c.stats.Hits++
+	c.lru.MoveToFront(elem)
+	return elem.Value.(*cacheEntry).data, true
+}
+
+func (c *Cache) put(lnk datamodel.Link, data []byte) {
+	size := int64(len(data))
+	if size > c.maxBytes {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, exists := c.entries[lnk]; exists {
+		c.lru.MoveToFront(elem)
+		return
+	}
+	for c.bytes+size > c.maxBytes {
+		oldest := c.lru.Back()
+		ent := c.lru.Remove(oldest).(*cacheEntry)
+		delete(c.entries, ent.lnk)
+		c.bytes -= int64(len(ent.data))
+		c.stats.Evictions++
+	}
+	c.entries[lnk] = c.lru.PushFront(&cacheEntry{lnk, data})
+	c.bytes += size
+}
@@ -0,0 +1,84 @@
+package storage_test
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/linking"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	"github.com/ipld/go-ipld-prime/storage"
+)
+
+func TestCache(t *testing.T) {
+	store := &storage.Memory{}
+	var reads int
+	cache := storage.NewCache(30)
+	lsys := cidlink.DefaultLinkSystem()
+	lsys.StorageReadOpener = cache.WrapReadOpener(func(lnkCtx linking.LinkContext, lnk datamodel.Link) (io.Reader, error) {
+		reads++
+		return store.OpenRead(lnkCtx, lnk)
+	})
+	lsys.StorageWriteOpener = store.OpenWrite
+
+	// Each of these blocks is 8 bytes of dag-json (a quoted six character string), so three will fit.
+	var links []datamodel.Link
+	for i := 0; i < 4; i++ {
+		links = append(links, lsys.MustStore(linking.LinkContext{}, lp, basicnode.NewString(fmt.Sprintf("block%d", i))))
+	}
+	load := func(lnk datamodel.Link) {
+		_, err := lsys.Load(linking.LinkContext{}, lnk, basicnode.Prototype.Any)
+		qt.Assert(t, err, qt.IsNil)
+	}
+
+	for _, l := range links[:3] {
+		load(l)
+	}
+	qt.Check(t, reads, qt.Equals, 3)
+	load(links[0])
+	qt.Check(t, reads, qt.Equals, 3)
+	qt.Check(t, cache.Stats(), qt.DeepEquals, storage.CacheStats{Hits: 1, Misses: 3, Blocks: 3, Bytes: 24})
+
+	// Loading a fourth block evicts the least recently used one, which is now links[1].
+	load(links[3])
+	qt.Check(t, cache.Stats().Evictions, qt.Equals, uint64(1))
+	load(links[0])
+	load(links[2])
+	qt.Check(t, reads, qt.Equals, 4)
+	load(links[1])
+	qt.Check(t, reads, qt.Equals, 5)
+
+	t.Run("writes populate the cache", func(t *testing.T) {
+		lsys := lsys
+		lsys.StorageWriteOpener = cache.WrapWriteOpener(store.OpenWrite)
+		lnk := lsys.MustStore(linking.LinkContext{}, lp, basicnode.NewString("stored"))
+		before := reads
+		load(lnk)
+		qt.Check(t, reads, qt.Equals, before)
+	})
+	t.Run("concurrent use", func(t *testing.T) {
+		cache := storage.NewCache(1 << 20)
+		lsys := cidlink.DefaultLinkSystem()
+		lsys.StorageReadOpener = cache.WrapReadOpener(store.OpenRead)
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for _, l := range links {
+					_, err := lsys.Load(linking.LinkContext{}, l, basicnode.Prototype.Any)
+					qt.Check(t, err, qt.IsNil)
+				}
+			}()
+		}
+		wg.Wait()
+		st := cache.Stats()
+		qt.Check(t, st.Hits+st.Misses, qt.Equals, uint64(8*len(links)))
+		qt.Check(t, st.Blocks, qt.Equals, len(links))
+	})
+}
@@ -0,0 +1,129 @@
+package car_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+	"github.com/ipfs/go-cid"
+
+	_ "github.com/ipld/go-ipld-prime/codec/dagcbor"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/fluent/qp"
+	"github.com/ipld/go-ipld-prime/linking"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	"github.com/ipld/go-ipld-prime/storage"
+	"github.com/ipld/go-ipld-prime/storage/car"
+)
+
+var lp = cidlink.LinkPrototype{Prefix: cid.Prefix{
+	Version:  1,
+	Codec:    0x71, // dag-cbor
+	MhType:   0x12, // sha2-256
+	MhLength: 32,
+}}
+
+// buildFixture stores a small DAG into a memory store, and returns the root link, all links in storage order, and the store.
+func buildFixture(t *testing.T) (datamodel.Link, []datamodel.Link, *storage.Memory) {
+	store := &storage.Memory{}
+	lsys := cidlink.DefaultLinkSystem()
+	lsys.StorageReadOpener = store.OpenRead
+	lsys.StorageWriteOpener = store.OpenWrite
+
+	var links []datamodel.Link
+	for _, s := range []string{"alpha", "beta", "gamma"} {
+		lnk, err := lsys.Store(linking.LinkContext{}, lp, basicnode.NewString(s))
+		qt.Assert(t, err, qt.IsNil)
+		links = append(links, lnk)
+	}
+	n, err := qp.BuildMap(basicnode.Prototype.Any, 1, func(ma datamodel.MapAssembler) {
+		qp.MapEntry(ma, "children", qp.List(int64(len(links)), func(la datamodel.ListAssembler) {
+			for _, l := range links {
+				qp.ListEntry(la, qp.Link(l))
+			}
+		}))
+	})
+	qt.Assert(t, err, qt.IsNil)
+	root, err := lsys.Store(linking.LinkContext{}, lp, n)
+	qt.Assert(t, err, qt.IsNil)
+	return root, append([]datamodel.Link{root}, links...), store
+}
+
+func TestHeaderBytes(t *testing.T) {
+	var buf bytes.Buffer
+	_, err := car.NewWriter(&buf, nil)
+	qt.Assert(t, err, qt.IsNil)
+	// varint(17), then {"roots": [], "version": 1} in dag-cbor.
+	qt.Check(t, hex.EncodeToString(buf.Bytes()), qt.Equals, "11a265726f6f7473806776657273696f6e01")
+}
+
+func TestRoundtrip(t *testing.T) {
+	root, links, mem := buildFixture(t)
+
+	// Write a CAR through a LinkSystem, by copying from the memory store.
+	var buf bytes.Buffer
+	ws, err := car.NewWriteStore(&buf, []datamodel.Link{root})
+	qt.Assert(t, err, qt.IsNil)
+	lsys := cidlink.DefaultLinkSystem()
+	lsys.StorageReadOpener = mem.OpenRead
+	lsys.StorageWriteOpener = ws.OpenWrite
+	for _, l := range links {
+		n, err := lsys.Load(linking.LinkContext{}, l, basicnode.Prototype.Any)
+		qt.Assert(t, err, qt.IsNil)
+		_, err = lsys.Store(linking.LinkContext{}, lp, n)
+		qt.Assert(t, err, qt.IsNil)
+		// A second store of the same block should not write a second section.
+		_, err = lsys.Store(linking.LinkContext{}, lp, n)
+		qt.Assert(t, err, qt.IsNil)
+	}
+
+	t.Run("streaming reader", func(t *testing.T) {
+		cr, err := car.NewReader(bytes.NewReader(buf.Bytes()))
+		qt.Assert(t, err, qt.IsNil)
+		qt.Check(t, fmt.Sprint(cr.Roots()), qt.Equals, fmt.Sprint([]datamodel.Link{root}))
+		var seen []datamodel.Link
+		for {
+			lnk, data, err := cr.Next()
+			if err == io.EOF {
+				break
+			}
+			qt.Assert(t, err, qt.IsNil)
+			qt.Check(t, data, qt.DeepEquals, mem.Bag[lnk])
+			seen = append(seen, lnk)
+		}
+		qt.Check(t, fmt.Sprint(seen), qt.Equals, fmt.Sprint(links))
+	})
+	t.Run("read store", func(t *testing.T) {
+		rs, err := car.NewReadStore(bytes.NewReader(buf.Bytes()))
+		qt.Assert(t, err, qt.IsNil)
+		qt.Check(t, fmt.Sprint(rs.Roots()), qt.Equals, fmt.Sprint([]datamodel.Link{root}))
+		qt.Check(t, fmt.Sprint(rs.Links()), qt.Equals, fmt.Sprint(links))
+		has, err := rs.Has(context.Background(), root)
+		qt.Check(t, err, qt.IsNil)
+		qt.Check(t, has, qt.IsTrue)
+
+		lsys := cidlink.DefaultLinkSystem()
+		lsys.StorageReadOpener = rs.OpenRead
+		n, err := lsys.Load(linking.LinkContext{}, root, basicnode.Prototype.Any)
+		qt.Assert(t, err, qt.IsNil)
+		children, err := n.LookupByString("children")
+		qt.Assert(t, err, qt.IsNil)
+		qt.Check(t, children.Length(), qt.Equals, int64(3))
+		for _, l := range links[1:] {
+			_, err := lsys.Load(linking.LinkContext{}, l, basicnode.Prototype.Any)
+			qt.Check(t, err, qt.IsNil)
+		}
+
+		_, err = rs.OpenRead(linking.LinkContext{}, lp.BuildLink(make([]byte, 32)))
+		qt.Check(t, err, qt.ErrorMatches, "block not found: .*")
+	})
+	t.Run("truncated file", func(t *testing.T) {
+		_, err := car.NewReadStore(bytes.NewReader(buf.Bytes()[:buf.Len()-3]))
+		qt.Check(t, err, qt.ErrorMatches, "car: truncated section .*")
+	})
+}
@@ -0,0 +1,226 @@
+package car
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/multiformats/go-multihash"
+)
+
+// IndexCodec is the multicodec indicator for the index format implemented by Index
+// ("car-multihash-index-sorted").
+const IndexCodec = 0x0401
+
+// Index is a sorted multihash index, mapping the multihash of each block in a CARv1 payload
+// to the offset of that block's section, relative to the start of the payload.
+//
+// The serial form is the "MultihashIndexSorted" format used in CARv2 files:
+// records are grouped into buckets by multihash code and by digest length,
+// and records within each bucket are sorted by digest, so lookups can use binary search.
+// See https://ipld.io/specs/transport/car/carv2/#format-0x0401-multihashindexsorted .
+type Index struct {
+	buckets []indexBucket // sorted by code, then by width.
+}
+
+// indexBucket holds fixed-width records of digest followed by a little-endian uint64 offset.
+type indexBucket struct {
+	code    uint64
+	width   uint32
+	records []byte
+}
+
+func (b indexBucket) count() int {
+	return len(b.records) / int(b.width)
+}
+
+func (b indexBucket) digestAt(i int) []byte {
+	start := i * int(b.width)
+	return b.records[start : start+int(b.width)-8]
+}
+
+func (b indexBucket) offsetAt(i int) uint64 {
+	end := (i + 1) * int(b.width)
+	return binary.LittleEndian.Uint64(b.records[end-8 : end])
+}
+
+// BuildIndex reads a CARv1 stream and builds an Index of all the blocks in it.
+func BuildIndex(r io.Reader) (*Index, error) {
+	cr, err := NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	type record struct {
+		digest []byte
+		offset uint64
+	}
+	type bucketKey struct {
+		code  uint64
+		width uint32
+	}
+	records := make(map[bucketKey][]record)
+	for {
+		start := cr.cr.offset
+		lnk, _, _, err := cr.next(false)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		dmh, err := multihash.Decode(lnk.Cid.Hash())
+		if err != nil {
+			return nil, fmt.Errorf("car: invalid multihash in section at offset %d: %w", start, err)
+		}
+		k := bucketKey{dmh.Code, uint32(len(dmh.Digest) + 8)}
+		records[k] = append(records[k], record{dmh.Digest, uint64(start)})
+	}
+	idx := &Index{}
+	for k, recs := range records {
+		sort.SliceStable(recs, func(i, j int) bool {
+			return bytes.Compare(recs[i].digest, recs[j].digest) < 0
+		})
+		b := indexBucket{code: k.code, width: k.width, records: make([]byte, 0, len(recs)*int(k.width))}
+		for _, rec := range recs {
+			b.records = append(b.records, rec.digest...)
+			var obuf [8]byte
+			binary.LittleEndian.PutUint64(obuf[:], rec.offset)
+			b.records = append(b.records, obuf[:]...)
+		}
+		idx.buckets = append(idx.buckets, b)
+	}
+	sort.Slice(idx.buckets, func(i, j int) bool {
+		if idx.buckets[i].code != idx.buckets[j].code {
+			return idx.buckets[i].code < idx.buckets[j].code
+		}
+		return idx.buckets[i].width < idx.buckets[j].width
+	})
+	return idx, nil
+}
+
+// Lookup returns the offset of the section holding the block with the given multihash.
+// The offset is relative to the start of the CARv1 payload.
+func (idx *Index) Lookup(mh multihash.Multihash) (uint64, bool) {
+	dmh, err := multihash.Decode(mh)
+	if err != nil {
+		return 0, false
+	}
+	width := uint32(len(dmh.Digest) + 8)
+	for _, b := range idx.buckets {
+		if b.code != dmh.Code || b.width != width {
+			continue
+		}
+		n := b.count()
+		i := sort.Search(n, func(i int) bool {
+			return bytes.Compare(b.digestAt(i), dmh.Digest) >= 0
+		})
+		if i < n && bytes.Equal(b.digestAt(i), dmh.Digest) {
+			return b.offsetAt(i), true
+		}
+		return 0, false
+	}
+	return 0, false
+}
+
+// WriteTo writes the serial form of the Index to w, including the leading IndexCodec varint.
+func (idx *Index) WriteTo(w io.Writer) (int64, error) {
+	var buf bytes.Buffer
+	var vbuf [binary.MaxVarintLen64]byte
+	buf.Write(vbuf[:binary.PutUvarint(vbuf[:], IndexCodec)])
+	// Buckets are already sorted by code and then width, so they can be emitted in runs of the same code.
+	var codes []int // start positions of each run of buckets with the same code.
+	for i, b := range idx.buckets {
+		if i == 0 || b.code != idx.buckets[i-1].code {
+			codes = append(codes, i)
+		}
+	}
+	binary.Write(&buf, binary.LittleEndian, int32(len(codes)))
+	for ci, start := range codes {
+		end := len(idx.buckets)
+		if ci+1 < len(codes) {
+			end = codes[ci+1]
+		}
+		binary.Write(&buf, binary.LittleEndian, idx.buckets[start].code)
+		binary.Write(&buf, binary.LittleEndian, int32(end-start))
+		for _, b := range idx.buckets[start:end] {
+			binary.Write(&buf, binary.LittleEndian, b.width)
+			binary.Write(&buf, binary.LittleEndian, int64(len(b.records)))
+			buf.Write(b.records)
+		}
+	}
+	return buf.WriteTo(w)
+}
+
+// ReadIndex reads the serial form of an Index, as written by Index.WriteTo.
+//
+// The index is validated as it's read: bucket sizes must be whole multiples of their record width,
+// and records must be sorted.
+// (The offsets it contains can't be validated without the data they point into;
+// IndexedReadStore checks each one as it's used.)
+func ReadIndex(r io.Reader) (*Index, error) {
+	br, ok := r.(io.ByteReader)
+	if !ok {
+		br = &byteReader{r}
+	}
+	codec, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, fmt.Errorf("car: invalid index: %w", err)
+	}
+	if codec != IndexCodec {
+		return nil, fmt.Errorf("car: unsupported index format 0x%x", codec)
+	}
+	var nCodes int32
+	if err := binary.Read(r, binary.LittleEndian, &nCodes); err != nil {
+		return nil, fmt.Errorf("car: invalid index: %w", err)
+	}
+	idx := &Index{}
+	for ; nCodes > 0; nCodes-- {
+		var code uint64
+		var nWidths int32
+		if err := binary.Read(r, binary.LittleEndian, &code); err != nil {
+			return nil, fmt.Errorf("car: invalid index: %w", err)
+		}
+		if err := binary.Read(r, binary.LittleEndian, &nWidths); err != nil {
+			return nil, fmt.Errorf("car: invalid index: %w", err)
+		}
+		for ; nWidths > 0; nWidths-- {
+			b := indexBucket{code: code}
+			var size int64
+			if err := binary.Read(r, binary.LittleEndian, &b.width); err != nil {
+				return nil, fmt.Errorf("car: invalid index: %w", err)
+			}
+			if err := binary.Read(r, binary.LittleEndian, &size); err != nil {
+				return nil, fmt.Errorf("car: invalid index: %w", err)
+			}
+			if b.width <= 8 || size < 0 || size%int64(b.width) != 0 || size > MaxIndexLength {
+				return nil, fmt.Errorf("car: invalid index: bucket of width %d has impossible size %d", b.width, size)
+			}
+			b.records = make([]byte, size)
+			if _, err := io.ReadFull(r, b.records); err != nil {
+				return nil, fmt.Errorf("car: invalid index: %w", err)
+			}
+			for i := 1; i < b.count(); i++ {
+				if bytes.Compare(b.digestAt(i-1), b.digestAt(i)) > 0 {
+					return nil, fmt.Errorf("car: invalid index: records for multihash code 0x%x are not sorted", code)
+				}
+			}
+			idx.buckets = append(idx.buckets, b)
+		}
+	}
+	return idx, nil
+}
+
+// MaxIndexLength is the largest index bucket this package will accept while reading.
+const MaxIndexLength = 1 << 30
+
+type byteReader struct {
+	io.Reader
+}
+
+func (r *byteReader) ReadByte() (byte, error) {
+	var b [1]byte
+	_, err := io.ReadFull(r.Reader, b[:])
+	return b[0], err
+}
@@ -0,0 +1,109 @@
+package car
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+
+	"github.com/ipfs/go-cid"
+
+	"github.com/ipld/go-ipld-prime/datamodel"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+)
+
+// Reader reads a CARv1 stream, yielding one block at a time.
+//
+// Reader does not verify that block data matches the hash in its CID;
+// if the blocks are loaded through a LinkSystem (e.g. via a ReadStore), that will be checked there.
+type Reader struct {
+	cr     countingReader
+	header Header
+}
+
+// NewReader reads the header of a CARv1 stream and returns a Reader positioned at the first block.
+// An error is returned if the header is invalid or if the version is not 1.
+func NewReader(r io.Reader) (*Reader, error) {
+	cr := &Reader{cr: countingReader{br: bufio.NewReader(r)}}
+	l, err := readLength(&cr.cr)
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, fmt.Errorf("car: could not read header: %w", err)
+	}
+	data := make([]byte, l)
+	if _, err := io.ReadFull(&cr.cr, data); err != nil {
+		return nil, fmt.Errorf("car: could not read header: %w", err)
+	}
+	cr.header, err = decodeHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	if cr.header.Version != 1 {
+		return nil, fmt.Errorf("car: unsupported version %d", cr.header.Version)
+	}
+	return cr, nil
+}
+
+// Roots returns the root links named in the header.
+func (cr *Reader) Roots() []datamodel.Link {
+	return cr.header.Roots
+}
+
+// Position returns the number of bytes of the stream consumed so far.
+// After a successful call to Next, this is the offset of the end of that block's section
+// (and so the offset of the block's data is Position minus the length of the data).
+func (cr *Reader) Position() int64 {
+	return cr.cr.offset
+}
+
+// Next returns the link and data of the next block in the stream.
+// At the end of the stream, it returns io.EOF.
+func (cr *Reader) Next() (datamodel.Link, []byte, error) {
+	lnk, _, data, err := cr.next(true)
+	return lnk, data, err
+}
+
+// next reads the next section.
+// It returns the offset of the block data (relative to the start of the stream), as well as its length.
+// If readData is false, the data is skipped over, and the returned slice is nil.
+func (cr *Reader) next(readData bool) (lnk cidlink.Link, offset int64, data []byte, err error) {
+	start := cr.cr.offset
+	l, err := readLength(&cr.cr)
+	if err != nil {
+		return cidlink.Link{}, 0, nil, err
+	}
+	cidStart := cr.cr.offset
+	// Peek enough to parse the CID.  CIDs are small, so this should always be available from the buffer.
+	peek, peekErr := cr.cr.br.Peek(l)
+	if peekErr != nil && len(peek) == 0 {
+		return cidlink.Link{}, 0, nil, fmt.Errorf("car: truncated section at offset %d: %w", start, io.ErrUnexpectedEOF)
+	}
+	n, c, err := cid.CidFromBytes(peek)
+	if err != nil {
+		if peekErr == io.EOF {
+			// The stream ended partway through the CID; report that, rather than the CID being malformed.
+			return cidlink.Link{}, 0, nil, fmt.Errorf("car: truncated section at offset %d: %w", start, io.ErrUnexpectedEOF)
+		}
+		return cidlink.Link{}, 0, nil, fmt.Errorf("car: invalid CID in section at offset %d: %w", start, err)
+	}
+	if _, err := cr.cr.Discard(n); err != nil {
+		return cidlink.Link{}, 0, nil, fmt.Errorf("car: truncated section at offset %d: %w", start, io.ErrUnexpectedEOF)
+	}
+	dataLen := l - n
+	offset = cidStart + int64(n)
+	if !readData {
+		if _, err := cr.cr.Discard(dataLen); err != nil {
+			return cidlink.Link{}, 0, nil, fmt.Errorf("car: truncated section at offset %d: %w", start, io.ErrUnexpectedEOF)
+		}
+		return cidlink.Link{Cid: c}, offset, nil, nil
+	}
+	data = make([]byte, dataLen)
+	if _, err := io.ReadFull(&cr.cr, data); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return cidlink.Link{}, 0, nil, fmt.Errorf("car: truncated section at offset %d: %w", start, err)
+	}
+	return cidlink.Link{Cid: c}, offset, data, nil
+}
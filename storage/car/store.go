@@ -0,0 +1,158 @@
+package car
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync"
+
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/linking"
+)
+
+// ReadStore offers read-only access to the blocks of a CARv1 file.
+//
+// The OpenRead method conforms to linking.BlockReadOpener,
+// so it can be used in a LinkSystem like this:
+//
+//		store, err := car.NewReadStore(file)
+//		lsys.StorageReadOpener = store.OpenRead
+//
+// NewReadStore scans the whole file once to learn the offset of every block,
+// and keeps that index in memory; reads after that go directly to the block.
+// ReadStore is safe for concurrent use (as long as the io.ReaderAt is,
+// which is true of *os.File).
+type ReadStore struct {
+	ra    io.ReaderAt
+	roots []datamodel.Link
+	index map[datamodel.Link]section
+	order []datamodel.Link
+}
+
+// section locates a block's data within a file.
+type section struct {
+	offset int64
+	length int64
+}
+
+// NewReadStore indexes the CARv1 data readable from ra.
+func NewReadStore(ra io.ReaderAt) (*ReadStore, error) {
+	cr, err := NewReader(io.NewSectionReader(ra, 0, 1<<63-1))
+	if err != nil {
+		return nil, err
+	}
+	store := &ReadStore{
+		ra:    ra,
+		roots: cr.Roots(),
+		index: make(map[datamodel.Link]section),
+	}
+	for {
+		lnk, offset, _, err := cr.next(false)
+		if err == io.EOF {
+			return store, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if _, exists := store.index[lnk]; exists {
+			continue
+		}
+		store.index[lnk] = section{offset, cr.cr.offset - offset}
+		store.order = append(store.order, lnk)
+	}
+}
+
+// Roots returns the root links named in the header.
+func (store *ReadStore) Roots() []datamodel.Link {
+	return store.roots
+}
+
+// Links returns the links of all blocks in the file, in the order they first appear.
+func (store *ReadStore) Links() []datamodel.Link {
+	return store.order
+}
+
+// Has conforms to storage.HasStore.
+func (store *ReadStore) Has(ctx context.Context, lnk datamodel.Link) (bool, error) {
+	_, exists := store.index[lnk]
+	return exists, nil
+}
+
+// Enumerate conforms to storage.EnumerableStore.
+// Blocks are visited in the order they first appear in the file.
+func (store *ReadStore) Enumerate(ctx context.Context, fn func(lnk datamodel.Link, size int64) error) error {
+	for _, lnk := range store.order {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(lnk, store.index[lnk].length); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (store *ReadStore) OpenRead(lnkCtx linking.LinkContext, lnk datamodel.Link) (io.Reader, error) {
+	cl, err := asCidLink(lnk)
+	if err != nil {
+		return nil, err
+	}
+	sec, exists := store.index[cl]
+	if !exists {
+		return nil, linking.ErrNotFound{Link: lnk, Path: lnkCtx.LinkPath}
+	}
+	return io.NewSectionReader(store.ra, sec.offset, sec.length), nil
+}
+
+// WriteStore appends blocks to a CARv1 stream.
+//
+// The OpenWrite method conforms to linking.BlockWriteOpener,
+// so it can be used in a LinkSystem like this:
+//
+//		store, err := car.NewWriteStore(file, roots)
+//		lsys.StorageWriteOpener = store.OpenWrite
+//
+// Since the roots are part of the header at the start of a CAR,
+// they must be known before any blocks are written.
+//
+// Each block is buffered in memory until it is committed, and then appended in full;
+// blocks which have already been written once are skipped.
+// WriteStore is safe for concurrent use.
+type WriteStore struct {
+	mu      sync.Mutex
+	w       *Writer
+	written map[datamodel.Link]struct{}
+}
+
+// NewWriteStore writes a CARv1 header naming the given roots to w,
+// and returns a WriteStore that will append blocks after it.
+func NewWriteStore(w io.Writer, roots []datamodel.Link) (*WriteStore, error) {
+	cw, err := NewWriter(w, roots)
+	if err != nil {
+		return nil, err
+	}
+	return &WriteStore{
+		w:       cw,
+		written: make(map[datamodel.Link]struct{}),
+	}, nil
+}
+
+func (store *WriteStore) OpenWrite(lnkCtx linking.LinkContext) (io.Writer, linking.BlockWriteCommitter, error) {
+	buf := bytes.Buffer{}
+	return &buf, func(lnk datamodel.Link) error {
+		cl, err := asCidLink(lnk)
+		if err != nil {
+			return err
+		}
+		store.mu.Lock()
+		defer store.mu.Unlock()
+		if _, exists := store.written[cl]; exists {
+			return nil
+		}
+		if err := store.w.WriteBlock(cl, buf.Bytes()); err != nil {
+			return err
+		}
+		store.written[cl] = struct{}{}
+		return nil
+	}, nil
+}
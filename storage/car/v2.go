@@ -0,0 +1,204 @@
+package car
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/ipfs/go-cid"
+
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/linking"
+)
+
+// A CARv2 file is a fixed "pragma" (which is a CARv1 header with version 2 and no roots, so that CARv1 readers reject it gracefully),
+// a fixed-size header locating the other parts, a complete CARv1 payload, and optionally an index of that payload.
+// See https://ipld.io/specs/transport/car/carv2/ for the specification.
+
+// v2Pragma is the varint length prefix and dag-cbor encoding of {"version": 2}.
+var v2Pragma = []byte{0x0a, 0xa1, 0x67, 'v', 'e', 'r', 's', 'i', 'o', 'n', 0x02}
+
+const v2HeaderSize = 40
+
+// V2Header is the fixed-size header that follows the pragma in a CARv2 file.
+// All offsets are from the start of the file.
+type V2Header struct {
+	Characteristics [16]byte
+	DataOffset      uint64
+	DataSize        uint64
+	IndexOffset     uint64 // Zero if there is no index.
+}
+
+func (h V2Header) marshal() []byte {
+	buf := make([]byte, v2HeaderSize)
+	copy(buf[0:16], h.Characteristics[:])
+	binary.LittleEndian.PutUint64(buf[16:24], h.DataOffset)
+	binary.LittleEndian.PutUint64(buf[24:32], h.DataSize)
+	binary.LittleEndian.PutUint64(buf[32:40], h.IndexOffset)
+	return buf
+}
+
+// ReadV2Header reads and checks the pragma and header at the start of a CARv2 file.
+func ReadV2Header(ra io.ReaderAt) (V2Header, error) {
+	buf := make([]byte, len(v2Pragma)+v2HeaderSize)
+	if _, err := ra.ReadAt(buf, 0); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return V2Header{}, fmt.Errorf("car: could not read CARv2 header: %w", err)
+	}
+	if !bytes.Equal(buf[:len(v2Pragma)], v2Pragma) {
+		return V2Header{}, fmt.Errorf("car: not a CARv2 file")
+	}
+	buf = buf[len(v2Pragma):]
+	var h V2Header
+	copy(h.Characteristics[:], buf[0:16])
+	h.DataOffset = binary.LittleEndian.Uint64(buf[16:24])
+	h.DataSize = binary.LittleEndian.Uint64(buf[24:32])
+	h.IndexOffset = binary.LittleEndian.Uint64(buf[32:40])
+	if h.DataOffset < uint64(len(v2Pragma)+v2HeaderSize) || h.DataOffset+h.DataSize < h.DataOffset {
+		return V2Header{}, fmt.Errorf("car: invalid CARv2 header: data payload at %d (size %d) is out of range", h.DataOffset, h.DataSize)
+	}
+	if h.IndexOffset != 0 && h.IndexOffset < h.DataOffset+h.DataSize {
+		return V2Header{}, fmt.Errorf("car: invalid CARv2 header: index at %d overlaps data payload", h.IndexOffset)
+	}
+	return h, nil
+}
+
+// WriteV2 writes a CARv2 file to w, wrapping the CARv1 payload of the given size readable from v1,
+// and appending an index of it built with BuildIndex.
+func WriteV2(w io.Writer, v1 io.ReaderAt, size int64) error {
+	idx, err := BuildIndex(io.NewSectionReader(v1, 0, size))
+	if err != nil {
+		return err
+	}
+	h := V2Header{
+		DataOffset: uint64(len(v2Pragma) + v2HeaderSize),
+		DataSize:   uint64(size),
+	}
+	h.IndexOffset = h.DataOffset + h.DataSize
+	if _, err := w.Write(v2Pragma); err != nil {
+		return err
+	}
+	if _, err := w.Write(h.marshal()); err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, io.NewSectionReader(v1, 0, size)); err != nil {
+		return err
+	}
+	_, err = idx.WriteTo(w)
+	return err
+}
+
+// IndexedReadStore offers read-only access to the blocks of an indexed CARv2 file.
+//
+// The OpenRead method conforms to linking.BlockReadOpener,
+// so it can be used in a LinkSystem like this:
+//
+//		store, err := car.NewIndexedReadStore(file)
+//		lsys.StorageReadOpener = store.OpenRead
+//
+// Unlike ReadStore, no scan of the data is needed: the index is loaded when the store is opened,
+// and each read seeks straight to the block's section.
+// Since the index is only a hint about where to look, every read checks that the section found
+// really holds a CID with the requested multihash, and returns an error if it doesn't;
+// hashing the data itself is left to the LinkSystem (as usual for a BlockReadOpener),
+// so a corrupt index or corrupt data will both be caught.
+//
+// IndexedReadStore is safe for concurrent use (as long as the io.ReaderAt is,
+// which is true of *os.File).
+type IndexedReadStore struct {
+	ra     io.ReaderAt
+	header V2Header
+	roots  []datamodel.Link
+	index  *Index
+}
+
+// NewIndexedReadStore opens a CARv2 file, and reads its index.
+// An error is returned if the file has no index.
+func NewIndexedReadStore(ra io.ReaderAt) (*IndexedReadStore, error) {
+	h, err := ReadV2Header(ra)
+	if err != nil {
+		return nil, err
+	}
+	if h.IndexOffset == 0 {
+		return nil, fmt.Errorf("car: CARv2 file has no index")
+	}
+	cr, err := NewReader(io.NewSectionReader(ra, int64(h.DataOffset), int64(h.DataSize)))
+	if err != nil {
+		return nil, err
+	}
+	idx, err := ReadIndex(io.NewSectionReader(ra, int64(h.IndexOffset), 1<<63-1-int64(h.IndexOffset)))
+	if err != nil {
+		return nil, err
+	}
+	return &IndexedReadStore{
+		ra:     ra,
+		header: h,
+		roots:  cr.Roots(),
+		index:  idx,
+	}, nil
+}
+
+// Roots returns the root links named in the header of the CARv1 payload.
+func (store *IndexedReadStore) Roots() []datamodel.Link {
+	return store.roots
+}
+
+// Has conforms to storage.HasStore.
+// It consults only the index, without reading the block.
+func (store *IndexedReadStore) Has(ctx context.Context, lnk datamodel.Link) (bool, error) {
+	cl, err := asCidLink(lnk)
+	if err != nil {
+		return false, err
+	}
+	_, exists := store.index.Lookup(cl.Cid.Hash())
+	return exists, nil
+}
+
+func (store *IndexedReadStore) OpenRead(lnkCtx linking.LinkContext, lnk datamodel.Link) (io.Reader, error) {
+	cl, err := asCidLink(lnk)
+	if err != nil {
+		return nil, err
+	}
+	offset, exists := store.index.Lookup(cl.Cid.Hash())
+	if !exists {
+		return nil, linking.ErrNotFound{Link: lnk, Path: lnkCtx.LinkPath}
+	}
+	if offset >= store.header.DataSize {
+		return nil, fmt.Errorf("car: corrupt index: offset %d for %s is beyond the end of the data payload", offset, lnk)
+	}
+	// Read the length prefix.  Varints are at most 10 bytes, but the section may be shorter than that.
+	pos := int64(store.header.DataOffset + offset)
+	end := int64(store.header.DataOffset + store.header.DataSize)
+	var lbuf [binary.MaxVarintLen64]byte
+	n, err := store.ra.ReadAt(lbuf[:min64(int64(len(lbuf)), end-pos)], pos)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	l, ln := binary.Uvarint(lbuf[:n])
+	if ln <= 0 || l > MaxSectionLength || pos+int64(ln)+int64(l) > end {
+		return nil, fmt.Errorf("car: corrupt index: offset %d for %s does not point at a valid section", offset, lnk)
+	}
+	section := make([]byte, l)
+	if _, err := store.ra.ReadAt(section, pos+int64(ln)); err != nil && err != io.EOF {
+		return nil, err
+	}
+	cn, c, err := cid.CidFromBytes(section)
+	if err != nil {
+		return nil, fmt.Errorf("car: corrupt index: offset %d for %s does not point at a valid section: %w", offset, lnk, err)
+	}
+	if !bytes.Equal(c.Hash(), cl.Cid.Hash()) {
+		return nil, fmt.Errorf("car: corrupt index: offset %d for %s points at the section for %s", offset, lnk, c)
+	}
+	return bytes.NewReader(section[cn:]), nil
+}
+
+func min64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
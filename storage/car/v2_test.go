@@ -0,0 +1,116 @@
+package car_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/linking"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	"github.com/ipld/go-ipld-prime/storage/car"
+)
+
+// buildV2 makes a CARv2 file of the fixture DAG.
+func buildV2(t *testing.T) (datamodel.Link, []datamodel.Link, []byte) {
+	root, links, mem := buildFixture(t)
+	var v1 bytes.Buffer
+	cw, err := car.NewWriter(&v1, []datamodel.Link{root})
+	qt.Assert(t, err, qt.IsNil)
+	for _, l := range links {
+		qt.Assert(t, cw.WriteBlock(l, mem.Bag[l]), qt.IsNil)
+	}
+	var v2 bytes.Buffer
+	qt.Assert(t, car.WriteV2(&v2, bytes.NewReader(v1.Bytes()), int64(v1.Len())), qt.IsNil)
+	return root, links, v2.Bytes()
+}
+
+func TestIndexedReadStore(t *testing.T) {
+	root, links, v2 := buildV2(t)
+
+	t.Run("load through index", func(t *testing.T) {
+		rs, err := car.NewIndexedReadStore(bytes.NewReader(v2))
+		qt.Assert(t, err, qt.IsNil)
+		qt.Check(t, fmt.Sprint(rs.Roots()), qt.Equals, fmt.Sprint([]datamodel.Link{root}))
+
+		lsys := cidlink.DefaultLinkSystem()
+		lsys.StorageReadOpener = rs.OpenRead
+		for _, l := range links {
+			_, err := lsys.Load(linking.LinkContext{}, l, basicnode.Prototype.Any)
+			qt.Check(t, err, qt.IsNil)
+		}
+		_, err = rs.OpenRead(linking.LinkContext{}, lp.BuildLink(make([]byte, 32)))
+		qt.Check(t, err, qt.ErrorMatches, "block not found: .*")
+	})
+	t.Run("index roundtrip", func(t *testing.T) {
+		h, err := car.ReadV2Header(bytes.NewReader(v2))
+		qt.Assert(t, err, qt.IsNil)
+		idx, err := car.ReadIndex(bytes.NewReader(v2[h.IndexOffset:]))
+		qt.Assert(t, err, qt.IsNil)
+		var buf bytes.Buffer
+		_, err = idx.WriteTo(&buf)
+		qt.Assert(t, err, qt.IsNil)
+		qt.Check(t, buf.Bytes(), qt.DeepEquals, v2[h.IndexOffset:])
+
+		idx2, err := car.BuildIndex(bytes.NewReader(v2[h.DataOffset : h.DataOffset+h.DataSize]))
+		qt.Assert(t, err, qt.IsNil)
+		for _, l := range links {
+			o1, ok1 := idx.Lookup(l.(cidlink.Link).Hash())
+			o2, ok2 := idx2.Lookup(l.(cidlink.Link).Hash())
+			qt.Check(t, ok1, qt.IsTrue)
+			qt.Check(t, ok2, qt.IsTrue)
+			qt.Check(t, o1, qt.Equals, o2)
+		}
+	})
+	t.Run("corrupt index is caught", func(t *testing.T) {
+		h, err := car.ReadV2Header(bytes.NewReader(v2))
+		qt.Assert(t, err, qt.IsNil)
+		corrupt := append([]byte(nil), v2...)
+		// The first record starts after: codec varint (2), code count (4), code (8), width count (4), width (4), bucket size (8).
+		// Each record is a 32 byte digest and an 8 byte offset; point the first record at the second record's section.
+		recs := corrupt[h.IndexOffset+30:]
+		copy(recs[32:40], recs[72:80])
+
+		rs, err := car.NewIndexedReadStore(bytes.NewReader(corrupt))
+		qt.Assert(t, err, qt.IsNil)
+		lsys := cidlink.DefaultLinkSystem()
+		lsys.StorageReadOpener = rs.OpenRead
+		var failed int
+		for _, l := range links {
+			if _, err := lsys.Load(linking.LinkContext{}, l, basicnode.Prototype.Any); err != nil {
+				qt.Check(t, err, qt.ErrorMatches, "storage error for .*: car: corrupt index: .*")
+				failed++
+			}
+		}
+		qt.Check(t, failed, qt.Equals, 1)
+
+		// Unsorted records are rejected outright.
+		binary.LittleEndian.PutUint64(recs[32:40], 0)
+		recs[0], recs[40] = 0xff, 0x00
+		_, err = car.NewIndexedReadStore(bytes.NewReader(corrupt))
+		qt.Check(t, err, qt.ErrorMatches, "car: invalid index: .* not sorted")
+	})
+	t.Run("corrupt data is caught by the LinkSystem", func(t *testing.T) {
+		h, err := car.ReadV2Header(bytes.NewReader(v2))
+		qt.Assert(t, err, qt.IsNil)
+		corrupt := append([]byte(nil), v2...)
+		// The last byte of the payload is inside the data of the last block.
+		corrupt[h.DataOffset+h.DataSize-1] ^= 0x01
+
+		rs, err := car.NewIndexedReadStore(bytes.NewReader(corrupt))
+		qt.Assert(t, err, qt.IsNil)
+		lsys := cidlink.DefaultLinkSystem()
+		lsys.StorageReadOpener = rs.OpenRead
+		_, err = lsys.Load(linking.LinkContext{}, links[len(links)-1], basicnode.Prototype.Any)
+		qt.Check(t, errors.As(err, &linking.ErrHashMismatch{}), qt.IsTrue)
+	})
+	t.Run("CARv1 readers reject CARv2", func(t *testing.T) {
+		_, err := car.NewReader(bytes.NewReader(v2))
+		qt.Check(t, err, qt.ErrorMatches, "car: unsupported version 2")
+	})
+}
@@ -0,0 +1,64 @@
+package car
+
+import (
+	"encoding/binary"
+	"io"
+
+	"github.com/ipld/go-ipld-prime/datamodel"
+)
+
+// Writer writes a CARv1 stream.
+//
+// The header (and thus the list of roots) is written immediately by NewWriter,
+// and each call to WriteBlock appends one section.
+// Writer does not deduplicate blocks; see WriteStore if that's desired.
+type Writer struct {
+	w   io.Writer
+	buf [binary.MaxVarintLen64]byte
+}
+
+// NewWriter writes a CARv1 header naming the given roots to w,
+// and returns a Writer that can be used to append blocks.
+func NewWriter(w io.Writer, roots []datamodel.Link) (*Writer, error) {
+	for _, r := range roots {
+		if _, err := asCidLink(r); err != nil {
+			return nil, err
+		}
+	}
+	hdr, err := Header{Roots: roots, Version: 1}.encode()
+	if err != nil {
+		return nil, err
+	}
+	cw := &Writer{w: w}
+	if err := cw.writeLength(len(hdr)); err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(hdr); err != nil {
+		return nil, err
+	}
+	return cw, nil
+}
+
+// WriteBlock appends a section containing the given link and block data.
+// The data is not checked against the hash in the link.
+func (cw *Writer) WriteBlock(lnk datamodel.Link, data []byte) error {
+	cl, err := asCidLink(lnk)
+	if err != nil {
+		return err
+	}
+	cb := cl.Cid.Bytes()
+	if err := cw.writeLength(len(cb) + len(data)); err != nil {
+		return err
+	}
+	if _, err := cw.w.Write(cb); err != nil {
+		return err
+	}
+	_, err = cw.w.Write(data)
+	return err
+}
+
+func (cw *Writer) writeLength(l int) error {
+	n := binary.PutUvarint(cw.buf[:], uint64(l))
+	_, err := cw.w.Write(cw.buf[:n])
+	return err
+}
@@ -0,0 +1,95 @@
+package storage
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"io"
+
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/linking"
+)
+
+// Compressor describes a compression format, as a pair of functions for wrapping writers and readers.
+// Gzip and Flate are provided; any other format can be used by filling in a Compressor.
+type Compressor struct {
+	// NewWriter wraps w so that data written to the result is compressed into w.
+	// The result will be closed when the block is committed, and it should flush everything to w at that point.
+	NewWriter func(w io.Writer) (io.WriteCloser, error)
+
+	// NewReader wraps r so that reading from the result yields the decompressed form of data read from r.
+	NewReader func(r io.Reader) (io.Reader, error)
+}
+
+var (
+	// Gzip compresses blocks in the gzip format, at the default compression level.
+	Gzip = Compressor{
+		NewWriter: func(w io.Writer) (io.WriteCloser, error) { return gzip.NewWriter(w), nil },
+		NewReader: func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) },
+	}
+
+	// Flate compresses blocks in the raw DEFLATE format, at the default compression level.
+	// It has less overhead per block than Gzip, which can matter if blocks are small.
+	Flate = Compressor{
+		NewWriter: func(w io.Writer) (io.WriteCloser, error) { return flate.NewWriter(w, flate.DefaultCompression) },
+		NewReader: func(r io.Reader) (io.Reader, error) { return flate.NewReader(r), nil },
+	}
+)
+
+// Compressed wraps another storage system so that block data is compressed as it's written,
+// and decompressed as it's read.
+//
+//		store := storage.Compressed{
+//			ReadOpener:  inner.OpenRead,
+//			WriteOpener: inner.OpenWrite,
+//			Compressor:  storage.Gzip,
+//		}
+//		lsys.StorageReadOpener = store.OpenRead
+//		lsys.StorageWriteOpener = store.OpenWrite
+//
+// The LinkSystem only ever sees the uncompressed data, so hashes are computed over the canonical, uncompressed form:
+// links don't change when compression is used, and hash verification on load keeps working as usual.
+// Only the wrapped storage sees compressed data.
+//
+// All data in the wrapped storage must have been written through a Compressed wrapper using the same Compressor;
+// there is no detection of uncompressed data.
+//
+// Compressed has no state of its own, so it is safe for concurrent use if the wrapped storage is.
+type Compressed struct {
+	ReadOpener  linking.BlockReadOpener
+	WriteOpener linking.BlockWriteOpener
+
+	// Compressor selects the compression format.  If its functions are nil, Gzip is used.
+	Compressor Compressor
+}
+
+func (store *Compressed) compressor() Compressor {
+	if store.Compressor.NewWriter == nil || store.Compressor.NewReader == nil {
+		return Gzip
+	}
+	return store.Compressor
+}
+
+func (store *Compressed) OpenRead(lnkCtx linking.LinkContext, lnk datamodel.Link) (io.Reader, error) {
+	r, err := store.ReadOpener(lnkCtx, lnk)
+	if err != nil {
+		return nil, err
+	}
+	return store.compressor().NewReader(r)
+}
+
+func (store *Compressed) OpenWrite(lnkCtx linking.LinkContext) (io.Writer, linking.BlockWriteCommitter, error) {
+	w, commit, err := store.WriteOpener(lnkCtx)
+	if err != nil {
+		return nil, nil, err
+	}
+	cw, err := store.compressor().NewWriter(w)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cw, func(lnk datamodel.Link) error {
+		if err := cw.Close(); err != nil {
+			return err
+		}
+		return commit(lnk)
+	}, nil
+}
@@ -0,0 +1,52 @@
+package storage_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/linking"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	"github.com/ipld/go-ipld-prime/storage"
+)
+
+func TestCompressed(t *testing.T) {
+	for name, compressor := range map[string]storage.Compressor{
+		"gzip":  storage.Gzip,
+		"flate": storage.Flate,
+	} {
+		t.Run(name, func(t *testing.T) {
+			inner := &storage.Memory{}
+			store := storage.Compressed{
+				ReadOpener:  inner.OpenRead,
+				WriteOpener: inner.OpenWrite,
+				Compressor:  compressor,
+			}
+			lsys := cidlink.DefaultLinkSystem()
+			lsys.StorageReadOpener = store.OpenRead
+			lsys.StorageWriteOpener = store.OpenWrite
+
+			n := basicnode.NewString(strings.Repeat("very compressible ", 100))
+			lnk, err := lsys.Store(linking.LinkContext{}, lp, n)
+			qt.Assert(t, err, qt.IsNil)
+
+			// The link is the same as it would be without compression.
+			qt.Check(t, lnk, qt.Equals, lsys.MustComputeLink(lp, n))
+			// The stored data is smaller than the encoded form.
+			var raw bytes.Buffer
+			enc, err := lsys.EncoderChooser(lp)
+			qt.Assert(t, err, qt.IsNil)
+			qt.Assert(t, enc(n, &raw), qt.IsNil)
+			qt.Check(t, len(inner.Bag[lnk]) < raw.Len()/4, qt.IsTrue)
+
+			// And loading it works, including hash verification.
+			n2, err := lsys.Load(linking.LinkContext{}, lnk, basicnode.Prototype.Any)
+			qt.Assert(t, err, qt.IsNil)
+			qt.Check(t, datamodel.DeepEqual(n2, n), qt.IsTrue)
+		})
+	}
+}
@@ -4,6 +4,8 @@
 //
 // These are provided as simple "batteries included" storage systems.
 // They are aimed at being quickly usable to build simple demonstrations.
+// Memory keeps everything in a map and is mostly useful for tests and demos;
+// Filesystem keeps blocks as files on local disk, and is reasonable for modest real usage.
 // For heavy usage (large datasets, with caching, etc) you'll probably
 // want to start looking for other libraries which go deeper on this subject.
 package storage
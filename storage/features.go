@@ -0,0 +1,50 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/ipld/go-ipld-prime/datamodel"
+)
+
+// The interfaces in this file describe optional features which a storage system may have,
+// beyond the OpenRead and OpenWrite functions which a LinkSystem needs.
+//
+// They're meant to be used for feature detection: code which needs one of these features
+// should take the store as an interface{} or as one of these interfaces,
+// and use a type assertion to check if the feature is available.
+// The implementations in this package (Memory and Filesystem) support all of them.
+//
+// As with OpenRead, these methods are cancellable by cancelling the context,
+// where the implementation is able to do so.
+
+// EnumerableStore is implemented by storage which can list the blocks it contains.
+type EnumerableStore interface {
+	// Enumerate calls fn for each block in storage, with the block's link and its size in bytes.
+	// Order is unspecified.
+	// If fn returns an error, enumeration stops, and that error is returned.
+	//
+	// Adding or removing blocks while enumerating (including from within fn) is allowed,
+	// but whether or not such blocks are visited is unspecified.
+	Enumerate(ctx context.Context, fn func(lnk datamodel.Link, size int64) error) error
+}
+
+// HasStore is implemented by storage which can check whether it contains a block without reading it.
+type HasStore interface {
+	Has(ctx context.Context, lnk datamodel.Link) (bool, error)
+}
+
+// DeletableStore is implemented by storage which can remove blocks.
+type DeletableStore interface {
+	// Delete removes a block.
+	// Deleting a block which is not present is not an error.
+	Delete(ctx context.Context, lnk datamodel.Link) error
+}
+
+var (
+	_ EnumerableStore = (*Memory)(nil)
+	_ HasStore        = (*Memory)(nil)
+	_ DeletableStore  = (*Memory)(nil)
+	_ EnumerableStore = (*Filesystem)(nil)
+	_ HasStore        = (*Filesystem)(nil)
+	_ DeletableStore  = (*Filesystem)(nil)
+)
@@ -0,0 +1,231 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/base32"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ipfs/go-cid"
+
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/linking"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+)
+
+// Filesystem is a storage for data indexed by datamodel.Link which keeps each block
+// as a file on local disk, beneath the Root directory.
+//
+// The OpenRead method conforms to linking.BlockReadOpener,
+// and the OpenWrite method conforms to linking.BlockWriteOpener.
+// Therefore it's easy to use in a LinkSystem like this:
+//
+//		store := storage.Filesystem{Root: "/path/to/blocks"}
+//		lsys.StorageReadOpener = (&store).OpenRead
+//		lsys.StorageWriteOpener = (&store).OpenWrite
+//
+// Each block is stored in a file named by the key of its link (see LinkKey, or the KeyFunc and LinkFunc fields),
+// placed in a shard directory chosen by the ShardFunc.
+// Writes go to a tempfile in the Root directory first,
+// and are moved into their final place with an atomic rename when the BlockWriteCommitter is called.
+// This means readers will never observe a partially written block.
+// (If a write is abandoned and its BlockWriteCommitter is never called, the tempfile is left behind;
+// tempfiles are named with a ".tmp-" prefix so they're easy to recognize and clean up.)
+//
+// Blocks are read fully into memory by OpenRead, so that no file handles are left open
+// (a LinkSystem does not close the readers it gets from a BlockReadOpener).
+//
+// Filesystem does no locking of its own, but since writes are atomic renames
+// and blocks are immutable, it's safe to use from multiple goroutines (and even multiple processes)
+// as long as the fields are not modified during use.
+type Filesystem struct {
+	// Root is the directory in which all blocks are kept.
+	// It will be created on first write if it does not exist yet.
+	Root string
+
+	// ShardFunc chooses the (relative) directory a block is kept in, given its key.
+	// If nil, ShardNextToLast2 is used.
+	// Changing the ShardFunc for a Root that already contains data will make the existing data unreachable.
+	ShardFunc func(key string) string
+
+	// KeyFunc and LinkFunc convert links to the keys used to name their files, and back again.
+	// They must be inverses of each other, and the keys must be safe to use as filenames.
+	// If nil, LinkKey and KeyLink are used, which support CIDs;
+	// set them to use other link implementations (the linking/sha256link package has a suitable pair, for example).
+	KeyFunc  func(datamodel.Link) (string, error)
+	LinkFunc func(key string) (datamodel.Link, error)
+}
+
+// ShardNextToLast2 is a ShardFunc which shards by the two characters
+// that come before the last character of the key.
+// This is the same layout used by the "flatfs" datastore commonly seen in IPFS implementations:
+// the tail of a key derived from a hash is much better distributed than the head
+// (which tends to repeat prefix information such as CID version and codec).
+func ShardNextToLast2(key string) string {
+	if len(key) < 3 {
+		return "_"
+	}
+	return key[len(key)-3 : len(key)-1]
+}
+
+// keyEncoding is the lowercase, unpadded, RFC4648 base32 alphabet.
+// It's safe for case-insensitive filesystems, and for CIDs it's identical to the multibase "b" form (minus the prefix character).
+var keyEncoding = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+// LinkKey returns the string used to name a link's block in a Filesystem store.
+//
+// Only cidlink.Link is supported; other link implementations will result in an error.
+// (A Filesystem can be given a different KeyFunc to support them.)
+func LinkKey(lnk datamodel.Link) (string, error) {
+	switch l := lnk.(type) {
+	case cidlink.Link:
+		return keyEncoding.EncodeToString(l.Cid.Bytes()), nil
+	default:
+		return "", fmt.Errorf("storage: cannot derive a key for link of type %T", lnk)
+	}
+}
+
+// KeyLink is the inverse of LinkKey.
+func KeyLink(key string) (datamodel.Link, error) {
+	bs, err := keyEncoding.DecodeString(key)
+	if err != nil {
+		return nil, fmt.Errorf("storage: invalid key %q: %w", key, err)
+	}
+	c, err := cid.Cast(bs)
+	if err != nil {
+		return nil, fmt.Errorf("storage: invalid key %q: %w", key, err)
+	}
+	return cidlink.Link{Cid: c}, nil
+}
+
+func (store *Filesystem) shard(key string) string {
+	if store.ShardFunc == nil {
+		return ShardNextToLast2(key)
+	}
+	return store.ShardFunc(key)
+}
+
+// pathFor returns the path at which the block for a link would be stored.
+func (store *Filesystem) pathFor(lnk datamodel.Link) (string, error) {
+	keyFunc := store.KeyFunc
+	if keyFunc == nil {
+		keyFunc = LinkKey
+	}
+	key, err := keyFunc(lnk)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(store.Root, store.shard(key), key), nil
+}
+
+func (store *Filesystem) OpenRead(lnkCtx linking.LinkContext, lnk datamodel.Link) (io.Reader, error) {
+	path, err := store.pathFor(lnk)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, linking.ErrNotFound{Link: lnk, Path: lnkCtx.LinkPath}
+		}
+		return nil, err
+	}
+	return bytes.NewReader(data), nil
+}
+
+func (store *Filesystem) OpenWrite(lnkCtx linking.LinkContext) (io.Writer, linking.BlockWriteCommitter, error) {
+	if err := os.MkdirAll(store.Root, 0755); err != nil {
+		return nil, nil, err
+	}
+	f, err := ioutil.TempFile(store.Root, ".tmp-")
+	if err != nil {
+		return nil, nil, err
+	}
+	return f, func(lnk datamodel.Link) error {
+		path, err := store.pathFor(lnk)
+		if err != nil {
+			f.Close()
+			os.Remove(f.Name())
+			return err
+		}
+		if err := f.Sync(); err != nil {
+			f.Close()
+			os.Remove(f.Name())
+			return err
+		}
+		if err := f.Close(); err != nil {
+			os.Remove(f.Name())
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			os.Remove(f.Name())
+			return err
+		}
+		if err := os.Rename(f.Name(), path); err != nil {
+			os.Remove(f.Name())
+			return err
+		}
+		return nil
+	}, nil
+}
+
+// Enumerate conforms to EnumerableStore.
+//
+// Files in Root which don't look like blocks (such as tempfiles from writes in progress) are skipped.
+func (store *Filesystem) Enumerate(ctx context.Context, fn func(lnk datamodel.Link, size int64) error) error {
+	linkFunc := store.LinkFunc
+	if linkFunc == nil {
+		linkFunc = KeyLink
+	}
+	err := filepath.Walk(store.Root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == store.Root {
+				return nil // Nothing written yet; nothing to enumerate.
+			}
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if info.IsDir() || strings.HasPrefix(info.Name(), ".") {
+			return nil
+		}
+		lnk, err := linkFunc(info.Name())
+		if err != nil {
+			return nil // Not one of ours.
+		}
+		return fn(lnk, info.Size())
+	})
+	return err
+}
+
+// Has conforms to HasStore.
+func (store *Filesystem) Has(ctx context.Context, lnk datamodel.Link) (bool, error) {
+	path, err := store.pathFor(lnk)
+	if err != nil {
+		return false, err
+	}
+	_, err = os.Stat(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Delete conforms to DeletableStore.
+func (store *Filesystem) Delete(ctx context.Context, lnk datamodel.Link) error {
+	path, err := store.pathFor(lnk)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,76 @@
+package storage_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+	"github.com/ipfs/go-cid"
+
+	_ "github.com/ipld/go-ipld-prime/codec/dagjson"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/fluent/qp"
+	"github.com/ipld/go-ipld-prime/linking"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	"github.com/ipld/go-ipld-prime/storage"
+)
+
+var lp = cidlink.LinkPrototype{Prefix: cid.Prefix{
+	Version:  1,
+	Codec:    0x0129, // dag-json
+	MhType:   0x12,   // sha2-256
+	MhLength: 32,
+}}
+
+func TestFilesystem(t *testing.T) {
+	root := t.TempDir()
+	store := storage.Filesystem{Root: filepath.Join(root, "blocks")}
+	lsys := cidlink.DefaultLinkSystem()
+	lsys.StorageReadOpener = store.OpenRead
+	lsys.StorageWriteOpener = store.OpenWrite
+
+	n, err := qp.BuildMap(basicnode.Prototype.Any, 2, func(ma datamodel.MapAssembler) {
+		qp.MapEntry(ma, "hello", qp.String("world"))
+		qp.MapEntry(ma, "n", qp.Int(12))
+	})
+	qt.Assert(t, err, qt.IsNil)
+
+	t.Run("store and load roundtrip", func(t *testing.T) {
+		lnk, err := lsys.Store(linking.LinkContext{}, lp, n)
+		qt.Assert(t, err, qt.IsNil)
+
+		n2, err := lsys.Load(linking.LinkContext{}, lnk, basicnode.Prototype.Any)
+		qt.Assert(t, err, qt.IsNil)
+		qt.Check(t, datamodel.DeepEqual(n2, n), qt.IsTrue)
+	})
+	t.Run("layout is sharded by key, and no tempfiles remain", func(t *testing.T) {
+		lnk, err := lsys.Store(linking.LinkContext{}, lp, n)
+		qt.Assert(t, err, qt.IsNil)
+		key, err := storage.LinkKey(lnk)
+		qt.Assert(t, err, qt.IsNil)
+		qt.Check(t, "b"+key, qt.Equals, lnk.String())
+
+		_, err = os.Stat(filepath.Join(store.Root, storage.ShardNextToLast2(key), key))
+		qt.Check(t, err, qt.IsNil)
+
+		tmps, err := filepath.Glob(filepath.Join(store.Root, ".tmp-*"))
+		qt.Assert(t, err, qt.IsNil)
+		qt.Check(t, tmps, qt.HasLen, 0)
+
+		lnk2, err := storage.KeyLink(key)
+		qt.Assert(t, err, qt.IsNil)
+		qt.Check(t, lnk2, qt.Equals, lnk)
+	})
+	t.Run("uncommitted writes are not readable", func(t *testing.T) {
+		w, _, err := store.OpenWrite(linking.LinkContext{})
+		qt.Assert(t, err, qt.IsNil)
+		_, err = w.Write([]byte(`"not committed"`))
+		qt.Assert(t, err, qt.IsNil)
+		lnk := lp.BuildLink(make([]byte, 32))
+		_, err = store.OpenRead(linking.LinkContext{}, lnk)
+		qt.Check(t, errors.As(err, &linking.ErrNotFound{}), qt.IsTrue)
+	})
+}
@@ -0,0 +1,213 @@
+// Package fsck implements an offline integrity check for block stores.
+//
+// Check enumerates every block in a store, re-hashes it, tries to decode it,
+// and checks that every link found in it points to a block which is also present in the store.
+// Problems are reported one at a time to a callback as they're found, and counted in a summary Report.
+//
+// This catches damage that a LinkSystem would otherwise only notice when the damaged data is next loaded
+// (or never notice, if the LinkSystem is configured with TrustedStorage).
+package fsck
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/linking"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	"github.com/ipld/go-ipld-prime/storage"
+	"github.com/ipld/go-ipld-prime/traversal"
+)
+
+// ProblemKind describes what is wrong with a block.
+type ProblemKind uint8
+
+const (
+	ProblemUnreadable   ProblemKind = iota + 1 // The block was enumerated, but couldn't be read.
+	ProblemHashMismatch                        // The block's data doesn't hash to its link.
+	ProblemUndecodable                         // The block's data couldn't be decoded (or no decoder is available for its link).
+	ProblemDanglingLink                        // The block contains a link to a block which isn't in the store.
+)
+
+func (k ProblemKind) String() string {
+	switch k {
+	case ProblemUnreadable:
+		return "unreadable"
+	case ProblemHashMismatch:
+		return "hash mismatch"
+	case ProblemUndecodable:
+		return "undecodable"
+	case ProblemDanglingLink:
+		return "dangling link"
+	default:
+		return fmt.Sprintf("ProblemKind(%d)", uint8(k))
+	}
+}
+
+// Problem describes one thing wrong with one block.
+type Problem struct {
+	Kind ProblemKind
+	Link datamodel.Link // The block with the problem.
+
+	// For ProblemHashMismatch: the link the data actually hashes to.
+	// For ProblemDanglingLink: the link which points to an absent block.
+	// Otherwise nil.
+	Other datamodel.Link
+
+	// For ProblemUnreadable and ProblemUndecodable: the error encountered.
+	Err error
+}
+
+func (p Problem) String() string {
+	switch p.Kind {
+	case ProblemHashMismatch:
+		return fmt.Sprintf("%s: %s: data hashes to %s", p.Link, p.Kind, p.Other)
+	case ProblemDanglingLink:
+		return fmt.Sprintf("%s: %s: %s is not in the store", p.Link, p.Kind, p.Other)
+	default:
+		return fmt.Sprintf("%s: %s: %v", p.Link, p.Kind, p.Err)
+	}
+}
+
+// Report summarizes the results of a Check.
+type Report struct {
+	Blocks         int64 // Number of blocks checked.
+	Bytes          int64 // Total size of the blocks checked.
+	Unreadable     int64
+	HashMismatches int64
+	Undecodable    int64
+	DanglingLinks  int64
+}
+
+// OK returns true if no problems were found.
+func (r Report) OK() bool {
+	return r.Unreadable+r.HashMismatches+r.Undecodable+r.DanglingLinks == 0
+}
+
+// Check verifies every block in the store.
+//
+// The LinkSystem provides the means to read blocks (its StorageReadOpener, which should read from the store being checked),
+// to hash them (its HasherChooser), and to decode them (its DecoderChooser).
+// Its TrustedStorage setting and NodeReifier are ignored.
+//
+// The onProblem callback is called for each problem found; it may be nil.
+// If it returns an error, checking stops, and that error is returned along with the report of what was checked so far.
+// Problems with the data are not errors in themselves; Check only returns an error if the store can't be enumerated,
+// the context is cancelled, or the callback asks to stop.
+//
+// Blocks which fail hash verification are still decoded and checked for dangling links,
+// so that a single report shows everything that's wrong.
+func Check(ctx context.Context, lsys linking.LinkSystem, store storage.EnumerableStore, onProblem func(Problem) error) (Report, error) {
+	var report Report
+	if lsys.StorageReadOpener == nil {
+		return report, fmt.Errorf("fsck: the LinkSystem must have a StorageReadOpener")
+	}
+	report1 := func(p Problem) error {
+		switch p.Kind {
+		case ProblemUnreadable:
+			report.Unreadable++
+		case ProblemHashMismatch:
+			report.HashMismatches++
+		case ProblemUndecodable:
+			report.Undecodable++
+		case ProblemDanglingLink:
+			report.DanglingLinks++
+		}
+		if onProblem == nil {
+			return nil
+		}
+		return onProblem(p)
+	}
+
+	// First, learn everything that's present, so that links can be checked against it.
+	present := make(map[datamodel.Link]struct{})
+	var order []datamodel.Link
+	if err := store.Enumerate(ctx, func(lnk datamodel.Link, size int64) error {
+		if _, exists := present[lnk]; !exists {
+			present[lnk] = struct{}{}
+			order = append(order, lnk)
+		}
+		return nil
+	}); err != nil {
+		return report, fmt.Errorf("fsck: enumerating store failed: %w", err)
+	}
+
+	// Then check each block.
+	for _, lnk := range order {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		report.Blocks++
+		lnkCtx := linking.LinkContext{Ctx: ctx}
+		r, err := lsys.StorageReadOpener(lnkCtx, lnk)
+		var data []byte
+		if err == nil {
+			data, err = ioutil.ReadAll(r)
+		}
+		if err != nil {
+			if err := report1(Problem{Kind: ProblemUnreadable, Link: lnk, Err: err}); err != nil {
+				return report, err
+			}
+			continue
+		}
+		report.Bytes += int64(len(data))
+
+		hasher, err := lsys.HasherChooser(lnk.Prototype())
+		if err != nil {
+			// Without a hasher, the data can't be verified; that's as bad as unreadable.
+			if err := report1(Problem{Kind: ProblemUnreadable, Link: lnk, Err: linking.ErrLinkingSetup{Detail: "could not choose a hasher", Cause: err}}); err != nil {
+				return report, err
+			}
+			continue
+		}
+		hasher.Write(data)
+		if actual := lnk.Prototype().BuildLink(hasher.Sum(nil)); actual != lnk {
+			if err := report1(Problem{Kind: ProblemHashMismatch, Link: lnk, Other: actual}); err != nil {
+				return report, err
+			}
+		}
+
+		decoder, err := lsys.DecoderChooser(lnk)
+		if err != nil {
+			if err := report1(Problem{Kind: ProblemUndecodable, Link: lnk, Err: linking.ErrLinkingSetup{Detail: "could not choose a decoder", Cause: err}}); err != nil {
+				return report, err
+			}
+			continue
+		}
+		nb := basicnode.Prototype.Any.NewBuilder()
+		if err := decoder(nb, bytes.NewReader(data)); err != nil {
+			if err := report1(Problem{Kind: ProblemUndecodable, Link: lnk, Err: err}); err != nil {
+				return report, err
+			}
+			continue
+		}
+		links, err := traversal.SelectLinks(nb.Build())
+		if err != nil {
+			if err := report1(Problem{Kind: ProblemUndecodable, Link: lnk, Err: err}); err != nil {
+				return report, err
+			}
+			continue
+		}
+		reported := make(map[datamodel.Link]struct{})
+		for _, target := range links {
+			if _, exists := present[target]; exists {
+				continue
+			}
+			if lsys.InlineData != nil {
+				if _, inline := lsys.InlineData(target); inline {
+					continue // Links which carry their own data can't dangle.
+				}
+			}
+			if _, dup := reported[target]; dup {
+				continue
+			}
+			reported[target] = struct{}{}
+			if err := report1(Problem{Kind: ProblemDanglingLink, Link: lnk, Other: target}); err != nil {
+				return report, err
+			}
+		}
+	}
+	return report, nil
+}
@@ -0,0 +1,108 @@
+package fsck_test
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+	"github.com/ipfs/go-cid"
+
+	_ "github.com/ipld/go-ipld-prime/codec/dagcbor"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/fluent/qp"
+	"github.com/ipld/go-ipld-prime/linking"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	"github.com/ipld/go-ipld-prime/storage"
+	"github.com/ipld/go-ipld-prime/storage/fsck"
+)
+
+var lp = cidlink.LinkPrototype{Prefix: cid.Prefix{
+	Version:  1,
+	Codec:    0x71, // dag-cbor
+	MhType:   0x12, // sha2-256
+	MhLength: 32,
+}}
+
+func TestCheck(t *testing.T) {
+	ctx := context.Background()
+	store := &storage.Memory{}
+	lsys := cidlink.DefaultLinkSystem()
+	lsys.StorageReadOpener = store.OpenRead
+	lsys.StorageWriteOpener = store.OpenWrite
+
+	good := lsys.MustStore(linking.LinkContext{}, lp, basicnode.NewString("good"))
+	absent := lsys.MustComputeLink(lp, basicnode.NewString("absent"))
+	inline := lsys.MustComputeLink(cidlink.LinkPrototype{Prefix: cid.Prefix{Version: 1, Codec: 0x71, MhType: 0x00, MhLength: -1}}, basicnode.NewString("inline"))
+	parent, err := qp.BuildMap(basicnode.Prototype.Any, 3, func(ma datamodel.MapAssembler) {
+		qp.MapEntry(ma, "good", qp.Link(good))
+		qp.MapEntry(ma, "absent", qp.Link(absent))
+		qp.MapEntry(ma, "inline", qp.Link(inline)) // Carries its own data, so isn't dangling.
+	})
+	qt.Assert(t, err, qt.IsNil)
+	parentLnk := lsys.MustStore(linking.LinkContext{}, lp, parent)
+
+	t.Run("clean store", func(t *testing.T) {
+		clean := &storage.Memory{Bag: map[datamodel.Link][]byte{good: store.Bag[good]}}
+		lsys := lsys
+		lsys.StorageReadOpener = clean.OpenRead
+		report, err := fsck.Check(ctx, lsys, clean, nil)
+		qt.Assert(t, err, qt.IsNil)
+		qt.Check(t, report.OK(), qt.IsTrue)
+		qt.Check(t, report.Blocks, qt.Equals, int64(1))
+	})
+
+	// Damage the store in a few ways.
+	tampered := lsys.MustStore(linking.LinkContext{}, lp, basicnode.NewString("tampered"))
+	store.Bag[tampered] = []byte{0x64, 'e', 'v', 'i', 'l'}
+	truncatedData := []byte{0xa1, 0x61}
+	truncated := lp.BuildLink(hashOf(t, lsys, truncatedData))
+	store.Bag[truncated] = truncatedData
+	unknownCodec := cidlink.LinkPrototype{Prefix: cid.Prefix{Version: 1, Codec: 0x300000, MhType: 0x12, MhLength: 32}}
+	unknown := unknownCodec.BuildLink(hashOf(t, lsys, []byte("??")))
+	store.Bag[unknown] = []byte("??")
+
+	var problems []fsck.Problem
+	report, err := fsck.Check(ctx, lsys, store, func(p fsck.Problem) error {
+		problems = append(problems, p)
+		return nil
+	})
+	qt.Assert(t, err, qt.IsNil)
+	qt.Check(t, report, qt.DeepEquals, fsck.Report{
+		Blocks:         5,
+		Bytes:          report.Bytes,
+		HashMismatches: 1,
+		Undecodable:    2,
+		DanglingLinks:  1,
+	})
+	qt.Check(t, report.OK(), qt.IsFalse)
+
+	byKind := map[fsck.ProblemKind][]datamodel.Link{}
+	for _, p := range problems {
+		byKind[p.Kind] = append(byKind[p.Kind], p.Link)
+	}
+	qt.Check(t, byKind[fsck.ProblemHashMismatch], qt.HasLen, 1)
+	qt.Check(t, byKind[fsck.ProblemHashMismatch][0], qt.Equals, tampered)
+	qt.Check(t, byKind[fsck.ProblemDanglingLink], qt.HasLen, 1)
+	qt.Check(t, byKind[fsck.ProblemDanglingLink][0], qt.Equals, parentLnk)
+	undecodable := []string{byKind[fsck.ProblemUndecodable][0].String(), byKind[fsck.ProblemUndecodable][1].String()}
+	want := []string{truncated.String(), unknown.String()}
+	sort.Strings(undecodable)
+	sort.Strings(want)
+	qt.Check(t, undecodable, qt.DeepEquals, want)
+
+	t.Run("callback can stop the check", func(t *testing.T) {
+		stop := errors.New("stop")
+		_, err := fsck.Check(ctx, lsys, store, func(fsck.Problem) error { return stop })
+		qt.Check(t, err, qt.Equals, stop)
+	})
+}
+
+func hashOf(t *testing.T, lsys linking.LinkSystem, data []byte) []byte {
+	h, err := lsys.HasherChooser(lp)
+	qt.Assert(t, err, qt.IsNil)
+	h.Write(data)
+	return h.Sum(nil)
+}
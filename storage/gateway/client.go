@@ -0,0 +1,99 @@
+// Package gateway connects LinkSystems to HTTP gateways which serve raw blocks by CID,
+// such as the "trustless" gateways found in IPFS deployments.
+//
+// Client fetches blocks from a gateway, and can be used as a LinkSystem's StorageReadOpener.
+// It does no verification of its own: the blocks it returns are checked against their links by LinkSystem.Fill,
+// just like blocks from any other storage, so a gateway need not be trusted.
+// (Don't set TrustedStorage on a LinkSystem using a Client.)
+//
+// Handler is the other side: an http.Handler serving the data in a LinkSystem,
+// as raw blocks, as nodes reached by paths and re-encoded with a negotiated codec, or as CARs of selected blocks.
+// A Client can fetch blocks from a Handler.
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/linking"
+)
+
+// DefaultMaxBlockSize is the largest block a Client will accept, unless configured otherwise.
+// It's comfortably larger than the block sizes in common use.
+const DefaultMaxBlockSize = 4 << 20
+
+// RawContentType is the media type for a single raw block.
+const RawContentType = "application/vnd.ipld.raw"
+
+// Client fetches blocks from an HTTP gateway, requesting `<URL>/ipfs/<cid>?format=raw` for each.
+//
+// The OpenRead method conforms to linking.BlockReadOpener,
+// so it's easy to use in a LinkSystem like this:
+//
+//		client := &gateway.Client{URL: "https://gateway.example"}
+//		lsys.StorageReadOpener = client.OpenRead
+//
+// Requests are made with the LinkContext's Ctx, so cancelling it cancels any request in flight.
+// A 404 response is reported as linking.ErrNotFound; any other unsuccessful response is an error.
+//
+// Client is safe for concurrent use, as long as its fields are not modified during use.
+type Client struct {
+	// URL is the base URL of the gateway, without the "/ipfs/" path.
+	URL string
+
+	// HTTPClient is used to make requests.  If nil, http.DefaultClient is used.
+	HTTPClient *http.Client
+
+	// MaxBlockSize is the largest response body accepted.  If zero, DefaultMaxBlockSize is used.
+	MaxBlockSize int64
+}
+
+func (c *Client) OpenRead(lnkCtx linking.LinkContext, lnk datamodel.Link) (io.Reader, error) {
+	ctx := lnkCtx.Ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(c.URL, "/")+"/ipfs/"+lnk.String()+"?format=raw", nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", RawContentType)
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, linking.ErrNotFound{Link: lnk, Path: lnkCtx.LinkPath}
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("gateway: unexpected response for %s: %s", lnk, resp.Status)
+	}
+	maxSize := c.MaxBlockSize
+	if maxSize == 0 {
+		maxSize = DefaultMaxBlockSize
+	}
+	if resp.ContentLength > maxSize {
+		return nil, fmt.Errorf("gateway: block %s is too large (%d bytes; limit is %d)", lnk, resp.ContentLength, maxSize)
+	}
+	// Read the whole body now, so the connection can be released (a LinkSystem doesn't close the readers it's given).
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > maxSize {
+		return nil, fmt.Errorf("gateway: block %s is too large (limit is %d bytes)", lnk, maxSize)
+	}
+	return bytes.NewReader(data), nil
+}
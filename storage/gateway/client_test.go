@@ -0,0 +1,128 @@
+package gateway_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+	"github.com/ipfs/go-cid"
+
+	_ "github.com/ipld/go-ipld-prime/codec/dagcbor"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/linking"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	"github.com/ipld/go-ipld-prime/storage"
+	"github.com/ipld/go-ipld-prime/storage/gateway"
+)
+
+var lp = cidlink.LinkPrototype{Prefix: cid.Prefix{
+	Version:  1,
+	Codec:    0x71, // dag-cbor
+	MhType:   0x12, // sha2-256
+	MhLength: 32,
+}}
+
+// rawServer serves the blocks in a Memory store the way a trustless gateway would.
+// If tamper is set, it's applied to every block before it's sent.
+func rawServer(t *testing.T, store *storage.Memory, tamper func([]byte) []byte) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("format") != "raw" || r.Header.Get("Accept") != gateway.RawContentType {
+			http.Error(w, "only raw blocks are served", http.StatusBadRequest)
+			return
+		}
+		c, err := cid.Decode(strings.TrimPrefix(r.URL.Path, "/ipfs/"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		data, exists := store.Bag[cidlink.Link{Cid: c}]
+		if !exists {
+			http.NotFound(w, r)
+			return
+		}
+		if tamper != nil {
+			data = tamper(data)
+		}
+		w.Header().Set("Content-Type", gateway.RawContentType)
+		w.Write(data)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestClient(t *testing.T) {
+	backing := &storage.Memory{}
+	lsysBacking := cidlink.DefaultLinkSystem()
+	lsysBacking.StorageReadOpener = backing.OpenRead
+	lsysBacking.StorageWriteOpener = backing.OpenWrite
+	n := basicnode.NewString("fetched over http")
+	lnk := lsysBacking.MustStore(linking.LinkContext{}, lp, n)
+
+	clientLinkSystem := func(url string) linking.LinkSystem {
+		client := &gateway.Client{URL: url}
+		lsys := cidlink.DefaultLinkSystem()
+		lsys.StorageReadOpener = client.OpenRead
+		return lsys
+	}
+
+	t.Run("load", func(t *testing.T) {
+		srv := rawServer(t, backing, nil)
+		lsys := clientLinkSystem(srv.URL)
+		n2, err := lsys.Load(linking.LinkContext{}, lnk, basicnode.Prototype.Any)
+		qt.Assert(t, err, qt.IsNil)
+		qt.Check(t, datamodel.DeepEqual(n2, n), qt.IsTrue)
+	})
+	t.Run("not found", func(t *testing.T) {
+		srv := rawServer(t, backing, nil)
+		lsys := clientLinkSystem(srv.URL + "/")
+		absent := lsys.MustComputeLink(lp, basicnode.NewString("absent"))
+		_, err := lsys.Load(linking.LinkContext{}, absent, basicnode.Prototype.Any)
+		var nf linking.ErrNotFound
+		qt.Assert(t, errors.As(err, &nf), qt.IsTrue)
+		qt.Check(t, nf.Link, qt.Equals, absent)
+	})
+	t.Run("tampered blocks are rejected", func(t *testing.T) {
+		srv := rawServer(t, backing, func(data []byte) []byte {
+			return append([]byte{}, data[:len(data)-1]...)
+		})
+		lsys := clientLinkSystem(srv.URL)
+		_, err := lsys.Load(linking.LinkContext{}, lnk, basicnode.Prototype.Any)
+		qt.Check(t, errors.As(err, &linking.ErrHashMismatch{}), qt.IsTrue)
+	})
+	t.Run("server errors", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "oops", http.StatusInternalServerError)
+		}))
+		defer srv.Close()
+		lsys := clientLinkSystem(srv.URL)
+		_, err := lsys.Load(linking.LinkContext{}, lnk, basicnode.Prototype.Any)
+		qt.Check(t, err, qt.ErrorMatches, `storage error for .*: gateway: unexpected response for .*: 500 Internal Server Error`)
+	})
+	t.Run("oversized blocks are rejected", func(t *testing.T) {
+		srv := rawServer(t, backing, nil)
+		client := &gateway.Client{URL: srv.URL, MaxBlockSize: 4}
+		_, err := client.OpenRead(linking.LinkContext{}, lnk)
+		qt.Check(t, err, qt.ErrorMatches, `gateway: block .* is too large .*`)
+	})
+	t.Run("cancellation", func(t *testing.T) {
+		release := make(chan struct{})
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-r.Context().Done():
+			case <-release:
+			}
+		}))
+		defer srv.Close()
+		defer close(release)
+		lsys := clientLinkSystem(srv.URL)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := lsys.Load(linking.LinkContext{Ctx: ctx}, lnk, basicnode.Prototype.Any)
+		qt.Check(t, errors.Is(err, context.Canceled), qt.IsTrue)
+	})
+}
@@ -0,0 +1,394 @@
+package gateway
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ipfs/go-cid"
+
+	"github.com/ipld/go-ipld-prime/codec/dagjson"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/linking"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/multicodec"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	"github.com/ipld/go-ipld-prime/storage/car"
+	"github.com/ipld/go-ipld-prime/traversal"
+	"github.com/ipld/go-ipld-prime/traversal/selector"
+	selectorbuilder "github.com/ipld/go-ipld-prime/traversal/selector/builder"
+
+	_ "github.com/ipld/go-ipld-prime/codec/dagcbor" // Registered for the default CodecMediaTypes.
+)
+
+// CarContentType is the media type for a CAR (version 1) stream.
+const CarContentType = "application/vnd.ipld.car"
+
+// CodecMediaType associates a media type with the multicodec indicator of the codec which produces it.
+type CodecMediaType struct {
+	MediaType string
+	Codec     uint64
+}
+
+// DefaultCodecMediaTypes are the codecs a Handler offers, unless configured otherwise.
+// The first is used when the client expresses no preference.
+var DefaultCodecMediaTypes = []CodecMediaType{
+	{"application/vnd.ipld.dag-json", 0x0129},
+	{"application/vnd.ipld.dag-cbor", 0x71},
+}
+
+// DefaultMaxCarBlocks and DefaultMaxCarDepth are the limits on CAR responses, unless a Handler is configured otherwise.
+const (
+	DefaultMaxCarBlocks = 100000
+	DefaultMaxCarDepth  = 1024
+)
+
+// Handler is an http.Handler which serves the data in a LinkSystem.
+//
+// Requests are of the form `/<link>` or `/<link>/path/segments`.
+// The path, if any, is resolved from the node the link points to, crossing further links as needed
+// (as traversal.Focus does).
+// To serve requests with a prefix, such as the "/ipfs/" used by Client, use http.StripPrefix:
+//
+//		http.Handle("/ipfs/", http.StripPrefix("/ipfs", &gateway.Handler{LinkSystem: lsys}))
+//
+// The response format is taken from the "format" query parameter if present,
+// or else negotiated from the Accept header.  The formats are:
+//
+//   - a node encoded with one of the CodecMediaTypes, such as dag-json or dag-cbor (format=dag-json, format=dag-cbor);
+//   - a single raw block, exactly as stored (format=raw, or RawContentType);
+//   - a CAR stream of the blocks visited by a selector (format=car, or CarContentType).
+//
+// Raw and CAR responses need the path to resolve to the root of a block (meaning its last segment crosses a link).
+// For CAR responses, the selector is given in dag-json in the "selector" query parameter;
+// if absent, the whole DAG beneath the resolved block is sent (down to MaxCarDepth).
+// The CAR's single root is the resolved block, and blocks are streamed in the order the traversal visits them,
+// each only once.
+//
+// Blocks are hash-checked as they're loaded, unless the LinkSystem has TrustedStorage set.
+// Since a CAR response is streamed, an error partway through one can only be reported by aborting the response.
+// Selectors come from clients, so the walk for a CAR response is limited by MaxCarBlocks.
+type Handler struct {
+	// LinkSystem is used to load all data.  Only its StorageReadOpener and choosers are needed.
+	LinkSystem linking.LinkSystem
+
+	// ParseLink parses the first segment of a request path.
+	// If nil, it's parsed as a CID, giving a cidlink.Link.
+	ParseLink func(string) (datamodel.Link, error)
+
+	// CodecMediaTypes lists the codecs offered for encoding nodes.
+	// If nil, DefaultCodecMediaTypes is used.
+	// Codecs with no encoder in the multicodec registry are not offered.
+	CodecMediaTypes []CodecMediaType
+
+	// MaxCarBlocks limits how many blocks the walk for a CAR response may load, including the block at its root.
+	// Blocks reached by more than one path are loaded (and counted) each time, though they're sent only once.
+	// Reaching the limit aborts the response, as any other error partway through a CAR does.
+	// If zero, DefaultMaxCarBlocks is used; if negative, there's no limit.
+	MaxCarBlocks int64
+
+	// MaxCarDepth limits how many levels of nodes, counting the CAR's root as the first, the default selector explores
+	// when a request doesn't give a selector of its own.
+	// Anything deeper is left out of the CAR, without error.
+	// If zero, DefaultMaxCarDepth is used; if negative, there's no limit.
+	MaxCarDepth int64
+}
+
+func parseCidLink(s string) (datamodel.Link, error) {
+	c, err := cid.Decode(s)
+	if err != nil {
+		return nil, err
+	}
+	return cidlink.Link{Cid: c}, nil
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Work out what we're going to send, before doing any loading.
+	offers := []string{}
+	encoders := map[string]CodecMediaType{}
+	codecs := h.CodecMediaTypes
+	if codecs == nil {
+		codecs = DefaultCodecMediaTypes
+	}
+	for _, cmt := range codecs {
+		if _, err := multicodec.LookupEncoder(cmt.Codec); err == nil {
+			offers = append(offers, cmt.MediaType)
+			encoders[cmt.MediaType] = cmt
+		}
+	}
+	offers = append(offers, RawContentType, CarContentType)
+	var mediaType string
+	if format := r.URL.Query().Get("format"); format != "" {
+		for _, offer := range offers {
+			if formatName(offer) == format {
+				mediaType = offer
+				break
+			}
+		}
+		if mediaType == "" {
+			http.Error(w, fmt.Sprintf("unsupported format %q", format), http.StatusBadRequest)
+			return
+		}
+	} else {
+		mediaType = negotiate(r.Header.Get("Accept"), offers)
+		if mediaType == "" {
+			http.Error(w, "none of the accepted media types can be produced; available are: "+strings.Join(offers, ", "), http.StatusNotAcceptable)
+			return
+		}
+	}
+
+	// Parse the request path.
+	first, rest := strings.TrimPrefix(r.URL.Path, "/"), ""
+	if i := strings.IndexByte(first, '/'); i >= 0 {
+		first, rest = first[:i], first[i+1:]
+	}
+	parseLink := h.ParseLink
+	if parseLink == nil {
+		parseLink = parseCidLink
+	}
+	lnk, err := parseLink(first)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid link %q: %v", first, err), http.StatusBadRequest)
+		return
+	}
+	path := datamodel.ParsePath(rest)
+
+	// Load and resolve the path.
+	req := &request{lsys: h.LinkSystem}
+	lsys := req.linkSystem()
+	lnkCtx := linking.LinkContext{Ctx: r.Context()}
+	root, err := lsys.Load(lnkCtx, lnk, basicnode.Prototype.Any)
+	if err != nil {
+		writeLoadError(w, err)
+		return
+	}
+	prog := traversal.Progress{Cfg: &traversal.Config{
+		Ctx:        r.Context(),
+		LinkSystem: lsys,
+		LinkTargetNodePrototypeChooser: func(datamodel.Link, linking.LinkContext) (datamodel.NodePrototype, error) {
+			return basicnode.Prototype.Any, nil
+		},
+	}}
+	prog.LastBlock.Link = lnk
+	var target datamodel.Node
+	err = prog.Focus(root, path, func(p traversal.Progress, n datamodel.Node) error {
+		prog, target = p, n
+		return nil
+	})
+	if err != nil {
+		writeLoadError(w, err)
+		return
+	}
+
+	switch mediaType {
+	case RawContentType, CarContentType:
+		if prog.LastBlock.Path.String() != path.String() {
+			http.Error(w, fmt.Sprintf("path %q does not resolve to a block", path), http.StatusBadRequest)
+			return
+		}
+		if mediaType == RawContentType {
+			w.Header().Set("Content-Type", RawContentType)
+			w.Header().Set("Content-Length", strconv.Itoa(len(req.lastData)))
+			w.Write(req.lastData)
+			return
+		}
+		h.serveCar(w, r, req, prog, target)
+	default:
+		cmt := encoders[mediaType]
+		encoder, err := multicodec.LookupEncoder(cmt.Codec)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		// Encode fully before sending anything, so an error can still be reported properly.
+		var buf bytes.Buffer
+		if err := encoder(target, &buf); err != nil {
+			http.Error(w, fmt.Sprintf("cannot encode as %s: %v", cmt.MediaType, err), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", cmt.MediaType)
+		w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+		buf.WriteTo(w)
+	}
+}
+
+func (h *Handler) serveCar(w http.ResponseWriter, r *http.Request, req *request, prog traversal.Progress, target datamodel.Node) {
+	var sel selector.Selector
+	var err error
+	if selText := r.URL.Query().Get("selector"); selText != "" {
+		nb := basicnode.Prototype.Any.NewBuilder()
+		if err := dagjson.Decode(nb, strings.NewReader(selText)); err != nil {
+			http.Error(w, fmt.Sprintf("invalid selector: %v", err), http.StatusBadRequest)
+			return
+		}
+		sel, err = selector.CompileSelector(nb.Build())
+	} else {
+		limit := selector.RecursionLimitNone()
+		switch {
+		case h.MaxCarDepth == 0:
+			limit = selector.RecursionLimitDepth(DefaultMaxCarDepth)
+		case h.MaxCarDepth > 0:
+			limit = selector.RecursionLimitDepth(h.MaxCarDepth)
+		}
+		ssb := selectorbuilder.NewSelectorSpecBuilder(basicnode.Prototype.Any)
+		sel, err = selector.CompileSelector(ssb.ExploreRecursive(limit, ssb.ExploreAll(ssb.ExploreRecursiveEdge())).Node())
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid selector: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", CarContentType+"; version=1")
+	cw, err := car.NewWriter(w, []datamodel.Link{prog.LastBlock.Link})
+	if err != nil {
+		panic(http.ErrAbortHandler)
+	}
+	seen := map[datamodel.Link]struct{}{}
+	writeBlock := func(lnk datamodel.Link, data []byte) error {
+		if _, ok := seen[lnk]; ok {
+			return nil
+		}
+		seen[lnk] = struct{}{}
+		return cw.WriteBlock(lnk, data)
+	}
+	if err := writeBlock(req.lastLink, req.lastData); err != nil {
+		panic(http.ErrAbortHandler)
+	}
+	req.onBlock = writeBlock
+	// The walk starts afresh from the resolved block, so paths and budgets are relative to it.
+	prog.Path = datamodel.Path{}
+	prog.LastBlock.Path = datamodel.Path{}
+	maxBlocks := h.MaxCarBlocks
+	if maxBlocks == 0 {
+		maxBlocks = DefaultMaxCarBlocks
+	}
+	if maxBlocks > 0 {
+		// The root block is already loaded, so it's not counted by the walk.
+		prog.Budget = &traversal.Budget{NodeBudget: math.MaxInt64, LinkBudget: maxBlocks - 1}
+	}
+	err = prog.WalkAdv(target, sel, func(traversal.Progress, datamodel.Node, traversal.VisitReason) error {
+		return nil
+	})
+	if err != nil {
+		// Headers and some of the body are already sent; all that can be done is to cut the response short,
+		// so the client doesn't mistake what it has for the whole.
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// writeLoadError reports an error from loading or path resolution.
+func writeLoadError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.As(err, &linking.ErrNotFound{}), errors.As(err, &datamodel.ErrNotExists{}):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.As(err, &linking.ErrStorage{}):
+		http.Error(w, err.Error(), http.StatusBadGateway)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// request holds the state for serving one request.
+type request struct {
+	lsys     linking.LinkSystem
+	lastLink datamodel.Link // The most recently loaded block.
+	lastData []byte
+	onBlock  func(lnk datamodel.Link, data []byte) error // If set, called with each block as it's loaded.
+}
+
+// linkSystem returns a LinkSystem which loads through the request,
+// so it sees the bytes of each block loaded.
+// Blocks are hash-checked as they're read (by LoadRaw), so the returned LinkSystem doesn't need to check them again;
+// and even blocks inline in their links are read through the request.
+// LoadRaw also applies the LoadPolicy and reports to OnLoad, so the returned LinkSystem doesn't do either,
+// and each block loaded is seen by them just once.
+func (req *request) linkSystem() linking.LinkSystem {
+	lsys := req.lsys
+	lsys.StorageReadOpener = req.openRead
+	lsys.TrustedStorage = true
+	lsys.InlineData = nil
+	lsys.LoadPolicy = nil
+	lsys.OnLoad = nil
+	return lsys
+}
+
+func (req *request) openRead(lnkCtx linking.LinkContext, lnk datamodel.Link) (io.Reader, error) {
+	data, err := req.lsys.LoadRaw(lnkCtx, lnk)
+	if err != nil {
+		return nil, err
+	}
+	req.lastLink, req.lastData = lnk, data
+	if req.onBlock != nil {
+		if err := req.onBlock(lnk, data); err != nil {
+			return nil, err
+		}
+	}
+	return bytes.NewReader(data), nil
+}
+
+// formatName gives the short name used for a media type in the "format" query parameter:
+// the part after the last "." or "/" (so "application/vnd.ipld.dag-json" is "dag-json").
+func formatName(mediaType string) string {
+	return mediaType[strings.LastIndexAny(mediaType, "./")+1:]
+}
+
+// negotiate picks the offer most preferred by an Accept header.
+// Ties go to whichever offer is earlier.
+// If the header is empty, the first offer is chosen; if nothing offered is acceptable, the result is empty.
+func negotiate(accept string, offers []string) string {
+	if strings.TrimSpace(accept) == "" {
+		return offers[0]
+	}
+	type accepted struct {
+		mediaType string
+		q         float64
+	}
+	var ranges []accepted
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		a := accepted{mediaType: strings.ToLower(strings.TrimSpace(params[0])), q: 1}
+		for _, param := range params[1:] {
+			kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+			if len(kv) == 2 && strings.TrimSpace(kv[0]) == "q" {
+				if q, err := strconv.ParseFloat(strings.TrimSpace(kv[1]), 64); err == nil {
+					a.q = q
+				}
+			}
+		}
+		ranges = append(ranges, a)
+	}
+	best, bestQ := "", 0.0
+	for _, offer := range offers {
+		// The most specific matching range determines the offer's quality.
+		q, specificity := 0.0, -1
+		for _, a := range ranges {
+			s := -1
+			switch {
+			case a.mediaType == offer:
+				s = 2
+			case strings.HasSuffix(a.mediaType, "/*") && strings.HasPrefix(offer, strings.TrimSuffix(a.mediaType, "*")):
+				s = 1
+			case a.mediaType == "*/*":
+				s = 0
+			}
+			if s > specificity {
+				q, specificity = a.q, s
+			}
+		}
+		if q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	return best
+}
@@ -0,0 +1,266 @@
+package gateway_test
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"sync"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/ipld/go-ipld-prime/codec/dagcbor"
+	"github.com/ipld/go-ipld-prime/codec/dagjson"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/fluent/qp"
+	"github.com/ipld/go-ipld-prime/linking"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	"github.com/ipld/go-ipld-prime/storage"
+	"github.com/ipld/go-ipld-prime/storage/car"
+	"github.com/ipld/go-ipld-prime/storage/gateway"
+	selectorbuilder "github.com/ipld/go-ipld-prime/traversal/selector/builder"
+)
+
+func TestHandler(t *testing.T) {
+	store := &storage.Memory{}
+	lsys := cidlink.DefaultLinkSystem()
+	lsys.StorageReadOpener = store.OpenRead
+	lsys.StorageWriteOpener = store.OpenWrite
+
+	mapOf := func(build func(ma datamodel.MapAssembler)) datamodel.Link {
+		n, err := qp.BuildMap(basicnode.Prototype.Any, -1, build)
+		qt.Assert(t, err, qt.IsNil)
+		return lsys.MustStore(linking.LinkContext{}, lp, n)
+	}
+	shared := lsys.MustStore(linking.LinkContext{}, lp, basicnode.NewString("shared"))
+	left := mapOf(func(ma datamodel.MapAssembler) {
+		qp.MapEntry(ma, "s", qp.Link(shared))
+		qp.MapEntry(ma, "name", qp.String("left"))
+	})
+	right := mapOf(func(ma datamodel.MapAssembler) {
+		qp.MapEntry(ma, "s", qp.Link(shared))
+	})
+	root := mapOf(func(ma datamodel.MapAssembler) {
+		qp.MapEntry(ma, "l", qp.Link(left))
+		qp.MapEntry(ma, "r", qp.Link(right))
+		qp.MapEntry(ma, "inline", qp.Map(1, func(ma datamodel.MapAssembler) {
+			qp.MapEntry(ma, "n", qp.Int(7))
+		}))
+	})
+
+	srv := httptest.NewServer(http.StripPrefix("/ipfs", &gateway.Handler{LinkSystem: lsys}))
+	defer srv.Close()
+
+	get := func(t *testing.T, path string, accept string) (*http.Response, []byte) {
+		req, err := http.NewRequest(http.MethodGet, srv.URL+"/ipfs/"+path, nil)
+		qt.Assert(t, err, qt.IsNil)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		qt.Assert(t, err, qt.IsNil)
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		qt.Assert(t, err, qt.IsNil)
+		return resp, body
+	}
+
+	t.Run("path resolution across links, as dag-json by default", func(t *testing.T) {
+		resp, body := get(t, root.String()+"/l/s", "")
+		qt.Assert(t, resp.StatusCode, qt.Equals, http.StatusOK)
+		qt.Check(t, resp.Header.Get("Content-Type"), qt.Equals, "application/vnd.ipld.dag-json")
+		qt.Check(t, string(body), qt.Equals, `"shared"`)
+
+		resp, body = get(t, root.String()+"/inline", "")
+		qt.Assert(t, resp.StatusCode, qt.Equals, http.StatusOK)
+		qt.Check(t, string(body), qt.Equals, `{"n":7}`)
+	})
+	t.Run("accept negotiation", func(t *testing.T) {
+		resp, body := get(t, root.String()+"/l", "text/html, application/vnd.ipld.dag-cbor;q=0.9, */*;q=0.1")
+		qt.Assert(t, resp.StatusCode, qt.Equals, http.StatusOK)
+		qt.Check(t, resp.Header.Get("Content-Type"), qt.Equals, "application/vnd.ipld.dag-cbor")
+		nb := basicnode.Prototype.Any.NewBuilder()
+		qt.Assert(t, dagcbor.Decode(nb, bytes.NewReader(body)), qt.IsNil)
+		name, err := nb.Build().LookupByString("name")
+		qt.Assert(t, err, qt.IsNil)
+		qt.Check(t, datamodel.DeepEqual(name, basicnode.NewString("left")), qt.IsTrue)
+
+		resp, _ = get(t, root.String(), "text/html")
+		qt.Check(t, resp.StatusCode, qt.Equals, http.StatusNotAcceptable)
+	})
+	t.Run("raw blocks", func(t *testing.T) {
+		resp, body := get(t, root.String()+"/l", gateway.RawContentType)
+		qt.Assert(t, resp.StatusCode, qt.Equals, http.StatusOK)
+		qt.Check(t, string(body), qt.Equals, string(store.Bag[left]))
+
+		// A path ending within a block has no block of its own to send.
+		resp, _ = get(t, root.String()+"/inline?format=raw", "")
+		qt.Check(t, resp.StatusCode, qt.Equals, http.StatusBadRequest)
+	})
+	t.Run("works with Client", func(t *testing.T) {
+		client := &gateway.Client{URL: srv.URL}
+		lsys2 := cidlink.DefaultLinkSystem()
+		lsys2.StorageReadOpener = client.OpenRead
+		n, err := lsys2.Load(linking.LinkContext{}, right, basicnode.Prototype.Any)
+		qt.Assert(t, err, qt.IsNil)
+		n2, err := lsys.Load(linking.LinkContext{}, right, basicnode.Prototype.Any)
+		qt.Assert(t, err, qt.IsNil)
+		qt.Check(t, datamodel.DeepEqual(n, n2), qt.IsTrue)
+	})
+	t.Run("errors", func(t *testing.T) {
+		absent := lsys.MustComputeLink(lp, basicnode.NewString("absent"))
+		for _, tc := range []struct {
+			path   string
+			status int
+		}{
+			{absent.String(), http.StatusNotFound},
+			{root.String() + "/nope", http.StatusNotFound},
+			{root.String() + "/l/name/deeper", http.StatusInternalServerError},
+			{"not-a-cid", http.StatusBadRequest},
+			{root.String() + "?format=yaml", http.StatusBadRequest},
+		} {
+			resp, body := get(t, tc.path, "")
+			qt.Check(t, resp.StatusCode, qt.Equals, tc.status, qt.Commentf("%s: %s", tc.path, body))
+		}
+	})
+	t.Run("car of the whole dag", func(t *testing.T) {
+		resp, body := get(t, root.String(), gateway.CarContentType)
+		qt.Assert(t, resp.StatusCode, qt.Equals, http.StatusOK)
+		roots, blocks := readCar(t, body)
+		qt.Check(t, fmt.Sprint(roots), qt.Equals, fmt.Sprint([]datamodel.Link{root}))
+		qt.Check(t, keys(blocks), qt.DeepEquals, linkStrings(root, left, shared, right))
+		for lnk, data := range store.Bag {
+			qt.Check(t, blocks[lnk.String()], qt.Equals, string(data))
+		}
+	})
+	t.Run("car of a selector, from a path", func(t *testing.T) {
+		ssb := selectorbuilder.NewSelectorSpecBuilder(basicnode.Prototype.Any)
+		sel := ssb.ExploreFields(func(efsb selectorbuilder.ExploreFieldsSpecBuilder) {
+			efsb.Insert("r", ssb.Matcher())
+		}).Node()
+		var selJSON bytes.Buffer
+		qt.Assert(t, dagjson.Encode(sel, &selJSON), qt.IsNil)
+
+		resp, body := get(t, root.String()+"?format=car&selector="+url.QueryEscape(selJSON.String()), "")
+		qt.Assert(t, resp.StatusCode, qt.Equals, http.StatusOK)
+		_, blocks := readCar(t, body)
+		qt.Check(t, keys(blocks), qt.DeepEquals, linkStrings(root, right))
+
+		resp, body = get(t, root.String()+"/l?format=car", "")
+		qt.Assert(t, resp.StatusCode, qt.Equals, http.StatusOK)
+		roots, blocks := readCar(t, body)
+		qt.Check(t, fmt.Sprint(roots), qt.Equals, fmt.Sprint([]datamodel.Link{left}))
+		qt.Check(t, keys(blocks), qt.DeepEquals, linkStrings(left, shared))
+
+		resp, _ = get(t, root.String()+"?format=car&selector=%7B%7D", "")
+		qt.Check(t, resp.StatusCode, qt.Equals, http.StatusBadRequest)
+	})
+	t.Run("each load is observed once", func(t *testing.T) {
+		var mu sync.Mutex
+		var events []linking.BlockEvent
+		lsys := lsys
+		lsys.OnLoad = func(_ linking.LinkContext, evt linking.BlockEvent) {
+			mu.Lock()
+			defer mu.Unlock()
+			events = append(events, evt)
+		}
+		srv := httptest.NewServer(&gateway.Handler{LinkSystem: lsys})
+		defer srv.Close()
+		for _, tc := range []struct {
+			path  string
+			loads []datamodel.Link
+		}{
+			{root.String() + "/l/s", []datamodel.Link{root, left, shared}},
+			{root.String() + "?format=car", []datamodel.Link{root, left, shared, right, shared}},
+		} {
+			events = nil
+			resp, err := http.Get(srv.URL + "/" + tc.path)
+			qt.Assert(t, err, qt.IsNil)
+			_, err = ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			qt.Assert(t, err, qt.IsNil)
+			mu.Lock()
+			qt.Assert(t, events, qt.HasLen, len(tc.loads), qt.Commentf(tc.path))
+			for i, evt := range events {
+				qt.Check(t, evt.Link, qt.Equals, tc.loads[i])
+				qt.Check(t, evt.HashCheck, qt.Equals, linking.HashMatched)
+			}
+			mu.Unlock()
+		}
+	})
+	t.Run("car limits", func(t *testing.T) {
+		getCar := func(t *testing.T, h *gateway.Handler) ([]byte, error) {
+			h.LinkSystem = lsys
+			srv := httptest.NewServer(h)
+			defer srv.Close()
+			// An aborted response shows up as an error from either Get or reading the body,
+			// depending on whether any of it was sent first.
+			resp, err := http.Get(srv.URL + "/" + root.String() + "?format=car")
+			if err != nil {
+				return nil, err
+			}
+			defer resp.Body.Close()
+			qt.Assert(t, resp.StatusCode, qt.Equals, http.StatusOK)
+			return ioutil.ReadAll(resp.Body)
+		}
+
+		// The whole DAG takes five loads: the root, both sides, and the shared block twice.
+		body, err := getCar(t, &gateway.Handler{MaxCarBlocks: 5})
+		qt.Assert(t, err, qt.IsNil)
+		_, blocks := readCar(t, body)
+		qt.Check(t, keys(blocks), qt.DeepEquals, linkStrings(root, left, shared, right))
+		_, err = getCar(t, &gateway.Handler{MaxCarBlocks: 4})
+		qt.Check(t, err, qt.Not(qt.IsNil))
+
+		// Limiting the depth to two levels leaves out what's below the root's children, without error.
+		body, err = getCar(t, &gateway.Handler{MaxCarDepth: 2})
+		qt.Assert(t, err, qt.IsNil)
+		_, blocks = readCar(t, body)
+		qt.Check(t, keys(blocks), qt.DeepEquals, linkStrings(root, left, right))
+	})
+}
+
+// readCar reads a CAR, returning its roots, and its blocks keyed by the string form of their links.
+// It also checks that no block appears twice.
+func readCar(t *testing.T, data []byte) ([]datamodel.Link, map[string]string) {
+	cr, err := car.NewReader(bytes.NewReader(data))
+	qt.Assert(t, err, qt.IsNil)
+	blocks := map[string]string{}
+	for {
+		lnk, data, err := cr.Next()
+		if err == io.EOF {
+			break
+		}
+		qt.Assert(t, err, qt.IsNil)
+		_, dup := blocks[lnk.String()]
+		qt.Check(t, dup, qt.IsFalse, qt.Commentf("%s appears twice", lnk))
+		blocks[lnk.String()] = string(data)
+	}
+	return cr.Roots(), blocks
+}
+
+// keys returns the sorted keys of a map from readCar.
+func keys(blocks map[string]string) []string {
+	strs := make([]string, 0, len(blocks))
+	for k := range blocks {
+		strs = append(strs, k)
+	}
+	sort.Strings(strs)
+	return strs
+}
+
+// linkStrings returns the sorted string forms of some links, for comparison with keys.
+func linkStrings(lnks ...datamodel.Link) []string {
+	strs := make([]string, len(lnks))
+	for i, lnk := range lnks {
+		strs[i] = lnk.String()
+	}
+	sort.Strings(strs)
+	return strs
+}
@@ -0,0 +1,139 @@
+// Package gc implements reachability-based garbage collection for block stores.
+//
+// Collect marks every block reachable from a set of root links,
+// by loading the roots and walking all the links in them (and so on, recursively) with the traversal package,
+// and then sweeps the store, deleting every block which was not marked.
+//
+// The store must support enumeration and deletion
+// (see storage.EnumerableStore and storage.DeletableStore).
+//
+// Collect does not coordinate with concurrent writers in any way.
+// If blocks are being written while a collection is in progress,
+// new blocks may be deleted before anything refers to them.
+// Callers are responsible for making sure that doesn't happen (for example, by holding a lock that writers also take).
+package gc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/linking"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	"github.com/ipld/go-ipld-prime/storage"
+	"github.com/ipld/go-ipld-prime/traversal"
+	"github.com/ipld/go-ipld-prime/traversal/selector"
+	selectorparse "github.com/ipld/go-ipld-prime/traversal/selector/parse"
+)
+
+// Store is the set of storage features needed for garbage collection.
+type Store interface {
+	storage.EnumerableStore
+	storage.DeletableStore
+}
+
+// Result describes what a collection did.
+type Result struct {
+	BlocksMarked int64 // Number of blocks found reachable from the roots (and present in the store).
+	BlocksFreed  int64 // Number of blocks deleted.
+	BytesFreed   int64 // Total size of the blocks deleted.
+}
+
+// Collect deletes all blocks from store which are not reachable from the given roots.
+//
+// The LinkSystem is used to load and decode blocks while marking,
+// so its StorageReadOpener should read from the store being collected.
+// Any NodeReifier on the LinkSystem is ignored, so that the links in the raw data are what get followed
+// (rather than whatever view of the data an ADL might present).
+//
+// Links to blocks which are not present in the store are not an error; there's simply nothing to mark beneath them.
+// However, if any block which is present can't be loaded (for example, because no decoder is available for it,
+// or because it fails hash verification), Collect stops and returns an error without deleting anything,
+// since it can't know what that block might have linked to.
+func Collect(ctx context.Context, lsys linking.LinkSystem, store Store, roots []datamodel.Link) (Result, error) {
+	var res Result
+	marked := make(map[datamodel.Link]struct{})
+
+	// Wrap the read opener so we see every block the traversal loads,
+	// and so that absent blocks are skipped instead of halting the walk.
+	readOpener := lsys.StorageReadOpener
+	if readOpener == nil {
+		return res, fmt.Errorf("gc: the LinkSystem must have a StorageReadOpener")
+	}
+	lsys.StorageReadOpener = func(lnkCtx linking.LinkContext, lnk datamodel.Link) (io.Reader, error) {
+		r, err := readOpener(lnkCtx, lnk)
+		if err != nil {
+			if errors.As(err, &linking.ErrNotFound{}) {
+				return nil, traversal.SkipMe{}
+			}
+			return nil, err
+		}
+		marked[lnk] = struct{}{}
+		return r, nil
+	}
+	lsys.NodeReifier = nil
+
+	sel, err := selector.CompileSelector(selectorparse.CommonSelector_ExploreAllRecursively)
+	if err != nil {
+		return res, err
+	}
+	prog := traversal.Progress{Cfg: &traversal.Config{
+		Ctx:        ctx,
+		LinkSystem: lsys,
+		LinkTargetNodePrototypeChooser: func(datamodel.Link, linking.LinkContext) (datamodel.NodePrototype, error) {
+			return basicnode.Prototype.Any, nil
+		},
+		LinkVisitOnlyOnce: true,
+	}}
+
+	// Mark.
+	for _, root := range roots {
+		if _, seen := marked[root]; seen {
+			continue
+		}
+		lnkCtx := linking.LinkContext{Ctx: ctx}
+		n, err := lsys.Load(lnkCtx, root, basicnode.Prototype.Any)
+		if err != nil {
+			if errors.Is(err, traversal.SkipMe{}) {
+				continue
+			}
+			return res, fmt.Errorf("gc: could not load root %s: %w", root, err)
+		}
+		if err := prog.WalkAdv(n, sel, func(traversal.Progress, datamodel.Node, traversal.VisitReason) error {
+			return ctx.Err()
+		}); err != nil {
+			return res, fmt.Errorf("gc: marking from root %s failed: %w", root, err)
+		}
+	}
+	res.BlocksMarked = int64(len(marked))
+
+	// Sweep.
+	//  Collect the garbage list first, rather than deleting while enumerating,
+	//  since not all stores will tolerate that well.
+	type garbage struct {
+		lnk  datamodel.Link
+		size int64
+	}
+	var sweep []garbage
+	if err := store.Enumerate(ctx, func(lnk datamodel.Link, size int64) error {
+		if _, live := marked[lnk]; !live {
+			sweep = append(sweep, garbage{lnk, size})
+		}
+		return nil
+	}); err != nil {
+		return res, fmt.Errorf("gc: enumerating store failed: %w", err)
+	}
+	for _, g := range sweep {
+		if err := ctx.Err(); err != nil {
+			return res, err
+		}
+		if err := store.Delete(ctx, g.lnk); err != nil {
+			return res, fmt.Errorf("gc: deleting %s failed: %w", g.lnk, err)
+		}
+		res.BlocksFreed++
+		res.BytesFreed += g.size
+	}
+	return res, nil
+}
@@ -0,0 +1,132 @@
+package gc_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+	"github.com/ipfs/go-cid"
+
+	_ "github.com/ipld/go-ipld-prime/codec/dagcbor"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/fluent/qp"
+	"github.com/ipld/go-ipld-prime/linking"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	"github.com/ipld/go-ipld-prime/storage"
+	"github.com/ipld/go-ipld-prime/storage/gc"
+)
+
+var lp = cidlink.LinkPrototype{Prefix: cid.Prefix{
+	Version:  1,
+	Codec:    0x71, // dag-cbor
+	MhType:   0x12, // sha2-256
+	MhLength: 32,
+}}
+
+func TestCollect(t *testing.T) {
+	t.Run("memory", func(t *testing.T) {
+		store := &storage.Memory{}
+		testCollect(t, store, store.OpenRead, store.OpenWrite)
+	})
+	t.Run("filesystem", func(t *testing.T) {
+		store := &storage.Filesystem{Root: filepath.Join(t.TempDir(), "blocks")}
+		testCollect(t, store, store.OpenRead, store.OpenWrite)
+	})
+}
+
+func testCollect(t *testing.T, store interface {
+	gc.Store
+	storage.HasStore
+}, ro linking.BlockReadOpener, wo linking.BlockWriteOpener) {
+	ctx := context.Background()
+	lsys := cidlink.DefaultLinkSystem()
+	lsys.StorageReadOpener = ro
+	lsys.StorageWriteOpener = wo
+
+	store1 := func(n datamodel.Node) datamodel.Link {
+		return lsys.MustStore(linking.LinkContext{}, lp, n)
+	}
+	mapOf := func(entries map[string]datamodel.Link) datamodel.Node {
+		n, err := qp.BuildMap(basicnode.Prototype.Any, int64(len(entries)), func(ma datamodel.MapAssembler) {
+			for k, v := range entries {
+				qp.MapEntry(ma, k, qp.Link(v))
+			}
+		})
+		qt.Assert(t, err, qt.IsNil)
+		return n
+	}
+
+	// A DAG with shared structure, a link to an absent block, and some unreferenced blocks.
+	shared := store1(basicnode.NewString("shared"))
+	absent := lsys.MustComputeLink(lp, basicnode.NewString("absent"))
+	left := store1(mapOf(map[string]datamodel.Link{"s": shared, "gone": absent}))
+	right := store1(mapOf(map[string]datamodel.Link{"s": shared}))
+	root := store1(mapOf(map[string]datamodel.Link{"l": left, "r": right}))
+	orphanLeaf := store1(basicnode.NewString("orphan leaf"))
+	orphan := store1(mapOf(map[string]datamodel.Link{"leaf": orphanLeaf, "s": shared}))
+
+	var orphanBytes int64
+	qt.Assert(t, store.Enumerate(ctx, func(lnk datamodel.Link, size int64) error {
+		if lnk == orphan || lnk == orphanLeaf {
+			orphanBytes += size
+		}
+		return nil
+	}), qt.IsNil)
+
+	res, err := gc.Collect(ctx, lsys, store, []datamodel.Link{root})
+	qt.Assert(t, err, qt.IsNil)
+	qt.Check(t, res, qt.DeepEquals, gc.Result{BlocksMarked: 4, BlocksFreed: 2, BytesFreed: orphanBytes})
+
+	for _, lnk := range []datamodel.Link{root, left, right, shared} {
+		has, err := store.Has(ctx, lnk)
+		qt.Assert(t, err, qt.IsNil)
+		qt.Check(t, has, qt.IsTrue)
+	}
+	for _, lnk := range []datamodel.Link{orphan, orphanLeaf} {
+		has, err := store.Has(ctx, lnk)
+		qt.Assert(t, err, qt.IsNil)
+		qt.Check(t, has, qt.IsFalse)
+	}
+
+	// Collecting again frees nothing more.
+	res, err = gc.Collect(ctx, lsys, store, []datamodel.Link{root})
+	qt.Assert(t, err, qt.IsNil)
+	qt.Check(t, res, qt.DeepEquals, gc.Result{BlocksMarked: 4})
+
+	// With no roots, everything goes.
+	res, err = gc.Collect(ctx, lsys, store, nil)
+	qt.Assert(t, err, qt.IsNil)
+	qt.Check(t, res.BlocksFreed, qt.Equals, int64(4))
+}
+
+func TestCollectWrappedNotFound(t *testing.T) {
+	// A read opener which wraps its not-found errors should still have absent blocks skipped.
+	ctx := context.Background()
+	store := &storage.Memory{}
+	lsys := cidlink.DefaultLinkSystem()
+	lsys.StorageWriteOpener = store.OpenWrite
+	lsys.StorageReadOpener = func(lnkCtx linking.LinkContext, lnk datamodel.Link) (io.Reader, error) {
+		r, err := store.OpenRead(lnkCtx, lnk)
+		if err != nil {
+			return nil, fmt.Errorf("wrapped: %w", err)
+		}
+		return r, nil
+	}
+
+	absent := lsys.MustComputeLink(lp, basicnode.NewString("absent"))
+	n, err := qp.BuildMap(basicnode.Prototype.Any, 1, func(ma datamodel.MapAssembler) {
+		qp.MapEntry(ma, "gone", qp.Link(absent))
+	})
+	qt.Assert(t, err, qt.IsNil)
+	root := lsys.MustStore(linking.LinkContext{}, lp, n)
+	lsys.MustStore(linking.LinkContext{}, lp, basicnode.NewString("orphan"))
+
+	res, err := gc.Collect(ctx, lsys, store, []datamodel.Link{root, absent})
+	qt.Assert(t, err, qt.IsNil)
+	qt.Check(t, res.BlocksMarked, qt.Equals, int64(1))
+	qt.Check(t, res.BlocksFreed, qt.Equals, int64(1))
+}
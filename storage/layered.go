@@ -0,0 +1,107 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"hash"
+	"io"
+	"io/ioutil"
+
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/linking"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+)
+
+// Layered composes several storage systems into one:
+// reads are attempted from each of the ReadLayers in order until one of them has the data,
+// and writes all go to the single WriteLayer.
+//
+// A typical use is to read from a fast local store first, falling back to a slower archive store,
+// while only ever writing to the local store:
+//
+//		store := storage.Layered{
+//			ReadLayers: []linking.BlockReadOpener{local.OpenRead, archive.OpenRead},
+//			WriteLayer: local.OpenWrite,
+//			Promote:    true,
+//		}
+//		lsys.StorageReadOpener = store.OpenRead
+//		lsys.StorageWriteOpener = store.OpenWrite
+//
+// A layer which returns linking.ErrNotFound (or an error wrapping it) is skipped, and the next layer is tried.
+// Any other error from a layer stops the read, and is returned.
+// If no layer has the data, linking.ErrNotFound is returned.
+//
+// Layered has no state of its own, so it is safe for concurrent use if all its layers are.
+type Layered struct {
+	ReadLayers []linking.BlockReadOpener
+	WriteLayer linking.BlockWriteOpener
+
+	// Promote, if true, causes data which was found in any layer other than the first
+	// to be copied into the WriteLayer when it is read, so later reads will find it sooner.
+	//
+	// Promoted data is read fully into memory and its hash is checked before it is written;
+	// data which doesn't match its link is still returned (so the LinkSystem will report the problem as usual),
+	// but is never promoted.
+	// Promotion is best-effort: if writing to the WriteLayer fails, the read still succeeds.
+	Promote bool
+
+	// HasherChooser is used to verify data before promoting it.
+	// If nil, the hasher chooser from cidlink.DefaultLinkSystem is used.
+	HasherChooser func(datamodel.LinkPrototype) (hash.Hash, error)
+}
+
+func (store *Layered) OpenRead(lnkCtx linking.LinkContext, lnk datamodel.Link) (io.Reader, error) {
+	for i, layer := range store.ReadLayers {
+		r, err := layer(lnkCtx, lnk)
+		if err != nil {
+			if isNotFound(err) {
+				continue
+			}
+			return nil, err
+		}
+		if i == 0 || !store.Promote || store.WriteLayer == nil {
+			return r, nil
+		}
+		data, err := ioutil.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		store.promote(lnkCtx, lnk, data)
+		return bytes.NewReader(data), nil
+	}
+	return nil, linking.ErrNotFound{Link: lnk, Path: lnkCtx.LinkPath}
+}
+
+func (store *Layered) OpenWrite(lnkCtx linking.LinkContext) (io.Writer, linking.BlockWriteCommitter, error) {
+	return store.WriteLayer(lnkCtx)
+}
+
+// promote writes data into the WriteLayer if it's verified to match the link.
+// Errors are ignored, since promotion is only an optimization.
+func (store *Layered) promote(lnkCtx linking.LinkContext, lnk datamodel.Link, data []byte) {
+	chooser := store.HasherChooser
+	if chooser == nil {
+		chooser = cidlink.DefaultLinkSystem().HasherChooser
+	}
+	hasher, err := chooser(lnk.Prototype())
+	if err != nil {
+		return
+	}
+	hasher.Write(data)
+	if lnk.Prototype().BuildLink(hasher.Sum(nil)) != lnk {
+		return
+	}
+	w, commit, err := store.WriteLayer(lnkCtx)
+	if err != nil {
+		return
+	}
+	if _, err := w.Write(data); err != nil {
+		return
+	}
+	commit(lnk)
+}
+
+// isNotFound reports whether err is, or wraps, a linking.ErrNotFound.
+func isNotFound(err error) bool {
+	return errors.As(err, &linking.ErrNotFound{})
+}
@@ -0,0 +1,61 @@
+package storage_test
+
+import (
+	"errors"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/ipld/go-ipld-prime/linking"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	"github.com/ipld/go-ipld-prime/storage"
+)
+
+func TestLayered(t *testing.T) {
+	top, bottom := &storage.Memory{}, &storage.Memory{}
+	bottomLsys := cidlink.DefaultLinkSystem()
+	bottomLsys.StorageWriteOpener = bottom.OpenWrite
+	archived := bottomLsys.MustStore(linking.LinkContext{}, lp, basicnode.NewString("archived"))
+	tampered := bottomLsys.MustStore(linking.LinkContext{}, lp, basicnode.NewString("tampered"))
+	bottom.Bag[tampered] = []byte(`"not what was hashed"`)
+
+	layered := storage.Layered{
+		ReadLayers: []linking.BlockReadOpener{top.OpenRead, bottom.OpenRead},
+		WriteLayer: top.OpenWrite,
+	}
+	lsys := cidlink.DefaultLinkSystem()
+	lsys.StorageReadOpener = layered.OpenRead
+	lsys.StorageWriteOpener = layered.OpenWrite
+
+	t.Run("writes go to the top layer", func(t *testing.T) {
+		lnk := lsys.MustStore(linking.LinkContext{}, lp, basicnode.NewString("fresh"))
+		qt.Check(t, top.Bag[lnk], qt.Not(qt.IsNil))
+		qt.Check(t, bottom.Bag[lnk], qt.IsNil)
+		_, err := lsys.Load(linking.LinkContext{}, lnk, basicnode.Prototype.Any)
+		qt.Check(t, err, qt.IsNil)
+	})
+	t.Run("reads fall through to lower layers", func(t *testing.T) {
+		n, err := lsys.Load(linking.LinkContext{}, archived, basicnode.Prototype.Any)
+		qt.Assert(t, err, qt.IsNil)
+		s, _ := n.AsString()
+		qt.Check(t, s, qt.Equals, "archived")
+		qt.Check(t, top.Bag[archived], qt.IsNil)
+	})
+	t.Run("absent everywhere is not found", func(t *testing.T) {
+		missing := lsys.MustComputeLink(lp, basicnode.NewString("missing"))
+		_, err := lsys.Load(linking.LinkContext{}, missing, basicnode.Prototype.Any)
+		qt.Check(t, errors.As(err, &linking.ErrNotFound{}), qt.IsTrue)
+	})
+	t.Run("promotion copies verified data up", func(t *testing.T) {
+		layered.Promote = true
+		defer func() { layered.Promote = false }()
+		_, err := lsys.Load(linking.LinkContext{}, archived, basicnode.Prototype.Any)
+		qt.Assert(t, err, qt.IsNil)
+		qt.Check(t, top.Bag[archived], qt.DeepEquals, bottom.Bag[archived])
+
+		_, err = lsys.Load(linking.LinkContext{}, tampered, basicnode.Prototype.Any)
+		qt.Check(t, errors.As(err, &linking.ErrHashMismatch{}), qt.IsTrue)
+		qt.Check(t, top.Bag[tampered], qt.IsNil)
+	})
+}
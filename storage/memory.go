@@ -2,7 +2,7 @@ package storage
 
 import (
 	"bytes"
-	"fmt"
+	"context"
 	"io"
 
 	"github.com/ipld/go-ipld-prime/datamodel"
@@ -38,7 +38,7 @@ func (store *Memory) OpenRead(lnkCtx linking.LinkContext, lnk datamodel.Link) (i
 	store.beInitialized()
 	data, exists := store.Bag[lnk]
 	if !exists {
-		return nil, fmt.Errorf("404") // FIXME this needs a standard error type
+		return nil, linking.ErrNotFound{Link: lnk, Path: lnkCtx.LinkPath}
 	}
 	return bytes.NewReader(data), nil
 }
@@ -51,3 +51,28 @@ func (store *Memory) OpenWrite(lnkCtx linking.LinkContext) (io.Writer, linking.B
 		return nil
 	}, nil
 }
+
+// Enumerate conforms to EnumerableStore.
+func (store *Memory) Enumerate(ctx context.Context, fn func(lnk datamodel.Link, size int64) error) error {
+	for lnk, data := range store.Bag {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(lnk, int64(len(data))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Has conforms to HasStore.
+func (store *Memory) Has(ctx context.Context, lnk datamodel.Link) (bool, error) {
+	_, exists := store.Bag[lnk]
+	return exists, nil
+}
+
+// Delete conforms to DeletableStore.
+func (store *Memory) Delete(ctx context.Context, lnk datamodel.Link) error {
+	delete(store.Bag, lnk)
+	return nil
+}
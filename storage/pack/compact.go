@@ -0,0 +1,113 @@
+package pack
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/ipld/go-ipld-prime/datamodel"
+)
+
+// Compact reclaims the space used by deleted blocks.
+//
+// Every pack containing any deleted data has its live blocks copied into the current pack,
+// and is then removed.  Packs with no deleted data are left alone.
+// The index is saved once the copies are durable and before any pack is removed,
+// so an interruption at any point leaves a store which opens correctly
+// (at worst with some blocks present in two packs, which the next Compact cleans up).
+//
+// Compact holds the store's lock for its whole duration, so reads and writes wait for it to finish.
+// If ctx is cancelled, Compact stops copying, but still saves the index and removes any packs it has fully emptied.
+func (store *Store) Compact(ctx context.Context) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if store.closed {
+		return fmt.Errorf("pack: store is closed")
+	}
+
+	// If the current pack has garbage itself, start a fresh one, so it can be compacted too.
+	if store.current != nil && store.current.garbage > 0 {
+		if err := store.startPack(); err != nil {
+			return err
+		}
+	}
+
+	var victims []uint32
+	for id, p := range store.packs {
+		if p.garbage > 0 && p != store.current {
+			victims = append(victims, id)
+		}
+	}
+	if len(victims) == 0 {
+		return nil
+	}
+	sort.Slice(victims, func(i, j int) bool { return victims[i] < victims[j] })
+	isVictim := make(map[uint32]bool, len(victims))
+	for _, id := range victims {
+		isVictim[id] = true
+	}
+
+	// Gather the live blocks in each victim, in the order they sit in the pack.
+	type liveBlock struct {
+		lnk datamodel.Link
+		loc location
+	}
+	live := make(map[uint32][]liveBlock)
+	for lnk, loc := range store.index {
+		if isVictim[loc.pack] {
+			live[loc.pack] = append(live[loc.pack], liveBlock{lnk, loc})
+		}
+	}
+
+	var copyErr error
+	var emptied []uint32
+	for _, id := range victims {
+		blocks := live[id]
+		sort.Slice(blocks, func(i, j int) bool { return blocks[i].loc.offset < blocks[j].loc.offset })
+		for _, blk := range blocks {
+			if copyErr = ctx.Err(); copyErr != nil {
+				break
+			}
+			data := make([]byte, blk.loc.length)
+			if _, copyErr = store.packs[id].file.ReadAt(data, blk.loc.offset); copyErr != nil {
+				break
+			}
+			// Remove the old entry first, so that append doesn't see it as already present.
+			delete(store.index, blk.lnk)
+			if copyErr = store.append(blk.lnk, data); copyErr != nil {
+				store.index[blk.lnk] = blk.loc
+				break
+			}
+		}
+		if copyErr != nil {
+			break
+		}
+		emptied = append(emptied, id)
+	}
+
+	// Make the copies durable, and record where they are, before removing anything.
+	if store.current != nil {
+		if err := store.current.file.Sync(); err != nil {
+			return err
+		}
+	}
+	removed := make([]*packFile, 0, len(emptied))
+	for _, id := range emptied {
+		removed = append(removed, store.packs[id])
+		delete(store.packs, id)
+	}
+	if err := store.saveIndex(); err != nil {
+		// Put the packs back; nothing has been lost, and they'll be compacted again next time.
+		for _, p := range removed {
+			store.packs[p.id] = p
+		}
+		return err
+	}
+	for _, p := range removed {
+		p.file.Close()
+		os.Remove(filepath.Join(store.dir, packName(p.id)))
+	}
+	return copyErr
+}
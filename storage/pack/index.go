@@ -0,0 +1,301 @@
+package pack
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ipfs/go-cid"
+
+	"github.com/ipld/go-ipld-prime/datamodel"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/storage/car"
+)
+
+// The saved index file is:
+//
+//   - a varint version number (currently 1);
+//   - a varint count of packs, then for each pack: varint id, varint size, varint garbage;
+//   - a varint count of entries, then for each entry: varint pack id, varint offset, varint length, varint CID length, and the CID;
+//   - a little-endian CRC-32 (IEEE) of everything before it.
+//
+// The pack sizes record how much of each pack the index describes.
+// Any pack whose size on disk differs from that is scanned again when the store is opened.
+const (
+	indexName    = "index"
+	indexVersion = 1
+)
+
+type savedPack struct {
+	size    int64
+	garbage int64
+}
+
+type savedEntry struct {
+	lnk datamodel.Link
+	loc location
+}
+
+// saveIndex writes the index to disk, atomically replacing any previous one.
+// Must be called with the lock held.
+func (store *Store) saveIndex() error {
+	var buf bytes.Buffer
+	var vbuf [binary.MaxVarintLen64]byte
+	putUvarint := func(v uint64) {
+		buf.Write(vbuf[:binary.PutUvarint(vbuf[:], v)])
+	}
+	putUvarint(indexVersion)
+	ids := make([]uint32, 0, len(store.packs))
+	for id := range store.packs {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	putUvarint(uint64(len(ids)))
+	for _, id := range ids {
+		p := store.packs[id]
+		putUvarint(uint64(id))
+		putUvarint(uint64(p.size))
+		putUvarint(uint64(p.garbage))
+	}
+	putUvarint(uint64(len(store.index)))
+	for lnk, loc := range store.index {
+		cb := []byte(lnk.(cidlink.Link).Cid.KeyString())
+		putUvarint(uint64(loc.pack))
+		putUvarint(uint64(loc.offset))
+		putUvarint(uint64(loc.length))
+		putUvarint(uint64(len(cb)))
+		buf.Write(cb)
+	}
+	var crc [4]byte
+	binary.LittleEndian.PutUint32(crc[:], crc32.ChecksumIEEE(buf.Bytes()))
+	buf.Write(crc[:])
+
+	f, err := ioutil.TempFile(store.dir, ".tmp-index-")
+	if err != nil {
+		return err
+	}
+	if _, err := buf.WriteTo(f); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), filepath.Join(store.dir, indexName))
+}
+
+// readIndex reads the saved index.
+// If it is absent or damaged, it returns nil maps and no error: the index will be rebuilt from the packs.
+func readIndex(dir string) (map[uint32]savedPack, map[uint32][]savedEntry, error) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, indexName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil, nil
+		}
+		return nil, nil, err
+	}
+	packs, entries, err := parseIndex(data)
+	if err != nil {
+		return nil, nil, nil // Damaged; rebuild.
+	}
+	return packs, entries, nil
+}
+
+func parseIndex(data []byte) (map[uint32]savedPack, map[uint32][]savedEntry, error) {
+	if len(data) < 4 {
+		return nil, nil, io.ErrUnexpectedEOF
+	}
+	body, crc := data[:len(data)-4], data[len(data)-4:]
+	if crc32.ChecksumIEEE(body) != binary.LittleEndian.Uint32(crc) {
+		return nil, nil, fmt.Errorf("pack: index checksum mismatch")
+	}
+	r := bytes.NewReader(body)
+	var err error
+	readUvarint := func() uint64 {
+		v, e := binary.ReadUvarint(r)
+		if e != nil && err == nil {
+			err = e
+		}
+		return v
+	}
+	if v := readUvarint(); v != indexVersion {
+		return nil, nil, fmt.Errorf("pack: unsupported index version %d", v)
+	}
+	packs := make(map[uint32]savedPack)
+	for n := readUvarint(); n > 0 && err == nil; n-- {
+		id := uint32(readUvarint())
+		packs[id] = savedPack{size: int64(readUvarint()), garbage: int64(readUvarint())}
+	}
+	entries := make(map[uint32][]savedEntry)
+	for n := readUvarint(); n > 0 && err == nil; n-- {
+		var ent savedEntry
+		ent.loc.pack = uint32(readUvarint())
+		ent.loc.offset = int64(readUvarint())
+		ent.loc.length = int64(readUvarint())
+		cb := make([]byte, readUvarint())
+		if _, e := io.ReadFull(r, cb); e != nil && err == nil {
+			err = e
+		}
+		c, e := cid.Cast(cb)
+		if e != nil && err == nil {
+			err = e
+		}
+		ent.lnk = cidlink.Link{Cid: c}
+		entries[ent.loc.pack] = append(entries[ent.loc.pack], ent)
+	}
+	if err == nil && r.Len() != 0 {
+		err = fmt.Errorf("pack: trailing data in index")
+	}
+	return packs, entries, err
+}
+
+// load opens all the packs in the store's directory, and builds the index,
+// using the saved index where it's up to date and scanning packs where it isn't.
+func (store *Store) load() error {
+	saved, savedEntries, err := readIndex(store.dir)
+	if err != nil {
+		return err
+	}
+	names, err := filepath.Glob(filepath.Join(store.dir, "*.car"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		id64, err := strconv.ParseUint(strings.TrimSuffix(filepath.Base(name), ".car"), 10, 32)
+		if err != nil {
+			continue // Not one of ours.
+		}
+		id := uint32(id64)
+		if id >= store.nextID {
+			store.nextID = id + 1
+		}
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		fi, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return err
+		}
+		p := &packFile{id: id, file: f, size: fi.Size()}
+		var entries []savedEntry
+		if sp, ok := saved[id]; ok && sp.size == p.size {
+			entries = savedEntries[id]
+			p.garbage = sp.garbage
+		} else {
+			entries, p.size, err = scanPack(f, id)
+			if err != nil {
+				f.Close()
+				if errors.Is(err, errEmptyPack) {
+					os.Remove(name)
+					continue
+				}
+				return fmt.Errorf("pack: %s: %w", name, err)
+			}
+			if p.size != fi.Size() {
+				// The pack ended with a partial section, from a write which was interrupted.  Trim it.
+				if err := os.Truncate(name, p.size); err != nil {
+					f.Close()
+					return err
+				}
+			}
+		}
+		store.packs[id] = p
+		for _, ent := range entries {
+			if _, exists := store.index[ent.lnk]; exists {
+				// A duplicate, perhaps from an interrupted compaction.  The copy here is garbage.
+				p.garbage += ent.loc.length
+				continue
+			}
+			store.index[ent.lnk] = ent.loc
+		}
+	}
+	return nil
+}
+
+var errEmptyPack = errors.New("pack has no complete header")
+
+// scanPack reads every section of a pack, and returns the index entries for it,
+// and the size of the pack up to the end of the last complete section.
+func scanPack(f *os.File, id uint32) ([]savedEntry, int64, error) {
+	// Read through a SectionReader rather than the file's own position, since the current pack's position is in use for appending.
+	cr, err := car.NewReader(bufio.NewReader(io.NewSectionReader(f, 0, 1<<62)))
+	if err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, 0, errEmptyPack
+		}
+		return nil, 0, err
+	}
+	var entries []savedEntry
+	good := cr.Position()
+	for {
+		lnk, data, err := cr.Next()
+		if err == io.EOF {
+			return entries, good, nil
+		}
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return entries, good, nil
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		end := cr.Position()
+		entries = append(entries, savedEntry{lnk, location{id, end - int64(len(data)), int64(len(data))}})
+		good = end
+	}
+}
+
+// RebuildIndex discards the in-memory index, and rebuilds it by scanning all packs.
+// Blocks which were deleted but not yet compacted will reappear.
+func (store *Store) RebuildIndex() error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if store.closed {
+		return fmt.Errorf("pack: store is closed")
+	}
+	index := make(map[datamodel.Link]location)
+	garbage := make(map[uint32]int64)
+	ids := make([]uint32, 0, len(store.packs))
+	for id := range store.packs {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for _, id := range ids {
+		p := store.packs[id]
+		entries, _, err := scanPack(p.file, id)
+		if err != nil && !errors.Is(err, errEmptyPack) {
+			return fmt.Errorf("pack: %s: %w", packName(id), err)
+		}
+		for _, ent := range entries {
+			if _, exists := index[ent.lnk]; exists {
+				garbage[id] += ent.loc.length
+				continue
+			}
+			index[ent.lnk] = ent.loc
+		}
+	}
+	store.index = index
+	for id, p := range store.packs {
+		p.garbage = garbage[id]
+	}
+	return nil
+}
@@ -0,0 +1,301 @@
+// Package pack implements a block store which appends blocks to a small number of large "pack" files,
+// rather than keeping each block in a file of its own.
+//
+// Each pack is a CARv1 file (with no roots), so packs can be inspected with any CAR tooling.
+// The store keeps an index from each link to the pack, offset, and length of its data.
+// The index is kept in memory, and saved to disk when the store is closed or compacted;
+// when a store is opened, any packs the saved index doesn't fully describe are scanned again,
+// and if the saved index is missing or damaged, it's rebuilt entirely from the packs.
+//
+// Packs are append-only.  Deleting a block only removes it from the index;
+// the space it used is reclaimed by Compact, which rewrites the live blocks of any pack containing deleted data.
+// Combined with the gc package, this drops all unreachable blocks:
+//
+//		res, err := gc.Collect(ctx, lsys, store, roots)
+//		...
+//		err = store.Compact(ctx)
+//
+// Note that deletions which haven't been compacted are only recorded in the saved index,
+// so if the index has to be rebuilt from the packs, those blocks will reappear
+// (which is harmless; they'll just be collected again).
+package pack
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/linking"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/storage"
+	"github.com/ipld/go-ipld-prime/storage/car"
+)
+
+// DefaultMaxPackSize is the size at which a Store starts a new pack, unless configured otherwise.
+const DefaultMaxPackSize = 256 << 20
+
+// Store is a block store kept in pack files in a directory.
+//
+// The OpenRead method conforms to linking.BlockReadOpener,
+// and the OpenWrite method conforms to linking.BlockWriteOpener.
+// Therefore it's easy to use in a LinkSystem like this:
+//
+//		store, err := pack.Open("/path/to/packs")
+//		lsys.StorageReadOpener = store.OpenRead
+//		lsys.StorageWriteOpener = store.OpenWrite
+//
+// Store also supports the optional storage.EnumerableStore, storage.HasStore, and storage.DeletableStore features.
+//
+// Store is safe for concurrent use, but a directory should only be opened by one Store at a time.
+// The Store must be closed when done with, so that its index is saved and files are released.
+type Store struct {
+	// MaxPackSize is the size at which a new pack is started.
+	// It may be changed before the store is used; it defaults to DefaultMaxPackSize.
+	// (Blocks larger than this still get written, in a pack of their own.)
+	MaxPackSize int64
+
+	dir string
+
+	mu      sync.RWMutex
+	index   map[datamodel.Link]location
+	packs   map[uint32]*packFile
+	current *packFile // The pack currently being appended to.  Nil until the first write.
+	nextID  uint32
+	closed  bool
+}
+
+// location is where a block's data is found.
+type location struct {
+	pack   uint32
+	offset int64
+	length int64
+}
+
+type packFile struct {
+	id      uint32
+	file    *os.File
+	size    int64
+	garbage int64      // Bytes of data in this pack for blocks which have been deleted.
+	writer  *car.Writer // Only set on the current pack.
+}
+
+func packName(id uint32) string {
+	return fmt.Sprintf("%08d.car", id)
+}
+
+// Open opens the pack store in dir, creating the directory if it does not exist.
+func Open(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	store := &Store{
+		MaxPackSize: DefaultMaxPackSize,
+		dir:         dir,
+		index:       make(map[datamodel.Link]location),
+		packs:       make(map[uint32]*packFile),
+		nextID:      1,
+	}
+	if err := store.load(); err != nil {
+		store.closeFiles()
+		return nil, err
+	}
+	return store, nil
+}
+
+// Close saves the index and releases all files.
+// The store must not be used after it is closed.
+func (store *Store) Close() error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if store.closed {
+		return nil
+	}
+	store.closed = true
+	var err error
+	if store.current != nil {
+		err = store.current.file.Sync()
+	}
+	if err2 := store.saveIndex(); err == nil {
+		err = err2
+	}
+	if err2 := store.closeFiles(); err == nil {
+		err = err2
+	}
+	return err
+}
+
+func (store *Store) closeFiles() error {
+	var err error
+	for _, p := range store.packs {
+		if err2 := p.file.Close(); err == nil {
+			err = err2
+		}
+	}
+	return err
+}
+
+// Sync flushes the current pack to stable storage.
+// (The index is not saved by Sync; if the process stops before Close, the index will be repaired from the packs on the next Open.)
+func (store *Store) Sync() error {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	if store.current == nil {
+		return nil
+	}
+	return store.current.file.Sync()
+}
+
+func (store *Store) OpenRead(lnkCtx linking.LinkContext, lnk datamodel.Link) (io.Reader, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	if store.closed {
+		return nil, fmt.Errorf("pack: store is closed")
+	}
+	loc, exists := store.index[lnk]
+	if !exists {
+		return nil, linking.ErrNotFound{Link: lnk, Path: lnkCtx.LinkPath}
+	}
+	data := make([]byte, loc.length)
+	if _, err := store.packs[loc.pack].file.ReadAt(data, loc.offset); err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(data), nil
+}
+
+func (store *Store) OpenWrite(lnkCtx linking.LinkContext) (io.Writer, linking.BlockWriteCommitter, error) {
+	buf := bytes.Buffer{}
+	return &buf, func(lnk datamodel.Link) error {
+		store.mu.Lock()
+		defer store.mu.Unlock()
+		if store.closed {
+			return fmt.Errorf("pack: store is closed")
+		}
+		return store.append(lnk, buf.Bytes())
+	}, nil
+}
+
+// append writes a block to the current pack, starting a new one if needed.
+// Blocks already present are skipped.
+// Must be called with the lock held.
+func (store *Store) append(lnk datamodel.Link, data []byte) error {
+	if _, exists := store.index[lnk]; exists {
+		return nil
+	}
+	// The section is a varint length, then the CID, then the data.  Work out its size, and where the data will land.
+	cl, ok := lnk.(cidlink.Link)
+	if !ok {
+		return fmt.Errorf("pack: only cidlink.Link can be stored, not %T", lnk)
+	}
+	cidLen := len(cl.Cid.KeyString())
+	var vbuf [binary.MaxVarintLen64]byte
+	sectionLen := cidLen + len(data)
+	prefixLen := binary.PutUvarint(vbuf[:], uint64(sectionLen))
+	if store.current == nil || (store.current.size > 0 && store.current.size+int64(prefixLen+sectionLen) > store.MaxPackSize) {
+		if err := store.startPack(); err != nil {
+			return err
+		}
+	}
+	p := store.current
+	if err := p.writer.WriteBlock(lnk, data); err != nil {
+		// The pack may now have a partial section at its end, so don't append to it any further.
+		// (The partial section will be trimmed when the store is next opened.)
+		p.writer = nil
+		store.current = nil
+		return err
+	}
+	store.index[lnk] = location{
+		pack:   p.id,
+		offset: p.size + int64(prefixLen+cidLen),
+		length: int64(len(data)),
+	}
+	p.size += int64(prefixLen + sectionLen)
+	return nil
+}
+
+// startPack creates a new pack and makes it current.
+// Must be called with the lock held.
+func (store *Store) startPack() error {
+	id := store.nextID
+	f, err := os.OpenFile(filepath.Join(store.dir, packName(id)), os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	cw, err := car.NewWriter(f, nil)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	size, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	if store.current != nil {
+		store.current.writer = nil
+	}
+	p := &packFile{id: id, file: f, size: size, writer: cw}
+	store.packs[id] = p
+	store.current = p
+	store.nextID++
+	return nil
+}
+
+// Has conforms to storage.HasStore.
+func (store *Store) Has(ctx context.Context, lnk datamodel.Link) (bool, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	_, exists := store.index[lnk]
+	return exists, nil
+}
+
+// Enumerate conforms to storage.EnumerableStore.
+//
+// The blocks visited are those present when Enumerate was called.
+func (store *Store) Enumerate(ctx context.Context, fn func(lnk datamodel.Link, size int64) error) error {
+	type entry struct {
+		lnk  datamodel.Link
+		size int64
+	}
+	store.mu.RLock()
+	entries := make([]entry, 0, len(store.index))
+	for lnk, loc := range store.index {
+		entries = append(entries, entry{lnk, loc.length})
+	}
+	store.mu.RUnlock()
+	for _, ent := range entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(ent.lnk, ent.size); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete conforms to storage.DeletableStore.
+//
+// The block is removed from the index immediately, but the space it occupies is only reclaimed by Compact.
+func (store *Store) Delete(ctx context.Context, lnk datamodel.Link) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	loc, exists := store.index[lnk]
+	if !exists {
+		return nil
+	}
+	delete(store.index, lnk)
+	store.packs[loc.pack].garbage += loc.length
+	return nil
+}
+
+var (
+	_ storage.EnumerableStore = (*Store)(nil)
+	_ storage.HasStore        = (*Store)(nil)
+	_ storage.DeletableStore  = (*Store)(nil)
+)
@@ -0,0 +1,237 @@
+package pack_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+	"github.com/ipfs/go-cid"
+
+	_ "github.com/ipld/go-ipld-prime/codec/dagcbor"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/fluent/qp"
+	"github.com/ipld/go-ipld-prime/linking"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	"github.com/ipld/go-ipld-prime/storage/gc"
+	"github.com/ipld/go-ipld-prime/storage/pack"
+)
+
+var lp = cidlink.LinkPrototype{Prefix: cid.Prefix{
+	Version:  1,
+	Codec:    0x71, // dag-cbor
+	MhType:   0x12, // sha2-256
+	MhLength: 32,
+}}
+
+func linkSystem(store *pack.Store) linking.LinkSystem {
+	lsys := cidlink.DefaultLinkSystem()
+	lsys.StorageReadOpener = store.OpenRead
+	lsys.StorageWriteOpener = store.OpenWrite
+	return lsys
+}
+
+// storeStrings stores n string nodes, and returns their links.
+func storeStrings(t *testing.T, lsys linking.LinkSystem, prefix string, n int) []datamodel.Link {
+	lnks := make([]datamodel.Link, n)
+	for i := range lnks {
+		lnk, err := lsys.Store(linking.LinkContext{}, lp, basicnode.NewString(fmt.Sprintf("%s %d", prefix, i)))
+		qt.Assert(t, err, qt.IsNil)
+		lnks[i] = lnk
+	}
+	return lnks
+}
+
+// checkStrings checks that every link loads, and has the value storeStrings gave it.
+func checkStrings(t *testing.T, lsys linking.LinkSystem, prefix string, lnks []datamodel.Link) {
+	t.Helper()
+	for i, lnk := range lnks {
+		n, err := lsys.Load(linking.LinkContext{}, lnk, basicnode.Prototype.Any)
+		qt.Assert(t, err, qt.IsNil)
+		s, err := n.AsString()
+		qt.Assert(t, err, qt.IsNil)
+		qt.Check(t, s, qt.Equals, fmt.Sprintf("%s %d", prefix, i))
+	}
+}
+
+func packFiles(t *testing.T, dir string) []string {
+	names, err := filepath.Glob(filepath.Join(dir, "*.car"))
+	qt.Assert(t, err, qt.IsNil)
+	return names
+}
+
+func TestRoundtrip(t *testing.T) {
+	dir := t.TempDir()
+	store, err := pack.Open(dir)
+	qt.Assert(t, err, qt.IsNil)
+	lsys := linkSystem(store)
+
+	lnks := storeStrings(t, lsys, "block", 10)
+	checkStrings(t, lsys, "block", lnks)
+
+	// Storing the same block again doesn't write it twice.
+	fi, err := os.Stat(packFiles(t, dir)[0])
+	qt.Assert(t, err, qt.IsNil)
+	storeStrings(t, lsys, "block", 10)
+	fi2, err := os.Stat(packFiles(t, dir)[0])
+	qt.Assert(t, err, qt.IsNil)
+	qt.Check(t, fi2.Size(), qt.Equals, fi.Size())
+
+	has, err := store.Has(context.Background(), lnks[3])
+	qt.Assert(t, err, qt.IsNil)
+	qt.Check(t, has, qt.IsTrue)
+
+	var count int
+	qt.Assert(t, store.Enumerate(context.Background(), func(datamodel.Link, int64) error {
+		count++
+		return nil
+	}), qt.IsNil)
+	qt.Check(t, count, qt.Equals, 10)
+
+	_, err = store.OpenRead(linking.LinkContext{}, lp.BuildLink(make([]byte, 32)))
+	qt.Check(t, errors.As(err, &linking.ErrNotFound{}), qt.IsTrue)
+
+	qt.Assert(t, store.Close(), qt.IsNil)
+}
+
+func TestReopen(t *testing.T) {
+	setup := func(t *testing.T) (string, []datamodel.Link) {
+		dir := t.TempDir()
+		store, err := pack.Open(dir)
+		qt.Assert(t, err, qt.IsNil)
+		lnks := storeStrings(t, linkSystem(store), "block", 20)
+		qt.Assert(t, store.Close(), qt.IsNil)
+		return dir, lnks
+	}
+	reopen := func(t *testing.T, dir string, lnks []datamodel.Link) *pack.Store {
+		store, err := pack.Open(dir)
+		qt.Assert(t, err, qt.IsNil)
+		t.Cleanup(func() { store.Close() })
+		checkStrings(t, linkSystem(store), "block", lnks)
+		return store
+	}
+
+	t.Run("with saved index", func(t *testing.T) {
+		dir, lnks := setup(t)
+		reopen(t, dir, lnks)
+	})
+	t.Run("index missing", func(t *testing.T) {
+		dir, lnks := setup(t)
+		qt.Assert(t, os.Remove(filepath.Join(dir, "index")), qt.IsNil)
+		reopen(t, dir, lnks)
+	})
+	t.Run("index corrupt", func(t *testing.T) {
+		dir, lnks := setup(t)
+		path := filepath.Join(dir, "index")
+		data, err := ioutil.ReadFile(path)
+		qt.Assert(t, err, qt.IsNil)
+		data[len(data)/2] ^= 0xff
+		qt.Assert(t, ioutil.WriteFile(path, data, 0644), qt.IsNil)
+		reopen(t, dir, lnks)
+	})
+	t.Run("torn tail", func(t *testing.T) {
+		dir, lnks := setup(t)
+		// Simulate a crash partway through a write: part of a section at the end of the pack, and a stale index.
+		name := packFiles(t, dir)[0]
+		f, err := os.OpenFile(name, os.O_WRONLY|os.O_APPEND, 0)
+		qt.Assert(t, err, qt.IsNil)
+		_, err = f.Write([]byte{0x40, 0x01, 0x71})
+		qt.Assert(t, err, qt.IsNil)
+		qt.Assert(t, f.Close(), qt.IsNil)
+
+		store := reopen(t, dir, lnks)
+		// New writes still work, and survive another reopen.
+		more := storeStrings(t, linkSystem(store), "more", 3)
+		qt.Assert(t, store.Close(), qt.IsNil)
+		store = reopen(t, dir, lnks)
+		checkStrings(t, linkSystem(store), "more", more)
+	})
+	t.Run("writes after reopen go to a new pack", func(t *testing.T) {
+		dir, lnks := setup(t)
+		store := reopen(t, dir, lnks)
+		more := storeStrings(t, linkSystem(store), "more", 3)
+		qt.Check(t, packFiles(t, dir), qt.HasLen, 2)
+		qt.Assert(t, store.Close(), qt.IsNil)
+		store = reopen(t, dir, lnks)
+		checkStrings(t, linkSystem(store), "more", more)
+	})
+}
+
+func TestMaxPackSize(t *testing.T) {
+	dir := t.TempDir()
+	store, err := pack.Open(dir)
+	qt.Assert(t, err, qt.IsNil)
+	store.MaxPackSize = 200
+	lsys := linkSystem(store)
+	lnks := storeStrings(t, lsys, "block", 20)
+	qt.Check(t, len(packFiles(t, dir)) > 1, qt.IsTrue)
+	for _, name := range packFiles(t, dir) {
+		fi, err := os.Stat(name)
+		qt.Assert(t, err, qt.IsNil)
+		qt.Check(t, fi.Size() <= 200, qt.IsTrue, qt.Commentf("%s is %d bytes", name, fi.Size()))
+	}
+	checkStrings(t, lsys, "block", lnks)
+	qt.Assert(t, store.Close(), qt.IsNil)
+}
+
+func TestCompact(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	store, err := pack.Open(dir)
+	qt.Assert(t, err, qt.IsNil)
+	store.MaxPackSize = 200
+	lsys := linkSystem(store)
+
+	garbage := storeStrings(t, lsys, "garbage", 10)
+	leaves := storeStrings(t, lsys, "leaf", 10)
+	root, err := qp.BuildList(basicnode.Prototype.Any, int64(len(leaves)), func(la datamodel.ListAssembler) {
+		for _, lnk := range leaves {
+			qp.ListEntry(la, qp.Link(lnk))
+		}
+	})
+	qt.Assert(t, err, qt.IsNil)
+	rootLnk, err := lsys.Store(linking.LinkContext{}, lp, root)
+	qt.Assert(t, err, qt.IsNil)
+
+	res, err := gc.Collect(ctx, lsys, store, []datamodel.Link{rootLnk})
+	qt.Assert(t, err, qt.IsNil)
+	qt.Check(t, res.BlocksFreed, qt.Equals, int64(10))
+	qt.Assert(t, store.Compact(ctx), qt.IsNil)
+
+	// Packs which held garbage are gone, and nothing that was still live was lost.
+	after := packFiles(t, dir)
+	for _, name := range after {
+		data, err := ioutil.ReadFile(name)
+		qt.Assert(t, err, qt.IsNil)
+		qt.Check(t, string(data), qt.Not(qt.Contains), "garbage")
+	}
+	checkStrings(t, lsys, "leaf", leaves)
+	for _, lnk := range garbage {
+		has, err := store.Has(ctx, lnk)
+		qt.Assert(t, err, qt.IsNil)
+		qt.Check(t, has, qt.IsFalse)
+	}
+
+	// A second compaction has nothing to do.
+	qt.Assert(t, store.Compact(ctx), qt.IsNil)
+	qt.Check(t, packFiles(t, dir), qt.DeepEquals, after)
+
+	// And it all survives reopening, including from scratch.
+	qt.Assert(t, store.Close(), qt.IsNil)
+	qt.Assert(t, os.Remove(filepath.Join(dir, "index")), qt.IsNil)
+	store, err = pack.Open(dir)
+	qt.Assert(t, err, qt.IsNil)
+	defer store.Close()
+	lsys = linkSystem(store)
+	checkStrings(t, lsys, "leaf", leaves)
+	for _, lnk := range garbage {
+		has, err := store.Has(ctx, lnk)
+		qt.Assert(t, err, qt.IsNil)
+		qt.Check(t, has, qt.IsFalse)
+	}
+}
@@ -4,7 +4,6 @@ import (
 	"fmt"
 
 	"github.com/ipld/go-ipld-prime/datamodel"
-	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
 )
 
 // Condition provides a mechanism for matching and limiting matching and
@@ -39,11 +38,8 @@ func (c *Condition) Match(n datamodel.Node) bool {
 		if err != nil {
 			return false
 		}
-		cidlnk, ok := lnk.(cidlink.Link)
-		cidmatch, ok2 := match.(cidlink.Link)
-		if ok && ok2 {
-			return cidmatch.Equals(cidlnk.Cid)
-		}
+		// Links of any implementation are compared by their String,
+		// which the datamodel.Link contract says is unique.
 		return match.String() == lnk.String()
 	default:
 		return false
@@ -1,6 +1,7 @@
 package traversal
 
 import (
+	"errors"
 	"fmt"
 
 	"github.com/ipld/go-ipld-prime/datamodel"
@@ -144,7 +145,7 @@ func (prog Progress) walkAdv_iterateAll(n datamodel.Node, s selector.Selector, f
 				progNext.LastBlock.Link = lnk
 				v, err = progNext.loadLink(v, n)
 				if err != nil {
-					if _, ok := err.(SkipMe); ok {
+					if err == (SkipMe{}) {
 						continue
 					}
 					return err
@@ -185,7 +186,7 @@ func (prog Progress) walkAdv_iterateSelective(n datamodel.Node, attn []datamodel
 				progNext.LastBlock.Link = lnk
 				v, err = progNext.loadLink(v, n)
 				if err != nil {
-					if _, ok := err.(SkipMe); ok {
+					if err == (SkipMe{}) {
 						continue
 					}
 					return err
@@ -228,8 +229,8 @@ func (prog Progress) loadLink(v datamodel.Node, parent datamodel.Node) (datamode
 	// Load link!
 	n, err := prog.Cfg.LinkSystem.Load(lnkCtx, lnk, np)
 	if err != nil {
-		if _, ok := err.(SkipMe); ok {
-			return nil, err
+		if errors.Is(err, SkipMe{}) {
+			return nil, SkipMe{}
 		}
 		return nil, fmt.Errorf("error traversing node at %q: could not load link %q: %w", prog.Path, lnk, err)
 	}